@@ -0,0 +1,215 @@
+package up
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"up/checker"
+	"up/httpapi"
+)
+
+// maxAgentBuffer caps how many results an agent holds while the server is
+// unreachable; the oldest are dropped first.
+const maxAgentBuffer = 10000
+
+var (
+	agentTargetsMu sync.Mutex
+	agentTargets   = map[string]bool{}
+)
+
+// agentTargetNames returns, sorted, the targets agents have reported that
+// are not in exclude.
+func agentTargetNames(exclude []string) []string {
+	agentTargetsMu.Lock()
+	defer agentTargetsMu.Unlock()
+
+	var names []string
+	for name := range agentTargets {
+		if !slices.Contains(exclude, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ingestHandler accepts a JSON array of check results from an agent.
+func (s *server) ingestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !httpapi.BearerTokenMatches(r, s.cfg.AgentToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var results []checker.Result
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&results); err != nil {
+		http.Error(w, "Invalid results", http.StatusBadRequest)
+		return
+	}
+	for _, res := range results {
+		if res.Target == "" || (!checker.Answered(res.Status) && res.Status != "down" && res.Status != "captive") || res.Timestamp.IsZero() {
+			http.Error(w, "Invalid results", http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, res := range results {
+		if res.Probe == "" {
+			res.Probe = "agent"
+		}
+		agentTargetsMu.Lock()
+		agentTargets[res.Target] = true
+		agentTargetsMu.Unlock()
+		threshold, _ := latencyThreshold(&s.cfg, res.Target)
+		markDegraded(&res, threshold)
+		processResult(&s.cfg, res)
+	}
+	slog.Debug("Ingested agent results", "count", len(results), "remote", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"accepted": len(results)})
+}
+
+// runAgentCommand implements `up agent`: it checks targets like serve, but
+// instead of storing results it posts them to a central server's /ingest.
+func runAgentCommand(args []string) int {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	serverURL := fs.String("server", "", "Base URL of the central up server, e.g. https://up.example.com")
+	token := fs.String("token", "", "Shared token matching the server's -agent-token")
+	hostname, _ := os.Hostname()
+	fs.StringVar(&cfg.ProbeName, "probe", hostname, "Name of this vantage point, recorded with every check")
+	interval := fs.Duration("interval", 30*time.Second, "Interval between checks")
+	splay := fs.Duration("splay", 0, "Spread each target's checks by a random delay of up to this long")
+	concurrency := fs.Int("check-concurrency", 16, "Most checks to run at once; a target is never checked again while its last check is still running")
+	fs.StringVar(&cfg.ProxyURL, "proxy", "", "Proxy URL for checks and reporting (default: HTTP_PROXY/HTTPS_PROXY from the environment)")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if *serverURL == "" || *token == "" {
+		fmt.Fprintln(os.Stderr, "agent needs -server and -token")
+		return 2
+	}
+	if *interval < scheduleTick || *splay < 0 {
+		fmt.Fprintln(os.Stderr, "-interval must be at least 1s and -splay must not be negative")
+		return 2
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-check-concurrency must be at least 1")
+		return 2
+	}
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-serviceStop
+		stop()
+	}()
+
+	endpoint := strings.TrimSuffix(*serverURL, "/") + "/ingest"
+	client := checker.OutboundClient(cfg.ProxyURL)
+	client.Timeout = 30 * time.Second
+
+	slog.Info("Starting agent", "server", *serverURL, "probe", cfg.ProbeName, "targets", len(targets))
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+	schedule := newCheckSchedule(*interval, *splay)
+	pool := newCheckPool(*concurrency)
+
+	// Checks run in the pool and leave their results in checked, which is
+	// reported on the next tick.
+	var checked struct {
+		sync.Mutex
+		results []checker.Result
+	}
+	check := func(t *targetConfig, sleep func(time.Duration)) {
+		window := activeMaintenance(t, time.Now())
+		if window != nil && window.Skip {
+			return
+		}
+		r := checkTarget(&cfg, t, sleep)
+		r.Maintenance = window != nil
+		slog.Info("Check completed", "target", r.Target, "status", r.Status, "latency_ms", r.LatencyMs, "maintenance", r.Maintenance)
+		checked.Lock()
+		checked.results = append(checked.results, r)
+		checked.Unlock()
+	}
+
+	var pending []checker.Result
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Agent shutting down")
+			return 0
+		case <-ticker.C:
+		}
+
+		// Push targets are pinged on the central server, not the agent.
+		ts := slices.DeleteFunc(slices.Clone(targets), func(t targetConfig) bool { return t.Type == "push" })
+		pool.startDue(schedule, ts, time.Now(), check)
+
+		// Results that failed to send are retried along with new ones.
+		checked.Lock()
+		fresh := checked.results
+		checked.results = nil
+		checked.Unlock()
+		if len(fresh) == 0 {
+			continue
+		}
+		pending = append(pending, fresh...)
+		if len(pending) > maxAgentBuffer {
+			pending = pending[len(pending)-maxAgentBuffer:]
+		}
+
+		if err := postResults(client, endpoint, *token, pending); err != nil {
+			slog.Error("Failed to report results", "pending", len(pending), "error", err)
+			continue
+		}
+		pending = nil
+	}
+}
+
+func postResults(client *http.Client, endpoint, token string, results []checker.Result) error {
+	body, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
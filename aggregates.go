@@ -0,0 +1,208 @@
+package up
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// recentSample is what the summaries need of a check outside maintenance.
+type recentSample struct {
+	at    time.Time
+	probe string
+	// up is whether the target answered; degraded whether it was slow to.
+	up       bool
+	degraded bool
+	latency  int64
+}
+
+// recentChecks keeps each target's checks from the recent window in
+// memory, updated as results come in, so /summary and /uptime can answer
+// without aggregating the checks table on every request. It is unused
+// until loaded, as in read-only mode, where another instance may be
+// writing the database.
+var recentChecks struct {
+	sync.Mutex
+	loaded   bool
+	window   time.Duration
+	byTarget map[string][]recentSample
+}
+
+// loadRecentChecks fills the in-memory window from the database.
+func loadRecentChecks(window time.Duration) error {
+	rows, err := db.Query(`SELECT target, probe, timestamp, status, latency_ms FROM checks
+		WHERE timestamp > ? AND maintenance = 0 ORDER BY timestamp`, time.Now().Add(-window))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byTarget := map[string][]recentSample{}
+	for rows.Next() {
+		var target, status string
+		var s recentSample
+		if err := rows.Scan(&target, &s.probe, &s.at, &status, &s.latency); err != nil {
+			return err
+		}
+		s.up, s.degraded = checker.Answered(status), status == "degraded"
+		byTarget[target] = append(byTarget[target], s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	recentChecks.Lock()
+	defer recentChecks.Unlock()
+	recentChecks.loaded, recentChecks.window, recentChecks.byTarget = true, window, byTarget
+	noteChecksChanged()
+	return nil
+}
+
+// noteRecentCheck adds a result to the in-memory window and drops the
+// target's checks that have left it, invalidating cached responses, which
+// may have been answered from the window (with -no-db, only from it).
+func noteRecentCheck(r checker.Result) {
+	if r.Maintenance {
+		return
+	}
+	recentChecks.Lock()
+	defer recentChecks.Unlock()
+	if !recentChecks.loaded {
+		return
+	}
+	cutoff := time.Now().Add(-recentChecks.window)
+	samples := slices.DeleteFunc(recentChecks.byTarget[r.Target], func(s recentSample) bool { return !s.at.After(cutoff) })
+	if r.Timestamp.After(cutoff) {
+		samples = append(samples, recentSample{at: r.Timestamp, probe: r.Probe, up: checker.Answered(r.Status), degraded: r.Status == "degraded", latency: r.LatencyMs})
+	}
+	recentChecks.byTarget[r.Target] = samples
+	noteChecksChanged()
+}
+
+// forgetRecentChecks drops the in-memory checks from before cutoff of the
+// targets matching match, after pruning or -max-db-size has deleted them
+// from the database, so the summaries keep matching it.
+func forgetRecentChecks(cutoff time.Time, match func(target string) bool) {
+	recentChecks.Lock()
+	defer recentChecks.Unlock()
+	if !recentChecks.loaded {
+		return
+	}
+	for target, samples := range recentChecks.byTarget {
+		if match(target) {
+			recentChecks.byTarget[target] = slices.DeleteFunc(samples, func(s recentSample) bool { return s.at.Before(cutoff) })
+		}
+	}
+	noteChecksChanged()
+}
+
+// recentSamples returns a copy of the target's checks from probe (or all
+// probes) over the last window, oldest first, and whether the in-memory
+// window covers it. A zero window returns all the checks held.
+func recentSamples(target, probe string, window time.Duration) ([]recentSample, bool) {
+	recentChecks.Lock()
+	defer recentChecks.Unlock()
+	if !recentChecks.loaded || window > recentChecks.window {
+		return nil, false
+	}
+	cutoff := time.Now().Add(-cmp.Or(window, recentChecks.window))
+	var samples []recentSample
+	for _, s := range recentChecks.byTarget[target] {
+		if s.at.After(cutoff) && (probe == "" || s.probe == probe) {
+			samples = append(samples, s)
+		}
+	}
+	return samples, true
+}
+
+// recentSummary summarizes the target's checks over the last window like
+// querySummaries, from memory. It reports false if the window isn't held in
+// memory.
+func recentSummary(cfg *Config, name, probe string, window time.Duration) (summaryResult, bool) {
+	samples, ok := recentSamples(name, probe, window)
+	if !ok {
+		return summaryResult{}, false
+	}
+	summary := summaryResult{Target: name, Probe: probe, TotalChecks: len(samples), Flapping: isFlapping(name, probe)}
+	if len(samples) == 0 {
+		return summary, true
+	}
+	var up, degraded int
+	var latencySum int64
+	var apdex float64
+	var latencies []int64
+	for _, s := range samples {
+		latencySum += s.latency
+		if !s.up {
+			continue
+		}
+		up++
+		if s.degraded {
+			degraded++
+		}
+		latencies = append(latencies, s.latency)
+		switch {
+		case s.latency <= cfg.ApdexThreshold:
+			apdex++
+		case s.latency <= cfg.apdexFrustrated():
+			apdex += 0.5
+		}
+	}
+	n := float64(len(samples))
+	summary.UptimePct = roundTo(100*float64(up)/n, 2)
+	summary.DegradedPct = roundTo(100*float64(degraded)/n, 2)
+	summary.AvgLatency = roundTo(float64(latencySum)/n, 2)
+	summary.Apdex = roundTo(apdex/n, 3)
+	slices.Sort(latencies)
+	summary.P50 = percentile(latencies, 50)
+	summary.P90 = percentile(latencies, 90)
+	summary.P95 = percentile(latencies, 95)
+	summary.P99 = percentile(latencies, 99)
+	return summary, true
+}
+
+// recentSummaries is recentSummary for each of names, or false if the
+// window isn't held in memory.
+func recentSummaries(cfg *Config, names []string, probe string, window time.Duration) ([]summaryResult, bool) {
+	var summaries []summaryResult
+	for _, name := range names {
+		summary, ok := recentSummary(cfg, name, probe, window)
+		if !ok {
+			return nil, false
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, true
+}
+
+// recentUptime counts the target's checks over the last window and the
+// percentages that were answered and degraded, like uptimeHandler's query,
+// from memory. It reports false if the window isn't held in memory.
+func recentUptime(name, probe string, window time.Duration) (total int, pct, degradedPct float64, ok bool) {
+	samples, ok := recentSamples(name, probe, window)
+	if !ok || len(samples) == 0 {
+		return 0, 0, 0, ok
+	}
+	var up, degraded int
+	for _, s := range samples {
+		if s.up {
+			up++
+		}
+		if s.degraded {
+			degraded++
+		}
+	}
+	n := float64(len(samples))
+	return len(samples), roundTo(100*float64(up)/n, 2), roundTo(100*float64(degraded)/n, 2), true
+}
+
+// roundTo rounds like SQLite's ROUND, so answers from memory match the
+// database's.
+func roundTo(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
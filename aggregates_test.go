@@ -0,0 +1,99 @@
+package up
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"up/checker"
+)
+
+// useTargets sets the monitored targets for the test.
+func useTargets(t *testing.T, ts []targetConfig) {
+	targetsMu.Lock()
+	old := targets
+	targets = ts
+	targetsMu.Unlock()
+	t.Cleanup(func() {
+		targetsMu.Lock()
+		targets = old
+		targetsMu.Unlock()
+	})
+}
+
+func TestRecentSummariesMatchDatabase(t *testing.T) {
+	useTestDB(t)
+	const window = time.Hour
+	cfg := Config{Retention: 2 * time.Hour, ApdexThreshold: 100, WriteInterval: time.Hour, WriteBatchSize: 100}
+	// "short" keeps its checks for less than the window, so pruning
+	// deletes some the window still covers.
+	useTargets(t, []targetConfig{
+		{Target: checker.Target{Name: "a"}},
+		{Target: checker.Target{Name: "short"}, retention: 30 * time.Minute},
+	})
+
+	now := time.Now()
+	result := func(target, probe, status string, ago time.Duration, latency int64) checker.Result {
+		return checker.Result{Timestamp: now.Add(-ago), Target: target, Probe: probe, Status: status, LatencyMs: latency}
+	}
+	// Checks from before the server started are loaded from the database.
+	if err := insertResults([]checker.Result{
+		result("a", "local", "up", 3*time.Hour, 10),
+		result("a", "local", "down", 50*time.Minute, 0),
+		result("short", "local", "up", 45*time.Minute, 40),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	useRecentChecks(t, window)
+	if err := loadRecentChecks(window); err != nil {
+		t.Fatal(err)
+	}
+
+	rollingOff := result("a", "vps", "up", window-200*time.Millisecond, 500)
+	maintenance := result("a", "local", "down", 5*time.Minute, 0)
+	maintenance.Maintenance = true
+	for _, r := range []checker.Result{
+		rollingOff,
+		maintenance,
+		result("a", "local", "up", 20*time.Minute, 80),
+		result("a", "vps", "degraded", 10*time.Minute, 1500),
+		result("a", "local", "up", time.Minute, 250),
+		result("short", "local", "up", 40*time.Minute, 30),
+		result("short", "vps", "down", 2*time.Minute, 0),
+		result("short", "local", "degraded", time.Minute, 900),
+	} {
+		saveResult(&cfg, r)
+	}
+	if _, err := writeQueuedResults(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pruneOnce(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Let the oldest check in the window leave it.
+	time.Sleep(300 * time.Millisecond)
+
+	names := []string{"a", "short", "none"}
+	for _, probe := range []string{"", "local", "vps"} {
+		fromMemory, ok := recentSummaries(&cfg, names, probe, window)
+		if !ok {
+			t.Fatal("the window isn't held in memory")
+		}
+		fromDB, err := querySummaries(db, &cfg, names, probe, false, time.Now().Add(-window))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fromMemory, fromDB) {
+			t.Errorf("probe %q: from memory\n%+v\nfrom the database\n%+v", probe, fromMemory, fromDB)
+		}
+	}
+
+	// The check that rolled off and the short target's pruned ones are
+	// gone from both.
+	if summary, _ := recentSummary(&cfg, "short", "", window); summary.TotalChecks != 2 {
+		t.Errorf("short has %d checks in the window, want the 2 kept by its retention", summary.TotalChecks)
+	}
+	if summary, _ := recentSummary(&cfg, "a", "vps", window); summary.TotalChecks != 1 {
+		t.Errorf("a has %d checks from vps in the window, want 1", summary.TotalChecks)
+	}
+}
@@ -0,0 +1,265 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"up/httpapi"
+)
+
+// annotation is a note attached to a time range, such as "router firmware
+// upgrade", or to an incident, such as "ISP confirmed area outage". An
+// annotation without a target applies to every target; one without an end
+// marks a moment.
+type annotation struct {
+	ID         int64      `json:"id"`
+	Target     string     `json:"target,omitempty"`
+	IncidentID int64      `json:"incident_id,omitempty"`
+	Start      time.Time  `json:"start"`
+	End        *time.Time `json:"end,omitempty"`
+	Text       string     `json:"text"`
+	Created    time.Time  `json:"created"`
+}
+
+func (a *annotation) in(loc *time.Location) {
+	a.Start = a.Start.In(loc)
+	if a.End != nil {
+		end := a.End.In(loc)
+		a.End = &end
+	}
+	a.Created = a.Created.In(loc)
+}
+
+// covers reports whether the annotation applies to target at t.
+func (a *annotation) covers(target string, t time.Time) bool {
+	if a.Target != "" && a.Target != target {
+		return false
+	}
+	end := a.Start
+	if a.End != nil {
+		end = *a.End
+	}
+	return !t.Before(a.Start) && !t.After(end)
+}
+
+// annotationsHandler serves
+//
+//	GET    /annotations      list annotations, newest first
+//	POST   /annotations      add an annotation (needs -api-token)
+//	DELETE /annotations/{id} remove an annotation (needs -api-token)
+func (s *server) annotationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && (s.cfg.APIToken == "" || !httpapi.BearerTokenMatches(r, s.cfg.APIToken)) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.listAnnotations(w, r)
+	case http.MethodPost:
+		s.addAnnotation(w, r)
+	case http.MethodDelete:
+		path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+		id, err := strconv.ParseInt(strings.TrimPrefix(path, "/annotations/"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid annotation ID", http.StatusBadRequest)
+			return
+		}
+		s.deleteAnnotation(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) listAnnotations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var from, to time.Time
+	if v := q.Get("from"); v != "" {
+		if from, err = parseTimeParam(v, loc); err != nil {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parseTimeParam(v, loc); err != nil {
+			http.Error(w, "Invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	annotations, err := queryAnnotations(s.db, q.Get("target"), from, to)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for i := range annotations {
+		annotations[i].in(loc)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(annotations)
+}
+
+const annotationColumns = `id, target, COALESCE(incident_id, 0), start_time, end_time, text, created_at`
+
+// queryAnnotations returns the annotations for target (or every target)
+// that overlap from–to, newest first. Zero times leave the range open.
+func queryAnnotations(db *sql.DB, target string, from, to time.Time) ([]annotation, error) {
+	query := `SELECT ` + annotationColumns + ` FROM annotations WHERE 1 = 1`
+	var args []any
+	if target != "" {
+		query += ` AND (target = '' OR target = ?)`
+		args = append(args, target)
+	}
+	if !from.IsZero() {
+		query += ` AND COALESCE(end_time, start_time) >= ?`
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += ` AND start_time <= ?`
+		args = append(args, to)
+	}
+	query += ` ORDER BY start_time DESC`
+
+	return scanAnnotations(db.Query(query, args...))
+}
+
+func scanAnnotations(rows *sql.Rows, err error) ([]annotation, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	annotations := []annotation{}
+	for rows.Next() {
+		var a annotation
+		var end sql.NullTime
+		if err := rows.Scan(&a.ID, &a.Target, &a.IncidentID, &a.Start, &end, &a.Text, &a.Created); err != nil {
+			return nil, err
+		}
+		if end.Valid {
+			a.End = &end.Time
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+func (s *server) addAnnotation(w http.ResponseWriter, r *http.Request) {
+	var a annotation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&a); err != nil {
+		http.Error(w, "Invalid annotation", http.StatusBadRequest)
+		return
+	}
+	if a.Text = strings.TrimSpace(a.Text); a.Text == "" {
+		http.Error(w, "Missing text", http.StatusBadRequest)
+		return
+	}
+
+	// An annotation on an incident covers the incident unless given its
+	// own range.
+	if a.IncidentID != 0 {
+		var target string
+		var start time.Time
+		var end sql.NullTime
+		err := s.db.QueryRow(`SELECT target, start_time, end_time FROM incidents WHERE id = ?`, a.IncidentID).Scan(&target, &start, &end)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Incident not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if a.Target == "" {
+			a.Target = target
+		}
+		if a.Start.IsZero() {
+			a.Start = start
+			if a.End == nil && end.Valid {
+				a.End = &end.Time
+			}
+		}
+	}
+	a.Created = time.Now()
+	if a.Start.IsZero() {
+		a.Start = a.Created
+	}
+	if a.End != nil && a.End.Before(a.Start) {
+		http.Error(w, "end is before start", http.StatusBadRequest)
+		return
+	}
+
+	var end, incidentID any
+	if a.End != nil {
+		end = *a.End
+	}
+	if a.IncidentID != 0 {
+		incidentID = a.IncidentID
+	}
+	res, err := s.db.Exec(`INSERT INTO annotations (target, incident_id, start_time, end_time, text, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		a.Target, incidentID, a.Start, end, a.Text, a.Created)
+	if err != nil {
+		slog.Error("Failed to save annotation", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	a.ID, _ = res.LastInsertId()
+	slog.Info("Annotation added", "id", a.ID, "target", a.Target)
+	actor, remote := requestActor(r)
+	recordAudit(actor, remote, "annotation.add", strconv.FormatInt(a.ID, 10), nil, a)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+func (s *server) deleteAnnotation(w http.ResponseWriter, r *http.Request, id int64) {
+	old, err := scanAnnotations(s.db.Query(`SELECT `+annotationColumns+` FROM annotations WHERE id = ?`, id))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	res, err := s.db.Exec(`DELETE FROM annotations WHERE id = ?`, id)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 || len(old) == 0 {
+		http.Error(w, "Annotation not found", http.StatusNotFound)
+		return
+	}
+	actor, remote := requestActor(r)
+	recordAudit(actor, remote, "annotation.delete", strconv.FormatInt(id, 10), old[0], nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// annotateIncidents attaches to each incident the annotations made on it,
+// and those for its target that overlap it.
+func annotateIncidents(db *sql.DB, incidents []incident) error {
+	for i := range incidents {
+		inc := &incidents[i]
+		end := time.Now()
+		if inc.End != nil {
+			end = *inc.End
+		}
+		annotations, err := scanAnnotations(db.Query(`SELECT `+annotationColumns+` FROM annotations
+			WHERE incident_id = ? OR (incident_id IS NULL AND (target = '' OR target = ?)
+				AND start_time <= ? AND COALESCE(end_time, start_time) >= ?)
+			ORDER BY start_time`, inc.ID, inc.Target, end, inc.Start))
+		if err != nil {
+			return err
+		}
+		if len(annotations) > 0 {
+			inc.Annotations = annotations
+		}
+	}
+	return nil
+}
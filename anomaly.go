@@ -0,0 +1,239 @@
+package up
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"up/checker"
+)
+
+const (
+	anomalyInterval = time.Minute
+	// At least this many successful checks are needed in the window and
+	// the baseline before a target is judged.
+	anomalyMinRecent   = 5
+	anomalyMinBaseline = 30
+)
+
+// degradation is a stretch of unusually high latency on a target that
+// stayed up.
+type degradation struct {
+	ID      int64      `json:"id"`
+	Target  string     `json:"target"`
+	Probe   string     `json:"probe"`
+	Start   time.Time  `json:"start"`
+	End     *time.Time `json:"end"`
+	Ongoing bool       `json:"ongoing"`
+	// BaselineMs is the median latency over the baseline when the
+	// degradation began; PeakMs is the highest median latency over the
+	// window while it lasted, and Score its robust z-score.
+	BaselineMs float64 `json:"baseline_ms"`
+	PeakMs     float64 `json:"peak_ms"`
+	Score      float64 `json:"score"`
+}
+
+type latencySample struct {
+	at      time.Time
+	latency float64
+}
+
+// monitorAnomalies compares each target's median latency over the last
+// -anomaly-window with the -anomaly-baseline before it every minute until
+// ctx is done, and records a degradation while the robust z-score (the
+// difference in median absolute deviations) is at least -anomaly-threshold.
+func monitorAnomalies(ctx context.Context, cfg *Config) {
+	slog.Info("Detecting latency anomalies", "threshold", cfg.AnomalyThreshold, "window", cfg.AnomalyWindow, "baseline", cfg.AnomalyBaseline)
+
+	open := map[probeTarget]*degradation{}
+	rows, err := db.Query(`SELECT id, target, probe, start_time, baseline_ms, peak_ms, score FROM degradations WHERE end_time IS NULL`)
+	if err != nil {
+		slog.Error("Failed to load open degradations", "error", err)
+		return
+	}
+	for rows.Next() {
+		d := &degradation{Ongoing: true}
+		if err := rows.Scan(&d.ID, &d.Target, &d.Probe, &d.Start, &d.BaselineMs, &d.PeakMs, &d.Score); err != nil {
+			slog.Error("Failed to load open degradations", "error", err)
+			rows.Close()
+			return
+		}
+		open[probeTarget{d.Target, d.Probe}] = d
+	}
+	rows.Close()
+
+	ticker := time.NewTicker(anomalyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := detectAnomalies(cfg, open, now); err != nil {
+				slog.Error("Latency anomaly detection failed", "error", err)
+			}
+		}
+	}
+}
+
+func detectAnomalies(cfg *Config, open map[probeTarget]*degradation, now time.Time) error {
+	split := now.Add(-cfg.AnomalyWindow)
+	rows, err := db.Query(`SELECT target, probe, timestamp, latency_ms FROM checks
+		WHERE timestamp > ? AND `+checker.AnsweredSQL+` AND maintenance = 0
+		ORDER BY timestamp`, split.Add(-cfg.AnomalyBaseline))
+	if err != nil {
+		return err
+	}
+	baseline := map[probeTarget][]float64{}
+	recent := map[probeTarget][]latencySample{}
+	for rows.Next() {
+		var key probeTarget
+		var s latencySample
+		if err := rows.Scan(&key.target, &key.probe, &s.at, &s.latency); err != nil {
+			rows.Close()
+			return err
+		}
+		if s.at.After(split) {
+			recent[key] = append(recent[key], s)
+		} else {
+			baseline[key] = append(baseline[key], s.latency)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for key, d := range open {
+		if _, ok := recent[key]; !ok {
+			closeDegradation(key, d, now)
+			delete(open, key)
+		}
+	}
+	for key, samples := range recent {
+		base := baseline[key]
+		if len(samples) < anomalyMinRecent || len(base) < anomalyMinBaseline {
+			continue
+		}
+		latencies := make([]float64, len(samples))
+		for i, s := range samples {
+			latencies[i] = s.latency
+		}
+		current := median(latencies)
+		baseMedian := median(base)
+		deviations := make([]float64, len(base))
+		for i, l := range base {
+			deviations[i] = math.Abs(l - baseMedian)
+		}
+		// Scale the MAD to match a standard deviation, with a floor so
+		// that a near-constant baseline (a LAN target at 1 ms) doesn't
+		// turn a millisecond of jitter into an anomaly.
+		score := (current - baseMedian) / (1.4826 * max(median(deviations), 1))
+
+		d := open[key]
+		switch {
+		case d == nil && score >= cfg.AnomalyThreshold:
+			d = &degradation{
+				Target: key.target, Probe: key.probe, Start: samples[0].at, Ongoing: true,
+				BaselineMs: baseMedian, PeakMs: current, Score: score,
+			}
+			res, err := db.Exec(`INSERT INTO degradations (target, probe, start_time, baseline_ms, peak_ms, score) VALUES (?, ?, ?, ?, ?, ?)`,
+				d.Target, d.Probe, d.Start, d.BaselineMs, d.PeakMs, d.Score)
+			if err != nil {
+				return err
+			}
+			d.ID, _ = res.LastInsertId()
+			open[key] = d
+			slog.Warn("Latency degradation started", "target", key.target, "probe", key.probe, "baseline_ms", baseMedian, "latency_ms", current, "score", score)
+		case d != nil && score >= cfg.AnomalyThreshold:
+			if current > d.PeakMs {
+				d.PeakMs, d.Score = current, score
+				if _, err := db.Exec(`UPDATE degradations SET peak_ms = ?, score = ? WHERE id = ?`, d.PeakMs, d.Score, d.ID); err != nil {
+					return err
+				}
+			}
+		case d != nil:
+			closeDegradation(key, d, now)
+			delete(open, key)
+		}
+	}
+	return nil
+}
+
+func closeDegradation(key probeTarget, d *degradation, now time.Time) {
+	if _, err := db.Exec(`UPDATE degradations SET end_time = ? WHERE id = ?`, now, d.ID); err != nil {
+		slog.Error("Failed to close degradation", "error", err)
+		return
+	}
+	slog.Info("Latency degradation ended", "target", key.target, "probe", key.probe, "duration", now.Sub(d.Start).Round(time.Second))
+}
+
+// median returns the median of values, reordering them.
+func median(values []float64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// degradationsHandler lists degradation events, newest first, optionally
+// for one ?target=.
+func (s *server) degradationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	degradations, err := queryDegradations(s.db, r.URL.Query().Get("target"), limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for i := range degradations {
+		d := &degradations[i]
+		d.Start = d.Start.In(loc)
+		if d.End != nil {
+			*d.End = d.End.In(loc)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(degradations)
+}
+
+func queryDegradations(db *sql.DB, target string, limit int) ([]degradation, error) {
+	rows, err := db.Query(`SELECT id, target, probe, start_time, end_time, baseline_ms, peak_ms, score FROM degradations
+		WHERE ? = '' OR target = ?
+		ORDER BY start_time DESC LIMIT ?`, target, target, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	degradations := []degradation{}
+	for rows.Next() {
+		var d degradation
+		var end sql.NullTime
+		if err := rows.Scan(&d.ID, &d.Target, &d.Probe, &d.Start, &end, &d.BaselineMs, &d.PeakMs, &d.Score); err != nil {
+			return nil, err
+		}
+		if end.Valid {
+			d.End = &end.Time
+		} else {
+			d.Ongoing = true
+		}
+		degradations = append(degradations, d)
+	}
+	return degradations, rows.Err()
+}
@@ -0,0 +1,104 @@
+package up
+
+import (
+	"up/checker"
+	"up/httpapi"
+)
+
+// apiPrefix is where the versioned JSON API is served. The same endpoints
+// stay at their original paths for existing clients.
+const apiPrefix = "/api/v1"
+
+var (
+	windowParam = httpapi.Param{Name: "window", Description: "Period to cover, as a Go duration such as 24h"}
+	probeParam  = httpapi.Param{Name: "probe", Description: "Only include checks from this probe"}
+	targetParam = httpapi.Param{Name: "target", Description: "Only include this target"}
+	groupParam  = httpapi.Param{Name: "group", Description: "Only include targets with this tag"}
+	formatParam = httpapi.Param{Name: "format", Description: "json (default), ndjson, or csv; the Accept header is used when absent"}
+)
+
+func (s *server) apiRoutes(reload func() error) []httpapi.Route {
+	routes := []httpapi.Route{
+		{Method: "GET", Path: "/status", V1: "/status", Summary: "Recent check results, newest first",
+			Params: []httpapi.Param{probeParam, tzParam, formatParam}, Response: []checker.Result{}, Handler: s.statusHandler},
+		{Method: "GET", Path: "/summary", V1: "/summary", Summary: "Uptime and latency percentiles per target over the recent window",
+			Params: []httpapi.Param{probeParam, groupParam, {Name: "by", Description: "Set to probe for one summary per target and probe"}, formatParam}, Response: []summaryResult{}, Handler: withResponseCache(s.summaryHandler)},
+		{Method: "GET", Path: "/uptime", V1: "/uptime", Summary: "Uptime per target over the recent window",
+			Params: []httpapi.Param{probeParam, groupParam}, Response: []uptimeSummary{}, Handler: withResponseCache(s.uptimeHandler)},
+		{Method: "GET", Path: "/groups", V1: "/groups", Summary: "Aggregate uptime per target group over the recent window",
+			Params: []httpapi.Param{probeParam}, Response: []groupSummary{}, Handler: withResponseCache(s.groupsHandler)},
+		{Method: "GET", Path: "/histogram", V1: "/histogram", Summary: "Latency histogram per target",
+			Params: []httpapi.Param{targetParam, probeParam, windowParam, {Name: "buckets", Description: "Comma-separated bucket upper bounds in milliseconds"}}, Response: []latencyHistogram{}, Handler: withResponseCache(s.histogramHandler)},
+		{Method: "GET", Path: "/size", V1: "/size", Summary: "Database size, space used, and -max-db-size quota",
+			Response: map[string]int64{}, Handler: s.tableSizeHandler},
+		{Method: "GET", Path: "/speedtest", V1: "/speedtest", Summary: "Recent speed test results, newest first",
+			Params: []httpapi.Param{{Name: "provider", Description: "Only include this provider"}, tzParam, formatParam}, Response: []speedTestResult{}, Handler: s.speedTestHandler},
+		{Method: "GET", Path: "/speedtest/compare", V1: "/speedtest/compare", Summary: "Recent speed test averages per provider",
+			Response: []providerComparison{}, Handler: s.speedTestCompareHandler},
+		{Method: "GET", Path: "/speedtest/usage", V1: "/speedtest/usage", Summary: "Data used by speed tests each month",
+			Response: []speedTestUsage{}, Handler: s.speedTestUsageHandler},
+		{Method: "GET", Path: "/incidents", V1: "/incidents", Summary: "Incidents, newest first",
+			Params: []httpapi.Param{targetParam, probeParam, {Name: "limit", Description: "Maximum number of incidents (default 100)"}, tzParam}, Response: []incident{}, Handler: s.incidentsHandler},
+		{Method: "GET", Path: "/degradations", V1: "/degradations", Summary: "Latency degradations, newest first",
+			Params: []httpapi.Param{targetParam, {Name: "limit", Description: "Maximum number of degradations (default 100)"}, tzParam}, Response: []degradation{}, Handler: s.degradationsHandler},
+		{Method: "GET", Path: "/certs", V1: "/certs", Summary: "Certificate currently presented by each HTTPS target",
+			Params: []httpapi.Param{targetParam, tzParam}, Response: []checker.Certificate{}, Handler: s.certsHandler},
+		{Method: "GET", Path: "/certs/history", V1: "/certs/history", Summary: "Certificates a target has presented, newest first",
+			Params: []httpapi.Param{targetParam, {Name: "limit", Description: "Maximum number of certificates (default 100)"}, tzParam}, Response: []checker.Certificate{}, Handler: s.certHistoryHandler},
+		{Method: "GET", Path: "/security-headers", V1: "/security-headers", Summary: "Latest security headers of each target with audit_headers",
+			Params: []httpapi.Param{targetParam, tzParam}, Response: []securityHeaders{}, Handler: s.securityHeadersHandler},
+		{Method: "GET", Path: "/security-headers/history", V1: "/security-headers/history", Summary: "Changes to a target's security headers, newest first",
+			Params: []httpapi.Param{targetParam, {Name: "limit", Description: "Maximum number of snapshots (default 100)"}, tzParam}, Response: []securityHeaders{}, Handler: s.securityHeadersHistoryHandler},
+		{Method: "GET", Path: "/changes", V1: "/changes", Summary: "Response content changes, newest first",
+			Params: []httpapi.Param{targetParam, {Name: "limit", Description: "Maximum number of changes (default 100)"}, tzParam}, Response: []contentChange{}, Handler: s.changesHandler},
+		{Method: "GET", Path: "/annotations", V1: "/annotations", Summary: "Annotations, newest first",
+			Params: []httpapi.Param{{Name: "target", Description: "Only include annotations for this target or every target"}, {Name: "from", Description: "Start, RFC 3339 or YYYY-MM-DD"}, {Name: "to", Description: "End, RFC 3339 or YYYY-MM-DD"}, tzParam}, Response: []annotation{}, Handler: s.annotationsHandler},
+		{Method: "GET", Path: "/path", V1: "/path", Summary: "Latest path measurement per target, or hop statistics over a window",
+			Params: []httpapi.Param{targetParam, windowParam}, Response: []pathReport{}, Handler: s.pathHandler},
+		{Method: "GET", Path: "/snmp", V1: "/snmp", Summary: "SNMP samples",
+			Params: []httpapi.Param{windowParam, {Name: "device", Description: "Only include this device"}, {Name: "metric", Description: "Only include this metric"}}, Response: []snmpSeries{}, Handler: s.snmpHandler},
+		{Method: "GET", Path: "/resolvers", V1: "/resolvers", Summary: "Lookup latency and failures per DNS resolver",
+			Params: []httpapi.Param{windowParam, {Name: "name", Description: "Only include lookups of this name"}}, Response: []resolverStats{}, Handler: s.resolversHandler},
+		{Method: "GET", Path: "/domains", V1: "/domains", Summary: "Registration expiry of each of -domains, soonest first",
+			Params: []httpapi.Param{tzParam}, Response: []domainExpiry{}, Handler: s.domainsHandler},
+		{Method: "GET", Path: "/ntp", V1: "/ntp", Summary: "Local clock offset and drift per NTP server",
+			Params: []httpapi.Param{windowParam}, Response: []ntpStats{}, Handler: s.ntpHandler},
+		{Method: "GET", Path: "/discovered", V1: "/discovered", Summary: "Devices found on the local network with -discover",
+			Response: []discoveredTarget{}, Handler: s.discoveredHandler},
+		{Method: "GET", Path: "/probes", V1: "/probes", Summary: "Probes that reported recently",
+			Response: []probeInfo{}, Handler: s.probesHandler},
+		{Method: "GET", Path: "/report", V1: "/report", Summary: "Uptime report per period",
+			Params: []httpapi.Param{targetParam, {Name: "period", Description: "daily, weekly, or monthly"}, {Name: "from", Description: "Start date, YYYY-MM-DD"}, {Name: "to", Description: "End date, YYYY-MM-DD"}, tzParam}, Response: []targetReport{}, Handler: s.reportHandler},
+		{Method: "GET", Path: "/report/plan", V1: "/report/plan", Summary: "Speed tests as a percentage of the internet plan, per period and hour of day",
+			Params: []httpapi.Param{{Name: "period", Description: "daily, weekly, or monthly"}, {Name: "from", Description: "Start date, YYYY-MM-DD"}, {Name: "to", Description: "End date, YYYY-MM-DD"}, tzParam}, Response: planReport{}, Handler: s.planReportHandler},
+		{Method: "GET", Path: "/calendar", V1: "/calendar", Summary: "Uptime and worst incident per day",
+			Params: []httpapi.Param{{Name: "target", Description: "Target name"}, {Name: "days", Description: "Number of days, up to 366 (default 90)"}, tzParam}, Response: []calendarDay{}, Handler: withResponseCache(s.calendarHandler)},
+		{Method: "GET", Path: "/healthz", V1: "/healthz", Summary: "Liveness",
+			Response: map[string]string{}, Handler: s.healthzHandler},
+		{Method: "GET", Path: "/readyz", V1: "/readyz", Summary: "Readiness, with the state of each dependency",
+			Response: map[string]string{}, Handler: s.readyzHandler},
+	}
+	if s.cfg.APIToken != "" {
+		routes = append(routes,
+			httpapi.Route{Method: "GET", Path: "/api/targets", V1: "/targets", Summary: "List targets", Auth: true,
+				Response: []listedTarget{}, Handler: s.targetsAPIHandler},
+			httpapi.Route{Method: "POST", Path: "/api/targets", V1: "/targets", Summary: "Add or replace a target", Auth: true,
+				Request: targetConfig{}, Response: targetConfig{}, Handler: s.targetsAPIHandler},
+			httpapi.Route{Method: "DELETE", Path: "/api/targets/", V1: "/targets/", Doc: "/targets/{name}", Summary: "Remove a target added through the API", Auth: true,
+				Params: []httpapi.Param{{Name: "name", Description: "Target name"}}, Handler: s.targetsAPIHandler},
+			httpapi.Route{Method: "POST", Path: "/check", V1: "/check", Summary: "Check targets now", Auth: true,
+				Params: []httpapi.Param{targetParam}, Response: []checker.Result{}, Handler: s.checkNowHandler},
+			httpapi.Route{Method: "POST", Path: "/speedtest/run", V1: "/speedtest/run", Summary: "Run a speed test now", Auth: true,
+				Params: []httpapi.Param{{Name: "provider", Description: "Only test this provider"}}, Response: speedTestRun{}, Handler: s.speedTestRunHandler},
+			httpapi.Route{Method: "POST", Path: "/annotations", V1: "/annotations", Summary: "Add an annotation", Auth: true,
+				Request: annotation{}, Response: annotation{}, Handler: s.annotationsHandler},
+			httpapi.Route{Method: "DELETE", Path: "/annotations/", V1: "/annotations/", Doc: "/annotations/{id}", Summary: "Remove an annotation", Auth: true,
+				Params: []httpapi.Param{{Name: "id", Description: "Annotation ID"}}, Handler: s.annotationsHandler},
+			httpapi.Route{Method: "POST", Path: "/reload", V1: "/reload", Summary: "Reload the config file", Auth: true,
+				Handler: s.reloadHandler(reload)},
+			httpapi.Route{Method: "GET", Path: "/audit", V1: "/audit", Summary: "Changes made at runtime, newest first", Auth: true,
+				Params: []httpapi.Param{{Name: "subject", Description: "Only include changes to this target name, annotation ID, or config"}, {Name: "limit", Description: "Maximum number of entries (default 100)"}, tzParam}, Response: []auditEntry{}, Handler: s.auditHandler},
+		)
+	}
+	return routes
+}
@@ -0,0 +1,120 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"up/httpapi"
+)
+
+// auditEntry records a change made at runtime: who made it, what it
+// changed, and the before and after, as JSON, where there is one.
+type auditEntry struct {
+	ID        int64           `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Remote    string          `json:"remote,omitempty"`
+	Action    string          `json:"action"`
+	Subject   string          `json:"subject"`
+	Old       json.RawMessage `json:"old,omitempty"`
+	New       json.RawMessage `json:"new,omitempty"`
+}
+
+// requestActor identifies who made an API request: the X-Audit-User header
+// if the client sends one, since everyone shares the API token, and the
+// client's address.
+func requestActor(r *http.Request) (actor, remote string) {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	actor = r.Header.Get("X-Audit-User")
+	if actor == "" {
+		actor = "api"
+	}
+	return actor, remote
+}
+
+// recordAudit adds an entry to the audit log. before and after are stored
+// as JSON unless nil. A failure is logged rather than failing the change,
+// which has already been made.
+func recordAudit(actor, remote, action, subject string, before, after any) {
+	encode := func(v any) string {
+		if v == nil {
+			return ""
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	if _, err := db.Exec(`INSERT INTO audit (timestamp, actor, remote, action, subject, old, new) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		time.Now(), actor, remote, action, subject, encode(before), encode(after)); err != nil {
+		slog.Error("Failed to record audit entry", "action", action, "subject", subject, "error", err)
+	}
+}
+
+// auditHandler serves the audit log, newest first, optionally for one
+// ?subject= (a target name or annotation ID).
+func (s *server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if !httpapi.BearerTokenMatches(r, s.cfg.APIToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	entries, err := queryAudit(s.db, r.URL.Query().Get("subject"), limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for i := range entries {
+		entries[i].Timestamp = entries[i].Timestamp.In(loc)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func queryAudit(db *sql.DB, subject string, limit int) ([]auditEntry, error) {
+	query := `SELECT id, timestamp, actor, remote, action, subject, old, new FROM audit`
+	var args []any
+	if subject != "" {
+		query += ` WHERE subject = ?`
+		args = append(args, subject)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		var before, after string
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Actor, &e.Remote, &e.Action, &e.Subject, &before, &after); err != nil {
+			return nil, err
+		}
+		if before != "" {
+			e.Old = json.RawMessage(before)
+		}
+		if after != "" {
+			e.New = json.RawMessage(after)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
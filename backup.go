@@ -0,0 +1,99 @@
+package up
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"up/httpapi"
+)
+
+// backupTo writes a consistent snapshot of the database to path, which must
+// not exist yet. VACUUM INTO reads inside a transaction, so checks keep
+// being written while it runs.
+func backupTo(path string) error {
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to back up database: %v", err)
+	}
+	return nil
+}
+
+// runBackup writes a timestamped backup to -backup-dir and deletes all but
+// the newest -backup-keep backups.
+func runBackup(cfg *Config) error {
+	if err := os.MkdirAll(cfg.BackupDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	path := filepath.Join(cfg.BackupDir, "up-"+time.Now().UTC().Format("20060102T150405Z")+".db")
+	if err := backupTo(path); err != nil {
+		return err
+	}
+	slog.Info("Database backed up", "path", path)
+
+	backups, err := filepath.Glob(filepath.Join(cfg.BackupDir, "up-*.db"))
+	if err != nil {
+		return err
+	}
+	// The timestamped names sort chronologically.
+	slices.Sort(backups)
+	for len(backups) > cfg.BackupKeep {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("failed to remove old backup: %v", err)
+		}
+		slog.Info("Removed old backup", "path", backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// scheduleBackups runs a backup every -backup-interval.
+func scheduleBackups(cfg *Config) {
+	for {
+		if err := runBackup(cfg); err != nil {
+			slog.Error("Backup failed", "error", err)
+		}
+		time.Sleep(cfg.BackupInterval)
+	}
+}
+
+// backupHandler streams a fresh snapshot of the database.
+func (s *server) backupHandler(w http.ResponseWriter, r *http.Request) {
+	if !httpapi.BearerTokenMatches(r, s.cfg.APIToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "up-backup")
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "up.db")
+	if err := backupTo(path); err != nil {
+		slog.Error("Backup failed", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	name := strings.TrimSuffix(filepath.Base(s.cfg.DBPath), filepath.Ext(s.cfg.DBPath))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.db"`, name, time.Now().UTC().Format("20060102T150405Z")))
+	if info, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	}
+	io.Copy(w, f)
+}
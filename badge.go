@@ -0,0 +1,146 @@
+package up
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+// targetSlug turns a target name into a URL-safe identifier, e.g.
+// "https://github.com" becomes "github-com".
+func targetSlug(name string) string {
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		name = rest
+	}
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// findTarget looks a target up by name or slug.
+func findTarget(id string) *targetConfig {
+	ts := currentTargets()
+	for i := range ts {
+		if ts[i].Name == id || targetSlug(ts[i].Name) == id {
+			return &ts[i]
+		}
+	}
+	return nil
+}
+
+var badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Label}}: {{.Message}}">
+<title>{{.Label}}: {{.Message}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="{{.LabelWidth}}" height="20" fill="#555"/>
+<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/>
+<rect width="{{.Width}}" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{.Label}}</text>
+<text x="{{.LabelX}}" y="14">{{.Label}}</text>
+<text x="{{.MessageX}}" y="15" fill="#010101" fill-opacity=".3">{{.Message}}</text>
+<text x="{{.MessageX}}" y="14">{{.Message}}</text>
+</g>
+</svg>
+`))
+
+type badge struct {
+	Label, Message, Color           string
+	Width, LabelWidth, MessageWidth int
+	LabelX, MessageX                float64
+}
+
+// newBadge lays out a shields.io style badge, approximating Verdana 11px
+// glyphs as 7px wide.
+func newBadge(label, message, color string) badge {
+	b := badge{Label: label, Message: message, Color: color}
+	b.LabelWidth = 7*len(label) + 10
+	b.MessageWidth = 7*len(message) + 10
+	b.Width = b.LabelWidth + b.MessageWidth
+	b.LabelX = float64(b.LabelWidth) / 2
+	b.MessageX = float64(b.LabelWidth) + float64(b.MessageWidth)/2
+	return b
+}
+
+// badgeHandler serves /badge/{target}.svg with the target's current status
+// and uptime over ?window= (default 24h).
+func (s *server) badgeHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/badge/"), ".svg")
+	t := findTarget(id)
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	var status string
+	err := s.db.QueryRow(`SELECT status FROM checks WHERE target = ? ORDER BY timestamp DESC LIMIT 1`, t.Name).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var uptime sql.NullFloat64
+	err = s.db.QueryRow(`
+		SELECT 100.0 * SUM(CASE WHEN `+checker.AnsweredSQL+` THEN 1 ELSE 0 END) / COUNT(*)
+		FROM checks
+		WHERE target = ? AND timestamp > ? AND maintenance = 0`, t.Name, time.Now().Add(-window)).Scan(&uptime)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = targetSlug(t.Name)
+	}
+
+	message, color := "unknown", "#9f9f9f"
+	switch status {
+	case "up":
+		message, color = "up", "#4c1"
+	case "degraded":
+		message, color = "degraded", "#dfb317"
+	case "down":
+		message, color = "down", "#e05d44"
+	case "captive":
+		message, color = "captive portal", "#fe7d37"
+	}
+	if uptime.Valid {
+		message = fmt.Sprintf("%s | %.2f%%", message, uptime.Float64)
+		if checker.Answered(status) && uptime.Float64 < 99 {
+			color = "#dfb317"
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if err := badgeTemplate.Execute(w, newBadge(label, message, color)); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
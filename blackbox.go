@@ -0,0 +1,113 @@
+package up
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+// blackboxModules map blackbox_exporter module names to target types, and
+// the URL scheme to add to targets given without one.
+var blackboxModules = map[string]struct{ typ, scheme string }{
+	"http_2xx":   {"http", "http"},
+	"icmp":       {"icmp", "icmp"},
+	"dns":        {"dns", "dns"},
+	"ssh_banner": {"ssh", "ssh"},
+	"smtp":       {"smtp", "smtp"},
+	"grpc":       {"grpc", "grpc"},
+	"websocket":  {"websocket", "ws"},
+}
+
+// probeHandler runs a one-off check of ?target= with ?module= (default
+// http_2xx) and answers with Prometheus metrics named as blackbox_exporter
+// names them, so Prometheus can scrape up like an exporter. The check is
+// not recorded. Configured targets can be given by name, slug, or URL and
+// are checked with their own settings; other targets need
+// -blackbox-any-target.
+func (s *server) probeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	target := q.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	t := findTarget(target)
+	if t == nil {
+		for _, c := range currentTargets() {
+			if c.URL == target {
+				t = &c
+				break
+			}
+		}
+	}
+	if t == nil {
+		if !s.cfg.BlackboxAnyTarget {
+			http.Error(w, fmt.Sprintf("Unknown target %q", target), http.StatusNotFound)
+			return
+		}
+		module := q.Get("module")
+		if module == "" {
+			module = "http_2xx"
+		}
+		m, ok := blackboxModules[module]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", module), http.StatusBadRequest)
+			return
+		}
+		url := target
+		if !strings.Contains(url, "://") {
+			url = m.scheme + "://" + url
+		}
+		t = &targetConfig{Target: checker.Target{URL: url, Type: m.typ}}
+		if err := t.init(&s.cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	start := time.Now()
+	res := probeOnce(&s.cfg, t)
+	duration := time.Since(start)
+
+	var b strings.Builder
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+	}
+	success := 0.0
+	if checker.Answered(res.Status) {
+		success = 1
+	}
+	gauge("probe_success", "Displays whether or not the probe was a success", success)
+	gauge("probe_duration_seconds", "Returns how long the probe took to complete in seconds", duration.Seconds())
+	if res.DNSMs > 0 {
+		gauge("probe_dns_lookup_time_seconds", "Returns the time taken for probe dns lookup in seconds", float64(res.DNSMs)/1000)
+	}
+	if t.Type == "" || t.Type == "http" || t.Type == "captive" {
+		fmt.Fprintf(&b, "# HELP probe_http_duration_seconds Duration of http request by phase, summed over all redirects\n# TYPE probe_http_duration_seconds gauge\n")
+		for _, p := range []struct {
+			phase string
+			ms    int64
+		}{{"resolve", res.DNSMs}, {"connect", res.ConnectMs}, {"tls", res.TLSMs}, {"processing", res.TTFBMs}} {
+			fmt.Fprintf(&b, "probe_http_duration_seconds{phase=%q} %g\n", p.phase, float64(p.ms)/1000)
+		}
+	}
+	if res.Cert != nil {
+		expiry := res.Cert.NotAfter
+		for _, c := range res.Cert.Chain {
+			if c.NotAfter.Before(expiry) {
+				expiry = c.NotAfter
+			}
+		}
+		gauge("probe_ssl_earliest_cert_expiry", "Returns last SSL chain expiry in unixtime", float64(expiry.Unix()))
+	}
+	if res.Failure != "" {
+		fmt.Fprintf(&b, "# HELP probe_failure_info How the probe failed, for checks that tell failures apart\n# TYPE probe_failure_info gauge\n")
+		fmt.Fprintf(&b, "probe_failure_info{failure=%q} 1\n", res.Failure)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, b.String())
+}
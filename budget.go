@@ -0,0 +1,113 @@
+package up
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteSize is a flag holding a number of bytes, written with an optional
+// decimal unit such as 500MB or 20GB.
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	n      int64
+}{{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1}}
+
+func (b *byteSize) String() string {
+	if *b == 0 {
+		return "0"
+	}
+	for _, u := range byteUnits {
+		if int64(*b)%u.n == 0 {
+			return strconv.FormatInt(int64(*b)/u.n, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.n
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(f * float64(mult))
+	return nil
+}
+
+// usageMonth returns the month t falls in, in t's location.
+func usageMonth(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// speedTestBudgetLeft reports whether this month's usage is still under
+// -speedtest-budget. When it isn't, the skip is recorded.
+func speedTestBudgetLeft(cfg *Config, provider string) (bool, error) {
+	if cfg.SpeedTestBudget == 0 {
+		return true, nil
+	}
+	month := usageMonth(time.Now().In(cfg.Timezone))
+	var used int64
+	if err := db.QueryRow(`SELECT COALESCE(SUM(bytes), 0) FROM speedtest_usage WHERE month = ?`, month).Scan(&used); err != nil {
+		return false, err
+	}
+	if used < int64(cfg.SpeedTestBudget) {
+		return true, nil
+	}
+	_, err := db.Exec(`INSERT INTO speedtest_usage (month, skipped) VALUES (?, 1)
+		ON CONFLICT(month) DO UPDATE SET skipped = skipped + 1`, month)
+	slog.Warn("Skipping speed test, monthly data budget used", "provider", provider, "used_bytes", used, "budget", cfg.SpeedTestBudget.String())
+	return false, err
+}
+
+// recordSpeedTestUsage adds the bytes a speed test transferred to the
+// total for the month t falls in, in t's location.
+func recordSpeedTestUsage(t time.Time, bytes int64) error {
+	_, err := db.Exec(`INSERT INTO speedtest_usage (month, bytes) VALUES (?, ?)
+		ON CONFLICT(month) DO UPDATE SET bytes = bytes + excluded.bytes`, usageMonth(t), bytes)
+	return err
+}
+
+type speedTestUsage struct {
+	Month       string `json:"month"`
+	Bytes       int64  `json:"bytes"`
+	Skipped     int    `json:"skipped"`
+	BudgetBytes int64  `json:"budget_bytes,omitempty"`
+}
+
+// speedTestUsageHandler lists the data used by speed tests each month, and
+// how many tests were skipped for being over budget.
+func (s *server) speedTestUsageHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`SELECT month, bytes, skipped FROM speedtest_usage ORDER BY month DESC`)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	usage := []speedTestUsage{}
+	for rows.Next() {
+		u := speedTestUsage{BudgetBytes: int64(s.cfg.SpeedTestBudget)}
+		if err := rows.Scan(&u.Month, &u.Bytes, &u.Skipped); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		usage = append(usage, u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
@@ -0,0 +1,147 @@
+package up
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// responseCacheTTL bounds how long a cached response is served even when no
+// checks were recorded, since the window it covers keeps moving.
+const responseCacheTTL = 10 * time.Second
+
+var (
+	// checksVersion changes whenever the checks change, in the database or
+	// in recentChecks; checksModified is when that last happened.
+	checksVersion  atomic.Uint64
+	checksModified atomic.Int64
+
+	responseCache = struct {
+		sync.Mutex
+		entries map[string]*cachedResponse
+	}{entries: map[string]*cachedResponse{}}
+)
+
+// noteChecksChanged invalidates cached responses after a check is written
+// to the database or recentChecks changes.
+func noteChecksChanged() {
+	checksVersion.Add(1)
+	checksModified.Store(time.Now().UnixNano())
+}
+
+type cachedResponse struct {
+	header   http.Header
+	body     []byte
+	etag     string
+	modified time.Time
+	version  uint64
+	created  time.Time
+}
+
+// withResponseCache serves repeated GETs of an aggregate endpoint from
+// memory until the checks change or responseCacheTTL passes, and answers
+// conditional requests with 304 Not Modified when the response is the same.
+func withResponseCache(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h(w, r)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, apiPrefix) + "?" + r.URL.RawQuery + "\n" + r.Header.Get("Accept")
+		version := checksVersion.Load()
+
+		responseCache.Lock()
+		c := responseCache.entries[key]
+		if c != nil && (c.version != version || time.Since(c.created) > responseCacheTTL) {
+			c = nil
+		}
+		responseCache.Unlock()
+
+		if c == nil {
+			rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+			h(rec, r)
+			if rec.status != http.StatusOK {
+				rec.writeTo(w)
+				return
+			}
+			sum := sha256.Sum256(rec.body.Bytes())
+			c = &cachedResponse{
+				header:  rec.header,
+				body:    rec.body.Bytes(),
+				etag:    `W/"` + hex.EncodeToString(sum[:8]) + `"`,
+				version: version,
+				created: time.Now(),
+			}
+			c.modified = time.Unix(0, checksModified.Load())
+			if checksModified.Load() == 0 {
+				c.modified = c.created
+			}
+			responseCache.Lock()
+			// Drop expired entries so varied query strings don't pile up.
+			for k, e := range responseCache.entries {
+				if time.Since(e.created) > responseCacheTTL {
+					delete(responseCache.entries, k)
+				}
+			}
+			responseCache.entries[key] = c
+			responseCache.Unlock()
+		}
+
+		for k, v := range c.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", c.etag)
+		w.Header().Set("Last-Modified", c.modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-cache")
+		if notModified(r, c) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(c.body)
+	}
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since without it.
+// Last-Modified has whole seconds, and the checks can change several times
+// in one, so If-Modified-Since only matches a response last changed in an
+// earlier second than it names.
+func notModified(r *http.Request, c *cachedResponse) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(c.etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return c.modified.Truncate(time.Second).Before(ims)
+	}
+	return false
+}
+
+// responseRecorder captures a handler's response for the cache.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+func (r *responseRecorder) WriteHeader(code int)        { r.status = code }
+
+func (r *responseRecorder) writeTo(w http.ResponseWriter) {
+	for k, v := range r.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
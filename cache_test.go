@@ -0,0 +1,103 @@
+package up
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"up/checker"
+)
+
+// useRecentChecks starts the in-memory window empty for the test, as
+// loadRecentChecks does for a new database.
+func useRecentChecks(t *testing.T, window time.Duration) {
+	recentChecks.Lock()
+	recentChecks.loaded, recentChecks.window, recentChecks.byTarget = true, window, map[string][]recentSample{}
+	recentChecks.Unlock()
+	t.Cleanup(func() {
+		recentChecks.Lock()
+		recentChecks.loaded, recentChecks.window, recentChecks.byTarget = false, 0, nil
+		recentChecks.Unlock()
+	})
+}
+
+// cachedUptime is a cached handler answering with the number of checks of
+// target "a" in memory, as /uptime does.
+func cachedUptime() http.HandlerFunc {
+	return withResponseCache(func(w http.ResponseWriter, r *http.Request) {
+		total, _, _, _ := recentUptime("a", "", 0)
+		fmt.Fprint(w, total)
+	})
+}
+
+func getCached(h http.HandlerFunc, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h(w, req)
+	return w
+}
+
+func TestResponseCacheNoDB(t *testing.T) {
+	useRecentChecks(t, time.Hour)
+	h := cachedUptime()
+	first := getCached(h, "/test/nodb")
+	if first.Body.String() != "0" {
+		t.Fatalf("body %q, want 0", first.Body)
+	}
+
+	// With -no-db, the check only reaches the in-memory window.
+	saveResult(&Config{NoDB: true}, checker.Result{Timestamp: time.Now(), Target: "a", Status: "up"})
+
+	if w := getCached(h, "/test/nodb"); w.Body.String() != "1" {
+		t.Errorf("after a check, cached body %q, want 1", w.Body)
+	}
+	if w := getCached(h, "/test/nodb", "If-None-Match", first.Header().Get("ETag")); w.Code != http.StatusOK {
+		t.Errorf("after a check, the old ETag got status %d, want 200", w.Code)
+	}
+}
+
+func TestResponseCacheConditional(t *testing.T) {
+	useRecentChecks(t, time.Hour)
+	h := cachedUptime()
+	first := getCached(h, "/test/conditional")
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		t.Fatalf("Last-Modified %q: %v", lastModified, err)
+	}
+
+	tests := []struct {
+		name   string
+		header []string
+		want   int
+	}{
+		{"same ETag", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"other ETag", []string{"If-None-Match", `W/"other"`}, http.StatusOK},
+		{"ETag over If-Modified-Since", []string{"If-None-Match", `W/"other"`, "If-Modified-Since", modified.Add(time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+		{"If-Modified-Since later", []string{"If-Modified-Since", modified.Add(time.Second).Format(http.TimeFormat)}, http.StatusNotModified},
+		// The checks may have changed later in the same second.
+		{"If-Modified-Since the same second", []string{"If-Modified-Since", lastModified}, http.StatusOK},
+		{"If-Modified-Since earlier", []string{"If-Modified-Since", modified.Add(-time.Second).Format(http.TimeFormat)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := getCached(h, "/test/conditional", tt.header...); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	// A check recorded within the second Last-Modified names must not be
+	// answered with 304.
+	noteRecentCheck(checker.Result{Timestamp: time.Now(), Target: "a", Status: "up"})
+	w := getCached(h, "/test/conditional", "If-Modified-Since", lastModified)
+	if w.Code != http.StatusOK || w.Body.String() != "1" {
+		t.Errorf("after a check, If-Modified-Since got status %d with %q, want 200 with 1", w.Code, w.Body)
+	}
+	if w := getCached(h, "/test/conditional", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("after a check, the old ETag got status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxCalendarDays = 366
+
+type calendarDay struct {
+	Date        string  `json:"date"`
+	TotalChecks int     `json:"total_checks"`
+	UptimePct   float64 `json:"uptime_pct"`
+	// Status buckets the day as the status page does: "none" without
+	// checks, then "ok", "minor", or "major".
+	Status          string  `json:"status"`
+	DowntimeMinutes float64 `json:"downtime_minutes"`
+	Incidents       int     `json:"incidents"`
+	// WorstIncident is the longest incident overlapping the day.
+	WorstIncident *incident `json:"worst_incident,omitempty"`
+}
+
+// calendarHandler serves a target's uptime for each of the last ?days=
+// (default 90) days, for drawing a status bar without fetching raw checks.
+func (s *server) calendarHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	target := q.Get("target")
+	if target == "" {
+		http.Error(w, "Missing target", http.StatusBadRequest)
+		return
+	}
+	days := statusPageDays
+	if v := q.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxCalendarDays {
+			http.Error(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to := nextPeriod(periodStart(time.Now(), "daily", loc), "daily")
+	from := to.AddDate(0, 0, -days)
+	calendar, err := buildCalendar(s.db, target, from, to, loc)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
+
+func buildCalendar(db *sql.DB, target string, from, to time.Time, loc *time.Location) ([]calendarDay, error) {
+	report, err := buildReport(db, target, "daily", from, to, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, target, probe, start_time, end_time, check_count, classification
+		FROM incidents
+		WHERE target = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)`, target, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var incidents []incident
+	for rows.Next() {
+		var inc incident
+		var end sql.NullTime
+		if err := rows.Scan(&inc.ID, &inc.Target, &inc.Probe, &inc.Start, &end, &inc.CheckCount, &inc.Classification); err != nil {
+			return nil, err
+		}
+		inc.Start = inc.Start.In(loc)
+		if end.Valid {
+			end.Time = end.Time.In(loc)
+			inc.End = &end.Time
+			inc.DurationSeconds = end.Time.Sub(inc.Start).Seconds()
+		} else {
+			inc.Ongoing = true
+			inc.DurationSeconds = time.Since(inc.Start).Seconds()
+		}
+		incidents = append(incidents, inc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	calendar := make([]calendarDay, 0, len(report.Periods))
+	for _, p := range report.Periods {
+		day := calendarDay{
+			Date:            p.Start,
+			TotalChecks:     p.TotalChecks,
+			UptimePct:       p.UptimePct,
+			Status:          statusPageDay{Checks: p.TotalChecks, UptimePct: p.UptimePct}.Class(),
+			DowntimeMinutes: p.DowntimeMinutes,
+			Incidents:       p.Incidents,
+		}
+		start, _ := time.ParseInLocation("2006-01-02", p.Start, loc)
+		end, _ := time.ParseInLocation("2006-01-02", p.End, loc)
+		for i := range incidents {
+			inc := &incidents[i]
+			if !inc.Start.Before(end) || (inc.End != nil && !inc.End.After(start)) {
+				continue
+			}
+			if day.WorstIncident == nil || inc.DurationSeconds > day.WorstIncident.DurationSeconds {
+				day.WorstIncident = inc
+			}
+		}
+		calendar = append(calendar, day)
+	}
+	return calendar, nil
+}
@@ -0,0 +1,142 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+var (
+	certFingerprintsMu sync.Mutex
+	certFingerprints   = map[probeTarget]string{}
+)
+
+// trackCertificate records the result's certificate when it differs from
+// the one the target presented before, so that unexpected swaps show up in
+// the history.
+func trackCertificate(r checker.Result) {
+	certFingerprintsMu.Lock()
+	defer certFingerprintsMu.Unlock()
+
+	key := probeTarget{r.Target, r.Probe}
+	prev, ok := certFingerprints[key]
+	if !ok {
+		err := db.QueryRow(`SELECT fingerprint FROM certificates WHERE target = ? AND probe = ? ORDER BY id DESC LIMIT 1`,
+			r.Target, r.Probe).Scan(&prev)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Failed to load certificate", "target", r.Target, "error", err)
+			return
+		}
+	}
+	c := r.Cert
+	certFingerprints[key] = c.Fingerprint
+	if prev == c.Fingerprint {
+		return
+	}
+
+	c.Target, c.Probe, c.FirstSeen = r.Target, r.Probe, r.Timestamp
+	sans, _ := json.Marshal(c.SANs)
+	chain, _ := json.Marshal(c.Chain)
+	_, err := db.Exec(`INSERT INTO certificates (first_seen, target, probe, fingerprint, subject, issuer, serial, sans, not_before, not_after, chain)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.FirstSeen, c.Target, c.Probe, c.Fingerprint, c.Subject, c.Issuer, c.Serial, string(sans), c.NotBefore, c.NotAfter, string(chain))
+	if err != nil {
+		slog.Error("Failed to record certificate", "target", r.Target, "error", err)
+		return
+	}
+	if prev != "" {
+		slog.Warn("Certificate changed", "target", r.Target, "probe", r.Probe, "subject", c.Subject, "issuer", c.Issuer, "not_after", c.NotAfter)
+		events.publish(event{Type: "certificate", Data: c})
+	}
+}
+
+// certsHandler serves the certificate each HTTPS target currently
+// presents, or just ?target='s.
+func (s *server) certsHandler(w http.ResponseWriter, r *http.Request) {
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	names := targetNames()
+	if target := r.URL.Query().Get("target"); target != "" {
+		names = []string{target}
+	}
+	certs, err := queryCertificates(s.db, `id IN (SELECT MAX(id) FROM certificates GROUP BY target, probe)`)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	certs = slices.DeleteFunc(certs, func(c checker.Certificate) bool { return !slices.Contains(names, c.Target) })
+	writeCertificates(w, certs, loc)
+}
+
+// certHistoryHandler lists the certificates a target has presented, newest
+// first.
+func (s *server) certHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "Missing target", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	certs, err := queryCertificates(s.db, `target = ? ORDER BY id DESC LIMIT ?`, target, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeCertificates(w, certs, loc)
+}
+
+func writeCertificates(w http.ResponseWriter, certs []checker.Certificate, loc *time.Location) {
+	now := time.Now()
+	for i := range certs {
+		c := &certs[i]
+		c.ExpiresIn = c.NotAfter.Sub(now).Hours() / 24
+		c.FirstSeen, c.NotBefore, c.NotAfter = c.FirstSeen.In(loc), c.NotBefore.In(loc), c.NotAfter.In(loc)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certs)
+}
+
+func queryCertificates(db *sql.DB, where string, args ...any) ([]checker.Certificate, error) {
+	rows, err := db.Query(`SELECT first_seen, target, probe, fingerprint, subject, issuer, serial, sans, not_before, not_after, chain
+		FROM certificates WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []checker.Certificate{}
+	for rows.Next() {
+		var c checker.Certificate
+		var sans, chain string
+		if err := rows.Scan(&c.FirstSeen, &c.Target, &c.Probe, &c.Fingerprint, &c.Subject, &c.Issuer, &c.Serial, &sans, &c.NotBefore, &c.NotAfter, &chain); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(sans), &c.SANs); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(chain), &c.Chain); err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	return certs, rows.Err()
+}
@@ -0,0 +1,111 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// contentChange is a change in the response body of a target with
+// detect_changes, identified by the bodies' SHA-256 hashes.
+type contentChange struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Target    string    `json:"target"`
+	Probe     string    `json:"probe"`
+	OldHash   string    `json:"old_hash"`
+	NewHash   string    `json:"new_hash"`
+}
+
+var (
+	contentHashesMu sync.Mutex
+	contentHashes   = map[probeTarget]string{}
+)
+
+// trackContentChange compares the result's body hash with the previous
+// one and records a change when they differ. The first hash seen for a
+// target is recorded too, with no old hash, so that a change across a
+// restart is still noticed.
+func trackContentChange(r checker.Result) {
+	contentHashesMu.Lock()
+	defer contentHashesMu.Unlock()
+
+	key := probeTarget{r.Target, r.Probe}
+	prev, ok := contentHashes[key]
+	if !ok {
+		err := db.QueryRow(`SELECT new_hash FROM content_changes WHERE target = ? AND probe = ? ORDER BY timestamp DESC LIMIT 1`,
+			r.Target, r.Probe).Scan(&prev)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Failed to load content hash", "target", r.Target, "error", err)
+			return
+		}
+	}
+	contentHashes[key] = r.BodyHash
+	if prev == r.BodyHash {
+		return
+	}
+
+	c := contentChange{Timestamp: r.Timestamp, Target: r.Target, Probe: r.Probe, OldHash: prev, NewHash: r.BodyHash}
+	res, err := db.Exec(`INSERT INTO content_changes (timestamp, target, probe, old_hash, new_hash) VALUES (?, ?, ?, ?, ?)`,
+		c.Timestamp, c.Target, c.Probe, c.OldHash, c.NewHash)
+	if err != nil {
+		slog.Error("Failed to record content change", "target", r.Target, "error", err)
+		return
+	}
+	if prev != "" {
+		c.ID, _ = res.LastInsertId()
+		slog.Warn("Content changed", "target", r.Target, "probe", r.Probe, "hash", r.BodyHash)
+		events.publish(event{Type: "change", Data: c})
+	}
+}
+
+// changesHandler lists content changes, newest first, optionally for one
+// ?target=.
+func (s *server) changesHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	changes, err := queryContentChanges(s.db, r.URL.Query().Get("target"), limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for i := range changes {
+		changes[i].Timestamp = changes[i].Timestamp.In(loc)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+func queryContentChanges(db *sql.DB, target string, limit int) ([]contentChange, error) {
+	rows, err := db.Query(`SELECT id, timestamp, target, probe, old_hash, new_hash FROM content_changes
+		WHERE old_hash != '' AND (? = '' OR target = ?)
+		ORDER BY timestamp DESC LIMIT ?`, target, target, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []contentChange{}
+	for rows.Next() {
+		var c contentChange
+		if err := rows.Scan(&c.ID, &c.Timestamp, &c.Target, &c.Probe, &c.OldHash, &c.NewHash); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,34 @@
+package up
+
+import (
+	"time"
+
+	"up/checker"
+)
+
+// checkTarget checks a single target and returns the result, retrying a
+// failed probe as the target's confirmations say.
+func checkTarget(cfg *Config, t *targetConfig, sleep func(time.Duration)) checker.Result {
+	// A push target's state doesn't change by asking again.
+	if t.Type == "push" {
+		r := probeOnce(cfg, t)
+		r.Attempts = 1
+		return r
+	}
+	return t.Confirm(func() checker.Result { return probeOnce(cfg, t) }, sleep)
+}
+
+func probeOnce(cfg *Config, t *targetConfig) checker.Result {
+	var r checker.Result
+	// Push targets are pinged for real even when simulating.
+	switch {
+	case t.Type == "push":
+		r = checkPush(t)
+	case cfg.simulation != nil:
+		r = cfg.simulation.check(t)
+	default:
+		r = t.Probe()
+	}
+	r.Probe = cfg.ProbeName
+	return r
+}
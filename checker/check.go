@@ -0,0 +1,202 @@
+// Package checker probes network targets, such as HTTP endpoints, DNS
+// resolvers, and mail servers, and reports whether they answered and how
+// fast.
+package checker
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// maxBodyBytes caps how much of a response body is read for content assertions.
+const maxBodyBytes = 1 << 20
+
+// PhaseTimings breaks a check's latency down by connection phase. Phases
+// that did not happen (e.g. TLS for plain HTTP) are zero.
+type PhaseTimings struct {
+	DNSMs     int64
+	ConnectMs int64
+	TLSMs     int64
+	TTFBMs    int64
+}
+
+// tracePhases returns a context that records phase timings into p.
+func tracePhases(ctx context.Context, start time.Time, p *PhaseTimings) context.Context {
+	var dnsStart, connectStart, tlsStart time.Time
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			p.DNSMs += time.Since(dnsStart).Milliseconds()
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(string, string, error) {
+			p.ConnectMs += time.Since(connectStart).Milliseconds()
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.TLSMs += time.Since(tlsStart).Milliseconds()
+		},
+		GotFirstResponseByte: func() {
+			p.TTFBMs = time.Since(start).Milliseconds()
+		},
+	})
+}
+
+// Check probes the target and returns the result. A failed probe is
+// retried up to the target's confirmations, waiting the retry backoff
+// (doubling each time) with sleep in between, and only reported down if
+// every attempt fails.
+func (t *Target) Check(sleep func(time.Duration)) Result {
+	return t.Confirm(t.Probe, sleep)
+}
+
+// Confirm is Check with the probing done by probe, such as a simulated one.
+func (t *Target) Confirm(probe func() Result, sleep func(time.Duration)) Result {
+	r := probe()
+	r.Attempts = 1
+	backoff := t.retryBackoff
+	for !Answered(r.Status) && r.Attempts <= t.Confirmations {
+		sleep(backoff)
+		backoff *= 2
+		attempts := r.Attempts + 1
+		r = probe()
+		r.Attempts = attempts
+	}
+	if r.Attempts > 1 {
+		slog.Debug("Retried check", "target", t.Name, "attempts", r.Attempts, "status", r.Status)
+	}
+	return r
+}
+
+func (t *Target) initConfirmations() error {
+	if t.Confirmations < 0 {
+		return fmt.Errorf("target %s: confirmations must not be negative", cmp.Or(t.Name, t.URL))
+	}
+	t.retryBackoff = time.Second
+	if t.RetryBackoff != "" {
+		d, err := time.ParseDuration(t.RetryBackoff)
+		if err != nil || d < 0 {
+			return fmt.Errorf("target %s: invalid retry_backoff %q", cmp.Or(t.Name, t.URL), t.RetryBackoff)
+		}
+		t.retryBackoff = d
+	}
+	return nil
+}
+
+// Probe checks the target once, by its type.
+func (t *Target) Probe() Result {
+	switch t.Type {
+	case "grpc":
+		return checkGRPC(t)
+	case "websocket":
+		return checkWebSocket(t)
+	case "smtp":
+		return checkSMTP(t)
+	case "ssh":
+		return checkSSH(t)
+	case "icmp":
+		return checkICMP(t)
+	case "dns":
+		return checkDNS(t)
+	case "quic":
+		return checkQUICReachable(t)
+	case "presence":
+		return checkPresence(t)
+	}
+	return checkHTTP(t)
+}
+
+// checkHTTP requests the target's URL. Targets with a body assertion are
+// fetched with GET; all others use HEAD. Captive portal targets are
+// "captive" rather than down when they get a response other than the
+// expected one, such as a redirect to a login page.
+func checkHTTP(t *Target) Result {
+	method := http.MethodHead
+	if t.needsBody() || t.DetectChanges || t.Type == "captive" {
+		method = http.MethodGet
+	}
+
+	status := "down"
+	start := time.Now()
+	latency := int64(0)
+	var phases PhaseTimings
+	var bodyHash string
+	var cert *Certificate
+	var headers map[string]string
+	var failure, protocol string
+
+	req, err := t.newRequest(method, t.URL, nil)
+	if err == nil {
+		req = req.WithContext(tracePhases(req.Context(), start, &phases))
+
+		var resp *http.Response
+		resp, err = t.client.Do(req)
+		latency = time.Since(start).Milliseconds()
+		if err == nil {
+			protocol = resp.Proto
+			cert = peerCertificate(resp.TLS)
+			var data []byte
+			if t.needsBody() || t.DetectChanges {
+				data, err = io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+			}
+			if err == nil && t.accepted.contains(resp.StatusCode) && t.bodyMatches(data) {
+				status = "up"
+				if t.DetectChanges {
+					sum := sha256.Sum256(data)
+					bodyHash = hex.EncodeToString(sum[:])
+				}
+				if t.AuditHeaders {
+					headers = auditedHeaders(resp.Header)
+				}
+			} else if t.Type == "captive" {
+				status = "captive"
+			}
+			resp.Body.Close()
+		} else {
+			failure = requestFailure(err)
+		}
+	}
+
+	return Result{
+		Timestamp:    time.Now(),
+		Target:       t.Name,
+		Family:       t.Family,
+		Status:       status,
+		LatencyMs:    latency,
+		Failure:      failure,
+		Protocol:     protocol,
+		PhaseTimings: phases,
+		BodyHash:     bodyHash,
+		Cert:         cert,
+		Headers:      headers,
+	}
+}
+
+func (t *Target) needsBody() bool {
+	return t.ExpectBody != "" || t.expectRegex != nil || len(t.RejectBody) > 0
+}
+
+func (t *Target) bodyMatches(data []byte) bool {
+	if t.ExpectBody != "" && !strings.Contains(string(data), t.ExpectBody) {
+		return false
+	}
+	if t.expectRegex != nil && !t.expectRegex.Match(data) {
+		return false
+	}
+	for _, s := range t.RejectBody {
+		if strings.Contains(string(data), s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package checker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheckHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprint(w, "all systems operational")
+		case "/maintenance":
+			fmt.Fprint(w, "down for maintenance")
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	noFollow := false
+	tests := []struct {
+		name   string
+		target Target
+		want   string
+	}{
+		{"up", Target{URL: srv.URL + "/ok"}, "up"},
+		{"not found", Target{URL: srv.URL + "/missing"}, "down"},
+		{"accepted status", Target{URL: srv.URL + "/missing", AcceptedStatus: "200-299,404"}, "up"},
+		{"expect body", Target{URL: srv.URL + "/ok", ExpectBody: "operational"}, "up"},
+		{"expect body missing", Target{URL: srv.URL + "/maintenance", ExpectBody: "operational"}, "down"},
+		{"expect regex", Target{URL: srv.URL + "/ok", ExpectRegex: `^all \w+`}, "up"},
+		{"reject body", Target{URL: srv.URL + "/maintenance", RejectBody: []string{"maintenance"}}, "down"},
+		{"follow redirect", Target{URL: srv.URL + "/moved"}, "up"},
+		{"redirect not followed", Target{URL: srv.URL + "/moved", FollowRedirects: &noFollow}, "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if err := target.Init(Options{Proxy: "direct"}); err != nil {
+				t.Fatal(err)
+			}
+			r := target.Check(func(time.Duration) {})
+			if r.Status != tt.want {
+				t.Errorf("status = %q, want %q", r.Status, tt.want)
+			}
+			if r.Target != target.URL {
+				t.Errorf("target = %q, want the URL %q", r.Target, target.URL)
+			}
+			if r.Protocol != "HTTP/1.1" {
+				t.Errorf("protocol = %q, want HTTP/1.1", r.Protocol)
+			}
+		})
+	}
+}
+
+func TestCheckHTTPDetectChanges(t *testing.T) {
+	body := "v1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	target := Target{URL: srv.URL, DetectChanges: true, AuditHeaders: true}
+	if err := target.Init(Options{Proxy: "direct"}); err != nil {
+		t.Fatal(err)
+	}
+	first := target.Probe()
+	body = "v2"
+	second := target.Probe()
+	if first.BodyHash == "" || first.BodyHash == second.BodyHash {
+		t.Errorf("body hashes %q and %q, want two different hashes", first.BodyHash, second.BodyHash)
+	}
+	if got := second.Headers["X-Frame-Options"]; got != "DENY" {
+		t.Errorf("X-Frame-Options = %q, want DENY", got)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name          string
+		confirmations int
+		failures      int
+		wantStatus    string
+		wantAttempts  int
+		wantSleeps    []time.Duration
+	}{
+		{"up first time", 2, 0, "up", 1, nil},
+		{"down without confirmations", 0, 1, "down", 1, nil},
+		{"recovers on retry", 2, 2, "up", 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"down after every retry", 2, 5, "down", 3, []time.Duration{time.Second, 2 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := Target{Name: "t", URL: "http://example.com", Confirmations: tt.confirmations}
+			if err := target.Init(Options{}); err != nil {
+				t.Fatal(err)
+			}
+			calls := 0
+			probe := func() Result {
+				calls++
+				if calls <= tt.failures {
+					return Result{Status: "down"}
+				}
+				return Result{Status: "up"}
+			}
+			var sleeps []time.Duration
+			r := target.Confirm(probe, func(d time.Duration) { sleeps = append(sleeps, d) })
+			if r.Status != tt.wantStatus || r.Attempts != tt.wantAttempts {
+				t.Errorf("got %s after %d attempts, want %s after %d", r.Status, r.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if !slices.Equal(sleeps, tt.wantSleeps) {
+				t.Errorf("slept %v, want %v", sleeps, tt.wantSleeps)
+			}
+		})
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   Target
+		wantType string
+		wantErr  bool
+	}{
+		{"http", Target{URL: "https://example.com"}, "", false},
+		{"type from scheme", Target{URL: "ssh://example.com"}, "ssh", false},
+		{"dns", Target{URL: "dns://192.0.2.1/example.com", RecordType: "AAAA"}, "dns", false},
+		{"presence from mac", Target{MAC: "00:11:22:33:44:55"}, "presence", false},
+		{"captive defaults", Target{Type: "captive"}, "captive", false},
+		{"missing url", Target{}, "", true},
+		{"unknown type", Target{Type: "gopher", URL: "gopher://example.com"}, "", true},
+		{"bad status", Target{URL: "https://example.com", AcceptedStatus: "600"}, "", true},
+		{"bad regex", Target{URL: "https://example.com", ExpectRegex: "("}, "", true},
+		{"empty reject body", Target{URL: "https://example.com", RejectBody: []string{""}}, "", true},
+		{"negative confirmations", Target{URL: "https://example.com", Confirmations: -1}, "", true},
+		{"bad retry backoff", Target{URL: "https://example.com", RetryBackoff: "soon"}, "", true},
+		{"bad proxy", Target{URL: "https://example.com", Proxy: "ftp://proxy"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			err := target.Init(Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Init() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && target.Type != tt.wantType {
+				t.Errorf("type = %q, want %q", target.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestParseStatusRanges(t *testing.T) {
+	tests := []struct {
+		in      string
+		in200   bool
+		in301   bool
+		in404   bool
+		wantErr bool
+	}{
+		{in: "200-299", in200: true},
+		{in: "200-299, 301,302", in200: true, in301: true},
+		{in: "404", in404: true},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "299-200", wantErr: true},
+		{in: "99", wantErr: true},
+	}
+	for _, tt := range tests {
+		r, err := parseStatusRanges(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStatusRanges(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if r.contains(200) != tt.in200 || r.contains(301) != tt.in301 || r.contains(404) != tt.in404 {
+			t.Errorf("parseStatusRanges(%q) = %v", tt.in, r)
+		}
+	}
+}
+
+func TestAnswered(t *testing.T) {
+	for status, want := range map[string]bool{"up": true, "degraded": true, "down": false, "captive": false} {
+		if got := Answered(status); got != want {
+			t.Errorf("Answered(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"up/internal/dnsmsg"
+)
+
+const dnsCheckTimeout = 10 * time.Second
+
+var (
+	errDNSSECBogus       = errors.New("DNSSEC validation failed")
+	errDNSSECUnvalidated = errors.New("answer not DNSSEC-validated")
+	errDNSMismatch       = errors.New("unexpected records")
+)
+
+// initDNS configures a target with a dns://server[:port]/name URL.
+func (t *Target) initDNS() error {
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+	_, addr, err := parseTargetAddr(t.URL, map[string]string{"dns": "53"})
+	if err != nil {
+		return fmt.Errorf("target %s: %v", t.Name, err)
+	}
+	u, _ := url.Parse(t.URL)
+	t.dnsName = strings.Trim(u.Path, "/")
+	if t.dnsName == "" {
+		return fmt.Errorf("target %s: DNS targets need a dns://server/name url", t.Name)
+	}
+	t.dnsType = dnsmsg.TypeA
+	if t.RecordType != "" {
+		qtype, ok := dnsmsg.Types[strings.ToUpper(t.RecordType)]
+		if !ok {
+			return fmt.Errorf("target %s: unsupported record_type %q", t.Name, t.RecordType)
+		}
+		t.dnsType = qtype
+	}
+	t.addr = addr
+	return nil
+}
+
+// checkDNS looks up the target's name on its server. With dnssec, the
+// server must be a validating resolver and the answer must be
+// authenticated; a failure to validate is recorded as a "dnssec" failure
+// rather than a "resolution" one. An answer missing any of expect_records
+// is a "mismatch".
+func checkDNS(t *Target) Result {
+	status := "down"
+	start := time.Now()
+
+	err := t.dnsQuery()
+	latency := time.Since(start).Milliseconds()
+	var failure string
+	switch {
+	case err == nil:
+		status = "up"
+	case errors.Is(err, errDNSSECBogus), errors.Is(err, errDNSSECUnvalidated):
+		failure = "dnssec"
+	case errors.Is(err, errDNSMismatch):
+		failure = "mismatch"
+	default:
+		failure = "resolution"
+	}
+	if err != nil {
+		slog.Debug("DNS check failed", "target", t.Name, "error", err)
+	}
+
+	return Result{
+		Timestamp: time.Now(),
+		Target:    t.Name,
+		Family:    t.Family,
+		Status:    status,
+		LatencyMs: latency,
+		Failure:   failure,
+	}
+}
+
+func (t *Target) dnsQuery() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsCheckTimeout)
+	defer cancel()
+
+	resp, err := dnsmsg.Exchange(ctx, t.addr, t.dnsName, t.dnsType, dnsmsg.Flags{DNSSECOK: t.DNSSEC})
+	if err != nil {
+		return err
+	}
+	if resp.Rcode == 2 && t.DNSSEC {
+		// A validating resolver answers SERVFAIL for bogus signatures. If
+		// it can answer with validation off, the signatures are the
+		// problem rather than the zone's servers.
+		unchecked, err := dnsmsg.Exchange(ctx, t.addr, t.dnsName, t.dnsType, dnsmsg.Flags{DNSSECOK: true, CheckingDisabled: true})
+		if err == nil && unchecked.Rcode == 0 {
+			return fmt.Errorf("%s: %w", t.dnsName, errDNSSECBogus)
+		}
+	}
+	if resp.Rcode != 0 {
+		if s, ok := dnsmsg.Rcodes[resp.Rcode]; ok {
+			return fmt.Errorf("%s: %s", t.dnsName, s)
+		}
+		return fmt.Errorf("%s: rcode %d", t.dnsName, resp.Rcode)
+	}
+	var values []string
+	for _, rr := range resp.Answers {
+		if rr.Type == t.dnsType {
+			values = append(values, normalizeDNSValue(t.dnsType, rr.Value))
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("%s: no answer", t.dnsName)
+	}
+	if t.DNSSEC && !resp.Authenticated {
+		return fmt.Errorf("%s: %w", t.dnsName, errDNSSECUnvalidated)
+	}
+	for _, want := range t.ExpectRecords {
+		if !slices.Contains(values, normalizeDNSValue(t.dnsType, want)) {
+			return fmt.Errorf("%s: %w: %q not in %q", t.dnsName, errDNSMismatch, want, values)
+		}
+	}
+	return nil
+}
+
+// normalizeDNSValue makes record values of type qtype comparable:
+// addresses in canonical form, and names in lower case without the
+// trailing dot. TXT values are compared as they are.
+func normalizeDNSValue(qtype uint16, v string) string {
+	switch qtype {
+	case dnsmsg.TypeA, dnsmsg.TypeAAAA:
+		if ip := net.ParseIP(v); ip != nil {
+			return ip.String()
+		}
+	case dnsmsg.TypeCNAME, dnsmsg.TypeMX:
+		return strings.ToLower(strings.TrimSuffix(v, "."))
+	}
+	return v
+}
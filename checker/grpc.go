@@ -0,0 +1,187 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// gRPC health checks speak the standard grpc.health.v1 protocol directly
+// over HTTP/2: a unary Check call is a POST with a length-prefixed protobuf
+// body, and its status comes back in the grpc-status trailer.
+
+const grpcServing = 1
+
+// initGRPC configures a target with a grpc:// (plaintext) or grpcs:// (TLS)
+// URL.
+func (t *Target) initGRPC(transport *http.Transport) error {
+	u, err := url.Parse(t.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("target %s: invalid gRPC url", t.URL)
+	}
+	var protocols http.Protocols
+	scheme := "https"
+	switch u.Scheme {
+	case "grpcs":
+		protocols.SetHTTP2(true)
+	case "grpc":
+		// Plaintext gRPC is HTTP/2 with prior knowledge, which can't go
+		// through an HTTP proxy.
+		scheme = "http"
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Proxy = nil
+	default:
+		return fmt.Errorf("target %s: gRPC targets need a grpc:// or grpcs:// url", t.URL)
+	}
+	transport.Protocols = &protocols
+	t.grpcURL = scheme + "://" + u.Host + "/grpc.health.v1.Health/Check"
+	return nil
+}
+
+// checkGRPC calls Health/Check for the target's service. The target is up
+// if the call succeeds and the service reports SERVING.
+func checkGRPC(t *Target) Result {
+	status := "down"
+	start := time.Now()
+	var phases PhaseTimings
+
+	req, err := t.newRequest(http.MethodPost, t.grpcURL, bytes.NewReader(grpcHealthRequest(t.Service)))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+		req = req.WithContext(tracePhases(req.Context(), start, &phases))
+
+		var resp *http.Response
+		if resp, err = t.client.Do(req); err == nil {
+			err = readGRPCHealth(resp)
+		}
+	}
+	latency := time.Since(start).Milliseconds()
+	if err == nil {
+		status = "up"
+	} else {
+		slog.Debug("gRPC health check failed", "target", t.Name, "error", err)
+	}
+
+	return Result{
+		Timestamp:    time.Now(),
+		Target:       t.Name,
+		Family:       t.Family,
+		Status:       status,
+		LatencyMs:    latency,
+		PhaseTimings: phases,
+	}
+}
+
+// grpcHealthRequest encodes a HealthCheckRequest as a gRPC message.
+func grpcHealthRequest(service string) []byte {
+	var msg []byte
+	if service != "" {
+		msg = append(msg, 0x0a) // field 1, length-delimited
+		msg = binary.AppendUvarint(msg, uint64(len(service)))
+		msg = append(msg, service...)
+	}
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// readGRPCHealth reads a Health/Check response and returns an error unless
+// the service is SERVING.
+func readGRPCHealth(resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	// Trailers are only available once the body has been read. Calls that
+	// fail straight away send grpc-status in the headers instead.
+	code := resp.Trailer.Get("Grpc-Status")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+	}
+	if code != "0" {
+		msg, _ := url.PathUnescape(resp.Trailer.Get("Grpc-Message") + resp.Header.Get("Grpc-Message"))
+		return fmt.Errorf("grpc-status %s: %s", code, msg)
+	}
+
+	if len(body) < 5 || body[0] != 0 {
+		return fmt.Errorf("invalid gRPC response")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint64(n) > uint64(len(body)-5) {
+		return fmt.Errorf("truncated gRPC response")
+	}
+	serving, err := grpcHealthStatus(body[5 : 5+n])
+	if err != nil {
+		return err
+	}
+	if serving != grpcServing {
+		return fmt.Errorf("service is %s", grpcServingStatusName(serving))
+	}
+	return nil
+}
+
+// grpcHealthStatus decodes the status field of a HealthCheckResponse,
+// skipping any fields it doesn't know.
+func grpcHealthStatus(msg []byte) (uint64, error) {
+	var status uint64
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid health check response")
+		}
+		msg = msg[n:]
+
+		var skip uint64
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, fmt.Errorf("invalid health check response")
+			}
+			if tag>>3 == 1 {
+				status = v
+			}
+			skip = uint64(n)
+		case 1:
+			skip = 8
+		case 2:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, fmt.Errorf("invalid health check response")
+			}
+			skip = uint64(n) + l
+		case 5:
+			skip = 4
+		default:
+			return 0, fmt.Errorf("invalid health check response")
+		}
+		if skip > uint64(len(msg)) {
+			return 0, fmt.Errorf("truncated health check response")
+		}
+		msg = msg[skip:]
+	}
+	return status, nil
+}
+
+func grpcServingStatusName(s uint64) string {
+	switch s {
+	case 0:
+		return "UNKNOWN"
+	case 2:
+		return "NOT_SERVING"
+	case 3:
+		return "SERVICE_UNKNOWN"
+	}
+	return fmt.Sprintf("in status %d", s)
+}
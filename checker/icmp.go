@@ -0,0 +1,46 @@
+package checker
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// initICMP configures a target with an icmp://host URL.
+func (t *Target) initICMP() error {
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+	if t.Hostname() == "" {
+		return fmt.Errorf("target %s: ICMP targets need an icmp://host url", t.Name)
+	}
+	return nil
+}
+
+// checkICMP pings the target. Like TracePath, it needs a raw socket.
+func checkICMP(t *Target) Result {
+	status := "down"
+	var latency int64
+
+	p, err := newPathProber(t.Hostname(), t.Family)
+	if err == nil {
+		var rtt time.Duration
+		rtt, err = p.ping(time.Second)
+		p.close()
+		if err == nil {
+			status = "up"
+			latency = rtt.Milliseconds()
+		}
+	}
+	if err != nil {
+		slog.Debug("ICMP check failed", "target", t.Name, "error", err)
+	}
+
+	return Result{
+		Timestamp: time.Now(),
+		Target:    t.Name,
+		Family:    t.Family,
+		Status:    status,
+		LatencyMs: latency,
+	}
+}
@@ -0,0 +1,329 @@
+package checker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"time"
+)
+
+// maxPathHops is the highest TTL probed.
+const maxPathHops = 30
+
+// PathHop is one hop on the path to a target. Addr is empty if nothing
+// replied from that hop.
+type PathHop struct {
+	TTL   int     `json:"ttl"`
+	Addr  string  `json:"addr,omitempty"`
+	RTTMs float64 `json:"rtt_ms,omitempty"`
+}
+
+// pathProber traces the path to a host by sending ICMP echo requests with
+// increasing TTLs over a raw socket and listening for the time exceeded
+// replies, which needs root or CAP_NET_RAW.
+type pathProber struct {
+	conn *net.IPConn
+	dst  *net.IPAddr
+	v6   bool
+	id   uint16
+	seq  uint16
+	// destTTL is the hop count to the destination once a round has
+	// reached it, so later rounds stop there.
+	destTTL int
+}
+
+func newPathProber(host, family string) (*pathProber, error) {
+	network := "ip"
+	switch family {
+	case "ipv4":
+		network = "ip4"
+	case "ipv6":
+		network = "ip6"
+	}
+	dst, err := net.ResolveIPAddr(network, host)
+	if err != nil {
+		return nil, err
+	}
+	p := &pathProber{dst: dst, v6: dst.IP.To4() == nil, id: uint16(rand.N(1 << 16))}
+	if p.v6 {
+		p.conn, err = net.ListenIP("ip6:ipv6-icmp", nil)
+	} else {
+		p.conn, err = net.ListenIP("ip4:icmp", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ICMP socket: %v", err)
+	}
+	return p, nil
+}
+
+func (p *pathProber) close() {
+	p.conn.Close()
+}
+
+// round sends one probe to every hop and returns the hops up to the
+// destination, or up to the last hop that replied if it wasn't reached.
+func (p *pathProber) round(timeout time.Duration) ([]PathHop, error) {
+	last := maxPathHops
+	if p.destTTL > 0 {
+		last = p.destTTL
+	}
+	base := p.seq
+	p.seq += maxPathHops
+
+	sent := make([]time.Time, last+1)
+	for ttl := 1; ttl <= last; ttl++ {
+		if err := setTTL(p.conn, p.v6, ttl); err != nil {
+			return nil, fmt.Errorf("failed to set TTL: %v", err)
+		}
+		sent[ttl] = time.Now()
+		if _, err := p.conn.WriteTo(p.echoRequest(base+uint16(ttl)), p.dst); err != nil {
+			return nil, err
+		}
+	}
+
+	hops := make([]PathHop, last+1)
+	reached := 0
+	p.conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 1500)
+	for !p.complete(hops, reached) {
+		n, from, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			// The deadline ends every round that doesn't hear from
+			// every hop.
+			break
+		}
+		seq, final, ok := p.parseReply(buf[:n])
+		ttl := int(seq - base)
+		if !ok || ttl < 1 || ttl > last || hops[ttl].Addr != "" {
+			continue
+		}
+		hops[ttl] = PathHop{Addr: from.String(), RTTMs: float64(time.Since(sent[ttl]).Microseconds()) / 1000}
+		if final && (reached == 0 || ttl < reached) {
+			reached = ttl
+		}
+	}
+
+	end := reached
+	if end == 0 {
+		for ttl := last; ttl > 0 && end == 0; ttl-- {
+			if hops[ttl].Addr != "" {
+				end = ttl
+			}
+		}
+	} else {
+		p.destTTL = reached
+	}
+	hops = hops[1 : end+1]
+	for i := range hops {
+		hops[i].TTL = i + 1
+	}
+	return hops, nil
+}
+
+// complete reports whether every hop up to the destination has replied.
+func (p *pathProber) complete(hops []PathHop, reached int) bool {
+	if reached == 0 {
+		return false
+	}
+	for ttl := 1; ttl <= reached; ttl++ {
+		if hops[ttl].Addr == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pathProber) echoRequest(seq uint16) []byte {
+	msg := make([]byte, 16)
+	msg[0] = 8 // echo request
+	if p.v6 {
+		msg[0] = 128
+	}
+	binary.BigEndian.PutUint16(msg[4:], p.id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "up-trace")
+	// The kernel fills in the ICMPv6 checksum.
+	if !p.v6 {
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+	return msg
+}
+
+// parseReply matches an ICMP message to one of our probes. final is set
+// when the reply came from the destination rather than a router on the way.
+func (p *pathProber) parseReply(msg []byte) (seq uint16, final, ok bool) {
+	if len(msg) < 8 {
+		return 0, false, false
+	}
+	echoReply, timeExceeded, unreachable, echoRequest, ipHeader := byte(0), byte(11), byte(3), byte(8), 0
+	if p.v6 {
+		echoReply, timeExceeded, unreachable, echoRequest, ipHeader = 129, 3, 1, 128, 40
+	}
+
+	var inner []byte
+	switch msg[0] {
+	case echoReply:
+		inner, final = msg, true
+	case timeExceeded, unreachable:
+		// The error quotes the IP header and the start of our probe.
+		quoted := msg[8:]
+		if !p.v6 && len(quoted) > 0 {
+			ipHeader = int(quoted[0]&0x0f) * 4
+		}
+		if len(quoted) < ipHeader+8 || quoted[ipHeader] != echoRequest {
+			return 0, false, false
+		}
+		inner, final = quoted[ipHeader:], msg[0] == unreachable
+	default:
+		return 0, false, false
+	}
+	if binary.BigEndian.Uint16(inner[4:]) != p.id {
+		return 0, false, false
+	}
+	return binary.BigEndian.Uint16(inner[6:]), final, true
+}
+
+// ping sends echo requests until one is answered, up to three times, and
+// returns the round-trip time.
+func (p *pathProber) ping(timeout time.Duration) (time.Duration, error) {
+	if err := setTTL(p.conn, p.v6, 64); err != nil {
+		return 0, fmt.Errorf("failed to set TTL: %v", err)
+	}
+	buf := make([]byte, 1500)
+	for range 3 {
+		p.seq++
+		start := time.Now()
+		if _, err := p.conn.WriteTo(p.echoRequest(p.seq), p.dst); err != nil {
+			return 0, err
+		}
+		p.conn.SetReadDeadline(start.Add(timeout))
+		for {
+			n, _, err := p.conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			seq, _, ok := p.parseReply(buf[:n])
+			if ok && seq == p.seq && (buf[0] == 0 || buf[0] == 129) {
+				return time.Since(start), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no reply from %s", p.dst)
+}
+
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// TracePath runs a traceroute of three probes per hop, keeping the fastest
+// reply from each.
+func TracePath(host, family string) ([]PathHop, error) {
+	p, err := newPathProber(host, family)
+	if err != nil {
+		return nil, err
+	}
+	defer p.close()
+
+	var path []PathHop
+	for range 3 {
+		hops, err := p.round(2 * time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if len(hops) > len(path) {
+			path = append(path, hops[len(path):]...)
+		}
+		for i, h := range hops[:min(len(hops), len(path))] {
+			if path[i].Addr == "" || (h.Addr != "" && h.RTTMs < path[i].RTTMs) {
+				path[i] = h
+			}
+		}
+	}
+	return path, nil
+}
+
+// HopStats summarizes one hop over a path measurement.
+type HopStats struct {
+	TTL      int     `json:"ttl"`
+	Addr     string  `json:"addr,omitempty"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	LossPct  float64 `json:"loss_pct"`
+	AvgMs    float64 `json:"avg_ms"`
+	BestMs   float64 `json:"best_ms"`
+	WorstMs  float64 `json:"worst_ms"`
+}
+
+// MeasurePath probes every hop to the host rounds times, a second apart,
+// and returns each hop's loss and latency.
+func MeasurePath(host, family string, rounds int) ([]HopStats, error) {
+	p, err := newPathProber(host, family)
+	if err != nil {
+		return nil, err
+	}
+	defer p.close()
+
+	var results [][]PathHop
+	for range rounds {
+		start := time.Now()
+		hops, err := p.round(time.Second)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, hops)
+		time.Sleep(time.Second - time.Since(start))
+	}
+
+	n := 0
+	for _, hops := range results {
+		n = max(n, len(hops))
+	}
+	stats := make([]HopStats, n)
+	for i := range stats {
+		s := &stats[i]
+		s.TTL = i + 1
+		var total float64
+		for _, hops := range results {
+			s.Sent++
+			if i >= len(hops) || hops[i].Addr == "" {
+				continue
+			}
+			h := hops[i]
+			s.Addr = h.Addr
+			if s.Received == 0 || h.RTTMs < s.BestMs {
+				s.BestMs = h.RTTMs
+			}
+			s.WorstMs = max(s.WorstMs, h.RTTMs)
+			total += h.RTTMs
+			s.Received++
+		}
+		if s.Received > 0 {
+			s.AvgMs = math.Round(total/float64(s.Received)*1000) / 1000
+		}
+		s.LossPct = float64(s.Sent-s.Received) / float64(s.Sent) * 100
+	}
+	return stats, nil
+}
+
+// Hostname is the host the target's checks connect to, or empty if its
+// URL has none.
+func (t *Target) Hostname() string {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
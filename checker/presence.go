@@ -0,0 +1,166 @@
+package checker
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// initPresence configures a presence target: an arp://host URL, a mac, or
+// both. A target with only a MAC address is found by sweeping the local
+// subnets, so it keeps working when DHCP gives the device a new address.
+func (t *Target) initPresence() error {
+	if t.MAC != "" {
+		mac, err := net.ParseMAC(t.MAC)
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("target %s: invalid mac %q", cmp.Or(t.Name, t.URL), t.MAC)
+		}
+		t.mac = mac.String()
+	}
+	if t.URL != "" && t.Hostname() == "" {
+		return fmt.Errorf("target %s: presence targets need an arp://host url", cmp.Or(t.Name, t.URL))
+	}
+	if t.URL == "" && t.mac == "" {
+		return fmt.Errorf("target %s: presence targets need an arp://host url or a mac", t.Name)
+	}
+	if t.Name == "" {
+		t.Name = cmp.Or(t.URL, t.mac)
+	}
+	return nil
+}
+
+// checkPresence tells whether a device on the LAN is online. A device with
+// a known address is pinged; one that doesn't answer pings, such as a
+// phone asleep or a camera with a firewall, still counts as present if it
+// answers ARP, so the address is poked with a UDP packet and looked up in
+// the neighbour table. If the target has a MAC address, the entry must
+// match it.
+func checkPresence(t *Target) Result {
+	r := Result{Timestamp: time.Now(), Target: t.Name, Family: t.Family, Status: "down"}
+
+	ip, err := t.presenceIP()
+	if err == nil && ip == "" {
+		// Only the MAC address is known.
+		err = sweepLAN()
+	}
+	if err == nil && ip != "" {
+		if p, perr := newPathProber(ip, "ipv4"); perr == nil {
+			rtt, perr := p.ping(time.Second)
+			p.close()
+			if perr == nil && t.mac == "" {
+				r.Status, r.LatencyMs, r.Protocol = "up", rtt.Milliseconds(), "ICMP"
+				return r
+			}
+		}
+		pokeAddr(ip)
+		time.Sleep(500 * time.Millisecond)
+	}
+	var table map[string]string
+	if err == nil {
+		table, err = neighbours()
+	}
+	if err != nil {
+		slog.Debug("Presence check failed", "target", t.Name, "error", err)
+		return r
+	}
+
+	switch {
+	case ip != "" && table[ip] != "":
+		if t.mac != "" && table[ip] != t.mac {
+			// Another device has the address.
+			r.Failure = "mismatch"
+			return r
+		}
+		r.Status, r.Protocol = "up", "ARP"
+	case ip == "":
+		for _, mac := range table {
+			if mac == t.mac {
+				r.Status, r.Protocol = "up", "ARP"
+			}
+		}
+	}
+	return r
+}
+
+// presenceIP resolves the target's host to an IPv4 address, or returns ""
+// for a target with only a MAC address.
+func (t *Target) presenceIP() (string, error) {
+	host := t.Hostname()
+	if host == "" {
+		return "", nil
+	}
+	addr, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return "", err
+	}
+	return addr.IP.String(), nil
+}
+
+// pokeAddr sends an empty UDP packet to the discard port, which makes the
+// kernel resolve the address with ARP whether or not anything listens.
+func pokeAddr(ip string) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip, "9"))
+	if err != nil {
+		return
+	}
+	conn.Write(nil)
+	conn.Close()
+}
+
+// maxSweepHosts caps the subnets swept, so a /16 on the LAN isn't.
+const maxSweepHosts = 1024
+
+// lanSweep remembers when the local subnets were last swept, so that
+// presence targets checked together share one sweep.
+var lanSweep struct {
+	sync.Mutex
+	at time.Time
+}
+
+// sweepLAN pokes every address on the local IPv4 subnets, at most every 30
+// seconds, and waits for the ARP replies to fill the neighbour table.
+func sweepLAN() error {
+	lanSweep.Lock()
+	defer lanSweep.Unlock()
+	if time.Since(lanSweep.at) < 30*time.Second {
+		return nil
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			n, ok := a.(*net.IPNet)
+			if !ok || n.IP.To4() == nil {
+				continue
+			}
+			ones, bits := n.Mask.Size()
+			if 1<<(bits-ones) > maxSweepHosts {
+				slog.Debug("Subnet too large to sweep", "interface", iface.Name, "subnet", n)
+				continue
+			}
+			base := n.IP.To4().Mask(n.Mask)
+			for i := 1; i < 1<<(bits-ones)-1; i++ {
+				ip := net.IPv4(base[0], base[1], base[2]|byte(i>>8), base[3]|byte(i))
+				conn.WriteTo(nil, &net.UDPAddr{IP: ip, Port: 9})
+			}
+		}
+	}
+	time.Sleep(time.Second)
+	lanSweep.at = time.Now()
+	return nil
+}
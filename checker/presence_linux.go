@@ -0,0 +1,30 @@
+package checker
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// neighbours reads the resolved entries of the ARP table from
+// /proc/net/arp, as IP address to MAC address.
+func neighbours() (map[string]string, error) {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table := map[string]string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device; flag 0x2
+		// marks a resolved entry.
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 || fields[2] == "0x0" {
+			continue
+		}
+		table[fields[0]] = strings.ToLower(fields[3])
+	}
+	return table, s.Err()
+}
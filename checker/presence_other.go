@@ -0,0 +1,47 @@
+//go:build !linux && !windows
+
+package checker
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// neighbours parses the ARP table from arp -an, as on macOS and the BSDs,
+// as IP address to MAC address.
+func neighbours() (map[string]string, error) {
+	out, err := exec.Command("arp", "-an").Output()
+	if err != nil {
+		return nil, err
+	}
+	table := map[string]string{}
+	// ? (192.168.1.1) at 0:11:22:33:44:55 on en0 ifscope [ethernet]
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "at" {
+			continue
+		}
+		ip := strings.Trim(fields[1], "()")
+		if mac, err := parseShortMAC(fields[3]); err == nil && net.ParseIP(ip) != nil {
+			table[ip] = mac
+		}
+	}
+	return table, nil
+}
+
+// parseShortMAC parses a MAC address as arp prints it, without leading
+// zeros, such as 0:11:22:3:44:55.
+func parseShortMAC(s string) (string, error) {
+	parts := strings.Split(s, ":")
+	for i, p := range parts {
+		if len(p) == 1 {
+			parts[i] = "0" + p
+		}
+	}
+	mac, err := net.ParseMAC(strings.Join(parts, ":"))
+	if err != nil {
+		return "", err
+	}
+	return mac.String(), nil
+}
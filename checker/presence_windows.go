@@ -0,0 +1,28 @@
+package checker
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// neighbours parses the ARP table from arp -a, as IP address to MAC
+// address.
+func neighbours() (map[string]string, error) {
+	out, err := exec.Command("arp", "-a").Output()
+	if err != nil {
+		return nil, err
+	}
+	table := map[string]string{}
+	// Internet Address  Physical Address  Type
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		if mac, err := net.ParseMAC(fields[1]); err == nil {
+			table[fields[0]] = mac.String()
+		}
+	}
+	return table, nil
+}
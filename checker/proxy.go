@@ -0,0 +1,39 @@
+package checker
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ProxyFunc resolves the proxy for a client from a proxy URL. When it is empty, HTTP_PROXY, HTTPS_PROXY, and NO_PROXY from the
+// environment are honored instead; "direct" disables proxying.
+func ProxyFunc(raw string) (func(*http.Request) (*url.URL, error), error) {
+	switch raw {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "direct":
+		return nil, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: unsupported scheme %q", raw, u.Scheme)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// OutboundClient returns a client for speed tests and probes that goes
+// through proxyURL, as ProxyFunc resolves it.
+func OutboundClient(proxyURL string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy, err := ProxyFunc(proxyURL); err == nil {
+		transport.Proxy = proxy
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,159 @@
+package checker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// quicProbeVersion is a reserved version (RFC 9000, section 15) that no
+// server supports, so every QUIC server answers it with a Version
+// Negotiation packet.
+const quicProbeVersion = 0x1a2a3a4a
+
+// initQUIC configures a target with a quic://host[:port] URL; the port
+// defaults to 443.
+func (t *Target) initQUIC() error {
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+	_, addr, err := parseTargetAddr(t.URL, map[string]string{"quic": "443", "https": "443"})
+	if err != nil {
+		return fmt.Errorf("target %s: %v", t.Name, err)
+	}
+	t.addr = addr
+	return nil
+}
+
+// checkQUICReachable is a QUIC reachability probe, not an HTTP/3 check: it
+// sends an Initial-sized packet with a version the server can't support
+// and waits for the Version Negotiation packet every QUIC server must send
+// back. No handshake is made and no request is sent, so a server that
+// speaks QUIC but not HTTP/3 (no h3 ALPN, or failing requests) is still
+// up; the probe only shows that UDP to the server isn't blocked and a QUIC
+// server is listening. A probe that gets no answer fails with "timeout",
+// the usual sign of a network dropping QUIC.
+func checkQUICReachable(t *Target) Result {
+	status, protocol := "down", ""
+	var failure string
+	start := time.Now()
+
+	versions, err := t.quicVersions()
+	latency := time.Since(start).Milliseconds()
+	switch {
+	case err == nil:
+		status, protocol = "up", "QUIC"
+		slog.Debug("QUIC reachability probe answered", "target", t.Name, "versions", versions)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		failure = "timeout"
+	default:
+		failure = "connection"
+	}
+	if err != nil {
+		slog.Debug("QUIC reachability probe failed", "target", t.Name, "error", err)
+	}
+
+	return Result{
+		Timestamp: time.Now(),
+		Target:    t.Name,
+		Family:    t.Family,
+		Status:    status,
+		LatencyMs: latency,
+		Failure:   failure,
+		Protocol:  protocol,
+	}
+}
+
+// quicVersions sends the version negotiation probe, resending it each
+// second in case it is lost, and returns the versions the server offers.
+func (t *Target) quicVersions() ([]string, error) {
+	conn, err := net.DialTimeout(strings.Replace(t.network(), "tcp", "udp", 1), t.addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var dcid, scid [8]byte
+	rand.Read(dcid[:])
+	rand.Read(scid[:])
+	// A long header packet (RFC 8999): flags, version, and the connection
+	// IDs, padded to the 1200 bytes a client's first datagram must have.
+	packet := make([]byte, 1200)
+	packet[0] = 0xc0
+	binary.BigEndian.PutUint32(packet[1:], quicProbeVersion)
+	packet[5] = byte(len(dcid))
+	copy(packet[6:], dcid[:])
+	packet[14] = byte(len(scid))
+	copy(packet[15:], scid[:])
+
+	deadline := time.Now().Add(5 * time.Second)
+	buf := make([]byte, 1500)
+	for time.Now().Before(deadline) {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+		wait := time.Now().Add(time.Second)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+		for {
+			n, err := conn.Read(buf)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if versions, ok := parseVersionNegotiation(buf[:n], dcid[:], scid[:]); ok {
+				return versions, nil
+			}
+		}
+	}
+	return nil, os.ErrDeadlineExceeded
+}
+
+// parseVersionNegotiation reads a Version Negotiation packet answering a
+// packet sent with dcid and scid, which it echoes swapped, and returns the
+// versions it lists.
+func parseVersionNegotiation(p, dcid, scid []byte) ([]string, bool) {
+	if len(p) < 7 || p[0]&0x80 == 0 || binary.BigEndian.Uint32(p[1:]) != 0 {
+		return nil, false
+	}
+	p = p[5:]
+	gotDCID, p, ok := quicConnID(p)
+	if !ok || !bytes.Equal(gotDCID, scid) {
+		return nil, false
+	}
+	gotSCID, p, ok := quicConnID(p)
+	if !ok || !bytes.Equal(gotSCID, dcid) {
+		return nil, false
+	}
+	var versions []string
+	for ; len(p) >= 4; p = p[4:] {
+		switch v := binary.BigEndian.Uint32(p); v {
+		case 1:
+			versions = append(versions, "v1")
+		case 0x6b3343cf:
+			versions = append(versions, "v2")
+		default:
+			versions = append(versions, fmt.Sprintf("0x%08x", v))
+		}
+	}
+	return versions, true
+}
+
+func quicConnID(p []byte) (id, rest []byte, ok bool) {
+	if len(p) < 1 || len(p) < 1+int(p[0]) {
+		return nil, nil, false
+	}
+	n := 1 + int(p[0])
+	return p[1:n], p[n:], true
+}
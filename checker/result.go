@@ -0,0 +1,142 @@
+package checker
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Result is the outcome of checking a target.
+type Result struct {
+	Timestamp time.Time
+	Target    string
+	// Status is "up", "degraded" when the target answered but slower than
+	// its latency threshold, "down", or "captive".
+	Status      string
+	LatencyMs   int64
+	Maintenance bool
+	Family      string
+	Probe       string
+	// Attempts is how many times the target was probed for this result;
+	// more than one means earlier attempts failed.
+	Attempts int
+	// Failure tells apart the ways a check can fail, for checks that
+	// distinguish them: "resolution", "dnssec", or "mismatch" for DNS
+	// checks, "resolution", "connection", or "tls" for HTTP checks that
+	// got no response, and "mismatch" for presence checks that found
+	// another device at the address.
+	Failure string `json:",omitempty"`
+	// Protocol is the protocol the check's response came over, e.g.
+	// "HTTP/2.0" for HTTP checks, or "QUIC" for QUIC reachability probes
+	// that got a version negotiation answer.
+	Protocol string `json:",omitempty"`
+	PhaseTimings
+	// Annotations are the texts of the annotations covering the check;
+	// only /status fills them in.
+	Annotations []string `json:",omitempty"`
+
+	// BodyHash is the SHA-256 of the response body of an HTTP target with
+	// detect_changes, when it was up.
+	BodyHash string `json:"-"`
+	// Cert is the certificate an HTTPS target presented.
+	Cert *Certificate `json:"-"`
+	// Headers are the security headers of an HTTP target with
+	// audit_headers, when it was up.
+	Headers map[string]string `json:"-"`
+}
+
+// Answered reports whether a check status means the target responded:
+// "up", or "degraded" if it was slow. Anything else is an outage.
+func Answered(status string) bool {
+	return status == "up" || status == "degraded"
+}
+
+// AnsweredSQL is Answered as an SQL condition on a status column, for
+// queries over stored checks. Keep the two in step.
+const AnsweredSQL = "status IN ('up', 'degraded')"
+
+// Certificate is the leaf certificate an HTTPS target presented, with the
+// rest of the chain it sent.
+type Certificate struct {
+	Target    string    `json:"target"`
+	Probe     string    `json:"probe"`
+	FirstSeen time.Time `json:"first_seen"`
+	// Fingerprint is the SHA-256 of the leaf certificate.
+	Fingerprint string      `json:"fingerprint"`
+	Subject     string      `json:"subject"`
+	Issuer      string      `json:"issuer"`
+	Serial      string      `json:"serial"`
+	SANs        []string    `json:"sans"`
+	NotBefore   time.Time   `json:"not_before"`
+	NotAfter    time.Time   `json:"not_after"`
+	ExpiresIn   float64     `json:"expires_in_days"`
+	Chain       []ChainCert `json:"chain"`
+}
+
+// ChainCert is an intermediate or root certificate in a chain.
+type ChainCert struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// peerCertificate describes the certificates of a TLS connection, or
+// returns nil for a plain one.
+func peerCertificate(state *tls.ConnectionState) *Certificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := state.PeerCertificates[0]
+	sum := sha256.Sum256(leaf.Raw)
+	c := &Certificate{
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		Serial:      leaf.SerialNumber.Text(16),
+		SANs:        certificateSANs(leaf),
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		Chain:       []ChainCert{},
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		c.Chain = append(c.Chain, ChainCert{Subject: cert.Subject.String(), Issuer: cert.Issuer.String(), NotAfter: cert.NotAfter})
+	}
+	return c
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := slices.Clone(cert.DNSNames)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return append(sans, cert.EmailAddresses...)
+}
+
+// SecurityHeaderNames are the response headers recorded for targets with
+// audit_headers.
+var SecurityHeaderNames = []string{
+	"Strict-Transport-Security",
+	"Content-Security-Policy",
+	"X-Frame-Options",
+	"X-Content-Type-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+	"Cross-Origin-Opener-Policy",
+}
+
+func auditedHeaders(h http.Header) map[string]string {
+	headers := map[string]string{}
+	for _, name := range SecurityHeaderNames {
+		if v := h.Get(name); v != "" {
+			headers[name] = v
+		}
+	}
+	return headers
+}
@@ -0,0 +1,111 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+// initSMTP configures a target with an smtp:// URL, or smtps:// for
+// servers that expect TLS from the start.
+func (t *Target) initSMTP() error {
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+	scheme, addr, err := parseTargetAddr(t.URL, map[string]string{"smtp": "25", "smtps": "465"})
+	if err != nil {
+		return fmt.Errorf("target %s: %v", t.Name, err)
+	}
+	if scheme == "smtps" && t.StartTLS {
+		return fmt.Errorf("target %s: starttls can't be used with smtps://", t.Name)
+	}
+	t.addr, t.implicitTLS = addr, scheme == "smtps"
+	return nil
+}
+
+// checkSMTP connects to a mail server, waits for its greeting, and says
+// EHLO, then with starttls set upgrades to TLS, before quitting. The target is
+// up if every step succeeds.
+func checkSMTP(t *Target) Result {
+	status := "down"
+	start := time.Now()
+	var phases PhaseTimings
+
+	err := t.smtpSession(start, &phases)
+	latency := time.Since(start).Milliseconds()
+	if err == nil {
+		status = "up"
+	} else {
+		slog.Debug("SMTP check failed", "target", t.Name, "error", err)
+	}
+
+	return Result{
+		Timestamp:    time.Now(),
+		Target:       t.Name,
+		Family:       t.Family,
+		Status:       status,
+		LatencyMs:    latency,
+		PhaseTimings: phases,
+	}
+}
+
+func (t *Target) smtpSession(start time.Time, phases *PhaseTimings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conn, err := t.dial(tracePhases(ctx, start, phases), t.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	host, _, _ := net.SplitHostPort(t.addr)
+	tlsConfig := &tls.Config{}
+	if t.tlsConfig != nil {
+		tlsConfig = t.tlsConfig.Clone()
+	}
+	tlsConfig.ServerName = host
+	if t.implicitTLS {
+		tlsStart := time.Now()
+		tc := tls.Client(conn, tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		phases.TLSMs = time.Since(tlsStart).Milliseconds()
+		conn = tc
+	}
+
+	// NewClient reads the server's 220 greeting.
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	phases.TTFBMs = time.Since(start).Milliseconds()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	if err := c.Hello(hostname); err != nil {
+		return err
+	}
+	if t.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not offer STARTTLS")
+		}
+		tlsStart := time.Now()
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+		phases.TLSMs = time.Since(tlsStart).Milliseconds()
+	}
+	return c.Quit()
+}
@@ -0,0 +1,91 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// initSSH configures a target with an ssh:// URL.
+func (t *Target) initSSH() error {
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+	_, addr, err := parseTargetAddr(t.URL, map[string]string{"ssh": "22"})
+	if err != nil {
+		return fmt.Errorf("target %s: %v", t.Name, err)
+	}
+	t.addr = addr
+	return nil
+}
+
+// checkSSH connects to an SSH server and reads its identification string,
+// without authenticating. The target is up if the server announces SSH
+// protocol version 2.
+func checkSSH(t *Target) Result {
+	status := "down"
+	start := time.Now()
+	var phases PhaseTimings
+
+	version, err := t.sshVersion(start, &phases)
+	latency := time.Since(start).Milliseconds()
+	if err == nil {
+		status = "up"
+		slog.Debug("SSH check succeeded", "target", t.Name, "version", version)
+	} else {
+		slog.Debug("SSH check failed", "target", t.Name, "error", err)
+	}
+
+	return Result{
+		Timestamp:    time.Now(),
+		Target:       t.Name,
+		Family:       t.Family,
+		Status:       status,
+		LatencyMs:    latency,
+		PhaseTimings: phases,
+	}
+}
+
+func (t *Target) sshVersion(start time.Time, phases *PhaseTimings) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conn, err := t.dial(tracePhases(ctx, start, phases), t.addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// Sending our own identification keeps the server from logging a
+	// connection that never spoke SSH.
+	if _, err := conn.Write([]byte("SSH-2.0-up\r\n")); err != nil {
+		return "", err
+	}
+
+	// Servers may send other lines before the identification string
+	// (RFC 4253, section 4.2).
+	r := bufio.NewReader(conn)
+	for range 20 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if phases.TTFBMs == 0 {
+			phases.TTFBMs = time.Since(start).Milliseconds()
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, "SSH-") {
+			continue
+		}
+		if !strings.HasPrefix(line, "SSH-2.0-") && !strings.HasPrefix(line, "SSH-1.99-") {
+			return "", fmt.Errorf("unsupported SSH version %q", line)
+		}
+		return line, nil
+	}
+	return "", fmt.Errorf("no SSH identification string")
+}
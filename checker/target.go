@@ -0,0 +1,362 @@
+package checker
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Target describes a single probed endpoint. It is usually decoded from a
+// config file, then prepared with Init before it is probed.
+type Target struct {
+	Name            string `json:"name,omitempty"`
+	Type            string `json:"type,omitempty"`
+	URL             string `json:"url,omitempty"`
+	FollowRedirects *bool  `json:"follow_redirects,omitempty"`
+	AcceptedStatus  string `json:"accepted_status,omitempty"`
+	ExpectBody      string `json:"expect_body,omitempty"`
+	ExpectRegex     string `json:"expect_regex,omitempty"`
+	// RejectBody marks the target down when the body contains any of
+	// these strings, for error pages served with a 200.
+	RejectBody []string `json:"reject_body,omitempty"`
+	// DetectChanges fetches the target with GET and records when the
+	// response body changes.
+	DetectChanges bool `json:"detect_changes,omitempty"`
+	// AuditHeaders records the response's security headers and flags
+	// regressions.
+	AuditHeaders bool `json:"audit_headers,omitempty"`
+
+	Headers     map[string]string `json:"headers,omitempty"`
+	Host        string            `json:"host,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	BearerToken string            `json:"bearer_token,omitempty"`
+	Cookies     map[string]string `json:"cookies,omitempty"`
+
+	// DualStack checks the target separately over IPv4 and IPv6.
+	DualStack bool `json:"dual_stack,omitempty"`
+
+	// ClientCert and ClientKey are PEM files with a client certificate and
+	// its key, presented to endpoints behind mutual TLS.
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+	// CAFile is a PEM bundle of root certificates trusted for this target
+	// as well as the system's, and InsecureSkipVerify accepts any
+	// certificate, such as a self-signed one.
+	CAFile             string `json:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+
+	// Proxy overrides Options.Proxy for this target.
+	Proxy string `json:"proxy,omitempty"`
+
+	// Service is the service name sent in gRPC health checks; empty asks
+	// about the server as a whole.
+	Service string `json:"service,omitempty"`
+	// StartTLS makes SMTP checks upgrade the connection with STARTTLS
+	// after EHLO.
+	StartTLS bool `json:"starttls,omitempty"`
+
+	// Ping makes WebSocket checks send a ping after the handshake and wait
+	// for the pong.
+	Ping bool `json:"ping,omitempty"`
+	// DNSSEC makes DNS checks require an answer the resolver validated.
+	DNSSEC bool `json:"dnssec,omitempty"`
+	// RecordType is the record type DNS checks ask for (default "A"), and
+	// ExpectRecords the values the answer must include.
+	RecordType    string   `json:"record_type,omitempty"`
+	ExpectRecords []string `json:"expect_records,omitempty"`
+	// MAC is the MAC address a presence target's device must have, or
+	// finds it by on its own.
+	MAC string `json:"mac,omitempty"`
+
+	// Confirmations is how many times a failed check is retried before
+	// the target is recorded as down, waiting RetryBackoff (default 1s)
+	// before the first retry and twice as long before each one after.
+	Confirmations int    `json:"confirmations,omitempty"`
+	RetryBackoff  string `json:"retry_backoff,omitempty"`
+
+	// Family limits the check to "ipv4" or "ipv6"; dual-stack targets are
+	// checked once with each.
+	Family string `json:"-"`
+
+	accepted     statusRanges
+	expectRegex  *regexp.Regexp
+	client       *http.Client
+	retryBackoff time.Duration
+	tlsConfig    *tls.Config
+	proxy        string
+	grpcURL      string
+	wsDialer     *websocket.Dialer
+	addr         string
+	implicitTLS  bool
+	dnsName      string
+	dnsType      uint16
+	mac          string
+}
+
+// Options are the defaults a target uses where it sets none itself.
+type Options struct {
+	// Proxy is the proxy URL checks go through; "direct" or empty uses none.
+	Proxy string
+	// CAFile is a PEM bundle of root certificates trusted as well as the
+	// system's.
+	CAFile string
+}
+
+type statusRange struct {
+	min, max int
+}
+
+type statusRanges []statusRange
+
+const defaultAcceptedStatus = "200-299"
+
+// parseStatusRanges parses a comma-separated list of status codes and
+// inclusive ranges, e.g. "200-299,301,302".
+func parseStatusRanges(s string) (statusRanges, error) {
+	var ranges statusRanges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi, isRange := strings.Cut(part, "-")
+		min, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", part)
+		}
+		max := min
+		if isRange {
+			max, err = strconv.Atoi(strings.TrimSpace(hi))
+			if err != nil {
+				return nil, fmt.Errorf("invalid status range %q", part)
+			}
+		}
+		if min < 100 || max > 599 || min > max {
+			return nil, fmt.Errorf("invalid status range %q", part)
+		}
+		ranges = append(ranges, statusRange{min: min, max: max})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no status codes in %q", s)
+	}
+	return ranges, nil
+}
+
+func (r statusRanges) contains(code int) bool {
+	for _, sr := range r {
+		if code >= sr.min && code <= sr.max {
+			return true
+		}
+	}
+	return false
+}
+
+// schemeTypes are the target types implied by URL schemes, so that targets
+// given only as a URL need no type.
+var schemeTypes = map[string]string{
+	"grpc": "grpc", "grpcs": "grpc",
+	"ws": "websocket", "wss": "websocket",
+	"smtp": "smtp", "smtps": "smtp",
+	"ssh":  "ssh",
+	"icmp": "icmp",
+	"dns":  "dns",
+	"quic": "quic",
+	"arp":  "presence",
+}
+
+// Init validates the target and prepares it to be probed, with o as
+// defaults.
+func (t *Target) Init(o Options) error {
+	if t.Type == "" {
+		scheme, _, _ := strings.Cut(t.URL, "://")
+		t.Type = schemeTypes[strings.ToLower(scheme)]
+		if t.URL == "" && t.MAC != "" {
+			t.Type = "presence"
+		}
+	}
+	t.proxy = cmp.Or(t.Proxy, o.Proxy)
+	if err := t.initConfirmations(); err != nil {
+		return err
+	}
+	if err := t.initTLS(o.CAFile); err != nil {
+		return err
+	}
+	switch t.Type {
+	case "", "http", "grpc", "websocket":
+	case "captive":
+		t.initCaptive()
+	case "smtp":
+		return t.initSMTP()
+	case "ssh":
+		return t.initSSH()
+	case "icmp":
+		return t.initICMP()
+	case "dns":
+		return t.initDNS()
+	case "quic":
+		return t.initQUIC()
+	case "presence":
+		return t.initPresence()
+	default:
+		return fmt.Errorf("target %s: unknown type %q", t.Name, t.Type)
+	}
+
+	if t.URL == "" {
+		return fmt.Errorf("target is missing a url")
+	}
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+
+	accepted := t.AcceptedStatus
+	if accepted == "" {
+		accepted = defaultAcceptedStatus
+	}
+	ranges, err := parseStatusRanges(accepted)
+	if err != nil {
+		return fmt.Errorf("target %s: %v", t.URL, err)
+	}
+	t.accepted = ranges
+
+	if t.ExpectRegex != "" {
+		re, err := regexp.Compile(t.ExpectRegex)
+		if err != nil {
+			return fmt.Errorf("target %s: invalid expect_regex: %v", t.URL, err)
+		}
+		t.expectRegex = re
+	}
+	if slices.Contains(t.RejectBody, "") {
+		return fmt.Errorf("target %s: reject_body can't contain an empty string", t.URL)
+	}
+
+	// Every check opens a fresh connection so DNS, connect, and TLS timings
+	// reflect the network path rather than a pooled connection.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.Proxy, err = ProxyFunc(t.proxy)
+	if err != nil {
+		return fmt.Errorf("target %s: %v", t.URL, err)
+	}
+	if t.tlsConfig != nil {
+		transport.TLSClientConfig = t.tlsConfig.Clone()
+	}
+	if t.Family != "" {
+		network := t.network()
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+
+	t.client = &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	switch t.Type {
+	case "grpc":
+		return t.initGRPC(transport)
+	case "websocket":
+		return t.initWebSocket(transport)
+	}
+	if t.FollowRedirects != nil && !*t.FollowRedirects {
+		t.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return nil
+}
+
+// defaultCaptiveURL answers 204 No Content; a captive portal intercepts it
+// with a redirect or a login page.
+const defaultCaptiveURL = "http://connectivity-check.gstatic.com/generate_204"
+
+// initCaptive sets the defaults for a captive portal target, which must see
+// redirects rather than follow them.
+func (t *Target) initCaptive() {
+	if t.URL == "" {
+		t.URL = defaultCaptiveURL
+	}
+	if t.Name == "" {
+		t.Name = "captive portal"
+	}
+	if t.AcceptedStatus == "" {
+		t.AcceptedStatus = "204"
+	}
+	noFollow := false
+	t.FollowRedirects = &noFollow
+}
+
+// network is the network to dial for the target's address family.
+func (t *Target) network() string {
+	switch t.Family {
+	case "ipv4":
+		return "tcp4"
+	case "ipv6":
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// dial connects to addr for checks that speak TCP themselves, such as SSH
+// and SMTP, through the target's SOCKS5 proxy, if it
+// has one.
+func (t *Target) dial(ctx context.Context, addr string) (net.Conn, error) {
+	if proxy := socksProxy(t.proxy); proxy != nil {
+		return dialSOCKS(ctx, proxy, addr)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, t.network(), addr)
+}
+
+// parseTargetAddr parses a URL such as smtp://mail.example.com and returns
+// its scheme and host:port, using the scheme's default port if it has none.
+func parseTargetAddr(rawURL string, defaultPorts map[string]string) (scheme, addr string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid url %q", rawURL)
+	}
+	port, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// newRequest builds a request for the target with its configured headers,
+// host override, and credentials applied.
+func (t *Target) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.UserAgent != "" {
+		req.Header.Set("User-Agent", t.UserAgent)
+	}
+	if t.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+t.BearerToken)
+	}
+	for name, value := range t.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	if t.Host != "" {
+		req.Host = t.Host
+	}
+	return req, nil
+}
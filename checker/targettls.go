@@ -0,0 +1,78 @@
+package checker
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// initTLS builds the TLS configuration the target's checks use when it
+// needs more than the defaults: a client certificate, for endpoints behind
+// mutual TLS; roots from caFile (Options.CAFile) or the target's ca_file,
+// trusted alongside the system's; or insecure_skip_verify. The files are
+// read again each time the target is initialized, so a renewed certificate
+// is picked up when it is.
+func (t *Target) initTLS(caFile string) error {
+	name := cmp.Or(t.Name, t.URL)
+	if t.ClientCert == "" && t.ClientKey == "" && caFile == "" && t.CAFile == "" && !t.InsecureSkipVerify {
+		return nil
+	}
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		if t.ClientCert == "" || t.ClientKey == "" {
+			return fmt.Errorf("target %s: client_cert and client_key must be set together", name)
+		}
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return fmt.Errorf("target %s: invalid client certificate: %v", name, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" || t.CAFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		for _, path := range []string{caFile, t.CAFile} {
+			if path == "" {
+				continue
+			}
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("target %s: failed to read CA file: %v", name, err)
+			}
+			if !roots.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("target %s: no certificates in CA file %s", name, path)
+			}
+		}
+		config.RootCAs = roots
+	}
+	t.tlsConfig = config
+	return nil
+}
+
+// requestFailure tells apart the ways an HTTP request can fail before a
+// response: "resolution" when the name didn't resolve, "tls" when the TLS
+// handshake failed (including the server rejecting the client
+// certificate), and "connection" for everything else, such as a refused or
+// timed out connection.
+func requestFailure(err error) string {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &dnsErr):
+		return "resolution"
+	// TLS alerts from the server, such as one rejecting the client
+	// certificate, come back as a "remote error".
+	case errors.As(err, &opErr) && opErr.Op == "remote error",
+		errors.As(err, &verifyErr), errors.As(err, &recordErr):
+		return "tls"
+	}
+	return "connection"
+}
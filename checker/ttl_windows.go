@@ -0,0 +1,28 @@
+//go:build windows
+
+package checker
+
+import (
+	"net"
+	"syscall"
+)
+
+// setTTL sets the TTL (hop limit for IPv6) of packets sent on c.
+func setTTL(c *net.IPConn, v6 bool, ttl int) error {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		if v6 {
+			serr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+		} else {
+			serr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,93 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// errPong stops the read loop in pingWebSocket once the pong arrives.
+var errPong = errors.New("pong received")
+
+// initWebSocket configures a target with a ws:// or wss:// URL, dialing
+// through the same proxy and address family as HTTP targets.
+func (t *Target) initWebSocket(transport *http.Transport) error {
+	u, err := url.Parse(t.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "ws" && u.Scheme != "wss") {
+		return fmt.Errorf("target %s: WebSocket targets need a ws:// or wss:// url", t.URL)
+	}
+	t.wsDialer = &websocket.Dialer{
+		Proxy:            transport.Proxy,
+		NetDialContext:   transport.DialContext,
+		TLSClientConfig:  transport.TLSClientConfig,
+		HandshakeTimeout: 30 * time.Second,
+	}
+	return nil
+}
+
+// checkWebSocket opens a WebSocket connection to the target and, with
+// ping set, waits for a pong. The target is up if the upgrade succeeds.
+func checkWebSocket(t *Target) Result {
+	status := "down"
+	start := time.Now()
+	var phases PhaseTimings
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := t.newRequest(http.MethodGet, t.URL, nil)
+	if err == nil {
+		header := req.Header
+		if t.Host != "" {
+			header.Set("Host", t.Host)
+		}
+		var conn *websocket.Conn
+		conn, _, err = t.wsDialer.DialContext(tracePhases(ctx, start, &phases), t.URL, header)
+		if err == nil {
+			deadline, _ := ctx.Deadline()
+			if t.Ping {
+				err = pingWebSocket(conn, deadline)
+			}
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+			conn.Close()
+		}
+	}
+	latency := time.Since(start).Milliseconds()
+	if err == nil {
+		status = "up"
+	} else {
+		slog.Debug("WebSocket check failed", "target", t.Name, "error", err)
+	}
+
+	return Result{
+		Timestamp:    time.Now(),
+		Target:       t.Name,
+		Family:       t.Family,
+		Status:       status,
+		LatencyMs:    latency,
+		PhaseTimings: phases,
+	}
+}
+
+// pingWebSocket sends a ping and reads until the pong arrives, discarding
+// any messages the server sends in the meantime.
+func pingWebSocket(conn *websocket.Conn, deadline time.Time) error {
+	conn.SetPongHandler(func(string) error { return errPong })
+	if err := conn.WriteControl(websocket.PingMessage, []byte("up"), deadline); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(deadline)
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			if err == errPong {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package up
+
+import (
+	"log/slog"
+	"time"
+
+	"up/checker"
+)
+
+// classifyIncidents works out where each open outage is by comparing the
+// target with the other targets checked from the same probe over the
+// outage so far:
+//
+//   - lan: the gateway was down too, so the problem is on the local network.
+//   - isp: every internet target (including resolvers) was down, so the
+//     connection itself is out.
+//   - remote: another internet target stayed up, so only the service is.
+//   - captive_portal: a target saw a captive portal (see checkHTTP), so
+//     the network wants a login or terms accepted before letting traffic
+//     through.
+//
+// Incidents with too little to compare against are left unclassified.
+func classifyIncidents() {
+	incidentMu.Lock()
+	open := make(map[int64]probeTarget, len(openIncidents))
+	for key, id := range openIncidents {
+		open[id] = key
+	}
+	incidentMu.Unlock()
+	if len(open) == 0 {
+		return
+	}
+
+	roles := map[string]string{}
+	for _, t := range currentTargets() {
+		// Push targets aren't checked from here, so say nothing about
+		// this end's connection.
+		if t.Type != "push" {
+			roles[t.Name] = t.Role
+		}
+	}
+	for id, key := range open {
+		class, err := classifyIncident(id, key, roles)
+		if err != nil {
+			slog.Error("Failed to classify incident", "incident", id, "error", err)
+			continue
+		}
+		if _, err := db.Exec(`UPDATE incidents SET classification = ? WHERE id = ?`, class, id); err != nil {
+			slog.Error("Failed to classify incident", "incident", id, "error", err)
+		}
+	}
+}
+
+func classifyIncident(id int64, key probeTarget, roles map[string]string) (string, error) {
+	if roles[key.target] == "gateway" {
+		return "lan", nil
+	}
+	var start time.Time
+	if err := db.QueryRow(`SELECT start_time FROM incidents WHERE id = ?`, id).Scan(&start); err != nil {
+		return "", err
+	}
+
+	// A target counts as down if it failed at least half its checks since
+	// the incident started.
+	rows, err := db.Query(`SELECT target, SUM(NOT `+checker.AnsweredSQL+`) * 2 >= COUNT(*), MAX(status = 'captive') FROM checks
+		WHERE probe = ? AND timestamp >= ? AND maintenance = 0 GROUP BY target`, key.probe, start)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var gatewayDown, othersUp, portal bool
+	others := 0
+	for rows.Next() {
+		var target string
+		var down, captive bool
+		if err := rows.Scan(&target, &down, &captive); err != nil {
+			return "", err
+		}
+		portal = portal || captive
+		role, known := roles[target]
+		switch {
+		case !known || target == key.target:
+		case role == "gateway":
+			gatewayDown = gatewayDown || down
+		default:
+			others++
+			othersUp = othersUp || !down
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case portal:
+		return "captive_portal", nil
+	case gatewayDown:
+		return "lan", nil
+	case othersUp:
+		return "remote", nil
+	case others > 0:
+		return "isp", nil
+	}
+	return "", nil
+}
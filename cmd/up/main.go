@@ -0,0 +1,13 @@
+// Command up monitors the uptime and latency of network targets and the
+// speed of the connection, and serves the results.
+package main
+
+import (
+	"os"
+
+	"up"
+)
+
+func main() {
+	os.Exit(up.Main(os.Args[1:]))
+}
@@ -0,0 +1,627 @@
+package up
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"up/checker"
+	"up/store"
+)
+
+// commonOptions holds the flags shared by commands that load targets and
+// open the database.
+type commonOptions struct {
+	configPath string
+	targets    string
+	logLevel   string
+	logFormat  string
+}
+
+func (c *Config) addCommonFlags(fs *flag.FlagSet) *commonOptions {
+	o := &commonOptions{}
+	fs.StringVar(&o.targets, "targets", "https://1.1.1.1,https://google.com,https://github.com", "Comma-separated list of URLs to monitor")
+	fs.StringVar(&o.configPath, "config", "", "Path to a JSON config file with per-target options (overrides -targets)")
+	fs.BoolVar(&c.DualStack, "dual-stack", false, "Check every target separately over IPv4 and IPv6")
+	fs.StringVar(&o.logLevel, "log-level", "info", "Log level: debug, info, warn, or error")
+	fs.StringVar(&o.logFormat, "log-format", "text", "Log format: text or json")
+	fs.StringVar(&c.DBPath, "db", "uptime.db", "Path to SQLite database file")
+	fs.StringVar(&c.DBKey, "db-key", "", "Key to encrypt the database with SQLCipher; prefer UP_DB_KEY or -db-key-file to keep it out of the process list")
+	fs.StringVar(&c.DBKeyFile, "db-key-file", "", "File holding the database encryption key, instead of -db-key")
+	fs.StringVar(&c.CAFile, "ca-file", "", "PEM file of extra root certificates to trust when checking targets, e.g. a private CA's")
+	c.addTimezoneFlag(fs)
+	return o
+}
+
+// setup configures logging and loads targets, maintenance windows, and
+// speed test providers into the package globals.
+func (o *commonOptions) setup(cfg *Config) error {
+	if err := setupLogger(o.logLevel, o.logFormat); err != nil {
+		return err
+	}
+	if _, err := checker.ProxyFunc(cfg.ProxyURL); err != nil {
+		return err
+	}
+
+	fc, err := o.load(cfg)
+	if err != nil {
+		return err
+	}
+	targets, maintenanceWindows, speedTestProviders = fc.Targets, fc.Maintenance, fc.SpeedTestProviders
+	alertRules, messageTemplates = fc.Alerts, fc.Templates
+	retentionPolicies = fc.Retention
+	snmpDevices = fc.SNMP
+	dnsResolvers = fc.Resolvers
+	return nil
+}
+
+// load reads and validates the targets, maintenance windows, speed test
+// providers, alert rules, and message templates from -config, or the targets from -targets.
+func (o *commonOptions) load(cfg *Config) (*fileConfig, error) {
+	fc := &fileConfig{}
+	if o.configPath != "" {
+		var err error
+		if fc, err = loadConfig(o.configPath); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, t := range strings.Split(o.targets, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				fc.Targets = append(fc.Targets, targetConfig{Target: checker.Target{URL: t}})
+			}
+		}
+	}
+
+	ts, err := prepareTargets(fc.Targets, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target: %v", err)
+	}
+	if cfg.MonitorGateway {
+		ts = addGatewayTarget(ts, cfg)
+	}
+	fc.Targets = ts
+	for i := range fc.Maintenance {
+		if err := fc.Maintenance[i].init(cfg.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	for i := range fc.SpeedTestProviders {
+		if err := fc.SpeedTestProviders[i].init(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range fc.Alerts {
+		if err := fc.Alerts[i].init(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range fc.Retention {
+		if err := fc.Retention[i].init(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range fc.SNMP {
+		if err := fc.SNMP[i].init(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range fc.Resolvers {
+		if err := fc.Resolvers[i].init(); err != nil {
+			return nil, err
+		}
+	}
+	for name, t := range fc.Templates {
+		if err := t.init(name); err != nil {
+			return nil, err
+		}
+		fc.Templates[name] = t
+	}
+	return fc, nil
+}
+
+// addSpeedTestFlags registers the speed test flags.
+func (c *Config) addSpeedTestFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.SpeedTestDownloadURL, "speedtest-download-url", "https://speed.cloudflare.com/__down?bytes={bytes}", "Speed test download URL; {bytes} is replaced with -speedtest-bytes")
+	fs.StringVar(&c.SpeedTestUploadURL, "speedtest-upload-url", "https://speed.cloudflare.com/__up?uploadId={id}", "Speed test upload URL; {id} is replaced with a random upload ID")
+	fs.Int64Var(&c.SpeedTestBytes, "speedtest-bytes", 25_000_000, "Size of file to download for speed test in bytes")
+	fs.Int64Var(&c.SpeedTestUploadBytes, "speedtest-upload-bytes", 10<<20, "Size of the payload uploaded for speed test in bytes")
+	fs.StringVar(&c.ProbeURL, "probe-url", "https://1.1.1.1", "URL probed during speed tests to measure latency, jitter, and packet loss")
+	fs.IntVar(&c.ProbeCount, "probe-count", 20, "Number of probes sent per speed test for jitter and packet loss")
+	fs.Var(&c.SpeedTestBudget, "speedtest-budget", "Monthly data cap for speed tests, e.g. 20GB; tests are skipped once it is used (default unlimited)")
+	fs.StringVar(&c.SpeedTestProvider, "speedtest-provider", "cloudflare", "Provider name recorded for the -speedtest-*-url endpoints")
+}
+
+// setupSpeedTestProviders falls back to a single provider built from the
+// -speedtest-* flags when the config file doesn't list any.
+func setupSpeedTestProviders(cfg *Config) {
+	if len(speedTestProviders) > 0 {
+		return
+	}
+	speedTestProviders = []speedTestProvider{{
+		Name:        cfg.SpeedTestProvider,
+		DownloadURL: cfg.SpeedTestDownloadURL,
+		UploadURL:   cfg.SpeedTestUploadURL,
+	}}
+}
+
+func openDB(cfg *Config) error {
+	key := cfg.DBKey
+	if cfg.DBKeyFile != "" {
+		b, err := os.ReadFile(cfg.DBKeyFile)
+		if err != nil {
+			return err
+		}
+		if key = strings.TrimSpace(string(b)); key == "" {
+			return fmt.Errorf("%s is empty", cfg.DBKeyFile)
+		}
+	}
+	var err error
+	if cfg.ReadOnly {
+		db, err = store.OpenReadOnly(cfg.DBPath, key)
+		return err
+	}
+	if cfg.NoDB {
+		if cfg.DBPath, err = tempDBPath(); err != nil {
+			return err
+		}
+		key = ""
+	}
+	db, err = store.Open(cfg.DBPath, key)
+	return err
+}
+
+// runCheckCommand implements `up check [flags] [url...]`: it checks each
+// target once, prints the results, and returns a non-zero exit code if any
+// target is down (but not if it is only degraded). It never touches the
+// database.
+func runCheckCommand(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	cfg := Config{Timezone: time.Local}
+	configPath := fs.String("config", "", "Path to a JSON config file whose targets are checked")
+	fs.BoolVar(&cfg.DualStack, "dual-stack", false, "Check every target separately over IPv4 and IPv6")
+	asJSON := fs.Bool("json", false, "Print results as JSON")
+	fs.Int64Var(&cfg.LatencyThreshold, "latency-threshold", 250, "Latency in milliseconds above which a successful check is reported as degraded rather than up")
+	fs.StringVar(&cfg.ProxyURL, "proxy", "", "Proxy URL for checks (default: HTTP_PROXY/HTTPS_PROXY from the environment)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: up check [flags] [url...]\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var ts []targetConfig
+	if *configPath != "" {
+		fc, err := loadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		ts = fc.Targets
+	}
+	for _, u := range fs.Args() {
+		ts = append(ts, targetConfig{Target: checker.Target{URL: u}})
+	}
+	if len(ts) == 0 {
+		fs.Usage()
+		return 2
+	}
+	if cfg.LatencyThreshold <= 0 {
+		fmt.Fprintln(os.Stderr, "-latency-threshold must be positive")
+		return 2
+	}
+
+	ts, err := prepareTargets(ts, &cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	exit := 0
+	var results []checker.Result
+	for i := range ts {
+		// Push targets only have state inside a running server.
+		if ts[i].Type == "push" {
+			continue
+		}
+		r := checkTarget(&cfg, &ts[i], time.Sleep)
+		ms := cfg.LatencyThreshold
+		if ts[i].latencyThreshold > 0 {
+			ms = ts[i].latencyThreshold.Milliseconds()
+		}
+		markDegraded(&r, ms)
+		if !checker.Answered(r.Status) {
+			exit = 1
+		}
+		if *asJSON {
+			results = append(results, r)
+			continue
+		}
+		fmt.Printf("%-8s %6dms  %s\n", r.Status, r.LatencyMs, r.Target)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+	}
+	return exit
+}
+
+// runReportCommand implements `up report`, writing a standalone uptime,
+// latency, and speed test report as JSON, Markdown, or HTML.
+func runReportCommand(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	period := fs.String("period", "daily", "Breakdown period: daily, weekly, or monthly")
+	target := fs.String("target", "", "Only report on this target")
+	fromStr := fs.String("from", "", "Start of the report (RFC 3339 or YYYY-MM-DD)")
+	toStr := fs.String("to", "", "End of the report (RFC 3339 or YYYY-MM-DD)")
+	format := fs.String("format", "md", "Output format: md, html, or json")
+	output := fs.String("o", "", "Write the report to this file instead of stdout")
+	cfg.addPlanFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := cfg.checkPlan(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !validPeriod(*period) {
+		fmt.Fprintln(os.Stderr, "period must be daily, weekly, or monthly")
+		return 2
+	}
+	from, to, err := parseRange(*period, *fromStr, *toStr, cfg.Timezone)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := openDB(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	names := targetNames()
+	if *target != "" {
+		names = []string{*target}
+	}
+	doc, err := buildReportDocument(db, &cfg, names, *period, from, to, cfg.Timezone)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := doc.write(w, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// parseRange resolves optional from/to strings, defaulting to the period's
+// default report range, with days beginning at midnight in loc.
+func parseRange(period, fromStr, toStr string, loc *time.Location) (time.Time, time.Time, error) {
+	from, to := defaultReportRange(period, time.Now(), loc)
+	if fromStr != "" {
+		t, err := parseTimeParam(fromStr, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from %q", fromStr)
+		}
+		from = t
+	}
+	if toStr != "" {
+		t, err := parseTimeParam(toStr, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to %q", toStr)
+		}
+		to = t
+	}
+	return from, to, nil
+}
+
+// runPruneCommand implements `up prune`, deleting old data immediately.
+func runPruneCommand(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	cfg.addRetentionFlags(fs)
+	fs.StringVar(&cfg.VacuumMode, "vacuum", "none", "Reclaim disk space after pruning: none, incremental, or full")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := cfg.validateRetention(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := cfg.checkVacuumMode(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := openDB(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	pruned, err := pruneOnce(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Pruned %d checks and %d speed tests\n", pruned["checks"], pruned["speedtests"])
+	if _, err := enforceSizeQuota(cfg.MaxDBSize); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := vacuumDB(cfg.VacuumMode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runMigrateCommand implements `up migrate`, which applies the pending
+// schema migrations, or with -dry-run lists them. up serve applies them at
+// startup anyway; this is for seeing what an upgrade will change first, or
+// migrating a large database ahead of a restart.
+func runMigrateCommand(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "List the pending migrations without applying them")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if _, err := os.Stat(cfg.DBPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// Look before changing anything.
+	look := cfg
+	look.ReadOnly = true
+	if err := openDB(&look); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	version, err := store.AppliedVersion(db)
+	if err != nil {
+		db.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	pending, err := store.Pending(db)
+	db.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Schema version %d, latest %d\n", version, store.Version())
+	if len(pending) == 0 {
+		fmt.Println("Nothing to migrate")
+		return 0
+	}
+	for _, m := range pending {
+		fmt.Printf("  %d  %s\n", m.Version, m.Description)
+	}
+	if *dryRun {
+		fmt.Printf("%d migrations pending\n", len(pending))
+		return 0
+	}
+
+	if err := openDB(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	fmt.Printf("Applied %d migrations\n", len(pending))
+	return 0
+}
+
+// exportColumns lists the exported columns of each table, in output order.
+var exportColumns = map[string][]string{
+	"checks":     {"timestamp", "target", "status", "latency_ms", "maintenance", "family", "probe", "dns_ms", "connect_ms", "tls_ms", "ttfb_ms"},
+	"speedtests": {"timestamp", "provider", "download_mbps", "download_peak_mbps", "upload_mbps", "latency_ms", "loaded_latency_ms", "jitter_ms", "packet_loss_pct"},
+}
+
+// runExportCommand implements `up export`, writing a table as CSV or JSON
+// to stdout.
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	table := fs.String("table", "checks", "Table to export: checks or speedtests")
+	format := fs.String("format", "csv", "Output format: csv or json")
+	fromStr := fs.String("from", "", "Only export rows at or after this time (RFC 3339 or YYYY-MM-DD)")
+	toStr := fs.String("to", "", "Only export rows before this time (RFC 3339 or YYYY-MM-DD)")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	columns, ok := exportColumns[*table]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown table %q\n", *table)
+		return 2
+	}
+
+	from, to := time.Time{}, time.Now().AddDate(100, 0, 0)
+	if *fromStr != "" || *toStr != "" {
+		var err error
+		if from, to, err = parseRange("daily", *fromStr, *toStr, cfg.Timezone); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if *fromStr == "" {
+			from = time.Time{}
+		}
+	}
+
+	if err := openDB(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := exportTable(os.Stdout, *table, columns, *format, from, to); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func exportTable(w io.Writer, table string, columns []string, format string, from, to time.Time) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT %s FROM %s WHERE timestamp >= ? AND timestamp < ? ORDER BY timestamp`,
+		strings.Join(columns, ", "), table), from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	var cw *csv.Writer
+	if format == "csv" {
+		cw = csv.NewWriter(w)
+		cw.Write(columns)
+	} else {
+		io.WriteString(w, "[")
+	}
+
+	first := true
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		if cw != nil {
+			record := make([]string, len(values))
+			for i, v := range values {
+				record[i] = formatExportValue(v)
+			}
+			cw.Write(record)
+			continue
+		}
+		row := make(map[string]any, len(columns))
+		for i, c := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[c] = string(b)
+			} else {
+				row[c] = values[i]
+			}
+		}
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if !first {
+			io.WriteString(w, ",")
+		}
+		first = false
+		io.WriteString(w, "\n  ")
+		w.Write(data)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if cw != nil {
+		cw.Flush()
+		return cw.Error()
+	}
+	_, err = io.WriteString(w, "\n]\n")
+	return err
+}
+
+func formatExportValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	case []string:
+		return strings.Join(v, "; ")
+	}
+	return fmt.Sprint(v)
+}
+
+// runSpeedTestCommand implements `up speedtest`, running one speed test
+// against every provider and storing the results.
+func runSpeedTestCommand(args []string) int {
+	fs := flag.NewFlagSet("speedtest", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	cfg.addSpeedTestFlags(fs)
+	fs.StringVar(&cfg.ProxyURL, "proxy", "", "Proxy URL for speed tests (default: HTTP_PROXY/HTTPS_PROXY from the environment)")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	setupSpeedTestProviders(&cfg)
+
+	if err := openDB(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := runSpeedTest(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
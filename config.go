@@ -0,0 +1,303 @@
+package up
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Config holds the settings of the monitor. It is filled in from flags (or
+// the config file's settings), validated, and then passed to the server,
+// the check loop, and the pruner.
+type Config struct {
+	CheckInterval time.Duration
+	// CheckConcurrency is how many checks run at once.
+	CheckConcurrency int
+	// Splay is the largest random offset applied to each target's check
+	// schedule.
+	Splay             time.Duration
+	SpeedTestInterval time.Duration
+	// SpeedTestSchedule is a cron expression that replaces
+	// SpeedTestInterval when set.
+	SpeedTestSchedule string
+	// LatencyThreshold is the latency in milliseconds above which a
+	// successful check is degraded rather than up.
+	LatencyThreshold int64
+	// ApdexThreshold is the Apdex target latency in milliseconds: checks at
+	// or under it are satisfied, and those up to ApdexFrustrated (default
+	// four times as long) tolerating.
+	ApdexThreshold  int64
+	ApdexFrustrated int64
+	// Recent is the window the dashboard and summaries cover.
+	Recent time.Duration
+
+	Retention time.Duration
+	// SpeedTestRetention defaults to Retention when zero.
+	SpeedTestRetention time.Duration
+	PruneInterval      time.Duration
+
+	// ProbeName names this vantage point in the checks it records, e.g.
+	// "home" or "vps". Agents report their own.
+	ProbeName string
+	// DualStack checks every target separately over IPv4 and IPv6,
+	// including those added through the API.
+	DualStack bool
+	// CAFile is a PEM bundle of extra root certificates trusted for every
+	// target, for internal services with a private CA.
+	CAFile string
+	// ProxyURL is the proxy for checks and speed tests. When empty,
+	// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY from the environment are
+	// honored instead.
+	ProxyURL       string
+	MonitorGateway bool
+	// TraceOnFailure traces the path to a target when it goes down.
+	TraceOnFailure bool
+	// AdaptiveThresholds learns each target's latency threshold from its
+	// history instead of using LatencyThreshold.
+	AdaptiveThresholds bool
+	// Timezone is the zone whose days reports, the status page,
+	// maintenance windows, cron schedules, and the speed test budget's
+	// months follow. Times are stored in UTC regardless.
+	Timezone *time.Location
+
+	DBPath    string
+	DBKey     string
+	DBKeyFile string
+	// ReadOnly serves an existing database without checking targets,
+	// running speed tests, pruning, or writing to it.
+	ReadOnly bool
+	// NoDB doesn't store check results; the rest of what up keeps, such as
+	// incidents and speed tests, goes to a temporary database that is
+	// removed on exit.
+	NoDB bool
+	// OutputFormat is "ndjson" to also write each check result to stdout.
+	OutputFormat string
+	// Check results are written in batches of up to WriteBatchSize, at
+	// least every WriteInterval (or each as it comes when that is zero).
+	WriteBatchSize int
+	WriteInterval  time.Duration
+	// VacuumMode is "none", "incremental", or "full".
+	VacuumMode string
+	// MaxDBSize is a quota on the database; zero means none.
+	MaxDBSize      byteSize
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+
+	// APIToken is the bearer token required by the management API, which
+	// is disabled when it is empty. AgentToken is the same for /ingest.
+	APIToken   string
+	AgentToken string
+	// CORSOrigins are the origins allowed to call the API from a browser;
+	// "*" allows any. Empty disables CORS.
+	CORSOrigins []string
+	CORSMethods string
+	// RateLimit is the limit on data endpoint requests per second from
+	// each client IP; zero disables it. RateBurst is how many requests a
+	// client may make at once before being limited.
+	RateLimit       float64
+	RateBurst       int
+	StatusPageTitle string
+	// DashboardURL is the public address of the dashboard, linked from
+	// alerts when set.
+	DashboardURL string
+	// BlackboxAnyTarget lets /probe check targets that aren't configured.
+	BlackboxAnyTarget bool
+
+	AlertDownAfter int
+	AlertUpAfter   int
+	FlapWindow     time.Duration
+	FlapThreshold  int
+	// Latency anomaly detection is off when AnomalyThreshold is zero.
+	AnomalyThreshold float64
+	AnomalyWindow    time.Duration
+	AnomalyBaseline  time.Duration
+
+	DiscordWebhook       string
+	PagerDutyRoutingKey  string
+	PagerDutySeverity    string
+	NtfyURL              string
+	NtfyTopic            string
+	NtfyToken            string
+	PushoverToken        string
+	PushoverUser         string
+	PushoverDownPriority int
+	PushoverUpPriority   int
+	MatrixHomeserver     string
+	MatrixToken          string
+	MatrixRoom           string
+	TwilioAccountSID     string
+	TwilioAuthToken      string
+	TwilioFrom           string
+	// TwilioTo is a comma-separated list of phone numbers to text alerts
+	// to.
+	TwilioTo string
+	// SMTPAddr is the host:port of the mail server alerts and digests are
+	// sent through.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// SMTPTo is a comma-separated list of addresses to send alerts to.
+	SMTPTo string
+	// DigestPeriod is "weekly" or "monthly" to email a digest at the start
+	// of each week or month, or empty for none. DigestTo defaults to
+	// SMTPTo.
+	DigestPeriod string
+	DigestTo     string
+
+	// PathInterval is how often to measure the path to every target; zero
+	// disables it.
+	PathInterval     time.Duration
+	ResolverInterval time.Duration
+	ResolverNames    string
+	// DiscoverInterval is how often to look for devices on the local
+	// network (zero disables it); DiscoverAdd monitors them as soon as
+	// they are first seen.
+	DiscoverInterval    time.Duration
+	DiscoverAdd         bool
+	Kubernetes          bool
+	KubernetesAPI       string
+	KubernetesNamespace string
+	Docker              bool
+	DockerHost          string
+	// NTP monitoring is off without NTPServers, and domain expiry
+	// monitoring without DomainNames.
+	NTPServers        string
+	NTPInterval       time.Duration
+	DomainNames       string
+	DomainInterval    time.Duration
+	DomainWarningDays int
+	RDAPServer        string
+
+	InfluxURL              string
+	InfluxOrg              string
+	InfluxBucket           string
+	InfluxToken            string
+	RemoteWriteURL         string
+	RemoteWriteUser        string
+	RemoteWritePassword    string
+	RemoteWriteToken       string
+	StatsDAddr             string
+	StatsDPrefix           string
+	StatsDDogStatsD        bool
+	SyslogURL              string
+	SyslogFacility         string
+	MQTTURL                string
+	MQTTTopic              string
+	MQTTClientID           string
+	HomeAssistant          bool
+	HomeAssistantDiscovery string
+	// OTel exports traces and metrics over OTLP/HTTP.
+	OTel bool
+
+	// SpeedTestProvider names the provider made from SpeedTestDownloadURL
+	// and SpeedTestUploadURL when the config file doesn't list any.
+	SpeedTestProvider    string
+	SpeedTestDownloadURL string
+	SpeedTestUploadURL   string
+	SpeedTestBytes       int64
+	SpeedTestUploadBytes int64
+	ProbeURL             string
+	ProbeCount           int
+	// SpeedTestBudget caps the data speed tests may use each calendar
+	// month; zero means unlimited.
+	SpeedTestBudget byteSize
+	// The advertised speeds of the internet plan, which speed tests are
+	// compared against, and the share of them a test must reach to meet
+	// the SLA.
+	PlanDownloadMbps float64
+	PlanUploadMbps   float64
+	PlanSLAPct       float64
+
+	// SimulateProfile is a profile to generate check and speed test
+	// results from, and SimulateReplay a database whose checks and speed
+	// tests are replayed SimulateSpeed times faster, instead of running
+	// any.
+	SimulateProfile string
+	SimulateReplay  string
+	SimulateSpeed   float64
+
+	speedTestCron *cronSchedule
+	// simulation is the parsed SimulateProfile, or nil when checks and
+	// speed tests are real.
+	simulation *simProfile
+}
+
+// addRetentionFlags adds the flags shared by serve and prune.
+func (c *Config) addRetentionFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Retention, "retention", 90*24*time.Hour, "How long to retain data")
+	fs.DurationVar(&c.SpeedTestRetention, "speedtest-retention", 0, "How long to retain speed test results (default: -retention)")
+	fs.Var(&c.MaxDBSize, "max-db-size", "Quota on the database's size, e.g. 500MB; the oldest data is aged out to stay under it (default unlimited)")
+}
+
+func (c *Config) speedTestRetention() time.Duration {
+	if c.SpeedTestRetention == 0 {
+		return c.Retention
+	}
+	return c.SpeedTestRetention
+}
+
+func (c *Config) apdexFrustrated() int64 {
+	if c.ApdexFrustrated == 0 {
+		return 4 * c.ApdexThreshold
+	}
+	return c.ApdexFrustrated
+}
+
+func (c *Config) validateRetention() error {
+	if c.Retention <= 0 {
+		return fmt.Errorf("-retention must be positive")
+	}
+	if c.SpeedTestRetention < 0 {
+		return fmt.Errorf("-speedtest-retention must not be negative")
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	for _, d := range []struct {
+		flag  string
+		value time.Duration
+	}{
+		{"-interval", c.CheckInterval},
+		{"-speedtest-interval", c.SpeedTestInterval},
+		{"-prune-interval", c.PruneInterval},
+		{"-recent", c.Recent},
+	} {
+		if d.value <= 0 {
+			return fmt.Errorf("%s must be positive", d.flag)
+		}
+	}
+	if c.Splay < 0 {
+		return fmt.Errorf("-splay must not be negative")
+	}
+	if c.CheckConcurrency < 1 {
+		return fmt.Errorf("-check-concurrency must be at least 1")
+	}
+	if c.LatencyThreshold <= 0 {
+		return fmt.Errorf("-latency-threshold must be positive")
+	}
+	if c.ApdexThreshold <= 0 {
+		return fmt.Errorf("-apdex-threshold must be positive")
+	}
+	if c.ApdexFrustrated != 0 && c.ApdexFrustrated < c.ApdexThreshold {
+		return fmt.Errorf("-apdex-frustrated must not be less than -apdex-threshold")
+	}
+	if c.SpeedTestSchedule != "" {
+		cron, err := parseCron(c.SpeedTestSchedule, c.Timezone)
+		if err != nil {
+			return fmt.Errorf("-speedtest-schedule: %v", err)
+		}
+		c.speedTestCron = cron
+	}
+	if c.BackupDir != "" {
+		if c.BackupInterval <= 0 {
+			return fmt.Errorf("-backup-interval must be positive")
+		}
+		if c.BackupKeep < 1 {
+			return fmt.Errorf("-backup-keep must be at least 1")
+		}
+	}
+	return c.validateRetention()
+}
@@ -0,0 +1,49 @@
+package up
+
+import (
+	"testing"
+	"time"
+)
+
+// testConfig returns a Config that passes validate.
+func testConfig() Config {
+	return Config{
+		CheckInterval:     time.Minute,
+		CheckConcurrency:  2,
+		SpeedTestInterval: time.Hour,
+		LatencyThreshold:  1000,
+		ApdexThreshold:    500,
+		Recent:            time.Hour,
+		Retention:         24 * time.Hour,
+		PruneInterval:     time.Hour,
+		BackupInterval:    24 * time.Hour,
+		BackupKeep:        7,
+	}
+}
+
+func TestValidateBackups(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		interval time.Duration
+		keep     int
+		wantErr  bool
+	}{
+		{"defaults", "backups", 24 * time.Hour, 7, false},
+		{"keep one", "backups", time.Hour, 1, false},
+		{"zero interval", "backups", 0, 7, true},
+		{"negative interval", "backups", -time.Hour, 7, true},
+		{"keep none", "backups", time.Hour, 0, true},
+		{"negative keep", "backups", time.Hour, -1, true},
+		{"disabled", "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.BackupDir, cfg.BackupInterval, cfg.BackupKeep = tt.dir, tt.interval, tt.keep
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
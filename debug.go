@@ -0,0 +1,50 @@
+package up
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync/atomic"
+)
+
+// checksInFlight counts target checks that have started but not finished.
+var checksInFlight atomic.Int64
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("checks_in_flight", expvar.Func(func() any {
+		return checksInFlight.Load()
+	}))
+	expvar.Publish("targets", expvar.Func(func() any {
+		return len(currentTargets())
+	}))
+	expvar.Publish("db", expvar.Func(func() any {
+		if db == nil {
+			return nil
+		}
+		return db.Stats()
+	}))
+}
+
+// startDebugServer serves pprof and expvar on a separate listener so they
+// are never exposed on the dashboard port.
+func startDebugServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	go func() {
+		slog.Info("Starting debug server", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
+			slog.Error("Debug server error", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,296 @@
+package up
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"up/checker"
+)
+
+// digestHour is the hour of the day, in -timezone, digests are sent at.
+const digestHour = 8
+
+// digestIncidents is how many of the longest incidents a digest lists.
+const digestIncidents = 5
+
+func (c *Config) addDigestFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.DigestTo, "digest-to", "", "Comma-separated addresses to email the digest to (default -smtp-to)")
+}
+
+func validDigestPeriod(period string) bool {
+	return period == "weekly" || period == "monthly"
+}
+
+// checkDigestSettings checks that a digest can be emailed.
+func (c *Config) checkDigestSettings() error {
+	if len(c.digestRecipients()) == 0 {
+		return fmt.Errorf("the digest needs -digest-to or -smtp-to")
+	}
+	return c.checkEmailSettings()
+}
+
+func (c *Config) digestRecipients() []string {
+	return splitAddresses(cmp.Or(c.DigestTo, c.SMTPTo))
+}
+
+// digest summarizes a week or month: each target's uptime and latency,
+// compared with the period before, the longest incidents, and the speed
+// tests.
+type digest struct {
+	Period         string
+	From           time.Time
+	To             time.Time
+	Targets        []digestTarget
+	Incidents      int
+	WorstIncidents []incident
+	SpeedTests     []speedTestSummary
+	DashboardURL   string
+}
+
+type digestTarget struct {
+	targetRangeSummary
+	// PrevAvgLatencyMs is the average latency in the period before, or 0
+	// if there were no checks.
+	PrevAvgLatencyMs float64
+}
+
+// LatencyChangePct is how much the average latency changed from the period
+// before, in percent.
+func (t digestTarget) LatencyChangePct() float64 {
+	if t.PrevAvgLatencyMs == 0 {
+		return 0
+	}
+	return 100 * (t.AvgLatencyMs - t.PrevAvgLatencyMs) / t.PrevAvgLatencyMs
+}
+
+// lastPeriod returns the last whole week or month before now, in loc.
+func lastPeriod(period string, now time.Time, loc *time.Location) (time.Time, time.Time) {
+	to := periodStart(now, period, loc)
+	return periodStart(to.AddDate(0, 0, -1), period, loc), to
+}
+
+func buildDigest(db *sql.DB, cfg *Config, names []string, period string, from, to time.Time, loc *time.Location) (*digest, error) {
+	doc, err := buildReportDocument(db, cfg, names, "daily", from, to, loc)
+	if err != nil {
+		return nil, err
+	}
+	d := &digest{
+		Period:       period,
+		From:         doc.From,
+		To:           doc.To,
+		Incidents:    len(doc.Incidents),
+		SpeedTests:   doc.SpeedTests,
+		DashboardURL: cfg.DashboardURL,
+	}
+
+	prevFrom, _ := lastPeriod(period, from, loc)
+	for _, t := range doc.Targets {
+		dt := digestTarget{targetRangeSummary: t}
+		var prev sql.NullFloat64
+		err := db.QueryRow(`SELECT AVG(latency_ms) FROM checks WHERE target = ? AND `+checker.AnsweredSQL+` AND maintenance = 0 AND timestamp >= ? AND timestamp < ?`,
+			t.Target, prevFrom, from).Scan(&prev)
+		if err != nil {
+			return nil, err
+		}
+		dt.PrevAvgLatencyMs = prev.Float64
+		d.Targets = append(d.Targets, dt)
+	}
+
+	d.WorstIncidents = slices.Clone(doc.Incidents)
+	slices.SortStableFunc(d.WorstIncidents, func(a, b incident) int {
+		return cmp.Compare(b.DurationSeconds, a.DurationSeconds)
+	})
+	d.WorstIncidents = d.WorstIncidents[:min(digestIncidents, len(d.WorstIncidents))]
+	return d, nil
+}
+
+// Subject is the digest email's subject line.
+func (d *digest) Subject() string {
+	worst := 100.0
+	for _, t := range d.Targets {
+		if t.TotalChecks > 0 {
+			worst = min(worst, t.UptimePct)
+		}
+	}
+	period := "Weekly"
+	if d.Period == "monthly" {
+		period = "Monthly"
+	}
+	return fmt.Sprintf("%s uptime digest, %s: %d incidents, lowest uptime %.2f%%", period, d.From.Format("2 Jan 2006"), d.Incidents, worst)
+}
+
+var digestFuncs = map[string]any{
+	"date":  func(t time.Time) string { return t.Format("Mon 2 Jan 15:04") },
+	"day":   func(t time.Time) string { return t.Format("Mon 2 Jan 2006") },
+	"f2":    func(f float64) string { return fmt.Sprintf("%.2f", f) },
+	"mins":  func(seconds float64) string { return fmt.Sprintf("%.0f", seconds/60) },
+	"trend": func(pct float64) string { return fmt.Sprintf("%+.0f%%", pct) },
+}
+
+const digestText = `Uptime digest for {{day .From}} – {{day (.To.AddDate 0 0 -1)}}
+
+Targets
+{{range .Targets}}  {{.Target}}: {{f2 .UptimePct}}% up, {{.Incidents}} incidents, {{f2 .DowntimeMinutes}} min down, {{f2 .AvgLatencyMs}} ms avg latency{{if .PrevAvgLatencyMs}} ({{trend .LatencyChangePct}}){{end}}
+{{end}}
+Longest incidents
+{{range .WorstIncidents}}  {{.Target}}: {{mins .DurationSeconds}} min from {{date .Start}}{{if .Ongoing}} (ongoing){{end}}
+{{else}}  None.
+{{end}}
+Speed tests
+{{range .SpeedTests}}  {{.Provider}}: {{f2 .AvgDownloadMbps}} Mbps down, {{f2 .AvgUploadMbps}} Mbps up, {{f2 .AvgLatencyMs}} ms latency ({{.Tests}} tests)
+{{else}}  None.
+{{end}}{{with .DashboardURL}}
+{{.}}
+{{end}}`
+
+const digestHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; color: #222;">
+<h2>Uptime digest</h2>
+<p>{{day .From}} – {{day (.To.AddDate 0 0 -1)}}</p>
+<h3>Targets</h3>
+<table cellpadding="4" style="border-collapse: collapse;">
+<tr><th align="left">Target</th><th align="right">Uptime</th><th align="right">Incidents</th><th align="right">Downtime</th><th align="right">Avg latency</th><th align="right">vs previous</th></tr>
+{{range .Targets}}<tr><td>{{.Target}}</td><td align="right">{{f2 .UptimePct}}%</td><td align="right">{{.Incidents}}</td><td align="right">{{f2 .DowntimeMinutes}} min</td><td align="right">{{f2 .AvgLatencyMs}} ms</td><td align="right">{{if .PrevAvgLatencyMs}}{{trend .LatencyChangePct}}{{end}}</td></tr>
+{{end}}</table>
+<h3>Longest incidents</h3>
+{{if .WorstIncidents}}<ul>
+{{range .WorstIncidents}}<li>{{.Target}}: {{mins .DurationSeconds}} min from {{date .Start}}{{if .Ongoing}} (ongoing){{end}}</li>
+{{end}}</ul>{{else}}<p>None.</p>{{end}}
+<h3>Speed tests</h3>
+{{if .SpeedTests}}<ul>
+{{range .SpeedTests}}<li>{{.Provider}}: {{f2 .AvgDownloadMbps}} Mbps down, {{f2 .AvgUploadMbps}} Mbps up, {{f2 .AvgLatencyMs}} ms latency ({{.Tests}} tests)</li>
+{{end}}</ul>{{else}}<p>None.</p>{{end}}
+{{with .DashboardURL}}<p><a href="{{.}}">Open the dashboard</a></p>{{end}}
+</body>
+</html>
+`
+
+var (
+	digestTextTemplate = template.Must(template.New("digest.txt").Funcs(digestFuncs).Parse(digestText))
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(digestFuncs).Parse(digestHTML))
+)
+
+// render returns the digest as plain text and HTML.
+func (d *digest) render() (string, string, error) {
+	var text, html strings.Builder
+	if err := digestTextTemplate.Execute(&text, d); err != nil {
+		return "", "", err
+	}
+	if err := digestHTMLTemplate.Execute(&html, d); err != nil {
+		return "", "", err
+	}
+	return text.String(), html.String(), nil
+}
+
+func (d *digest) send(cfg *Config) error {
+	text, html, err := d.render()
+	if err != nil {
+		return err
+	}
+	return cfg.smtpServer().send(cfg.digestRecipients(), d.Subject(), text, html)
+}
+
+// sendDigests emails the digest of the last -digest period at digestHour on
+// the first day of each, until ctx is done.
+func sendDigests(ctx context.Context, cfg *Config) {
+	period := cfg.DigestPeriod
+	for {
+		next := periodStart(time.Now(), period, cfg.Timezone).Add(digestHour * time.Hour)
+		if !next.After(time.Now()) {
+			next = nextPeriod(periodStart(time.Now(), period, cfg.Timezone), period).Add(digestHour * time.Hour)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		from, to := lastPeriod(period, time.Now(), cfg.Timezone)
+		d, err := buildDigest(db, cfg, targetNames(), period, from, to, cfg.Timezone)
+		if err == nil {
+			err = d.send(cfg)
+		}
+		if err != nil {
+			slog.Error("Failed to send digest", "period", period, "error", err)
+			continue
+		}
+		slog.Info("Digest sent", "period", period, "from", from, "to", to)
+	}
+}
+
+// runDigestCommand implements `up digest`: it prints the digest of the last
+// week or month, or with -send emails it.
+func runDigestCommand(args []string) int {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	cfg.addEmailFlags(fs)
+	cfg.addDigestFlags(fs)
+	period := fs.String("period", "weekly", "Period to summarize: weekly or monthly")
+	send := fs.Bool("send", false, "Email the digest instead of printing it")
+	format := fs.String("format", "text", "Output format when printing: text or html")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !validDigestPeriod(*period) {
+		fmt.Fprintln(os.Stderr, "-period must be weekly or monthly")
+		return 2
+	}
+	if *send {
+		if err := cfg.checkDigestSettings(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if *format != "text" && *format != "html" {
+		fmt.Fprintln(os.Stderr, "-format must be text or html")
+		return 2
+	}
+
+	if err := openDB(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	from, to := lastPeriod(*period, time.Now(), cfg.Timezone)
+	d, err := buildDigest(db, &cfg, targetNames(), *period, from, to, cfg.Timezone)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *send {
+		if err := d.send(&cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Sent the %s digest to %s\n", *period, strings.Join(cfg.digestRecipients(), ", "))
+		return 0
+	}
+	text, html, err := d.render()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *format == "html" {
+		text = html
+	}
+	fmt.Print(text)
+	return 0
+}
@@ -0,0 +1,64 @@
+package up
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type discordNotifier struct {
+	webhook string
+	client  *http.Client
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []discordEmbedField `json:"fields"`
+	Timestamp   string              `json:"timestamp"`
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (d *discordNotifier) name() string { return "discord" }
+
+func (d *discordNotifier) notify(a alert) error {
+	color := 0x2ecc71
+	sinceLabel, lastedLabel := "Down since", "Outage lasted"
+	if a.Rule != "" {
+		sinceLabel, lastedLabel = "Firing since", "Fired for"
+	}
+	duration := discordEmbedField{Name: lastedLabel, Value: a.Duration().String(), Inline: true}
+	if a.Firing {
+		color = 0xe74c3c
+		duration = discordEmbedField{Name: sinceLabel, Value: fmt.Sprintf("<t:%d:R>", a.Since.Unix()), Inline: true}
+	}
+
+	fields := []discordEmbedField{{Name: "Target", Value: a.Target, Inline: true}}
+	if a.Probe != "" && a.Probe != "local" {
+		fields = append(fields, discordEmbedField{Name: "Probe", Value: a.Probe, Inline: true})
+	}
+	fields = append(fields, duration)
+	if len(a.RecentLatencyMs) > 0 {
+		fields = append(fields, discordEmbedField{Name: "Recent latency (ms)", Value: a.Latencies()})
+	}
+
+	// The fields already carry the details, so the embed only has a
+	// description when a template asks for one.
+	return postJSON(d.client, d.webhook, map[string]any{
+		"username": "up",
+		"embeds": []discordEmbed{{
+			Title:       a.title("discord"),
+			Description: a.message("discord", func() string { return "" }),
+			URL:         a.dashboardURL,
+			Color:       color,
+			Fields:      fields,
+			Timestamp:   a.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+		}},
+	}, nil)
+}
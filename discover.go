@@ -0,0 +1,426 @@
+package up
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"up/checker"
+	"up/internal/dnsmsg"
+)
+
+const discoverTimeout = 3 * time.Second
+
+var (
+	mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	ssdpAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+)
+
+// mdnsServices are the DNS-SD service types looked for, and the target URL
+// scheme each is monitored with.
+var mdnsServices = map[string]string{
+	"_http._tcp.local.":        "http",
+	"_https._tcp.local.":       "https",
+	"_ipp._tcp.local.":         "http",
+	"_ssh._tcp.local.":         "ssh",
+	"_workstation._tcp.local.": "icmp",
+}
+
+// discoveredTarget is a device found on the local network, offered as a
+// target.
+type discoveredTarget struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Source is "mdns" or "ssdp"; Detail is the mDNS service type or the
+	// SSDP SERVER header.
+	Source    string    `json:"source"`
+	Detail    string    `json:"detail,omitempty"`
+	FirstSeen time.Time `json:"first_seen,omitzero"`
+	LastSeen  time.Time `json:"last_seen,omitzero"`
+	Monitored bool      `json:"monitored"`
+}
+
+// discoverLAN looks for devices with mDNS and SSDP for discoverTimeout and
+// returns them in URL order, one per URL. An error from one protocol is
+// returned only if the other failed too.
+func discoverLAN(ctx context.Context) ([]discoveredTarget, error) {
+	var ssdp []discoveredTarget
+	var ssdpErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ssdp, ssdpErr = discoverSSDP(ctx)
+	}()
+	mdns, mdnsErr := discoverMDNS(ctx)
+	<-done
+	if mdnsErr != nil && ssdpErr != nil {
+		return nil, errors.Join(mdnsErr, ssdpErr)
+	}
+	if mdnsErr != nil {
+		slog.Debug("mDNS discovery failed", "error", mdnsErr)
+	}
+	if ssdpErr != nil {
+		slog.Debug("SSDP discovery failed", "error", ssdpErr)
+	}
+
+	var found []discoveredTarget
+	for _, d := range append(mdns, ssdp...) {
+		if !slices.ContainsFunc(found, func(f discoveredTarget) bool { return f.URL == d.URL }) {
+			found = append(found, d)
+		}
+	}
+	slices.SortFunc(found, func(a, b discoveredTarget) int { return strings.Compare(a.URL, b.URL) })
+	return found, nil
+}
+
+// discoverMDNS asks for each of mdnsServices over multicast DNS. The
+// queries come from an ordinary port, so responders answer them directly
+// (RFC 6762, section 6.7) rather than to the multicast group.
+func discoverMDNS(ctx context.Context) ([]discoveredTarget, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for service := range mdnsServices {
+		query, _, err := dnsmsg.BuildQuery(service, dnsmsg.TypePTR, dnsmsg.Flags{})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.WriteTo(query, mdnsAddr); err != nil {
+			return nil, err
+		}
+	}
+
+	// Records are collected from every response before being matched up,
+	// since a responder may send a service's records in separate packets.
+	instances := map[string]string{} // instance name -> service type
+	srvs := map[string]string{}      // instance name -> "priority weight port host"
+	addrs := map[string]string{}     // host name -> IPv4 address
+	buf := make([]byte, 9000)
+	err = readUntil(ctx, conn, buf, func(p []byte) {
+		resp, err := dnsmsg.ParseResponse(p)
+		if err != nil {
+			return
+		}
+		for _, rr := range append(resp.Answers, resp.Additional...) {
+			switch rr.Type {
+			case dnsmsg.TypePTR:
+				if _, ok := mdnsServices[strings.ToLower(rr.Name)]; ok {
+					instances[rr.Value] = strings.ToLower(rr.Name)
+				}
+			case dnsmsg.TypeSRV:
+				srvs[rr.Name] = rr.Value
+			case dnsmsg.TypeA:
+				addrs[strings.ToLower(rr.Name)] = rr.Value
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []discoveredTarget
+	for instance, service := range instances {
+		fields := strings.Fields(srvs[instance])
+		if len(fields) != 4 {
+			continue
+		}
+		addr, ok := addrs[strings.ToLower(fields[3])]
+		if !ok {
+			continue
+		}
+		var u string
+		switch scheme := mdnsServices[service]; scheme {
+		case "icmp":
+			u = "icmp://" + addr
+		case "ssh":
+			u = "ssh://" + net.JoinHostPort(addr, fields[2])
+		default:
+			u = scheme + "://" + net.JoinHostPort(addr, fields[2]) + "/"
+		}
+		found = append(found, discoveredTarget{
+			Name:   strings.TrimSuffix(instance, "."+service),
+			URL:    u,
+			Source: "mdns",
+			Detail: strings.TrimSuffix(strings.TrimSuffix(service, "local."), "."),
+		})
+	}
+	return found, nil
+}
+
+// discoverSSDP sends a UPnP M-SEARCH for every device and service, and
+// offers each device's description URL, which UPnP devices serve over
+// HTTP, as a target.
+func discoverSSDP(ctx context.Context) ([]discoveredTarget, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), ssdpAddr); err != nil {
+		return nil, err
+	}
+
+	servers := map[string]string{} // description URL -> SERVER header
+	buf := make([]byte, 9000)
+	err = readUntil(ctx, conn, buf, func(p []byte) {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(p)), nil)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+		location := resp.Header.Get("Location")
+		if u, err := url.Parse(location); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return
+		}
+		servers[location] = resp.Header.Get("Server")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []discoveredTarget
+	for location, server := range servers {
+		u, _ := url.Parse(location)
+		name, err := upnpFriendlyName(ctx, location)
+		if err != nil || name == "" {
+			name = u.Host
+		}
+		found = append(found, discoveredTarget{
+			Name:   name,
+			URL:    location,
+			Source: "ssdp",
+			Detail: server,
+		})
+	}
+	return found, nil
+}
+
+// upnpFriendlyName fetches a UPnP device description for the device's
+// name.
+func upnpFriendlyName(ctx context.Context, location string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var desc struct {
+		FriendlyName string `xml:"device>friendlyName"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&desc); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(desc.FriendlyName), nil
+}
+
+// readUntil passes each packet read from conn to handle until
+// discoverTimeout has passed or ctx is done.
+func readUntil(ctx context.Context, conn *net.UDPConn, buf []byte, handle func([]byte)) error {
+	deadline := time.Now().Add(discoverTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	for {
+		n, err := conn.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		handle(buf[:n])
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// discoverLoop looks for devices every -discover and records them, adding
+// new ones as targets with -discover-add.
+func discoverLoop(ctx context.Context, cfg *Config) {
+	slog.Info("Discovering devices on the local network", "interval", cfg.DiscoverInterval, "add", cfg.DiscoverAdd)
+	ticker := time.NewTicker(cfg.DiscoverInterval)
+	defer ticker.Stop()
+	for {
+		found, err := discoverLAN(ctx)
+		if err != nil {
+			slog.Warn("Device discovery failed", "error", err)
+		} else if err := recordDiscovered(cfg, found, time.Now()); err != nil {
+			slog.Error("Failed to save discovered devices", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordDiscovered saves the devices found. A device seen for the first
+// time is added as a target with -discover-add; one that was removed since
+// isn't added again.
+func recordDiscovered(cfg *Config, found []discoveredTarget, now time.Time) error {
+	for _, d := range found {
+		res, err := db.Exec(`INSERT INTO discovered (url, name, source, detail, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(url) DO NOTHING`, d.URL, d.Name, d.Source, d.Detail, now, now)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			if _, err := db.Exec(`UPDATE discovered SET name = ?, detail = ?, last_seen = ? WHERE url = ?`, d.Name, d.Detail, now, d.URL); err != nil {
+				return err
+			}
+			continue
+		}
+		slog.Info("Discovered device", "name", d.Name, "url", d.URL, "source", d.Source)
+		if cfg.DiscoverAdd {
+			if err := addDiscoveredTarget(cfg, d); err != nil {
+				slog.Warn("Failed to add discovered device", "url", d.URL, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// addDiscoveredTarget monitors a discovered device as if it had been added
+// through the API, so it can be edited or removed the same way.
+func addDiscoveredTarget(cfg *Config, d discoveredTarget) error {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	for _, t := range targets {
+		if t.URL == d.URL {
+			return nil
+		}
+	}
+	t := targetConfig{Target: checker.Target{Name: d.Name, URL: d.URL}, Tags: []string{"discovered"}}
+	for _, existing := range targets {
+		if existing.Name == t.Name {
+			t.Name = fmt.Sprintf("%s (%s)", d.Name, hostOf(d.URL))
+			break
+		}
+	}
+
+	data, _ := json.Marshal(t)
+	_, err := db.Exec(`INSERT INTO targets (name, config, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO NOTHING`, t.Name, string(data), time.Now())
+	if err != nil {
+		return err
+	}
+	if err := rebuildTargets(cfg, append(slices.Clone(managedTargets), t)); err != nil {
+		db.Exec(`DELETE FROM targets WHERE name = ?`, t.Name)
+		return err
+	}
+	slog.Info("Target added", "target", t.Name, "source", d.Source)
+	recordAudit("discovery", "", "target.add", t.Name, nil, t)
+	return nil
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+// queryDiscovered returns the devices discovered so far, and whether each
+// is monitored.
+func queryDiscovered() ([]discoveredTarget, error) {
+	rows, err := db.Query(`SELECT url, name, source, detail, first_seen, last_seen FROM discovered ORDER BY url`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	monitored := map[string]bool{}
+	for _, t := range currentTargets() {
+		monitored[t.URL] = true
+	}
+	found := []discoveredTarget{}
+	for rows.Next() {
+		var d discoveredTarget
+		if err := rows.Scan(&d.URL, &d.Name, &d.Source, &d.Detail, &d.FirstSeen, &d.LastSeen); err != nil {
+			return nil, err
+		}
+		d.Monitored = monitored[d.URL]
+		found = append(found, d)
+	}
+	return found, rows.Err()
+}
+
+func (s *server) discoveredHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := queryDiscovered()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// runDiscoverCommand implements `up discover`, which lists the devices
+// found on the local network, or prints them as JSON or as a config file.
+func runDiscoverCommand(args []string) int {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text, json, or config (a config file's targets)")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *format != "text" && *format != "json" && *format != "config" {
+		fmt.Fprintln(os.Stderr, "-format must be text, json, or config")
+		return 2
+	}
+
+	found, err := discoverLAN(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	switch *format {
+	case "config":
+		var cfg fileConfig
+		for _, d := range found {
+			cfg.Targets = append(cfg.Targets, targetConfig{Target: checker.Target{Name: d.Name, URL: d.URL}, Tags: []string{"discovered"}})
+		}
+		enc.Encode(cfg)
+	case "json":
+		if found == nil {
+			found = []discoveredTarget{}
+		}
+		enc.Encode(found)
+	default:
+		for _, d := range found {
+			fmt.Printf("%-4s  %-40s  %s\n", d.Source, d.URL, d.Name)
+		}
+	}
+	return 0
+}
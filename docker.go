@@ -0,0 +1,166 @@
+package up
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+// The container labels that make a container a target. Only up.target is
+// required.
+const (
+	labelTarget = "up.target"
+	labelName   = "up.name"
+)
+
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// dockerClient talks to the Docker Engine API over a unix socket, or TCP
+// for a tcp:// host. The containers' targets are prepared with cfg.
+type dockerClient struct {
+	host   string
+	base   string
+	client *http.Client
+	cfg    *Config
+}
+
+func newDockerClient(cfg *Config) (*dockerClient, error) {
+	host := cmp.Or(cfg.DockerHost, os.Getenv("DOCKER_HOST"), "unix:///var/run/docker.sock")
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q", host)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &dockerClient{host: host, client: &http.Client{Transport: transport}, cfg: cfg}
+	switch u.Scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", u.Path)
+		}
+		c.base = "http://docker"
+	case "tcp", "http":
+		c.base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q: use unix:// or tcp://", host)
+	}
+	return c, nil
+}
+
+func (c *dockerClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+// watchDocker keeps the targets in step with the running containers
+// labelled up.target until ctx is done. The containers are listed again
+// whenever one starts or stops.
+func watchDocker(ctx context.Context, cfg *Config) {
+	c, err := newDockerClient(cfg)
+	if err != nil {
+		slog.Error("Failed to watch Docker", "error", err)
+		return
+	}
+	slog.Info("Watching Docker for labelled containers", "host", c.host)
+	for ctx.Err() == nil {
+		if err := c.watch(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Docker watch failed", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+}
+
+// watch subscribes to container events, lists the containers, and lists
+// them again after each event, until the event stream ends.
+func (c *dockerClient) watch(ctx context.Context) error {
+	filters, _ := json.Marshal(map[string][]string{
+		"type":  {"container"},
+		"event": {"start", "die", "destroy", "rename"},
+	})
+	// Subscribe first, so a container started while listing isn't missed.
+	events, err := c.get(ctx, "/events", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return err
+	}
+	defer events.Body.Close()
+	if err := c.sync(ctx); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(events.Body)
+	for {
+		var ev struct {
+			Action string `json:"Action"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("event stream ended: %v", err)
+		}
+		slog.Debug("Docker container event", "action", ev.Action)
+		if err := c.sync(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// sync lists the running containers with an up.target label and makes
+// them the Docker targets.
+func (c *dockerClient) sync(ctx context.Context) error {
+	filters, _ := json.Marshal(map[string][]string{"label": {labelTarget}})
+	resp, err := c.get(ctx, "/containers/json", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return err
+	}
+
+	var wanted []targetConfig
+	for _, ctr := range containers {
+		name := ctr.ID[:min(12, len(ctr.ID))]
+		if len(ctr.Names) > 0 {
+			name = strings.TrimPrefix(ctr.Names[0], "/")
+		}
+		wanted = append(wanted, targetConfig{
+			Target: checker.Target{
+				Name: cmp.Or(ctr.Labels[labelName], "container/"+name),
+				URL:  ctr.Labels[labelTarget],
+			},
+			Tags: []string{"docker"},
+		})
+	}
+	setProviderTargets(c.cfg, "docker", wanted)
+	return nil
+}
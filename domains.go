@@ -0,0 +1,300 @@
+package up
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+const rdapBootstrapURL = "https://data.iana.org/rdap/dns.json"
+
+// domainAlertDays are the days before expiry at which a domain is alerted
+// on again, once within -domain-warning.
+var domainAlertDays = []int{14, 7, 3, 1}
+
+type domainExpiry struct {
+	Domain    string     `json:"domain"`
+	Expires   *time.Time `json:"expires"`
+	DaysLeft  *float64   `json:"days_left"`
+	Registrar string     `json:"registrar,omitempty"`
+	Checked   time.Time  `json:"checked"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// monitorDomains looks up the expiry date of each of -domains with RDAP
+// every -domain-interval until ctx is done, and alerts when one is due to
+// expire within -domain-warning days.
+func monitorDomains(ctx context.Context, cfg *Config) {
+	domains := monitoredDomains(cfg.DomainNames)
+	slog.Info("Monitoring domain expiry", "domains", domains, "interval", cfg.DomainInterval, "warning_days", cfg.DomainWarningDays)
+
+	// alerted holds the fewest days left each domain was alerted at, and
+	// since when.
+	type alertState struct {
+		days  int
+		since time.Time
+	}
+	alerted := map[string]alertState{}
+	client := checker.OutboundClient(cfg.ProxyURL)
+	client.Timeout = 30 * time.Second
+
+	ticker := time.NewTicker(cfg.DomainInterval)
+	defer ticker.Stop()
+	for {
+		bootstrap, err := rdapBootstrap(client, cfg.RDAPServer)
+		if err != nil {
+			slog.Error("Failed to load the RDAP bootstrap registry", "error", err)
+		}
+		for _, domain := range domains {
+			now := time.Now()
+			d := domainExpiry{Domain: domain, Checked: now}
+			base, err := rdapBaseURL(cfg.RDAPServer, bootstrap, domain)
+			if err == nil {
+				var expires time.Time
+				expires, d.Registrar, err = lookupDomainExpiry(ctx, client, base, domain)
+				if err == nil {
+					d.Expires = &expires
+				}
+			}
+			if err != nil {
+				d.Error = err.Error()
+				slog.Warn("Domain expiry lookup failed", "domain", domain, "error", err)
+			}
+			if err := saveDomainExpiry(d); err != nil {
+				slog.Error("Failed to save domain expiry", "domain", domain, "error", err)
+			}
+			if d.Expires == nil {
+				continue
+			}
+
+			days := int(math.Round(d.Expires.Sub(now).Hours() / 24))
+			state, wasAlerted := alerted[domain]
+			switch {
+			case days <= cfg.DomainWarningDays && (!wasAlerted || domainAlertMilestone(days, cfg.DomainWarningDays) < state.days):
+				if !wasAlerted {
+					state.since = now
+				}
+				state.days = domainAlertMilestone(days, cfg.DomainWarningDays)
+				alerted[domain] = state
+				dispatchAlert(cfg, alert{
+					Target: domain, Rule: "domain-expiry", Firing: true, Reminder: wasAlerted,
+					Reason:    fmt.Sprintf("%s expires on %s (days left: %d)", domain, d.Expires.In(cfg.Timezone).Format(time.DateOnly), days),
+					Timestamp: now, Since: state.since,
+				})
+			case days > cfg.DomainWarningDays && wasAlerted:
+				delete(alerted, domain)
+				slog.Info("Domain renewed", "domain", domain, "expires", d.Expires)
+				dispatchAlert(cfg, alert{Target: domain, Rule: "domain-expiry", Timestamp: now, Since: state.since})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// monitoredDomains parses the comma-separated -domains list.
+func monitoredDomains(list string) []string {
+	var domains []string
+	for _, d := range strings.Split(list, ",") {
+		if d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), "."); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// domainAlertMilestone returns the smallest of warning (-domain-warning)
+// and domainAlertDays that days has reached.
+func domainAlertMilestone(days, warning int) int {
+	milestone := warning
+	for _, m := range domainAlertDays {
+		if days <= m && m < milestone {
+			milestone = m
+		}
+	}
+	return milestone
+}
+
+// rdapBootstrap maps TLDs to their RDAP servers, from IANA's registry. It
+// isn't needed with a server (-rdap-server).
+func rdapBootstrap(client *http.Client, server string) (map[string]string, error) {
+	if server != "" {
+		return nil, nil
+	}
+	resp, err := client.Get(rdapBootstrapURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	var registry struct {
+		Services [][][]string `json:"services"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&registry); err != nil {
+		return nil, err
+	}
+	servers := map[string]string{}
+	for _, service := range registry.Services {
+		if len(service) < 2 || len(service[1]) == 0 {
+			continue
+		}
+		for _, tld := range service[0] {
+			servers[strings.ToLower(tld)] = service[1][0]
+		}
+	}
+	return servers, nil
+}
+
+func rdapBaseURL(server string, bootstrap map[string]string, domain string) (string, error) {
+	if server != "" {
+		return server, nil
+	}
+	// Registries can serve several levels, such as co.uk, so the longest
+	// matching suffix wins.
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		if base, ok := bootstrap[strings.Join(labels[i:], ".")]; ok {
+			return base, nil
+		}
+	}
+	return "", fmt.Errorf("no RDAP server for %s", domain)
+}
+
+// lookupDomainExpiry asks the RDAP server at base for the domain's
+// expiration date and registrar.
+func lookupDomainExpiry(ctx context.Context, client *http.Client, base, domain string) (time.Time, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/domain/"+domain, nil)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return time.Time{}, "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var rdap struct {
+		Events []struct {
+			Action string    `json:"eventAction"`
+			Date   time.Time `json:"eventDate"`
+		} `json:"events"`
+		Entities []struct {
+			Roles []string          `json:"roles"`
+			VCard []json.RawMessage `json:"vcardArray"`
+		} `json:"entities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rdap); err != nil {
+		return time.Time{}, "", err
+	}
+	var registrar string
+	for _, e := range rdap.Entities {
+		if slices.Contains(e.Roles, "registrar") && len(e.VCard) == 2 {
+			registrar = vcardName(e.VCard[1])
+		}
+	}
+	for _, e := range rdap.Events {
+		if e.Action == "expiration" {
+			return e.Date, registrar, nil
+		}
+	}
+	return time.Time{}, registrar, fmt.Errorf("no expiration date for %s", domain)
+}
+
+// vcardName returns the formatted name in a jCard's properties.
+func vcardName(properties json.RawMessage) string {
+	var props [][]any
+	if json.Unmarshal(properties, &props) != nil {
+		return ""
+	}
+	for _, p := range props {
+		if len(p) == 4 && p[0] == "fn" {
+			name, _ := p[3].(string)
+			return name
+		}
+	}
+	return ""
+}
+
+func saveDomainExpiry(d domainExpiry) error {
+	var expires any
+	if d.Expires != nil {
+		expires = *d.Expires
+	}
+	_, err := db.Exec(`INSERT INTO domains (domain, checked, expires, registrar, error) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET checked = excluded.checked, error = excluded.error,
+			expires = COALESCE(excluded.expires, domains.expires),
+			registrar = CASE WHEN excluded.error = '' THEN excluded.registrar ELSE domains.registrar END`,
+		d.Domain, d.Checked, expires, d.Registrar, d.Error)
+	return err
+}
+
+// domainsHandler serves each monitored domain's expiry date and the days
+// left, from the latest lookup.
+func (s *server) domainsHandler(w http.ResponseWriter, r *http.Request) {
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	domains, err := queryDomainExpiry(s.db)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	domains = slices.DeleteFunc(domains, func(d domainExpiry) bool { return !slices.Contains(monitoredDomains(s.cfg.DomainNames), d.Domain) })
+	now := time.Now()
+	for i := range domains {
+		d := &domains[i]
+		d.Checked = d.Checked.In(loc)
+		if d.Expires != nil {
+			days := d.Expires.Sub(now).Hours() / 24
+			d.DaysLeft = &days
+			*d.Expires = d.Expires.In(loc)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domains)
+}
+
+func queryDomainExpiry(db *sql.DB) ([]domainExpiry, error) {
+	rows, err := db.Query(`SELECT domain, checked, expires, registrar, error FROM domains ORDER BY expires IS NULL, expires`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []domainExpiry{}
+	for rows.Next() {
+		var d domainExpiry
+		var expires sql.NullTime
+		if err := rows.Scan(&d.Domain, &d.Checked, &expires, &d.Registrar, &d.Error); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			d.Expires = &expires.Time
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
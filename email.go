@@ -0,0 +1,178 @@
+package up
+
+import (
+	"bytes"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+func (c *Config) addEmailFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.SMTPAddr, "smtp-addr", "", "Mail server to send email through, as host:port; port 465 uses TLS, others STARTTLS when offered")
+	fs.StringVar(&c.SMTPUsername, "smtp-username", "", "Username to log in to -smtp-addr with")
+	fs.StringVar(&c.SMTPPassword, "smtp-password", "", "Password to log in to -smtp-addr with; prefer UP_SMTP_PASSWORD to keep it out of the process list")
+	fs.StringVar(&c.SMTPFrom, "smtp-from", "", "From address of the email up sends")
+	fs.StringVar(&c.SMTPTo, "smtp-to", "", "Comma-separated addresses to email outage and recovery alerts to")
+}
+
+// checkEmailSettings checks that email can be sent, for when it is needed.
+func (c *Config) checkEmailSettings() error {
+	if c.SMTPAddr == "" || c.SMTPFrom == "" {
+		return fmt.Errorf("sending email needs -smtp-addr and -smtp-from")
+	}
+	if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+		return fmt.Errorf("invalid -smtp-addr %q: %v", c.SMTPAddr, err)
+	}
+	return nil
+}
+
+// smtpServer is the mail server email is sent through, and who it is from.
+type smtpServer struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+func (c *Config) smtpServer() smtpServer {
+	return smtpServer{addr: c.SMTPAddr, username: c.SMTPUsername, password: c.SMTPPassword, from: c.SMTPFrom}
+}
+
+// splitAddresses splits a comma-separated list of email addresses or phone
+// numbers.
+func splitAddresses(s string) []string {
+	var addrs []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// emailNotifier emails alerts to a list of addresses.
+type emailNotifier struct {
+	server smtpServer
+	to     []string
+}
+
+func (e *emailNotifier) name() string { return "email" }
+
+func (e *emailNotifier) notify(a alert) error {
+	return e.server.send(e.to, a.title("email"), a.message("email", a.Details), "")
+}
+
+// send sends a message through the server. The body is plain text, with
+// html as an alternative if it isn't empty.
+func (s smtpServer) send(to []string, subject, text, html string) error {
+	msg, err := s.buildEmail(to, subject, text, html)
+	if err != nil {
+		return err
+	}
+
+	host, port, _ := net.SplitHostPort(s.addr)
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	if port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && port != "465" {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildEmail formats a message, quoted-printable encoded, as a single text
+// part or a multipart/alternative of text and HTML.
+func (s smtpServer) buildEmail(to []string, subject, text, html string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if html == "" {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&b, text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeQuotedPrintable encodes s, whose line breaks become CRLF.
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, s); err != nil {
+		return err
+	}
+	return qp.Close()
+}
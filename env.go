@@ -0,0 +1,69 @@
+package up
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseFlags parses the command line and then fills in every flag that was
+// not given from, in order, its UP_* environment variable and the config
+// file's "settings" object. The resulting precedence is flag > environment >
+// config file > default.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid %s: %v", envName(f.Name), e)
+			}
+			set[f.Name] = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	configFlag := fs.Lookup("config")
+	if configFlag == nil || configFlag.Value.String() == "" {
+		return nil
+	}
+	cfg, err := loadConfig(configFlag.Value.String())
+	if err != nil {
+		return err
+	}
+	for name, raw := range cfg.Settings {
+		if fs.Lookup(name) == nil || name == "config" {
+			// Settings are shared by every command, so ones this command
+			// doesn't take are skipped rather than rejected.
+			continue
+		}
+		if set[name] {
+			continue
+		}
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			v = string(raw)
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("invalid setting %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// envName maps a flag name to its environment variable, e.g.
+// "speedtest-interval" to "UP_SPEEDTEST_INTERVAL".
+func envName(flagName string) string {
+	return "UP_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
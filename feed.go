@@ -0,0 +1,145 @@
+package up
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feedIncidents is how many incidents the Atom feed lists by default.
+const feedIncidents = 50
+
+// atomFeed is an Atom (RFC 4287) feed of incidents.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Link      atomLink `xml:"link"`
+	Content   string   `xml:"content"`
+}
+
+// incidentsFeedHandler serves the latest incidents as an Atom feed, for
+// following outages from a feed reader. An incident's entry is updated when
+// it is resolved. Entries link to page, the status page of the server
+// serving the feed. It takes target and limit like /incidents.
+func (s *server) incidentsFeedHandler(page string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := feedIncidents
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = min(l, 500)
+		}
+		incidents, err := queryIncidents(s.db, r.URL.Query().Get("target"), "", limit)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		base := requestBaseURL(r)
+		feed := atomFeed{
+			ID:    base + r.URL.Path,
+			Title: s.cfg.StatusPageTitle + " incidents",
+			Links: []atomLink{
+				{Rel: "self", Type: "application/atom+xml", Href: base + r.URL.RequestURI()},
+				{Rel: "alternate", Type: "text/html", Href: base + page},
+			},
+			Author: atomAuthor{Name: s.cfg.StatusPageTitle},
+		}
+		updated := time.Unix(0, 0)
+		for _, inc := range incidents {
+			e := incidentEntry(inc, r.Host, s.cfg.Timezone)
+			e.Link = atomLink{Rel: "alternate", Type: "text/html", Href: base + page}
+			feed.Entries = append(feed.Entries, e)
+			if inc.End != nil && inc.End.After(updated) {
+				updated = *inc.End
+			}
+			if inc.Start.After(updated) {
+				updated = inc.Start
+			}
+		}
+		feed.Updated = updated.UTC().Format(time.RFC3339)
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(feed); err != nil {
+			slog.Error("Failed to write incidents feed", "error", err)
+		}
+	}
+}
+
+// incidentEntry describes an incident. Its ID is a tag URI (RFC 4151) made
+// from the host and the day the incident started, so it stays the same when
+// the incident is resolved. Times are shown in loc.
+func incidentEntry(inc incident, host string, loc *time.Location) atomEntry {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	target := inc.Target
+	if inc.Probe != "" && inc.Probe != "local" {
+		target += " (from " + inc.Probe + ")"
+	}
+	duration := (time.Duration(inc.DurationSeconds) * time.Second).Round(time.Second)
+	start := inc.Start.In(loc).Format(time.DateTime + " MST")
+
+	e := atomEntry{
+		ID:        fmt.Sprintf("tag:%s,%s:incident/%d", host, inc.Start.UTC().Format(time.DateOnly), inc.ID),
+		Published: inc.Start.UTC().Format(time.RFC3339),
+		Updated:   inc.Start.UTC().Format(time.RFC3339),
+	}
+	var content strings.Builder
+	if inc.End == nil {
+		e.Title = target + " is down"
+		fmt.Fprintf(&content, "Down since %s.", start)
+	} else {
+		e.Title = fmt.Sprintf("%s was down for %s", target, duration)
+		e.Updated = inc.End.UTC().Format(time.RFC3339)
+		fmt.Fprintf(&content, "Down from %s to %s (%s).", start, inc.End.In(loc).Format(time.DateTime+" MST"), duration)
+	}
+	switch inc.Classification {
+	case "lan":
+		content.WriteString(" The outage was on the local network.")
+	case "isp":
+		content.WriteString(" The outage was at the internet provider.")
+	case "remote":
+		content.WriteString(" The outage was at the target's end.")
+	}
+	e.Content = content.String()
+	return e
+}
+
+// requestBaseURL is the scheme and host a request was made to, as seen by
+// the client, for absolute links.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
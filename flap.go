@@ -0,0 +1,152 @@
+package up
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// alertState tracks what has been alerted for a target, as seen from one
+// probe, so that outages and recoveries are only sent once they have lasted
+// -alert-down-after or -alert-up-after checks.
+type alertState struct {
+	// down is true once an outage alert has been sent, until the recovery.
+	down bool
+	// since is when the alerted outage started.
+	since time.Time
+
+	// streak counts consecutive results that disagree with down, starting
+	// at streakStart.
+	streak      int
+	streakStart time.Time
+
+	last     string
+	changes  []time.Time
+	flapping bool
+	flapFrom time.Time
+}
+
+var (
+	alertStateMu sync.Mutex
+	alertStates  = map[probeTarget]*alertState{}
+)
+
+func (c *Config) checkAlertSettings() error {
+	if c.AlertDownAfter < 1 || c.AlertUpAfter < 1 {
+		return fmt.Errorf("-alert-down-after and -alert-up-after must be at least 1")
+	}
+	if c.FlapWindow > 0 && c.FlapThreshold < 2 {
+		return fmt.Errorf("-flap-threshold must be at least 2")
+	}
+	return nil
+}
+
+// trackAlerts feeds a check result into the target's alert state and sends
+// an outage, recovery, or flapping alert when one is due. While a target is
+// flapping its outage and recovery alerts are held back; once it settles,
+// an alert is sent if its status ended up different from the last one
+// alerted.
+func trackAlerts(cfg *Config, r checker.Result) {
+	alertStateMu.Lock()
+	defer alertStateMu.Unlock()
+
+	key := probeTarget{r.Target, r.Probe}
+	down := !checker.Answered(r.Status)
+	st, ok := alertStates[key]
+	if !ok {
+		// Like state changes, the first result is taken as the baseline
+		// rather than alerted.
+		alertStates[key] = &alertState{down: down, since: r.Timestamp, last: r.Status}
+		return
+	}
+
+	if cfg.FlapWindow > 0 {
+		updateFlapping(cfg, st, key, r)
+	}
+	st.last = r.Status
+
+	if down == st.down {
+		st.streak = 0
+		return
+	}
+	if st.streak == 0 {
+		st.streakStart = r.Timestamp
+	}
+	st.streak++
+
+	needed := cfg.AlertDownAfter
+	if st.down {
+		needed = cfg.AlertUpAfter
+	}
+	if st.streak < needed || st.flapping {
+		return
+	}
+
+	a := alert{Target: r.Target, Probe: r.Probe, Status: r.Status, Firing: down, Timestamp: r.Timestamp, Since: st.streakStart}
+	if !down {
+		// The outage ended with the first successful check.
+		a.Timestamp, a.Since = st.streakStart, st.since
+	}
+	st.down, st.since, st.streak = down, st.streakStart, 0
+	go func() {
+		a.RecentLatencyMs = recentLatencies(a.Target, a.Probe)
+		dispatchAlert(cfg, a)
+	}()
+}
+
+// updateFlapping records a state change and marks the target as flapping
+// while -flap-threshold or more changes fall within -flap-window.
+// alertStateMu must be held.
+func updateFlapping(cfg *Config, st *alertState, key probeTarget, r checker.Result) {
+	// Going between up and degraded isn't flapping.
+	if r.Status != st.last && !(checker.Answered(r.Status) && checker.Answered(st.last)) {
+		st.changes = append(st.changes, r.Timestamp)
+	}
+	cutoff := r.Timestamp.Add(-cfg.FlapWindow)
+	for len(st.changes) > 0 && st.changes[0].Before(cutoff) {
+		st.changes = st.changes[1:]
+	}
+
+	flapping := len(st.changes) >= cfg.FlapThreshold
+	if flapping == st.flapping {
+		return
+	}
+	st.flapping = flapping
+	// /summary reports flapping, so cached summaries are out of date.
+	noteChecksChanged()
+
+	a := alert{
+		Target:    key.target,
+		Probe:     key.probe,
+		Status:    r.Status,
+		Firing:    flapping,
+		Timestamp: r.Timestamp,
+		Since:     r.Timestamp,
+		Rule:      "flapping",
+		Reason:    fmt.Sprintf("%s changed state %d times in %s", key.target, len(st.changes), cfg.FlapWindow),
+	}
+	if flapping {
+		st.flapFrom = r.Timestamp
+		slog.Warn("Target is flapping", "target", key.target, "probe", key.probe, "changes", len(st.changes))
+	} else {
+		a.Since = st.flapFrom
+		slog.Info("Target stopped flapping", "target", key.target, "probe", key.probe)
+	}
+	go dispatchAlert(cfg, a)
+}
+
+// isFlapping reports whether the target is flapping as seen from the probe,
+// or from any probe if probe is empty.
+func isFlapping(target, probe string) bool {
+	alertStateMu.Lock()
+	defer alertStateMu.Unlock()
+	for key, st := range alertStates {
+		if key.target == target && (probe == "" || key.probe == probe) && st.flapping {
+			return true
+		}
+	}
+	return false
+}
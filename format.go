@@ -0,0 +1,105 @@
+package up
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// responseFormat picks the format of a data endpoint's response: ?format=
+// (json, ndjson, or csv) if given, otherwise the Accept header, defaulting
+// to a JSON array.
+func responseFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		switch f {
+		case "json", "ndjson", "csv":
+			return f, nil
+		}
+		return "", fmt.Errorf("unknown format %q", f)
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		switch mediaType {
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			return "ndjson", nil
+		case "text/csv":
+			return "csv", nil
+		case "application/json":
+			return "json", nil
+		}
+	}
+	return "json", nil
+}
+
+// writeFormatted writes rows, a slice of structs, in format. NDJSON has one
+// JSON object per line, so consumers can process rows as they arrive; CSV
+// has a header row of the JSON field names.
+func writeFormatted(w http.ResponseWriter, format string, rows any) {
+	w.Header().Add("Vary", "Accept")
+	v := reflect.ValueOf(rows)
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for i := range v.Len() {
+			if err := enc.Encode(v.Index(i).Interface()); err != nil {
+				return
+			}
+		}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		columns := csvColumns(v.Type().Elem(), nil)
+		cw := csv.NewWriter(w)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.name
+		}
+		cw.Write(header)
+		for i := range v.Len() {
+			row := v.Index(i)
+			record := make([]string, len(columns))
+			for j, c := range columns {
+				record[j] = formatExportValue(row.FieldByIndex(c.index).Interface())
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rows)
+	}
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvColumns lists the fields encoding/json would encode for struct type t,
+// including those promoted from embedded structs.
+func csvColumns(t reflect.Type, index []int) []csvColumn {
+	var columns []csvColumn
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		fieldIndex := append(append([]int{}, index...), i)
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			columns = append(columns, csvColumns(f.Type, fieldIndex)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		columns = append(columns, csvColumn{cmp.Or(name, f.Name), fieldIndex})
+	}
+	return columns
+}
@@ -0,0 +1,32 @@
+package up
+
+import (
+	"log/slog"
+	"slices"
+
+	"up/checker"
+)
+
+// gatewayTarget is the name of the implicit target added by -gateway.
+const gatewayTarget = "gateway"
+
+// addGatewayTarget appends an ICMP target for the default gateway, unless
+// the config already has a target of that name. Failing to find the
+// gateway isn't fatal, so up still runs on hosts without one.
+func addGatewayTarget(ts []targetConfig, cfg *Config) []targetConfig {
+	if slices.ContainsFunc(ts, func(t targetConfig) bool { return t.Name == gatewayTarget }) {
+		return ts
+	}
+	gw, err := defaultGateway()
+	if err != nil {
+		slog.Warn("Failed to detect the default gateway", "error", err)
+		return ts
+	}
+	t := targetConfig{Target: checker.Target{Name: gatewayTarget, Type: "icmp", URL: "icmp://" + gw}, Role: "gateway"}
+	if err := t.init(cfg); err != nil {
+		slog.Warn("Failed to add the default gateway", "gateway", gw, "error", err)
+		return ts
+	}
+	slog.Info("Monitoring default gateway", "gateway", gw)
+	return append(ts, t)
+}
@@ -0,0 +1,26 @@
+//go:build !linux && !windows
+
+package up
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// defaultGateway asks route(8) for the default route, as on macOS and the
+// BSDs.
+func defaultGateway() (string, error) {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && key == "gateway" && net.ParseIP(strings.TrimSpace(value)) != nil {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("no default route")
+}
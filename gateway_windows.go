@@ -0,0 +1,24 @@
+package up
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// defaultGateway parses the IPv4 default route from route print.
+func defaultGateway() (string, error) {
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return "", err
+	}
+	// Network Destination  Netmask  Gateway  Interface  Metric
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "0.0.0.0" && fields[1] == "0.0.0.0" && net.ParseIP(fields[2]) != nil {
+			return fields[2], nil
+		}
+	}
+	return "", fmt.Errorf("no default route")
+}
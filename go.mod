@@ -2,4 +2,8 @@ module up
 
 go 1.24.2
 
-require github.com/mattn/go-sqlite3 v1.14.28
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/sys v0.39.0
+)
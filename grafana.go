@@ -0,0 +1,205 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+var errUnknownMetric = errors.New("unknown metric")
+
+// grafanaSpeedTestMetrics map the speed test metrics offered to Grafana to
+// their columns.
+var grafanaSpeedTestMetrics = map[string]string{
+	"speedtest_download": "download_mbps",
+	"speedtest_upload":   "upload_mbps",
+	"speedtest_latency":  "latency_ms",
+}
+
+// grafanaMetrics lists the metrics the Grafana datasource offers: the
+// uptime percentage and average latency of each target, as
+// "uptime:<target>" and "latency:<target>", and the speed test results.
+func grafanaMetrics() []string {
+	var metrics []string
+	for _, name := range targetNames() {
+		metrics = append(metrics, "uptime:"+name, "latency:"+name)
+	}
+	for m := range grafanaSpeedTestMetrics {
+		metrics = append(metrics, m)
+	}
+	slices.Sort(metrics)
+	return metrics
+}
+
+// grafanaHandler serves the endpoints of Grafana's JSON datasource (the
+// simple-JSON protocol, which the Infinity datasource can also read) under
+// /grafana/: / to test the connection, /search to list metrics, and /query
+// for their values over a time range.
+func (s *server) grafanaHandler(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/grafana") {
+	case "", "/":
+		fmt.Fprintln(w, "OK")
+	case "/search", "/metrics":
+		s.grafanaSearch(w, r)
+	case "/query":
+		s.grafanaQuery(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *server) grafanaSearch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	metrics := slices.DeleteFunc(grafanaMetrics(), func(m string) bool {
+		return !strings.Contains(strings.ToLower(m), strings.ToLower(req.Target))
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
+type grafanaQueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64 `json:"intervalMs"`
+	MaxDataPoints int64 `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+		Type   string `json:"type"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaTable struct {
+	Type    string           `json:"type"`
+	Columns []map[string]any `json:"columns"`
+	Rows    [][2]float64     `json:"rows"`
+}
+
+// grafanaQuery answers each query target with its values averaged over
+// buckets of the requested interval, as [value, unix ms] pairs, or as a
+// table for "type": "table".
+func (s *server) grafanaQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req grafanaQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	from, to := req.Range.From, req.Range.To
+	if from.IsZero() || to.IsZero() || !from.Before(to) {
+		http.Error(w, "Invalid range", http.StatusBadRequest)
+		return
+	}
+	// Buckets are at least a second, and no more than maxDataPoints fit in
+	// the range.
+	bucket := max(1, req.IntervalMs/1000)
+	if req.MaxDataPoints > 0 {
+		bucket = max(bucket, int64(to.Sub(from).Seconds())/req.MaxDataPoints+1)
+	}
+
+	response := []any{}
+	for _, t := range req.Targets {
+		if t.Hide || t.Target == "" {
+			continue
+		}
+		points, err := queryGrafanaMetric(s.db, t.Target, from, to, bucket)
+		if errors.Is(err, errUnknownMetric) {
+			http.Error(w, fmt.Sprintf("Unknown metric %q", t.Target), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if t.Type == "table" {
+			table := grafanaTable{
+				Type:    "table",
+				Columns: []map[string]any{{"text": "Time", "type": "time"}, {"text": t.Target, "type": "number"}},
+				Rows:    make([][2]float64, 0, len(points)),
+			}
+			for _, p := range points {
+				table.Rows = append(table.Rows, [2]float64{p[1], p[0]})
+			}
+			response = append(response, table)
+			continue
+		}
+		response = append(response, grafanaSeries{Target: t.Target, Datapoints: points})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// queryGrafanaMetric returns a metric's average in each bucket of the
+// given number of seconds between from and to, as [value, unix ms] pairs
+// in time order. Checks in maintenance are left out of uptime.
+func queryGrafanaMetric(db *sql.DB, metric string, from, to time.Time, bucket int64) ([][2]float64, error) {
+	var query string
+	var args []any
+	if column, ok := grafanaSpeedTestMetrics[metric]; ok {
+		query = `SELECT CAST(strftime('%s', timestamp) AS INTEGER) / ? * ? AS bucket, AVG(` + column + `)
+			FROM speedtests WHERE timestamp >= ? AND timestamp <= ?
+			GROUP BY bucket ORDER BY bucket`
+		args = []any{bucket, bucket, from, to}
+	} else {
+		kind, target, _ := strings.Cut(metric, ":")
+		if target == "" {
+			return nil, errUnknownMetric
+		}
+		switch kind {
+		case "uptime":
+			query = `SELECT CAST(strftime('%s', timestamp) AS INTEGER) / ? * ? AS bucket,
+				100.0 * SUM(CASE WHEN ` + checker.AnsweredSQL + ` THEN 1 ELSE 0 END) / COUNT(*)
+				FROM checks WHERE target = ? AND timestamp >= ? AND timestamp <= ? AND maintenance = 0
+				GROUP BY bucket ORDER BY bucket`
+		case "latency":
+			query = `SELECT CAST(strftime('%s', timestamp) AS INTEGER) / ? * ? AS bucket, AVG(latency_ms)
+				FROM checks WHERE target = ? AND timestamp >= ? AND timestamp <= ? AND ` + checker.AnsweredSQL + ` AND maintenance = 0
+				GROUP BY bucket ORDER BY bucket`
+		default:
+			return nil, errUnknownMetric
+		}
+		args = []any{bucket, bucket, target, from, to}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := [][2]float64{}
+	for rows.Next() {
+		var at int64
+		var value float64
+		if err := rows.Scan(&at, &value); err != nil {
+			return nil, err
+		}
+		points = append(points, [2]float64{value, float64(at * 1000)})
+	}
+	return points, rows.Err()
+}
@@ -0,0 +1,738 @@
+package up
+
+import (
+	"bytes"
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"up/checker"
+	"up/httpapi"
+)
+
+// graphQLField is a root field of the GraphQL API. Its objects have the
+// same fields as the JSON API, so the type they are returned as doubles as
+// the schema.
+type graphQLField struct {
+	args     []string
+	response any
+	resolve  func(s *server, args graphQLArgs) (any, error)
+}
+
+var graphQLFields = map[string]graphQLField{
+	"checks": {
+		args:     []string{"target", "probe", "status", "from", "to", "limit"},
+		response: []checker.Result{},
+		resolve: func(s *server, args graphQLArgs) (any, error) {
+			from, to, err := args.timeRange()
+			if err != nil {
+				return nil, err
+			}
+			limit, err := args.int("limit", 500)
+			if err != nil {
+				return nil, err
+			}
+			return graphQLDBResult(queryChecks(s.db, args.string("target"), args.string("probe"), args.string("status"), from, to, limit))
+		},
+	},
+	"summaries": {
+		args:     []string{"probe", "byProbe", "window", "group"},
+		response: []summaryResult{},
+		resolve: func(s *server, args graphQLArgs) (any, error) {
+			window := s.cfg.Recent
+			if v := args.string("window"); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					return nil, fmt.Errorf("invalid window %q", v)
+				}
+				window = d
+			}
+			byProbe, _ := args["byProbe"].(bool)
+			return graphQLDBResult(querySummaries(s.db, &s.cfg, groupTargetNames(args.string("group")), args.string("probe"), byProbe, time.Now().Add(-window)))
+		},
+	},
+	"incidents": {
+		args:     []string{"target", "probe", "limit"},
+		response: []incident{},
+		resolve: func(s *server, args graphQLArgs) (any, error) {
+			limit, err := args.int("limit", 100)
+			if err != nil {
+				return nil, err
+			}
+			return graphQLDBResult(queryIncidents(s.db, args.string("target"), args.string("probe"), limit))
+		},
+	},
+	"speedtests": {
+		args:     []string{"provider", "from", "to", "limit"},
+		response: []speedTestResult{},
+		resolve: func(s *server, args graphQLArgs) (any, error) {
+			from, to, err := args.timeRange()
+			if err != nil {
+				return nil, err
+			}
+			limit, err := args.int("limit", 100)
+			if err != nil {
+				return nil, err
+			}
+			return graphQLDBResult(querySpeedTests(s.db, args.string("provider"), from, to, limit))
+		},
+	},
+}
+
+// queryChecks returns up to limit checks after from (and before to, if
+// set), newest first.
+func queryChecks(db *sql.DB, target, probe, status string, from, to time.Time, limit int) ([]checker.Result, error) {
+	query := `SELECT timestamp, target, status, latency_ms, maintenance, family, probe, attempts, failure, dns_ms, connect_ms, tls_ms, ttfb_ms
+		FROM checks WHERE timestamp > ?`
+	args := []any{from}
+	if !to.IsZero() {
+		query += ` AND timestamp <= ?`
+		args = append(args, to)
+	}
+	for column, v := range map[string]string{"target": target, "probe": probe, "status": status} {
+		if v != "" {
+			query += ` AND ` + column + ` = ?`
+			args = append(args, v)
+		}
+	}
+	query += ` ORDER BY timestamp DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []checker.Result{}
+	for rows.Next() {
+		var r checker.Result
+		if err := rows.Scan(&r.Timestamp, &r.Target, &r.Status, &r.LatencyMs, &r.Maintenance, &r.Family, &r.Probe, &r.Attempts, &r.Failure, &r.DNSMs, &r.ConnectMs, &r.TLSMs, &r.TTFBMs); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// graphQLDBResult hides database errors from clients, as the JSON API does.
+func graphQLDBResult[T any](v T, err error) (any, error) {
+	if err != nil {
+		slog.Error("GraphQL query failed", "error", err)
+		return nil, fmt.Errorf("database error")
+	}
+	return v, nil
+}
+
+type graphQLArgs map[string]any
+
+func (a graphQLArgs) string(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+func (a graphQLArgs) int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		if v > 0 {
+			return int(v), nil
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil && n > 0 {
+			return int(n), nil
+		}
+	}
+	return 0, fmt.Errorf("%s must be a positive integer", name)
+}
+
+// timeRange parses the from and to arguments, RFC 3339 timestamps. Without
+// from, everything up to the limit is returned.
+func (a graphQLArgs) timeRange() (from, to time.Time, err error) {
+	for _, arg := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := a.string(arg.name); v != "" {
+			if *arg.t, err = time.Parse(time.RFC3339, v); err != nil {
+				return from, to, fmt.Errorf("%s must be an RFC 3339 timestamp", arg.name)
+			}
+		}
+	}
+	return from, to, nil
+}
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   *graphQLObject `json:"data,omitempty"`
+	Errors []graphQLError `json:"errors,omitempty"`
+}
+
+// graphQLHandler serves /graphql, which answers queries (GET ?query= or a
+// POSTed JSON request) over checks, summaries, incidents, and speed tests.
+// Fragments, directives, mutations, and introspection are not supported.
+func (s *server) graphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := decodeJSONNumbers([]byte(v), &req.Variables); err != nil {
+				writeGraphQL(w, http.StatusBadRequest, graphQLResponse{Errors: []graphQLError{{Message: "invalid variables"}}})
+				return
+			}
+		}
+	case http.MethodPost:
+		d := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		d.UseNumber()
+		if err := d.Decode(&req); err != nil {
+			writeGraphQL(w, http.StatusBadRequest, graphQLResponse{Errors: []graphQLError{{Message: "invalid request body"}}})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	op, err := parseGraphQL(req.Query, req.OperationName)
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, graphQLResponse{Errors: []graphQLError{{Message: err.Error()}}})
+		return
+	}
+	writeGraphQL(w, http.StatusOK, s.executeGraphQL(op, req.Variables))
+}
+
+func decodeJSONNumbers(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func writeGraphQL(w http.ResponseWriter, status int, resp graphQLResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *server) executeGraphQL(op *graphQLOperation, vars map[string]any) graphQLResponse {
+	data := graphQLObject{}
+	var errs []graphQLError
+	for _, f := range op.selection {
+		key := cmp.Or(f.alias, f.name)
+		value, err := s.resolveGraphQL(f, op, vars)
+		if err != nil {
+			errs = append(errs, graphQLError{Message: err.Error(), Path: []any{key}})
+		}
+		data = append(data, graphQLEntry{key, value})
+	}
+	return graphQLResponse{Data: &data, Errors: errs}
+}
+
+func (s *server) resolveGraphQL(f graphQLSelection, op *graphQLOperation, vars map[string]any) (any, error) {
+	if f.name == "__typename" {
+		return "Query", nil
+	}
+	field, ok := graphQLFields[f.name]
+	if !ok {
+		return nil, fmt.Errorf("cannot query field %q on type Query", f.name)
+	}
+	args := graphQLArgs{}
+	for name, v := range f.args {
+		if !slices.Contains(field.args, name) {
+			return nil, fmt.Errorf("unknown argument %q on field %q", name, f.name)
+		}
+		v, err := op.value(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			args[name] = v
+		}
+	}
+
+	value, err := field.resolve(s, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round-trip through JSON so objects have the JSON API's field names.
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := decodeJSONNumbers(data, &generic); err != nil {
+		return nil, err
+	}
+	schemas := map[string]any{}
+	schema := httpapi.JSONSchema(reflect.TypeOf(field.response), schemas)
+	return projectGraphQL(generic, schema, schemas, f.selection, f.name)
+}
+
+// projectGraphQL picks the selected fields out of a JSON value, checking
+// them against its schema.
+func projectGraphQL(v any, schema, schemas map[string]any, sel []graphQLSelection, path string) (any, error) {
+	schema = derefSchema(schema, schemas)
+	switch schema["type"] {
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		list, _ := v.([]any)
+		if len(list) == 0 {
+			// Still check the selection, so mistakes show up before there
+			// is data.
+			if _, err := projectGraphQL(nil, items, schemas, sel, path); err != nil {
+				return nil, err
+			}
+			return []any{}, nil
+		}
+		out := []any{}
+		for _, item := range list {
+			p, err := projectGraphQL(item, items, schemas, sel, path)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+		return out, nil
+	case "object":
+		props, ok := schema["properties"].(map[string]any)
+		if !ok {
+			break // a map, returned whole as a scalar
+		}
+		if sel == nil {
+			return nil, fmt.Errorf("field %q must have a selection of subfields", path)
+		}
+		m, _ := v.(map[string]any)
+		out := graphQLObject{}
+		for _, f := range sel {
+			key := cmp.Or(f.alias, f.name)
+			if f.name == "__typename" {
+				name, _ := schema["x-name"].(string)
+				out = append(out, graphQLEntry{key, name})
+				continue
+			}
+			prop, ok := props[f.name].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot query field %q on %q", f.name, path)
+			}
+			if len(f.args) > 0 {
+				return nil, fmt.Errorf("field %q takes no arguments", f.name)
+			}
+			p, err := projectGraphQL(m[f.name], prop, schemas, f.selection, f.name)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, graphQLEntry{key, p})
+		}
+		if v == nil {
+			return nil, nil
+		}
+		return out, nil
+	}
+	if sel != nil {
+		return nil, fmt.Errorf("field %q has no subfields", path)
+	}
+	return v, nil
+}
+
+// derefSchema follows $ref and the allOf wrapper used for nullable refs,
+// remembering the type name for __typename.
+func derefSchema(s, schemas map[string]any) map[string]any {
+	if all, ok := s["allOf"].([]any); ok && len(all) == 1 {
+		s, _ = all[0].(map[string]any)
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		t, _ := schemas[name].(map[string]any)
+		out := map[string]any{"x-name": name}
+		for k, v := range t {
+			out[k] = v
+		}
+		return out
+	}
+	return s
+}
+
+// graphQLObject is a JSON object that keeps its fields in the order they
+// were selected, as GraphQL responses do.
+type graphQLObject []graphQLEntry
+
+type graphQLEntry struct {
+	key   string
+	value any
+}
+
+func (o graphQLObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.key)
+		v, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// graphQLOperation is a parsed query operation.
+type graphQLOperation struct {
+	name      string
+	defaults  map[string]any
+	selection []graphQLSelection
+}
+
+type graphQLSelection struct {
+	alias, name string
+	args        map[string]any
+	selection   []graphQLSelection
+}
+
+// graphQLVariable is a $variable reference in an argument.
+type graphQLVariable string
+
+// value resolves variables in an argument value.
+func (op *graphQLOperation) value(v any, vars map[string]any) (any, error) {
+	switch v := v.(type) {
+	case graphQLVariable:
+		if val, ok := vars[string(v)]; ok {
+			return val, nil
+		}
+		if def, ok := op.defaults[string(v)]; ok {
+			return def, nil
+		}
+		if _, declared := op.defaults[string(v)]; !declared {
+			return nil, fmt.Errorf("variable $%s is not defined", v)
+		}
+		return nil, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			var err error
+			if out[i], err = op.value(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+type graphQLToken struct {
+	kind  byte // 'n'ame, 's'tring, 'i'nt, 'f'loat, 'p'unctuator, or 0 at the end
+	value string
+}
+
+func lexGraphQL(src string) ([]graphQLToken, error) {
+	var toks []graphQLToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, graphQLToken{'p', "..."})
+			i += 3
+		case strings.ContainsRune("!$():=@[]{}|", rune(c)):
+			toks = append(toks, graphQLToken{'p', string(c)})
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, graphQLToken{'n', src[i:j]})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j, kind := i+1, byte('i')
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				if strings.IndexByte(".eE", src[j]) >= 0 {
+					kind = 'f'
+				}
+				j++
+			}
+			toks = append(toks, graphQLToken{kind, src[i:j]})
+			i = j
+		case c == '"':
+			if strings.HasPrefix(src[i:], `"""`) {
+				return nil, fmt.Errorf("block strings are not supported")
+			}
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			// GraphQL strings use JSON's escapes.
+			var s string
+			if err := json.Unmarshal([]byte(src[i:j+1]), &s); err != nil {
+				return nil, fmt.Errorf("invalid string %s", src[i:j+1])
+			}
+			toks = append(toks, graphQLToken{'s', s})
+			i = j + 1
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return append(toks, graphQLToken{}), nil
+}
+
+type graphQLParser struct {
+	toks []graphQLToken
+	pos  int
+}
+
+// parseGraphQL parses a query document and returns the operation to run.
+func parseGraphQL(src, operationName string) (*graphQLOperation, error) {
+	toks, err := lexGraphQL(src)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error: %v", err)
+	}
+	p := &graphQLParser{toks: toks}
+	var ops []*graphQLOperation
+	for p.peek().kind != 0 {
+		op, err := p.operation()
+		if err != nil {
+			return nil, fmt.Errorf("syntax error: %v", err)
+		}
+		ops = append(ops, op)
+	}
+	switch {
+	case len(ops) == 0:
+		return nil, fmt.Errorf("no query")
+	case operationName != "":
+		for _, op := range ops {
+			if op.name == operationName {
+				return op, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown operation %q", operationName)
+	case len(ops) > 1:
+		return nil, fmt.Errorf("operationName is required with several operations")
+	}
+	return ops[0], nil
+}
+
+func (p *graphQLParser) peek() graphQLToken { return p.toks[p.pos] }
+
+func (p *graphQLParser) next() graphQLToken {
+	t := p.toks[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *graphQLParser) accept(punct string) bool {
+	if t := p.peek(); t.kind == 'p' && t.value == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *graphQLParser) expect(punct string) error {
+	if !p.accept(punct) {
+		return fmt.Errorf("expected %q, found %q", punct, p.peek().value)
+	}
+	return nil
+}
+
+func (p *graphQLParser) name() (string, error) {
+	t := p.next()
+	if t.kind != 'n' {
+		return "", fmt.Errorf("expected a name, found %q", t.value)
+	}
+	return t.value, nil
+}
+
+func (p *graphQLParser) operation() (*graphQLOperation, error) {
+	op := &graphQLOperation{defaults: map[string]any{}}
+	if t := p.peek(); t.kind == 'n' {
+		switch t.value {
+		case "query":
+			p.next()
+		case "mutation", "subscription":
+			return nil, fmt.Errorf("%ss are not supported", t.value)
+		case "fragment":
+			return nil, fmt.Errorf("fragments are not supported")
+		default:
+			return nil, fmt.Errorf("unexpected %q", t.value)
+		}
+		if p.peek().kind == 'n' {
+			op.name = p.next().value
+		}
+		if p.accept("(") {
+			for !p.accept(")") {
+				if err := p.expect("$"); err != nil {
+					return nil, err
+				}
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if err := p.skipType(); err != nil {
+					return nil, err
+				}
+				op.defaults[name] = nil
+				if p.accept("=") {
+					if op.defaults[name], err = p.value(); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	sel, err := p.selectionSet()
+	op.selection = sel
+	return op, err
+}
+
+// skipType skips a variable's type; values are checked by the fields that
+// use them.
+func (p *graphQLParser) skipType() error {
+	if p.accept("[") {
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	p.accept("!")
+	return nil
+}
+
+func (p *graphQLParser) selectionSet() ([]graphQLSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sel []graphQLSelection
+	for !p.accept("}") {
+		if p.peek().value == "..." {
+			return nil, fmt.Errorf("fragments are not supported")
+		}
+		var f graphQLSelection
+		var err error
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if p.accept(":") {
+			f.alias = f.name
+			if f.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.accept("(") {
+			f.args = map[string]any{}
+			for !p.accept(")") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if f.args[name], err = p.value(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if p.peek().value == "@" {
+			return nil, fmt.Errorf("directives are not supported")
+		}
+		if p.peek().value == "{" {
+			if f.selection, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		sel = append(sel, f)
+	}
+	if sel == nil {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return sel, nil
+}
+
+func (p *graphQLParser) value() (any, error) {
+	t := p.next()
+	switch t.kind {
+	case 's':
+		return t.value, nil
+	case 'i':
+		return strconv.ParseInt(t.value, 10, 64)
+	case 'f':
+		return strconv.ParseFloat(t.value, 64)
+	case 'n':
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t.value, nil // an enum value
+	case 'p':
+		switch t.value {
+		case "$":
+			name, err := p.name()
+			return graphQLVariable(name), err
+		case "[":
+			list := []any{}
+			for !p.accept("]") {
+				v, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		case "{":
+			return nil, fmt.Errorf("input objects are not supported")
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q", t.value)
+}
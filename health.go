@@ -0,0 +1,47 @@
+package up
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// lastCheckRun holds the unix nanosecond timestamp of the most recent check
+// round, used by the readiness probe to detect a stalled check loop.
+var lastCheckRun atomic.Int64
+
+func markCheckRun(t time.Time) {
+	lastCheckRun.Store(t.UnixNano())
+}
+
+func (s *server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (s *server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+
+	if err := s.db.PingContext(r.Context()); err != nil {
+		checks["db"] = err.Error()
+		ready = false
+	} else {
+		checks["db"] = "ok"
+	}
+
+	last := time.Unix(0, lastCheckRun.Load())
+	if since := time.Since(last); since > 2*s.cfg.CheckInterval {
+		checks["checks"] = "last check ran " + since.Round(time.Second).String() + " ago"
+		ready = false
+	} else {
+		checks["checks"] = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(checks)
+}
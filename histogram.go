@@ -0,0 +1,122 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+const maxHistogramBuckets = 50
+
+// latencyHistogram counts a target's successful checks by latency. Counts
+// has one entry per bound, counting latencies up to and including it, plus
+// a last entry for everything slower.
+type latencyHistogram struct {
+	Target string    `json:"target"`
+	Bounds []float64 `json:"bounds_ms"`
+	Counts []int     `json:"counts"`
+	Total  int       `json:"total"`
+}
+
+// histogramHandler serves latency histograms over the last ?window=
+// (default 24h) for every target or just ?target=, with the bucket bounds
+// in ?buckets= (default those of the OpenTelemetry export).
+func (s *server) histogramHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	window := 24 * time.Hour
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	bounds := otelDurationBounds
+	if v := q.Get("buckets"); v != "" {
+		var err error
+		if bounds, err = parseHistogramBounds(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	names := targetNames()
+	if target := q.Get("target"); target != "" {
+		names = []string{target}
+	}
+
+	histograms, err := queryLatencyHistograms(s.db, names, q.Get("probe"), bounds, time.Now().Add(-window))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(histograms)
+}
+
+// parseHistogramBounds parses comma-separated, increasing bucket bounds in
+// milliseconds, such as "10,50,100,500".
+func parseHistogramBounds(s string) ([]float64, error) {
+	var bounds []float64
+	for _, part := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || b < 0 {
+			return nil, fmt.Errorf("invalid bucket bound %q", part)
+		}
+		if len(bounds) > 0 && b <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("bucket bounds must be increasing")
+		}
+		bounds = append(bounds, b)
+	}
+	if len(bounds) > maxHistogramBuckets {
+		return nil, fmt.Errorf("at most %d bucket bounds are allowed", maxHistogramBuckets)
+	}
+	return bounds, nil
+}
+
+func queryLatencyHistograms(db *sql.DB, names []string, probe string, bounds []float64, since time.Time) ([]latencyHistogram, error) {
+	// The bucket index is computed in SQL, so only one row per bucket
+	// comes back rather than every check.
+	var bucket strings.Builder
+	var args []any
+	bucket.WriteString("CASE")
+	for i, b := range bounds {
+		fmt.Fprintf(&bucket, " WHEN latency_ms <= ? THEN %d", i)
+		args = append(args, b)
+	}
+	fmt.Fprintf(&bucket, " ELSE %d END", len(bounds))
+
+	histograms := []latencyHistogram{}
+	for _, name := range names {
+		h := latencyHistogram{Target: name, Bounds: bounds, Counts: make([]int, len(bounds)+1)}
+		rows, err := db.Query(`
+			SELECT `+bucket.String()+` AS bucket, COUNT(*)
+			FROM checks
+			WHERE target = ? AND timestamp > ? AND `+checker.AnsweredSQL+` AND maintenance = 0 AND (? = '' OR probe = ?)
+			GROUP BY bucket`, append(args, name, since, probe, probe)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var i, n int
+			if err := rows.Scan(&i, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			h.Counts[i] = n
+			h.Total += n
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		histograms = append(histograms, h)
+	}
+	return histograms, nil
+}
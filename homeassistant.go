@@ -0,0 +1,56 @@
+package up
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// homeAssistantConfig is a Home Assistant MQTT discovery payload for a
+// binary_sensor that is on while the target is up. Every field of the
+// latest check result, including the latency and phase timings, becomes an
+// attribute of the sensor.
+type homeAssistantConfig struct {
+	Name                string              `json:"name"`
+	UniqueID            string              `json:"unique_id"`
+	ObjectID            string              `json:"object_id"`
+	DeviceClass         string              `json:"device_class"`
+	StateTopic          string              `json:"state_topic"`
+	ValueTemplate       string              `json:"value_template"`
+	JSONAttributesTopic string              `json:"json_attributes_topic"`
+	AvailabilityTopic   string              `json:"availability_topic"`
+	Device              homeAssistantDevice `json:"device"`
+}
+
+type homeAssistantDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// announceHomeAssistant publishes the retained discovery config for a
+// target, so it shows up in Home Assistant without any YAML.
+func announceHomeAssistant(cfg *Config, c *mqttClient, target string) error {
+	slug := targetSlug(target)
+	node := targetSlug(cfg.MQTTClientID)
+	id := "up_" + strings.ReplaceAll(slug, "-", "_")
+	topic := cfg.MQTTTopic + "/checks/" + slug
+	payload, err := json.Marshal(homeAssistantConfig{
+		Name:                target,
+		UniqueID:            node + "_" + id,
+		ObjectID:            id,
+		DeviceClass:         "connectivity",
+		StateTopic:          topic,
+		ValueTemplate:       "{{ 'ON' if value_json.Status in ['up', 'degraded'] else 'OFF' }}",
+		JSONAttributesTopic: topic,
+		AvailabilityTopic:   cfg.MQTTTopic + "/status",
+		Device: homeAssistantDevice{
+			Identifiers:  []string{cfg.MQTTClientID},
+			Name:         "up (" + cfg.MQTTClientID + ")",
+			Manufacturer: "up",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return c.publish(cfg.HomeAssistantDiscovery+"/binary_sensor/"+node+"/"+id+"/config", payload, true)
+}
@@ -0,0 +1,224 @@
+// Package httpapi serves a JSON API: it registers its routes with CORS,
+// compression, and rate limiting, and documents them with OpenAPI.
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Route is a JSON endpoint of the API. The OpenAPI document is generated
+// from the routes.
+type Route struct {
+	Method string
+	// Path is the original path; V1 is the path under the API's prefix.
+	// Doc is the path as documented, when it differs from V1.
+	Path, V1, Doc string
+	Summary       string
+	Params        []Param
+	// Auth marks routes that need a bearer token.
+	Auth bool
+	// Request and Response are values of the body types; a nil Response
+	// means 204 No Content.
+	Request, Response any
+	Handler           http.HandlerFunc
+}
+
+// Param is a query parameter, or a path parameter if it appears in the
+// documented path.
+type Param struct {
+	Name, Description string
+}
+
+// API holds what a set of routes share.
+type API struct {
+	// Prefix is where the versioned routes are served, e.g. "/api/v1".
+	Prefix string
+	// Title and Version describe the API in its OpenAPI document.
+	Title, Version string
+	// CORSOrigins are the origins allowed to call the API from a browser,
+	// or "*" for any, with CORSMethods the methods they may use.
+	CORSOrigins []string
+	CORSMethods string
+	// Limiter rate limits the routes that don't need auth; nil disables
+	// it.
+	Limiter *RateLimiter
+}
+
+// Register serves the routes at their original paths and under Prefix,
+// along with the OpenAPI document, with CORS applied and responses
+// compressed for clients that accept it. Routes that don't need auth are
+// subject to the rate limit.
+func (a *API) Register(mux *http.ServeMux, routes []Route) {
+	seen := map[string]bool{}
+	for _, r := range routes {
+		h := Compress(r.Handler)
+		if !r.Auth {
+			h = a.Limiter.Limit(h)
+		}
+		for _, p := range []string{r.Path, a.Prefix + r.V1} {
+			if !seen[p] {
+				seen[p] = true
+				mux.HandleFunc(p, a.CORS(h))
+			}
+		}
+	}
+
+	doc, _ := json.Marshal(a.OpenAPIDocument(routes))
+	mux.HandleFunc(a.Prefix+"/openapi.json", a.CORS(Compress(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})))
+}
+
+// OpenAPIDocument describes the routes under Prefix as an OpenAPI 3
+// document.
+func (a *API) OpenAPIDocument(routes []Route) map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]map[string]any{}
+	for _, r := range routes {
+		path := a.Prefix + r.V1
+		if r.Doc != "" {
+			path = a.Prefix + r.Doc
+		}
+		op := map[string]any{"summary": r.Summary}
+
+		var params []map[string]any
+		for _, p := range r.Params {
+			in := "query"
+			if strings.Contains(path, "{"+p.Name+"}") {
+				in = "path"
+			}
+			params = append(params, map[string]any{
+				"name":        p.Name,
+				"in":          in,
+				"required":    in == "path",
+				"description": p.Description,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if r.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": JSONSchema(reflect.TypeOf(r.Request), schemas)}},
+			}
+		}
+		if r.Response != nil {
+			op["responses"] = map[string]any{"200": map[string]any{
+				"description": "OK",
+				"content":     map[string]any{"application/json": map[string]any{"schema": JSONSchema(reflect.TypeOf(r.Response), schemas)}},
+			}}
+		} else {
+			op["responses"] = map[string]any{"204": map[string]any{"description": "No Content"}}
+		}
+		if r.Auth {
+			op["security"] = []map[string]any{{"bearer": []string{}}}
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(r.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": a.Title, "version": a.Version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas":         schemas,
+			"securitySchemes": map[string]any{"bearer": map[string]any{"type": "http", "scheme": "bearer"}},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// JSONSchema describes how encoding/json encodes values of type t. Named
+// structs are added to schemas and referenced.
+func JSONSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := JSONSchema(t.Elem(), schemas)
+		if _, ref := s["$ref"]; ref {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": JSONSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": JSONSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // placeholder in case the type refers to itself
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	props := map[string]any{}
+	var required []string
+	addStructFields(t, schemas, props, &required)
+	s := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
+
+// addStructFields adds the fields encoding/json would encode, including
+// those promoted from embedded structs.
+func addStructFields(t reflect.Type, schemas map[string]any, props map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addStructFields(f.Type, schemas, props, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = JSONSchema(f.Type, schemas)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
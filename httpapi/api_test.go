@@ -0,0 +1,252 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type item struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Note    string    `json:"note,omitempty"`
+	// secret is unexported, so it isn't in the schema.
+	secret string
+}
+
+func newTestMux(a *API) *http.ServeMux {
+	mux := http.NewServeMux()
+	a.Register(mux, []Route{
+		{Method: "GET", Path: "/items", V1: "/items", Summary: "List items",
+			Params:   []Param{{Name: "limit", Description: "Maximum number of items"}},
+			Response: []item{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode([]item{{Name: "a"}})
+			}},
+		{Method: "DELETE", Path: "/items/", V1: "/items/", Doc: "/items/{name}", Summary: "Remove an item", Auth: true,
+			Params: []Param{{Name: "name", Description: "Item name"}}, Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}},
+	})
+	return mux
+}
+
+func serve(mux *http.ServeMux, req *http.Request) *http.Response {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestRegister(t *testing.T) {
+	mux := newTestMux(&API{Prefix: "/api/v1", Title: "test", Version: "1"})
+	for _, path := range []string{"/items", "/api/v1/items"} {
+		resp := serve(mux, httptest.NewRequest("GET", path, nil))
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", path, resp.StatusCode)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/items", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := serve(mux, req)
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []item
+	if err := json.NewDecoder(zr).Decode(&items); err != nil || len(items) != 1 {
+		t.Errorf("decoded %v, %v; want one item", items, err)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	mux := newTestMux(&API{Prefix: "/api/v1", Title: "test", Version: "1"})
+	resp := serve(mux, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	var doc struct {
+		Info  map[string]string `json:"info"`
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			Responses map[string]any   `json:"responses"`
+			Security  []map[string]any `json:"security"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info["title"] != "test" {
+		t.Errorf("title = %q, want test", doc.Info["title"])
+	}
+
+	list := doc.Paths["/api/v1/items"]["get"]
+	if len(list.Parameters) != 1 || list.Parameters[0].In != "query" {
+		t.Errorf("GET /items parameters = %+v, want one query parameter", list.Parameters)
+	}
+	if _, ok := list.Responses["200"]; !ok || list.Security != nil {
+		t.Errorf("GET /items: responses %v, security %v", list.Responses, list.Security)
+	}
+	del := doc.Paths["/api/v1/items/{name}"]["delete"]
+	if len(del.Parameters) != 1 || del.Parameters[0].In != "path" {
+		t.Errorf("DELETE /items/{name} parameters = %+v, want one path parameter", del.Parameters)
+	}
+	if _, ok := del.Responses["204"]; !ok || del.Security == nil {
+		t.Errorf("DELETE /items/{name}: responses %v, security %v", del.Responses, del.Security)
+	}
+
+	schema := doc.Components.Schemas["Item"]
+	if len(schema.Properties) != 3 {
+		t.Errorf("Item properties = %v, want name, created, and note", schema.Properties)
+	}
+	if schema.Properties["created"]["format"] != "date-time" {
+		t.Errorf("created = %v, want a date-time", schema.Properties["created"])
+	}
+	if len(schema.Required) != 2 {
+		t.Errorf("Item required = %v, want name and created", schema.Required)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	mux := newTestMux(&API{Prefix: "/api/v1", CORSOrigins: []string{"https://dash.example.com"}, CORSMethods: "GET, POST"})
+
+	req := httptest.NewRequest("OPTIONS", "/api/v1/items", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	resp := serve(mux, req)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("preflight status %d, want 204", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("Access-Control-Allow-Methods = %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/items", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp = serve(mux, req)
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("other origin allowed: %q", got)
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	got := ParseOrigins(" https://a.example.com/, ,https://b.example.com")
+	if len(got) != 2 || got[0] != "https://a.example.com" || got[1] != "https://b.example.com" {
+		t.Errorf("ParseOrigins = %q", got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	mux := newTestMux(&API{Prefix: "/api/v1", Limiter: NewRateLimiter(1, 2)})
+	get := func(addr string) *http.Response {
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.RemoteAddr = addr
+		return serve(mux, req)
+	}
+	for range 2 {
+		if resp := get("192.0.2.1:1234"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d within the burst, want 200", resp.StatusCode)
+		}
+	}
+	resp := get("192.0.2.1:1234")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status %d over the limit, want 429", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("Retry-After = %q, want 1", resp.Header.Get("Retry-After"))
+	}
+	if resp := get("192.0.2.2:1234"); resp.StatusCode != http.StatusOK {
+		t.Errorf("another client got %d, want 200", resp.StatusCode)
+	}
+
+	// Routes that need auth aren't limited.
+	req := httptest.NewRequest("DELETE", "/items/a", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if resp := serve(mux, req); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("auth route got %d, want 204", resp.StatusCode)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := NewRateLimiter(2, 1)
+	now := time.Now()
+	if ok, _ := l.allow("a", now); !ok {
+		t.Fatal("first request refused")
+	}
+	if ok, wait := l.allow("a", now); ok || wait != 500*time.Millisecond {
+		t.Fatalf("second request: allowed %v, wait %v; want refused for 500ms", ok, wait)
+	}
+	if ok, _ := l.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("request after refill refused")
+	}
+}
+
+func TestBearerTokenMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"Bearer s3cret", true},
+		{"Bearer wrong", false},
+		{"Basic s3cret", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if got := BearerTokenMatches(req, "s3cret"); got != tt.want {
+			t.Errorf("BearerTokenMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressSkipsNoContent(t *testing.T) {
+	h := Compress(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, deflate")
+	w := httptest.NewRecorder()
+	h(w, req)
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q for 204", got)
+	}
+	body, _ := io.ReadAll(w.Result().Body)
+	if len(body) != 0 {
+		t.Errorf("body %q for 204", body)
+	}
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := map[string]string{
+		"gzip, deflate":     "gzip",
+		"gzip;q=0, deflate": "deflate",
+		"br":                "",
+		"":                  "",
+		"GZIP;q=0.5":        "gzip",
+	}
+	for header, want := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if got := acceptedEncoding(req); got != want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	gzipWriters  = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	flateWriters = sync.Pool{New: func() any { w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression); return w }}
+)
+
+// acceptedEncoding picks gzip or deflate from the Accept-Encoding header,
+// preferring gzip, or returns "" for neither.
+func acceptedEncoding(r *http.Request) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		accepted[strings.ToLower(strings.TrimSpace(coding))] = q > 0
+	}
+	for _, coding := range []string{"gzip", "deflate"} {
+		if accepted[coding] {
+			return coding
+		}
+	}
+	return ""
+}
+
+// Compress compresses responses for clients that accept gzip or deflate.
+func Compress(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		coding := acceptedEncoding(r)
+		if coding == "" || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, coding: coding}
+		defer cw.close()
+		h(cw, r)
+	}
+}
+
+// compressWriter compresses the body once the handler has written a status
+// that has one.
+type compressWriter struct {
+	http.ResponseWriter
+	coding      string
+	wroteHeader bool
+	w           io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	h := c.Header()
+	if code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", c.coding)
+		h.Del("Content-Length")
+		if c.coding == "gzip" {
+			gw := gzipWriters.Get().(*gzip.Writer)
+			gw.Reset(c.ResponseWriter)
+			c.w = gw
+		} else {
+			fw := flateWriters.Get().(*flate.Writer)
+			fw.Reset(c.ResponseWriter)
+			c.w = fw
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.w == nil {
+		return c.ResponseWriter.Write(p)
+	}
+	return c.w.Write(p)
+}
+
+func (c *compressWriter) close() {
+	switch w := c.w.(type) {
+	case *gzip.Writer:
+		w.Close()
+		gzipWriters.Put(w)
+	case *flate.Writer:
+		w.Close()
+		flateWriters.Put(w)
+	}
+}
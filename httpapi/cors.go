@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORS adds CORS headers for the allowed origins and answers preflight
+// requests, so a dashboard hosted elsewhere can fetch from the API.
+func (a *API) CORS(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(a.CORSOrigins) == 0 || origin == "" {
+			h(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		switch {
+		case slices.Contains(a.CORSOrigins, "*"):
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case slices.Contains(a.CORSOrigins, origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		default:
+			h(w, r)
+			return
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", a.CORSMethods)
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// ParseOrigins splits a comma-separated list of origins, dropping any
+// trailing slash so they compare equal to Origin headers.
+func ParseOrigins(s string) []string {
+	var origins []string
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSuffix(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
@@ -0,0 +1,196 @@
+package up
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The iCalendar feed lists maintenance from this long ago to this far
+// ahead. Recurring windows are expanded into one event per occurrence, so
+// calendars show them at the right time whatever their own time zone.
+const (
+	icalPast  = 30 * 24 * time.Hour
+	icalAhead = 90 * 24 * time.Hour
+)
+
+// icalEvent is a VEVENT.
+type icalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Start, End  time.Time
+}
+
+// occurrences returns when the window is active between from and to.
+func (m *maintenanceWindow) occurrences(from, to time.Time) [][2]time.Time {
+	if !m.From.IsZero() {
+		if m.From.Before(to) && m.To.After(from) {
+			return [][2]time.Time{{m.From, m.To}}
+		}
+		return nil
+	}
+
+	var spans [][2]time.Time
+	f := from.In(m.loc)
+	// Start a day early for a window running past midnight into from.
+	for day := time.Date(f.Year(), f.Month(), f.Day()-1, 0, 0, 0, 0, m.loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if m.weekdays != nil && !m.weekdays[day.Weekday()] {
+			continue
+		}
+		start := day.Add(m.startOffset)
+		end := start.Add(m.length)
+		if start.Before(to) && end.After(from) {
+			spans = append(spans, [2]time.Time{start, end})
+		}
+	}
+	return spans
+}
+
+// maintenanceEvents returns the maintenance windows' occurrences between
+// from and to as events.
+func maintenanceEvents(windows []maintenanceWindow, from, to time.Time, host string) []icalEvent {
+	var events []icalEvent
+	for _, m := range windows {
+		desc := "Applies to all targets."
+		if len(m.Targets) > 0 {
+			desc = "Applies to " + strings.Join(m.Targets, ", ") + "."
+		}
+		if m.Skip {
+			desc += " Checks are not run."
+		} else {
+			desc += " Checks don't count towards uptime or alerts."
+		}
+		h := fnv.New64a()
+		h.Write([]byte(m.Name))
+		for _, span := range m.occurrences(from, to) {
+			events = append(events, icalEvent{
+				UID:         fmt.Sprintf("maintenance-%x-%d@%s", h.Sum64(), span[0].Unix(), host),
+				Summary:     "Maintenance: " + m.Name,
+				Description: desc,
+				Start:       span[0],
+				End:         span[1],
+			})
+		}
+	}
+	return events
+}
+
+// maintenanceICalHandler serves the maintenance windows as an iCalendar
+// feed, to subscribe to from a calendar app. ?incidents=true adds the
+// incidents of the last 30 days; an ongoing one ends now.
+func (s *server) maintenanceICalHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	from, to := now.Add(-icalPast), now.Add(icalAhead)
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	targetsMu.RLock()
+	windows := maintenanceWindows
+	targetsMu.RUnlock()
+	events := maintenanceEvents(windows, from, to, host)
+
+	if withIncidents, _ := strconv.ParseBool(r.URL.Query().Get("incidents")); withIncidents {
+		incidents, err := queryIncidentsSince(s.db, from)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		for _, inc := range incidents {
+			e := incidentEntry(inc, r.Host, s.cfg.Timezone)
+			end := now
+			if inc.End != nil {
+				end = *inc.End
+			}
+			events = append(events, icalEvent{
+				UID:         fmt.Sprintf("incident-%d@%s", inc.ID, host),
+				Summary:     e.Title,
+				Description: e.Content,
+				Start:       inc.Start,
+				End:         end,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(buildICal(s.cfg.StatusPageTitle+" maintenance", events, now)))
+}
+
+// queryIncidentsSince returns the incidents that started after from or are
+// still open, oldest first.
+func queryIncidentsSince(db *sql.DB, from time.Time) ([]incident, error) {
+	rows, err := db.Query(`SELECT id, target, probe, start_time, end_time, check_count, classification FROM incidents
+		WHERE start_time >= ? OR end_time IS NULL ORDER BY start_time`, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var incidents []incident
+	for rows.Next() {
+		var inc incident
+		var end sql.NullTime
+		if err := rows.Scan(&inc.ID, &inc.Target, &inc.Probe, &inc.Start, &end, &inc.CheckCount, &inc.Classification); err != nil {
+			return nil, err
+		}
+		if end.Valid {
+			inc.End = &end.Time
+			inc.DurationSeconds = end.Time.Sub(inc.Start).Seconds()
+		} else {
+			inc.Ongoing = true
+			inc.DurationSeconds = time.Since(inc.Start).Seconds()
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
+
+// buildICal formats events as an iCalendar (RFC 5545) document, with times
+// in UTC.
+func buildICal(name string, events []icalEvent, now time.Time) string {
+	var b strings.Builder
+	line := func(s string) {
+		// Lines are folded at 75 octets, without splitting a UTF-8
+		// sequence.
+		for len(s) > 75 {
+			i := 75
+			for i > 0 && s[i]&0xc0 == 0x80 {
+				i--
+			}
+			b.WriteString(s[:i] + "\r\n")
+			s = " " + s[i:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+	stamp := func(t time.Time) string { return t.UTC().Format("20060102T150405Z") }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//up//maintenance//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icalText(name))
+	line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + stamp(now))
+		line("DTSTART:" + stamp(e.Start))
+		line("DTEND:" + stamp(e.End))
+		line("SUMMARY:" + icalText(e.Summary))
+		line("DESCRIPTION:" + icalText(e.Description))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// icalText escapes a TEXT value.
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,277 @@
+package up
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// importKeys are the columns that identify a row when deduplicating.
+var importKeys = map[string][]string{
+	"checks":     {"timestamp", "target"},
+	"speedtests": {"timestamp", "provider"},
+}
+
+// runImportCommand implements `up import`, loading rows written by
+// `up export` or merging another instance's database. Rows whose timestamp
+// and target (or provider) already exist are skipped.
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var cfg Config
+	common := cfg.addCommonFlags(fs)
+	table := fs.String("table", "checks", "Table CSV and JSON files are imported into: checks or speedtests")
+	format := fs.String("format", "", "Input format: csv, json, or sqlite (default: from the file extension)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: up import [flags] file...\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := common.setup(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if _, ok := exportColumns[*table]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown table %q\n", *table)
+		return 2
+	}
+
+	if err := openDB(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	for _, path := range fs.Args() {
+		f := *format
+		if f == "" {
+			f = importFormat(path)
+		}
+
+		var err error
+		switch f {
+		case "sqlite":
+			err = importDatabase(path)
+		case "csv", "json":
+			err = importFile(path, *table, f)
+		default:
+			err = fmt.Errorf("unknown format %q", f)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func importFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".db", ".sqlite", ".sqlite3":
+		return "sqlite"
+	}
+	return ""
+}
+
+// importFile imports a CSV or JSON file as written by `up export`.
+func importFile(path, table, format string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var records []map[string]any
+	switch format {
+	case "csv":
+		records, err = readCSVRecords(f)
+	case "json":
+		err = json.NewDecoder(f).Decode(&records)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", format, err)
+	}
+
+	if len(records) == 0 {
+		fmt.Printf("%s: no rows to import\n", path)
+		return nil
+	}
+
+	var columns []string
+	for _, c := range exportColumns[table] {
+		if _, ok := records[0][c]; ok {
+			columns = append(columns, c)
+		}
+	}
+	for _, k := range importKeys[table] {
+		if !slices.Contains(columns, k) {
+			return fmt.Errorf("missing %s column", k)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	keys := importKeys[table]
+	var match []string
+	for _, k := range keys {
+		match = append(match, k+" = ?")
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s)`,
+		table, strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+		table, strings.Join(match, " AND ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var imported int64
+	for i, rec := range records {
+		var values []any
+		for _, c := range columns {
+			v := rec[c]
+			if c == "timestamp" {
+				if v, err = parseImportTime(v); err != nil {
+					return fmt.Errorf("row %d: %v", i+1, err)
+				}
+			}
+			values = append(values, v)
+		}
+		for _, k := range keys {
+			values = append(values, values[slices.Index(columns, k)])
+		}
+		res, err := stmt.Exec(values...)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i+1, err)
+		}
+		n, _ := res.RowsAffected()
+		imported += n
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: imported %d of %d %s (%d duplicates skipped)\n", path, imported, len(records), table, int64(len(records))-imported)
+	return nil
+}
+
+func readCSVRecords(r io.Reader) ([]map[string]any, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	header := rows[0]
+	records := make([]map[string]any, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		rec := make(map[string]any, len(header))
+		for i, c := range header {
+			if i < len(row) {
+				rec[c] = row[i]
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// parseImportTime accepts the RFC 3339 timestamps written by export as well
+// as SQLite's own format.
+func parseImportTime(v any) (time.Time, error) {
+	s, _ := v.(string)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// importDatabase merges the checks and speed tests of another up database.
+// Columns the other database predates are left at their defaults.
+func importDatabase(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS src`, path); err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer conn.ExecContext(ctx, `DETACH DATABASE src`)
+
+	for _, table := range []string{"checks", "speedtests"} {
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf(`SELECT name FROM pragma_table_info('%s', 'src')`, table))
+		if err != nil {
+			return err
+		}
+		var srcColumns []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			srcColumns = append(srcColumns, name)
+		}
+		rows.Close()
+		if len(srcColumns) == 0 {
+			continue
+		}
+
+		var columns, match []string
+		for _, c := range exportColumns[table] {
+			if slices.Contains(srcColumns, c) {
+				columns = append(columns, c)
+			}
+		}
+		for _, k := range importKeys[table] {
+			if slices.Contains(srcColumns, k) {
+				match = append(match, fmt.Sprintf("m.%s = s.%s", k, k))
+			}
+		}
+
+		var total int64
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM src.%s`, table)).Scan(&total); err != nil {
+			return err
+		}
+		res, err := conn.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO main.%s (%s)
+			SELECT %s FROM src.%s s
+			WHERE NOT EXISTS (SELECT 1 FROM main.%s m WHERE %s)`,
+			table, strings.Join(columns, ", "), "s."+strings.Join(columns, ", s."), table, table, strings.Join(match, " AND ")))
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %v", table, err)
+		}
+		imported, _ := res.RowsAffected()
+		fmt.Printf("%s: imported %d of %d %s (%d duplicates skipped)\n", path, imported, total, table, total-imported)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+type incident struct {
+	ID              int64      `json:"id"`
+	Target          string     `json:"target"`
+	Probe           string     `json:"probe"`
+	Start           time.Time  `json:"start"`
+	End             *time.Time `json:"end"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	CheckCount      int        `json:"check_count"`
+	Ongoing         bool       `json:"ongoing"`
+	// Classification is where the outage was: "lan", "isp", or "remote".
+	Classification string `json:"classification,omitempty"`
+	// Path is the traceroute taken when the incident opened, with
+	// -traceroute.
+	Path []checker.PathHop `json:"path,omitempty"`
+	// Annotations are the notes made on the incident or its time range.
+	Annotations []annotation `json:"annotations,omitempty"`
+}
+
+var (
+	incidentMu    sync.Mutex
+	openIncidents = map[probeTarget]int64{}
+)
+
+// loadOpenIncidents restores incidents left open by a previous run so that
+// an outage spanning a restart stays a single incident.
+func loadOpenIncidents() error {
+	rows, err := db.Query(`SELECT id, target, probe FROM incidents WHERE end_time IS NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+	for rows.Next() {
+		var id int64
+		var key probeTarget
+		if err := rows.Scan(&id, &key.target, &key.probe); err != nil {
+			return err
+		}
+		openIncidents[key] = id
+	}
+	return rows.Err()
+}
+
+// trackIncident opens, extends, or closes the target's incident based on
+// the latest check result.
+func trackIncident(cfg *Config, r checker.Result) {
+	incidentMu.Lock()
+	defer incidentMu.Unlock()
+
+	key := probeTarget{r.Target, r.Probe}
+	id, open := openIncidents[key]
+	switch {
+	case !checker.Answered(r.Status) && !open:
+		res, err := db.Exec(`INSERT INTO incidents (target, probe, start_time, check_count) VALUES (?, ?, ?, 1)`, r.Target, r.Probe, r.Timestamp)
+		if err != nil {
+			slog.Error("Failed to open incident", "target", r.Target, "error", err)
+			return
+		}
+		id, _ := res.LastInsertId()
+		openIncidents[key] = id
+		slog.Warn("Incident opened", "target", r.Target, "probe", r.Probe, "incident", id)
+		// Only this server's own checks can be traced from here.
+		if cfg.TraceOnFailure && r.Probe == cfg.ProbeName {
+			go captureIncidentPath(id, r.Target)
+		}
+	case !checker.Answered(r.Status) && open:
+		if _, err := db.Exec(`UPDATE incidents SET check_count = check_count + 1 WHERE id = ?`, id); err != nil {
+			slog.Error("Failed to update incident", "incident", id, "error", err)
+		}
+	case checker.Answered(r.Status) && open:
+		if _, err := db.Exec(`UPDATE incidents SET end_time = ? WHERE id = ?`, r.Timestamp, id); err != nil {
+			slog.Error("Failed to close incident", "incident", id, "error", err)
+			return
+		}
+		delete(openIncidents, key)
+		slog.Info("Incident resolved", "target", r.Target, "incident", id)
+	}
+}
+
+func (s *server) incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	incidents, err := queryIncidents(s.db, r.URL.Query().Get("target"), r.URL.Query().Get("probe"), limit)
+	if err == nil {
+		err = annotateIncidents(s.db, incidents)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for i := range incidents {
+		inc := &incidents[i]
+		inc.Start = inc.Start.In(loc)
+		if inc.End != nil {
+			*inc.End = inc.End.In(loc)
+		}
+		for j := range inc.Annotations {
+			inc.Annotations[j].in(loc)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incidents)
+}
+
+// queryIncidents returns up to limit incidents, newest first, optionally
+// only for one target or probe.
+func queryIncidents(db *sql.DB, target, probe string, limit int) ([]incident, error) {
+	query := `SELECT id, target, probe, start_time, end_time, check_count, path, classification FROM incidents WHERE 1 = 1`
+	var args []any
+	if target != "" {
+		query += ` AND target = ?`
+		args = append(args, target)
+	}
+	if probe != "" {
+		query += ` AND probe = ?`
+		args = append(args, probe)
+	}
+	query += ` ORDER BY start_time DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []incident{}
+	for rows.Next() {
+		var inc incident
+		var end sql.NullTime
+		var path sql.NullString
+		if err := rows.Scan(&inc.ID, &inc.Target, &inc.Probe, &inc.Start, &end, &inc.CheckCount, &path, &inc.Classification); err != nil {
+			return nil, err
+		}
+		if path.Valid {
+			json.Unmarshal([]byte(path.String), &inc.Path)
+		}
+		if end.Valid {
+			inc.End = &end.Time
+			inc.DurationSeconds = end.Time.Sub(inc.Start).Seconds()
+		} else {
+			inc.Ongoing = true
+			inc.DurationSeconds = time.Since(inc.Start).Seconds()
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
@@ -0,0 +1,125 @@
+package up
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+const (
+	influxFlushInterval = 10 * time.Second
+	influxBatchBytes    = 64 << 10
+	// influxMaxBuffer bounds what is kept while InfluxDB is unreachable.
+	influxMaxBuffer = 4 << 20
+)
+
+// startInfluxExporter writes every check and speed test result to InfluxDB
+// using the v2 write API, in batches.
+func startInfluxExporter(cfg *Config) {
+	ch := events.subscribe()
+	client := checker.OutboundClient(cfg.ProxyURL)
+	client.Timeout = 30 * time.Second
+
+	endpoint := strings.TrimSuffix(cfg.InfluxURL, "/") + "/api/v2/write?" + url.Values{
+		"org":       {cfg.InfluxOrg},
+		"bucket":    {cfg.InfluxBucket},
+		"precision": {"ns"},
+	}.Encode()
+
+	go func() {
+		ticker := time.NewTicker(influxFlushInterval)
+		defer ticker.Stop()
+
+		var buf bytes.Buffer
+		flush := func() {
+			if buf.Len() == 0 {
+				return
+			}
+			if err := writeInflux(client, endpoint, cfg.InfluxToken, buf.Bytes()); err != nil {
+				slog.Error("Failed to write to InfluxDB", "bytes", buf.Len(), "error", err)
+				if buf.Len() > influxMaxBuffer {
+					slog.Warn("Dropping buffered InfluxDB points", "bytes", buf.Len())
+					buf.Reset()
+				}
+				return
+			}
+			buf.Reset()
+		}
+
+		for {
+			select {
+			case e := <-ch:
+				appendInfluxLine(&buf, e)
+				if buf.Len() >= influxBatchBytes {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	slog.Info("Exporting results to InfluxDB", "url", cfg.InfluxURL, "bucket", cfg.InfluxBucket)
+}
+
+// appendInfluxLine encodes check and speed test events as line protocol;
+// other events are ignored.
+func appendInfluxLine(buf *bytes.Buffer, e event) {
+	switch r := e.Data.(type) {
+	case checker.Result:
+		up := 0
+		if checker.Answered(r.Status) {
+			up = 1
+		}
+		fmt.Fprintf(buf, "checks%s up=%di,degraded=%t,latency_ms=%di,dns_ms=%di,connect_ms=%di,tls_ms=%di,ttfb_ms=%di,maintenance=%t %d\n",
+			influxTags("target", r.Target, "probe", r.Probe, "family", r.Family),
+			up, r.Status == "degraded", r.LatencyMs, r.DNSMs, r.ConnectMs, r.TLSMs, r.TTFBMs, r.Maintenance, r.Timestamp.UnixNano())
+	case speedTestResult:
+		fmt.Fprintf(buf, "speedtests%s download_mbps=%g,download_peak_mbps=%g,upload_mbps=%g,latency_ms=%di,loaded_latency_ms=%di,jitter_ms=%g,packet_loss_pct=%g %d\n",
+			influxTags("provider", r.Provider),
+			r.DownloadMbps, r.DownloadPeakMbps, r.UploadMbps, r.LatencyMs, r.LoadedLatencyMs, r.JitterMs, r.PacketLossPct, r.Timestamp.UnixNano())
+	}
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxTags formats key/value pairs as a line protocol tag set, skipping
+// empty values.
+func influxTags(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			continue
+		}
+		b.WriteString("," + kv[i] + "=" + influxTagEscaper.Replace(kv[i+1]))
+	}
+	return b.String()
+}
+
+func writeInflux(client *http.Client, endpoint, token string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influxdb returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package dnsmsg is a minimal DNS client: it builds queries, parses the
+// responses, and exchanges them with a given server over UDP.
+package dnsmsg
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+)
+
+// Record types.
+const (
+	TypeA     = 1
+	TypeCNAME = 5
+	TypePTR   = 12
+	TypeMX    = 15
+	TypeTXT   = 16
+	TypeAAAA  = 28
+	TypeSRV   = 33
+)
+
+// Types are the record types that can be asked for by name.
+var Types = map[string]uint16{
+	"A": TypeA, "AAAA": TypeAAAA, "CNAME": TypeCNAME, "MX": TypeMX, "TXT": TypeTXT,
+}
+
+// Rcodes names the error response codes.
+var Rcodes = map[int]string{
+	1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+}
+
+// RR is a resource record from a DNS response. Data is the undecoded
+// RDATA; Value is its text form for the types in Types and PTR and SRV,
+// such as "192.0.2.1", "10 mail.example.com.", or "0 0 80 host.local.".
+type RR struct {
+	Name  string
+	Type  uint16
+	TTL   uint32
+	Data  []byte
+	Value string
+}
+
+// Response is a parsed DNS response.
+type Response struct {
+	Rcode int
+	// Authenticated is the AD bit: a validating resolver checked the
+	// answer's DNSSEC signatures.
+	Authenticated bool
+	Answers       []RR
+	// Additional holds the authority and additional sections, where mDNS
+	// responders put the records that go with the answers.
+	Additional []RR
+}
+
+// Flags modify a query. DNSSECOK sets the DO bit, asking for DNSSEC
+// records; CheckingDisabled sets the CD bit, asking a validating resolver
+// to answer even if validation fails.
+type Flags struct {
+	DNSSECOK         bool
+	CheckingDisabled bool
+}
+
+// Exchange sends a single recursive query for name to server (host:port)
+// over UDP and returns the response. Unlike net.Resolver, it asks exactly
+// that server and doesn't consult the hosts file.
+func Exchange(ctx context.Context, server, name string, qtype uint16, flags Flags) (*Response, error) {
+	query, id, err := BuildQuery(name, qtype, flags)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray responses to other queries.
+		if n < 12 || binary.BigEndian.Uint16(buf) != id {
+			continue
+		}
+		return ParseResponse(buf[:n])
+	}
+}
+
+// BuildQuery returns a recursive query for name and its ID.
+func BuildQuery(name string, qtype uint16, flags Flags) ([]byte, uint16, error) {
+	id := uint16(rand.N(1 << 16))
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = append(msg, 0x01, 0x00) // RD
+	if flags.CheckingDisabled {
+		msg[3] |= 0x10
+	}
+	msg = append(msg, 0, 1, 0, 0, 0, 0, 0, 0)
+	if flags.DNSSECOK {
+		msg[11] = 1 // an OPT record follows the question
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // IN
+	if flags.DNSSECOK {
+		// EDNS0: root name, type OPT, a 4096-byte UDP payload size in the
+		// class, and the DO bit in the TTL.
+		msg = append(msg, 0, 0, 41, 0x10, 0x00, 0, 0, 0x80, 0, 0, 0)
+	}
+	return msg, id, nil
+}
+
+var errMalformed = errors.New("malformed DNS response")
+
+// ParseResponse parses the DNS message b.
+func ParseResponse(b []byte) (*Response, error) {
+	if len(b) < 12 {
+		return nil, errMalformed
+	}
+	if b[2]&0x02 != 0 {
+		return nil, errors.New("truncated DNS response")
+	}
+	resp := &Response{Rcode: int(b[3] & 0x0f), Authenticated: b[3]&0x20 != 0}
+	qdcount := int(binary.BigEndian.Uint16(b[4:]))
+	ancount := int(binary.BigEndian.Uint16(b[6:]))
+	nscount := int(binary.BigEndian.Uint16(b[8:]))
+	arcount := int(binary.BigEndian.Uint16(b[10:]))
+
+	off := 12
+	for range qdcount {
+		_, next, err := readName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next + 4
+	}
+	for i := range ancount + nscount + arcount {
+		rr, next, err := readRR(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next
+		if i < ancount {
+			resp.Answers = append(resp.Answers, rr)
+		} else {
+			resp.Additional = append(resp.Additional, rr)
+		}
+	}
+	return resp, nil
+}
+
+// readRR reads the resource record at off and returns it with the
+// offset just past it.
+func readRR(b []byte, off int) (RR, int, error) {
+	name, off, err := readName(b, off)
+	if err != nil {
+		return RR{}, 0, err
+	}
+	if off+10 > len(b) {
+		return RR{}, 0, errMalformed
+	}
+	rr := RR{
+		Name: name,
+		Type: binary.BigEndian.Uint16(b[off:]),
+		TTL:  binary.BigEndian.Uint32(b[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	off += 10
+	if off+length > len(b) {
+		return RR{}, 0, errMalformed
+	}
+	rr.Data = b[off : off+length]
+	if rr.Value, err = rrValue(b, off, rr); err != nil {
+		return RR{}, 0, err
+	}
+	return rr, off + length, nil
+}
+
+// rrValue formats the RDATA of rr, which starts at off in the message
+// b; names in it may point elsewhere in the message.
+func rrValue(b []byte, off int, rr RR) (string, error) {
+	switch rr.Type {
+	case TypeA, TypeAAAA:
+		size := net.IPv4len
+		if rr.Type == TypeAAAA {
+			size = net.IPv6len
+		}
+		if len(rr.Data) != size {
+			return "", errMalformed
+		}
+		return net.IP(rr.Data).String(), nil
+	case TypeCNAME, TypePTR:
+		name, _, err := readName(b, off)
+		return name, err
+	case TypeMX:
+		if len(rr.Data) < 3 {
+			return "", errMalformed
+		}
+		name, _, err := readName(b, off+2)
+		return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(rr.Data), name), err
+	case TypeSRV:
+		if len(rr.Data) < 7 {
+			return "", errMalformed
+		}
+		name, _, err := readName(b, off+6)
+		return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(rr.Data), binary.BigEndian.Uint16(rr.Data[2:]), binary.BigEndian.Uint16(rr.Data[4:]), name), err
+	case TypeTXT:
+		var txt strings.Builder
+		for data := rr.Data; len(data) > 0; {
+			n := int(data[0])
+			if 1+n > len(data) {
+				return "", errMalformed
+			}
+			txt.Write(data[1 : 1+n])
+			data = data[1+n:]
+		}
+		return txt.String(), nil
+	}
+	return "", nil
+}
+
+// readName reads a possibly compressed name at off and returns it with
+// the offset just past it.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errMalformed
+		}
+		n := int(b[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(b) || jumps > 10 {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+n > len(b) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(b[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// Lookup resolves name's A records on server, treating an error rcode
+// or an empty answer as a failure.
+func Lookup(ctx context.Context, server, name string) ([]net.IP, error) {
+	resp, err := Exchange(ctx, server, name, TypeA, Flags{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != 0 {
+		if s, ok := Rcodes[resp.Rcode]; ok {
+			return nil, fmt.Errorf("%s: %s", name, s)
+		}
+		return nil, fmt.Errorf("%s: rcode %d", name, resp.Rcode)
+	}
+	var ips []net.IP
+	for _, rr := range resp.Answers {
+		if rr.Type == TypeA {
+			ips = append(ips, net.IP(rr.Data))
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s: no A records", name)
+	}
+	return ips, nil
+}
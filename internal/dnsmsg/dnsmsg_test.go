@@ -0,0 +1,130 @@
+package dnsmsg
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// answer turns query into a response with the given rcode and records,
+// each naming the question by a compression pointer.
+func answer(query []byte, rcode byte, records ...[]byte) []byte {
+	resp := append([]byte(nil), query...)
+	resp[2] |= 0x80 // QR
+	resp[3] = resp[3]&0xf0 | rcode
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(records)))
+	for _, rr := range records {
+		resp = append(resp, 0xc0, 12)
+		resp = append(resp, rr...)
+	}
+	return resp
+}
+
+// record is a record's type, class, TTL, and RDATA.
+func record(qtype uint16, data []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, qtype)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = binary.BigEndian.AppendUint32(b, 300)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func TestParseResponse(t *testing.T) {
+	query, _, err := BuildQuery("example.com", TypeA, Flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx := append([]byte{0, 10}, 4, 'm', 'a', 'i', 'l', 0xc0, 12)
+	resp, err := ParseResponse(answer(query, 0,
+		record(TypeA, []byte{192, 0, 2, 1}),
+		record(TypeMX, mx),
+		record(TypeTXT, []byte{5, 'h', 'e', 'l', 'l', 'o'}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.1", "10 mail.example.com.", "hello"}
+	if len(resp.Answers) != len(want) {
+		t.Fatalf("got %d answers, want %d", len(resp.Answers), len(want))
+	}
+	for i, rr := range resp.Answers {
+		if rr.Name != "example.com." || rr.TTL != 300 || rr.Value != want[i] {
+			t.Errorf("answer %d = %s %d %q, want example.com. 300 %q", i, rr.Name, rr.TTL, rr.Value, want[i])
+		}
+	}
+}
+
+func TestParseResponseMalformed(t *testing.T) {
+	query, _, err := BuildQuery("example.com", TypeA, Flags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := answer(query, 0, record(TypeA, []byte{192, 0, 2, 1}))
+	for _, b := range [][]byte{
+		full[:8],
+		full[:len(full)-2],
+		answer(query, 0, record(TypeA, []byte{192, 0, 2})),
+		// A name pointing at itself.
+		append(full[:12:12], 0xc0, 12, 0, 1, 0, 1),
+	} {
+		if _, err := ParseResponse(b); err == nil {
+			t.Errorf("ParseResponse(%x) succeeded", b)
+		}
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	q, id, err := BuildQuery("example.com.", TypeAAAA, Flags{DNSSECOK: true, CheckingDisabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint16(q) != id {
+		t.Errorf("ID %d, want %d", binary.BigEndian.Uint16(q), id)
+	}
+	if q[3]&0x10 == 0 {
+		t.Error("CD bit not set")
+	}
+	if binary.BigEndian.Uint16(q[10:]) != 1 {
+		t.Error("no OPT record for DNSSEC OK")
+	}
+	for _, name := range []string{"", "a..b", string(make([]byte, 64)) + ".com"} {
+		if _, _, err := BuildQuery(name, TypeA, Flags{}); err == nil {
+			t.Errorf("BuildQuery(%q) succeeded", name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// The question's first label starts at offset 13.
+			resp := answer(buf[:n], 0, record(TypeA, []byte{192, 0, 2, 7}))
+			if string(buf[13:15]) == "nx" {
+				resp = answer(buf[:n], 3)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ips, err := Lookup(ctx, conn.LocalAddr().String(), "example.com")
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 0, 2, 7)) {
+		t.Errorf("Lookup = %v, %v; want 192.0.2.7", ips, err)
+	}
+	if _, err := Lookup(ctx, conn.LocalAddr().String(), "nx.example.com"); err == nil || err.Error() != "nx.example.com: NXDOMAIN" {
+		t.Errorf("Lookup of a missing name: %v, want NXDOMAIN", err)
+	}
+}
@@ -0,0 +1,313 @@
+package up
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// The annotations that control monitoring of a Service or Ingress. Only
+// up.monitor is required.
+const (
+	annotationMonitor = "up.monitor"
+	annotationName    = "up.name"
+	annotationURL     = "up.url"
+	annotationPath    = "up.path"
+)
+
+// k8sObject holds the fields of Services and Ingresses that targets are
+// built from.
+type k8sObject struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		UID         string            `json:"uid"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		// Services
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+		// Ingresses
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+		Rules []k8sIngressRule `json:"rules"`
+	} `json:"spec"`
+}
+
+type k8sIngressRule struct {
+	Host string `json:"host"`
+	HTTP *struct {
+		Paths []struct {
+			Path string `json:"path"`
+		} `json:"paths"`
+	} `json:"http"`
+}
+
+type k8sList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []k8sObject `json:"items"`
+}
+
+type k8sEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// kubernetesClient talks to the API server with the pod's service account.
+// The objects' targets are prepared with cfg.
+type kubernetesClient struct {
+	base   string
+	token  string
+	client *http.Client
+	cfg    *Config
+}
+
+func newKubernetesClient(cfg *Config) (*kubernetesClient, error) {
+	c := &kubernetesClient{base: strings.TrimSuffix(cfg.KubernetesAPI, "/"), cfg: cfg}
+	if c.base == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("not running in a Kubernetes cluster: set -kubernetes-api")
+		}
+		c.base = "https://" + net.JoinHostPort(host, port)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if pem, err := os.ReadFile(serviceAccountDir + "/ca.crt"); err == nil {
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(pem)
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	if token, err := os.ReadFile(serviceAccountDir + "/token"); err == nil {
+		c.token = strings.TrimSpace(string(token))
+	}
+	c.client = &http.Client{Transport: transport}
+	return c, nil
+}
+
+func (c *kubernetesClient) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+// kubernetesResources are the kinds watched: the API group's path and the
+// resource's name in it.
+var kubernetesResources = map[string][2]string{
+	"service": {"/api/v1", "services"},
+	"ingress": {"/apis/networking.k8s.io/v1", "ingresses"},
+}
+
+// kubernetesObjects are the Services and Ingresses, by kind and UID.
+var (
+	kubernetesMu      sync.Mutex
+	kubernetesObjects = map[string]map[string]k8sObject{}
+)
+
+// watchKubernetes keeps the targets in step with the annotated Services and
+// Ingresses until ctx is done. Each kind is listed, then watched for
+// changes, and listed again whenever the watch ends.
+func watchKubernetes(ctx context.Context, cfg *Config) {
+	c, err := newKubernetesClient(cfg)
+	if err != nil {
+		slog.Error("Failed to watch Kubernetes", "error", err)
+		return
+	}
+	slog.Info("Watching Kubernetes for annotated Services and Ingresses", "api", c.base, "namespace", cmp.Or(cfg.KubernetesNamespace, "all"))
+	for kind, resource := range kubernetesResources {
+		path := resource[0]
+		if cfg.KubernetesNamespace != "" {
+			path += "/namespaces/" + url.PathEscape(cfg.KubernetesNamespace)
+		}
+		path += "/" + resource[1]
+		go func() {
+			for ctx.Err() == nil {
+				if err := c.listAndWatch(ctx, kind, path); err != nil && ctx.Err() == nil {
+					slog.Warn("Kubernetes watch failed", "kind", kind, "error", err)
+					select {
+					case <-ctx.Done():
+					case <-time.After(10 * time.Second):
+					}
+				}
+			}
+		}()
+	}
+}
+
+// listAndWatch lists the objects of a kind and then applies changes to
+// them as they are streamed, until the watch ends.
+func (c *kubernetesClient) listAndWatch(ctx context.Context, kind, path string) error {
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	var list k8sList
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	objects := map[string]k8sObject{}
+	for _, o := range list.Items {
+		objects[o.Metadata.UID] = o
+	}
+	kubernetesMu.Lock()
+	kubernetesObjects[kind] = objects
+	kubernetesMu.Unlock()
+	reconcileKubernetes(c.cfg)
+
+	resp, err = c.get(ctx, path+"?watch=1&allowWatchBookmarks=true&resourceVersion="+url.QueryEscape(list.Metadata.ResourceVersion))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev k8sEvent
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// The API server ends watches after a few minutes.
+			slog.Debug("Kubernetes watch ended", "kind", kind, "error", err)
+			return nil
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			var o k8sObject
+			if err := json.Unmarshal(ev.Object, &o); err != nil {
+				return err
+			}
+			kubernetesMu.Lock()
+			if ev.Type == "DELETED" {
+				delete(kubernetesObjects[kind], o.Metadata.UID)
+			} else {
+				kubernetesObjects[kind][o.Metadata.UID] = o
+			}
+			kubernetesMu.Unlock()
+			reconcileKubernetes(c.cfg)
+		case "ERROR":
+			// Usually 410 Gone: the resource version is too old, so list
+			// again.
+			return fmt.Errorf("watch error: %s", ev.Object)
+		}
+	}
+}
+
+// reconcileKubernetes rebuilds the targets from the annotated objects.
+func reconcileKubernetes(cfg *Config) {
+	kubernetesMu.Lock()
+	defer kubernetesMu.Unlock()
+
+	var wanted []targetConfig
+	for kind, objects := range kubernetesObjects {
+		for _, o := range objects {
+			if t, ok := kubernetesTarget(kind, o); ok {
+				wanted = append(wanted, t)
+			}
+		}
+	}
+	setProviderTargets(cfg, "kubernetes", wanted)
+}
+
+// kubernetesTarget builds the target for a Service or Ingress annotated
+// with up.monitor=true. Services are checked at their cluster DNS name on
+// the port named http or https, or else their first port; Ingresses at
+// their first host, over HTTPS if it is listed under tls.
+func kubernetesTarget(kind string, o k8sObject) (targetConfig, bool) {
+	a := o.Metadata.Annotations
+	if monitor, _ := strconv.ParseBool(a[annotationMonitor]); !monitor {
+		return targetConfig{}, false
+	}
+	t := targetConfig{
+		Target: checker.Target{
+			Name: cmp.Or(a[annotationName], kind+"/"+o.Metadata.Namespace+"/"+o.Metadata.Name),
+			URL:  a[annotationURL],
+		},
+		Tags: []string{"kubernetes"},
+	}
+	if t.URL != "" {
+		return t, true
+	}
+
+	path := a[annotationPath]
+	switch kind {
+	case "service":
+		if len(o.Spec.Ports) == 0 {
+			return t, false
+		}
+		port := o.Spec.Ports[0]
+		for _, p := range o.Spec.Ports {
+			if p.Name == "http" || p.Name == "https" {
+				port = p
+				break
+			}
+		}
+		scheme := "http"
+		if port.Name == "https" || port.Port == 443 {
+			scheme = "https"
+		}
+		host := o.Metadata.Name + "." + o.Metadata.Namespace + ".svc"
+		t.URL = scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port.Port))
+	case "ingress":
+		i := slices.IndexFunc(o.Spec.Rules, func(r k8sIngressRule) bool { return r.Host != "" })
+		if i < 0 {
+			return t, false
+		}
+		rule := o.Spec.Rules[i]
+		scheme := "http"
+		for _, tls := range o.Spec.TLS {
+			if slices.Contains(tls.Hosts, rule.Host) {
+				scheme = "https"
+			}
+		}
+		if path == "" && rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+			path = rule.HTTP.Paths[0].Path
+		}
+		t.URL = scheme + "://" + rule.Host
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	t.URL += path
+	return t, true
+}
@@ -0,0 +1,38 @@
+package up
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// listen opens the -listen address: host:port, or a unix socket path
+// (anything containing a slash, or prefixed with unix:).
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok && !strings.Contains(addr, "/") {
+		return net.Listen("tcp", addr)
+	}
+
+	// Remove a socket left behind by a previous run that didn't shut down
+	// cleanly, but never some other file.
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Like a port on localhost, the socket is open to every local user, so
+	// a reverse proxy running as another user can connect.
+	if err := os.Chmod(path, 0o666); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
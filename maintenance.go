@@ -0,0 +1,123 @@
+package up
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow is either a one-off window (From/To) or a recurring
+// daily window starting at Start (local HH:MM) for Duration, optionally
+// limited to certain weekdays. Windows with no Targets apply to all targets.
+type maintenanceWindow struct {
+	Name     string    `json:"name"`
+	Targets  []string  `json:"targets,omitempty"`
+	From     time.Time `json:"from,omitempty"`
+	To       time.Time `json:"to,omitempty"`
+	Start    string    `json:"start,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Days     []string  `json:"days,omitempty"`
+	Skip     bool      `json:"skip,omitempty"`
+
+	startOffset time.Duration
+	length      time.Duration
+	weekdays    map[time.Weekday]bool
+	// loc is the -timezone zone recurring windows' days begin in.
+	loc *time.Location
+}
+
+var maintenanceWindows []maintenanceWindow
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func (m *maintenanceWindow) init(loc *time.Location) error {
+	m.loc = loc
+	if !m.From.IsZero() || !m.To.IsZero() {
+		if !m.To.After(m.From) {
+			return fmt.Errorf("maintenance window %q: to must be after from", m.Name)
+		}
+		return nil
+	}
+
+	clock, err := time.Parse("15:04", m.Start)
+	if err != nil {
+		return fmt.Errorf("maintenance window %q: invalid start %q", m.Name, m.Start)
+	}
+	m.startOffset = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+
+	m.length, err = time.ParseDuration(m.Duration)
+	if err != nil || m.length <= 0 || m.length > 24*time.Hour {
+		return fmt.Errorf("maintenance window %q: invalid duration %q", m.Name, m.Duration)
+	}
+
+	if len(m.Days) > 0 {
+		m.weekdays = map[time.Weekday]bool{}
+		for _, d := range m.Days {
+			wd, ok := weekdayNames[strings.ToLower(d)[:min(3, len(d))]]
+			if !ok {
+				return fmt.Errorf("maintenance window %q: invalid day %q", m.Name, d)
+			}
+			m.weekdays[wd] = true
+		}
+	}
+	return nil
+}
+
+// appliesTo matches the window's targets against either the target's name
+// or its URL, so one entry covers both halves of a dual-stack target.
+func (m *maintenanceWindow) appliesTo(target *targetConfig) bool {
+	if len(m.Targets) == 0 {
+		return true
+	}
+	for _, t := range m.Targets {
+		if t == target.Name || t == target.URL {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *maintenanceWindow) active(t time.Time) bool {
+	if !m.From.IsZero() {
+		return !t.Before(m.From) && t.Before(m.To)
+	}
+
+	// A recurring window may have started the previous day and run past
+	// midnight, so check both occurrences.
+	t = t.In(m.loc)
+	for _, daysAgo := range []int{0, 1} {
+		day := time.Date(t.Year(), t.Month(), t.Day()-daysAgo, 0, 0, 0, 0, m.loc)
+		if m.weekdays != nil && !m.weekdays[day.Weekday()] {
+			continue
+		}
+		start := day.Add(m.startOffset)
+		if !t.Before(start) && t.Before(start.Add(m.length)) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeMaintenance returns the first maintenance window covering the
+// target at t, or nil.
+func activeMaintenance(target *targetConfig, t time.Time) *maintenanceWindow {
+	targetsMu.RLock()
+	windows := maintenanceWindows
+	targetsMu.RUnlock()
+
+	for i := range windows {
+		w := &windows[i]
+		if w.appliesTo(target) && w.active(t) {
+			return w
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package up
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// matrixNotifier posts alerts to a Matrix room, as notices so that bots in
+// the room don't answer them.
+type matrixNotifier struct {
+	homeserver string
+	token      string
+	room       string
+	client     *http.Client
+}
+
+func (m *matrixNotifier) name() string { return "matrix" }
+
+func (m *matrixNotifier) notify(a alert) error {
+	title, message := a.title("matrix"), a.message("matrix", a.Details)
+	msg := map[string]any{
+		"msgtype":        "m.notice",
+		"body":           title + "\n" + message,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": "<strong>" + html.EscapeString(title) + "</strong><br>" + strings.ReplaceAll(html.EscapeString(message), "\n", "<br>"),
+	}
+	// The transaction ID is the same when an alert is retried, so the
+	// homeserver doesn't post it twice if an earlier attempt got through.
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d/%t", a.Key(), a.Timestamp.UnixNano(), a.Firing)
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/up-%x",
+		strings.TrimSuffix(m.homeserver, "/"), url.PathEscape(m.room), h.Sum64())
+	return sendJSON(m.client, http.MethodPut, endpoint, msg, http.Header{"Authorization": {"Bearer " + m.token}})
+}
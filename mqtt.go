@@ -0,0 +1,292 @@
+package up
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+const mqttKeepAlive = 60 * time.Second
+
+// startMQTTPublisher publishes every check result to <topic>/checks/<target>
+// and every state change, retained, to <topic>/state/<target>. The broker
+// marks <topic>/status "offline" if the connection drops. Results published
+// while the broker is unreachable are lost; it is reconnected with backoff.
+func startMQTTPublisher(cfg *Config) error {
+	u, err := url.Parse(cfg.MQTTURL)
+	if err != nil {
+		return fmt.Errorf("invalid -mqtt-url: %v", err)
+	}
+	switch u.Scheme {
+	case "mqtt", "tcp", "mqtts", "ssl", "tls":
+	default:
+		return fmt.Errorf("invalid -mqtt-url: unsupported scheme %q", u.Scheme)
+	}
+	if cfg.MQTTClientID == "" {
+		host, _ := os.Hostname()
+		cfg.MQTTClientID = "up-" + host
+	}
+
+	ch := events.subscribe()
+	go func() {
+		backoff := time.Second
+		for {
+			c, err := dialMQTT(u, cfg.MQTTClientID, cfg.MQTTTopic+"/status")
+			if err != nil {
+				slog.Error("Failed to connect to MQTT broker", "url", u.Redacted(), "error", err)
+				time.Sleep(backoff)
+				backoff = min(backoff*2, time.Minute)
+				continue
+			}
+			backoff = time.Second
+			slog.Info("Connected to MQTT broker", "url", u.Redacted(), "topic", cfg.MQTTTopic)
+
+			err = publishMQTT(cfg, c, ch)
+			c.close()
+			slog.Error("MQTT connection lost", "error", err)
+		}
+	}()
+	return nil
+}
+
+// publishMQTT forwards events until the connection fails.
+func publishMQTT(cfg *Config, c *mqttClient, ch chan event) error {
+	if err := c.publish(cfg.MQTTTopic+"/status", []byte("online"), true); err != nil {
+		return err
+	}
+
+	// Targets are announced to Home Assistant on connect and, for targets
+	// added later, on their first result.
+	announced := map[string]bool{}
+	announce := func(target string) error {
+		if !cfg.HomeAssistant || announced[target] {
+			return nil
+		}
+		announced[target] = true
+		return announceHomeAssistant(cfg, c, target)
+	}
+	for _, name := range targetNames() {
+		if err := announce(name); err != nil {
+			return err
+		}
+	}
+
+	ping := time.NewTicker(mqttKeepAlive / 2)
+	defer ping.Stop()
+	for {
+		select {
+		case err := <-c.errc:
+			return err
+		case <-ping.C:
+			if err := c.write([]byte{0xc0, 0}); err != nil {
+				return err
+			}
+		case e := <-ch:
+			var topic string
+			retain := false
+			switch d := e.Data.(type) {
+			case checker.Result:
+				if err := announce(d.Target); err != nil {
+					return err
+				}
+				topic = cfg.MQTTTopic + "/checks/" + targetSlug(d.Target)
+			case stateChange:
+				topic = cfg.MQTTTopic + "/state/" + targetSlug(d.Target)
+				retain = true
+			default:
+				continue
+			}
+			payload, err := json.Marshal(e.Data)
+			if err != nil {
+				continue
+			}
+			if err := c.publish(topic, payload, retain); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// mqttClient is a minimal MQTT 3.1.1 client that only publishes at QoS 0.
+type mqttClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+	errc chan error
+}
+
+func dialMQTT(u *url.URL, clientID, willTopic string) (*mqttClient, error) {
+	host := u.Host
+	secure := u.Scheme == "mqtts" || u.Scheme == "ssl" || u.Scheme == "tls"
+	if u.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// CONNECT with a clean session and a retained "offline" will.
+	flags := byte(0x02 | 0x04 | 0x20)
+	var payload []byte
+	payload = appendMQTTString(payload, clientID)
+	payload = appendMQTTString(payload, willTopic)
+	payload = appendMQTTString(payload, "offline")
+	if u.User != nil {
+		flags |= 0x80
+		payload = appendMQTTString(payload, u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			flags |= 0x40
+			payload = appendMQTTString(payload, password)
+		}
+	}
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	body = append(body, payload...)
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(mqttPacket(0x10, body)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	typ, ack, err := readMQTTPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNACK: %v", err)
+	}
+	if typ != 0x20 || len(ack) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", typ)
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused connection: %s", mqttConnackReason(ack[1]))
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &mqttClient{conn: conn, errc: make(chan error, 1)}
+	go func() {
+		// Only PINGRESP is expected; a broker that stops answering pings
+		// is treated as gone.
+		for {
+			conn.SetReadDeadline(time.Now().Add(mqttKeepAlive + 30*time.Second))
+			if _, _, err := readMQTTPacket(r); err != nil {
+				c.errc <- err
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (c *mqttClient) publish(topic string, payload []byte, retain bool) error {
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	body = append(body, payload...)
+	return c.write(mqttPacket(header, body))
+}
+
+func (c *mqttClient) write(p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(p)
+	return err
+}
+
+func (c *mqttClient) close() {
+	c.write([]byte{0xe0, 0})
+	c.conn.Close()
+}
+
+func mqttPacket(header byte, body []byte) []byte {
+	p := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		p = append(p, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
@@ -0,0 +1,293 @@
+package up
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+// alert is an outage or recovery, or an alert rule firing or resolving,
+// sent to every configured notifier.
+type alert struct {
+	Target string
+	Probe  string
+	Status string
+	// Firing is true for outages and rules that started matching, and false
+	// for recoveries and resolved rules.
+	Firing    bool
+	Timestamp time.Time
+	// Since is when the outage started; for a recovery, Timestamp minus
+	// Since is how long it lasted.
+	Since           time.Time
+	RecentLatencyMs []int64
+
+	// Rule is the alert rule that raised the alert, if any, and Reason what
+	// it matched. Reminder is set when a rule's alert is repeated.
+	Rule     string
+	Reason   string
+	Reminder bool
+
+	// dashboardURL and loc are the -dashboard-url and -timezone settings,
+	// filled in when the alert is dispatched.
+	dashboardURL string
+	loc          *time.Location
+}
+
+// DashboardURL is the -dashboard-url setting.
+func (a alert) DashboardURL() string {
+	return a.dashboardURL
+}
+
+func (a alert) Duration() time.Duration {
+	return a.Timestamp.Sub(a.Since).Round(time.Second)
+}
+
+// Key identifies the outage or rule, so that a recovery can be matched to
+// the alert it resolves.
+func (a alert) Key() string {
+	key := "up/" + a.Target + "/" + a.Probe
+	if a.Rule != "" {
+		key += "/" + a.Rule
+	}
+	return key
+}
+
+// Summary is a one-line description of the alert.
+func (a alert) Summary() string {
+	target := a.Target
+	if a.Probe != "" && a.Probe != "local" {
+		target += " (from " + a.Probe + ")"
+	}
+	switch {
+	case a.Rule != "" && a.Reminder:
+		return fmt.Sprintf("%s: %s (still firing after %s)", a.Rule, a.Reason, a.Duration())
+	case a.Rule != "" && a.Firing:
+		return fmt.Sprintf("%s: %s", a.Rule, a.Reason)
+	case a.Rule != "":
+		return fmt.Sprintf("%s resolved for %s after %s", a.Rule, target, a.Duration())
+	case a.Firing && a.Status == "captive":
+		return target + " is behind a captive portal"
+	case a.Firing:
+		return target + " is down"
+	case a.Status == "degraded":
+		return fmt.Sprintf("%s is up again after %s, but degraded", target, a.Duration())
+	}
+	return fmt.Sprintf("%s is %s again after %s", target, a.Status, a.Duration())
+}
+
+// Details describes the outage and the recent latency, for notifiers that
+// send plain text.
+func (a alert) Details() string {
+	var b strings.Builder
+	switch {
+	case a.Rule != "" && a.Firing:
+		fmt.Fprintf(&b, "Firing since %s.", a.Since.In(a.loc).Format(time.DateTime+" MST"))
+	case a.Rule != "":
+		fmt.Fprintf(&b, "Fired for %s.", a.Duration())
+	case a.Firing:
+		fmt.Fprintf(&b, "Down since %s.", a.Since.In(a.loc).Format(time.DateTime+" MST"))
+	default:
+		fmt.Fprintf(&b, "Outage lasted %s.", a.Duration())
+	}
+	if len(a.RecentLatencyMs) > 0 {
+		fmt.Fprintf(&b, "\nRecent latency: %s ms", a.Latencies())
+	}
+	if a.dashboardURL != "" {
+		fmt.Fprintf(&b, "\n%s", a.dashboardURL)
+	}
+	return b.String()
+}
+
+// LatencyMs is the latency of the most recent successful check.
+func (a alert) LatencyMs() int64 {
+	if len(a.RecentLatencyMs) == 0 {
+		return 0
+	}
+	return a.RecentLatencyMs[0]
+}
+
+// Latencies is RecentLatencyMs as a comma-separated list.
+func (a alert) Latencies() string {
+	latencies := make([]string, len(a.RecentLatencyMs))
+	for i, ms := range a.RecentLatencyMs {
+		latencies[i] = fmt.Sprint(ms)
+	}
+	return strings.Join(latencies, ", ")
+}
+
+type notifier interface {
+	name() string
+	notify(a alert) error
+}
+
+var notifiers []notifier
+
+// notifierTypes are the names alert rules can escalate to.
+var notifierTypes = []string{"discord", "pagerduty", "ntfy", "pushover", "email", "twilio", "matrix"}
+
+// setupNotifiers creates a notifier for each configured alert channel.
+func setupNotifiers(cfg *Config) error {
+	notifiers = nil
+	if cfg.DiscordWebhook != "" {
+		notifiers = append(notifiers, &discordNotifier{webhook: cfg.DiscordWebhook, client: notifyClient(cfg.ProxyURL)})
+	}
+	if cfg.NtfyTopic != "" {
+		notifiers = append(notifiers, &ntfyNotifier{server: cfg.NtfyURL, topic: cfg.NtfyTopic, token: cfg.NtfyToken, client: notifyClient(cfg.ProxyURL)})
+	}
+	if cfg.PushoverToken != "" || cfg.PushoverUser != "" {
+		if cfg.PushoverToken == "" || cfg.PushoverUser == "" {
+			return fmt.Errorf("-pushover-token and -pushover-user must be set together")
+		}
+		for _, p := range []int{cfg.PushoverDownPriority, cfg.PushoverUpPriority} {
+			if err := checkPushoverPriority(p); err != nil {
+				return err
+			}
+		}
+		notifiers = append(notifiers, &pushoverNotifier{
+			token:        cfg.PushoverToken,
+			user:         cfg.PushoverUser,
+			downPriority: cfg.PushoverDownPriority,
+			upPriority:   cfg.PushoverUpPriority,
+			client:       notifyClient(cfg.ProxyURL),
+		})
+	}
+	if cfg.PagerDutyRoutingKey != "" {
+		severities, err := parsePagerDutySeverity(cfg.PagerDutySeverity)
+		if err != nil {
+			return err
+		}
+		notifiers = append(notifiers, &pagerDutyNotifier{routingKey: cfg.PagerDutyRoutingKey, severities: severities, client: notifyClient(cfg.ProxyURL)})
+	}
+	if cfg.SMTPTo != "" {
+		if err := cfg.checkEmailSettings(); err != nil {
+			return err
+		}
+		notifiers = append(notifiers, &emailNotifier{server: cfg.smtpServer(), to: splitAddresses(cfg.SMTPTo)})
+	}
+	if cfg.MatrixHomeserver != "" || cfg.MatrixRoom != "" {
+		if cfg.MatrixHomeserver == "" || cfg.MatrixToken == "" || cfg.MatrixRoom == "" {
+			return fmt.Errorf("-matrix-homeserver, -matrix-token, and -matrix-room must be set together")
+		}
+		if !strings.HasPrefix(cfg.MatrixRoom, "!") {
+			return fmt.Errorf("invalid -matrix-room %q: use the room ID, e.g. !abc123:example.org, from the room's settings", cfg.MatrixRoom)
+		}
+		notifiers = append(notifiers, &matrixNotifier{homeserver: cfg.MatrixHomeserver, token: cfg.MatrixToken, room: cfg.MatrixRoom, client: notifyClient(cfg.ProxyURL)})
+	}
+	if cfg.TwilioAccountSID != "" || cfg.TwilioTo != "" {
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" || cfg.TwilioFrom == "" || cfg.TwilioTo == "" {
+			return fmt.Errorf("-twilio-account-sid, -twilio-auth-token, -twilio-from, and -twilio-to must be set together")
+		}
+		to := splitAddresses(cfg.TwilioTo)
+		for _, n := range to {
+			if err := checkPhoneNumber(n); err != nil {
+				return err
+			}
+		}
+		notifiers = append(notifiers, &twilioNotifier{
+			accountSID: cfg.TwilioAccountSID,
+			authToken:  cfg.TwilioAuthToken,
+			from:       cfg.TwilioFrom,
+			to:         to,
+			client:     notifyClient(cfg.ProxyURL),
+		})
+	}
+
+	if len(notifiers) > 0 {
+		names := make([]string, len(notifiers))
+		for i, n := range notifiers {
+			names[i] = n.name()
+		}
+		slog.Info("Sending alerts", "notifiers", strings.Join(names, ","))
+	}
+	return nil
+}
+
+const notifyAttempts = 3
+
+// dispatchAlert sends an alert to every notifier. Each notifier is tried up
+// to three times so a slow or failing one doesn't hold up the others.
+func dispatchAlert(cfg *Config, a alert) {
+	dispatchAlertTo(cfg, a, nil)
+}
+
+// dispatchAlertTo sends an alert to the named notifiers, or to all of them
+// if names is nil.
+func dispatchAlertTo(cfg *Config, a alert, names []string) {
+	a.dashboardURL, a.loc = cfg.DashboardURL, cfg.Timezone
+	for _, n := range notifiers {
+		if names == nil || slices.Contains(names, n.name()) {
+			go sendAlert(n, a)
+		}
+	}
+}
+
+func sendAlert(n notifier, a alert) {
+	var err error
+	for attempt := 1; attempt <= notifyAttempts; attempt++ {
+		if err = n.notify(a); err == nil {
+			slog.Info("Alert sent", "notifier", n.name(), "target", a.Target, "rule", a.Rule, "firing", a.Firing)
+			return
+		}
+		time.Sleep(time.Duration(attempt) * 5 * time.Second)
+	}
+	slog.Error("Failed to send alert", "notifier", n.name(), "target", a.Target, "rule", a.Rule, "error", err)
+}
+
+// recentLatencies returns the latencies of the target's last 10 answered
+// checks from probe, newest first, from the in-memory recent checks.
+func recentLatencies(target, probe string) []int64 {
+	samples, _ := recentSamples(target, probe, 0)
+	var latencies []int64
+	for i := len(samples) - 1; i >= 0 && len(latencies) < 10; i-- {
+		if samples[i].up {
+			latencies = append(latencies, samples[i].latency)
+		}
+	}
+	return latencies
+}
+
+// postJSON sends a notification payload and treats any 2xx as success.
+func postJSON(client *http.Client, url string, payload any, header http.Header) error {
+	return sendJSON(client, http.MethodPost, url, payload, header)
+}
+
+// sendJSON is postJSON with another method.
+func sendJSON(client *http.Client, method, url string, payload any, header http.Header) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func notifyClient(proxyURL string) *http.Client {
+	client := checker.OutboundClient(proxyURL)
+	client.Timeout = 15 * time.Second
+	return client
+}
@@ -0,0 +1,41 @@
+package up
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ntfyNotifier publishes alerts to an ntfy topic. Outages are sent at high
+// priority so they get through on phones set to ignore routine messages.
+type ntfyNotifier struct {
+	server string
+	topic  string
+	token  string
+	client *http.Client
+}
+
+func (n *ntfyNotifier) name() string { return "ntfy" }
+
+func (n *ntfyNotifier) notify(a alert) error {
+	priority, tag := 3, "white_check_mark"
+	if a.Firing {
+		priority, tag = 5, "rotating_light"
+	}
+	var header http.Header
+	if n.token != "" {
+		header = http.Header{"Authorization": {"Bearer " + n.token}}
+	}
+	// Publishing JSON to the server root lets the message carry a title,
+	// priority, and tags without encoding them as headers.
+	msg := map[string]any{
+		"topic":    n.topic,
+		"title":    a.title("ntfy"),
+		"message":  a.message("ntfy", a.Details),
+		"priority": priority,
+		"tags":     []string{tag},
+	}
+	if a.dashboardURL != "" {
+		msg["click"] = a.dashboardURL
+	}
+	return postJSON(n.client, strings.TrimSuffix(n.server, "/"), msg, header)
+}
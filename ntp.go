@@ -0,0 +1,233 @@
+package up
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds from the NTP epoch (1900) to the
+// Unix epoch.
+const ntpEpochOffset = 2208988800
+
+type ntpSample struct {
+	Offset, Delay time.Duration
+	Stratum       int
+}
+
+// queryNTP asks server (host or host:port) for the time with a single SNTP
+// request, and returns the local clock's offset from it (positive when the
+// local clock is behind) and the round-trip delay.
+func queryNTP(server string) (ntpSample, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return ntpSample{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI 0, version 4, client mode
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(t1))
+	if _, err := conn.Write(req); err != nil {
+		return ntpSample{}, err
+	}
+	resp := make([]byte, 48)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return ntpSample{}, err
+		}
+		// The server echoes our transmit time as the originate time.
+		if n >= 48 && binary.BigEndian.Uint64(resp[24:]) == binary.BigEndian.Uint64(req[40:]) {
+			break
+		}
+	}
+	// Measure the round trip on the monotonic clock, so a clock step
+	// during the request doesn't distort it.
+	t4 := t1.Add(time.Since(t1))
+
+	if mode := resp[0] & 0x07; mode != 4 {
+		return ntpSample{}, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	stratum := int(resp[1])
+	if stratum == 0 {
+		return ntpSample{}, fmt.Errorf("kiss-of-death %q", strings.TrimRight(string(resp[12:16]), "\x00"))
+	}
+	if resp[0]>>6 == 3 {
+		return ntpSample{}, errors.New("server clock is not synchronized")
+	}
+	t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+	return ntpSample{
+		Offset:  (t2.Sub(t1) + t3.Sub(t4)) / 2,
+		Delay:   t4.Sub(t1) - t3.Sub(t2),
+		Stratum: stratum,
+	}, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+func fromNTPTime(v uint64) time.Time {
+	secs := int64(v>>32) - ntpEpochOffset
+	nanos := int64((v & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(secs, nanos)
+}
+
+// monitorNTP queries each of -ntp-servers every -ntp-interval until ctx is
+// done and records the clock offset.
+func monitorNTP(ctx context.Context, cfg *Config) {
+	var servers []string
+	for _, s := range strings.Split(cfg.NTPServers, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			servers = append(servers, s)
+		}
+	}
+	slog.Info("Monitoring clock offset", "servers", servers, "interval", cfg.NTPInterval)
+
+	ticker := time.NewTicker(cfg.NTPInterval)
+	defer ticker.Stop()
+	for {
+		for _, server := range servers {
+			recordNTPSample(server)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func recordNTPSample(server string) {
+	now := time.Now()
+	s, err := queryNTP(server)
+	var errText string
+	if err != nil {
+		errText = err.Error()
+		slog.Warn("NTP query failed", "server", server, "error", err)
+	} else {
+		slog.Debug("NTP query completed", "server", server, "offset", s.Offset, "delay", s.Delay)
+	}
+	_, err = db.Exec(`INSERT INTO ntp (timestamp, server, offset_ms, delay_ms, stratum, error) VALUES (?, ?, ?, ?, ?, ?)`,
+		now, server, durationMs(s.Offset), durationMs(s.Delay), s.Stratum, errText)
+	if err != nil {
+		slog.Error("Failed to insert NTP sample", "error", err)
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type ntpStats struct {
+	Server   string `json:"server"`
+	Samples  int    `json:"samples"`
+	Failures int    `json:"failures"`
+	// OffsetMs is the latest offset, positive when the local clock is
+	// behind the server.
+	OffsetMs float64 `json:"offset_ms"`
+	// MaxOffsetMs is the offset furthest from zero in the window.
+	MaxOffsetMs float64   `json:"max_offset_ms"`
+	DelayMs     float64   `json:"delay_ms"`
+	Stratum     int       `json:"stratum"`
+	LastSample  time.Time `json:"last_sample,omitzero"`
+	// DriftPPM is how fast the offset changed over the window, in parts
+	// per million (microseconds per second); zero with fewer than two
+	// samples.
+	DriftPPM  float64 `json:"drift_ppm"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+// ntpHandler serves each NTP server's latest offset and the drift over the
+// last ?window= (default 24h).
+func (s *server) ntpHandler(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	stats, err := queryNTPStats(s.db, time.Now().Add(-window))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func queryNTPStats(db *sql.DB, since time.Time) ([]ntpStats, error) {
+	rows, err := db.Query(`SELECT server, timestamp, offset_ms, delay_ms, stratum, error FROM ntp
+		WHERE timestamp > ? ORDER BY server, timestamp`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []ntpStats{}
+	var first, last time.Time
+	var firstOffset float64
+	finish := func() {
+		if len(stats) == 0 {
+			return
+		}
+		st := &stats[len(stats)-1]
+		if elapsed := last.Sub(first).Seconds(); elapsed > 0 {
+			st.DriftPPM = (st.OffsetMs - firstOffset) * 1000 / elapsed
+		}
+		first, last = time.Time{}, time.Time{}
+	}
+	for rows.Next() {
+		var server, errText string
+		var at time.Time
+		var offset, delay float64
+		var stratum int
+		if err := rows.Scan(&server, &at, &offset, &delay, &stratum, &errText); err != nil {
+			return nil, err
+		}
+		if len(stats) == 0 || stats[len(stats)-1].Server != server {
+			finish()
+			stats = append(stats, ntpStats{Server: server})
+		}
+		st := &stats[len(stats)-1]
+		st.Samples++
+		if errText != "" {
+			st.Failures++
+			st.LastError = errText
+			continue
+		}
+		if first.IsZero() {
+			first, firstOffset = at, offset
+		}
+		last = at
+		st.OffsetMs, st.DelayMs, st.Stratum, st.LastSample = offset, delay, stratum, at
+		if abs := max(offset, -offset); abs > max(st.MaxOffsetMs, -st.MaxOffsetMs) {
+			st.MaxOffsetMs = offset
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+	return stats, nil
+}
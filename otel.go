@@ -0,0 +1,580 @@
+package up
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"up/checker"
+)
+
+const (
+	otelSpanBatch     = 512
+	otelMaxSpans      = 8192
+	otelFlushInterval = 5 * time.Second
+)
+
+// otelDurationBounds are the histogram bucket boundaries, in milliseconds.
+var otelDurationBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func otelString(k, v string) otlpKeyValue {
+	return otlpKeyValue{k, map[string]any{"stringValue": v}}
+}
+
+func otelInt(k string, v int64) otlpKeyValue {
+	// OTLP/JSON encodes 64-bit integers as strings.
+	return otlpKeyValue{k, map[string]any{"intValue": strconv.FormatInt(v, 10)}}
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+
+	spanStatusError = 2
+)
+
+type span struct {
+	otlpSpan
+	start time.Time
+}
+
+// startSpan begins a span; parent is a W3C traceparent header value and may
+// be empty.
+func startSpan(name string, kind int, parent string, attrs ...otlpKeyValue) *span {
+	s := &span{start: time.Now()}
+	s.Name = name
+	s.Kind = kind
+	s.Attributes = attrs
+	s.SpanID = randomHex(8)
+	if traceID, spanID, ok := parseTraceparent(parent); ok {
+		s.TraceID, s.ParentSpanID = traceID, spanID
+	} else {
+		s.TraceID = randomHex(16)
+	}
+	return s
+}
+
+func (s *span) setError(msg string) {
+	s.Status = otlpStatus{Code: spanStatusError, Message: msg}
+}
+
+func (s *span) end(attrs ...otlpKeyValue) {
+	if !otelExporting.Load() {
+		return
+	}
+	s.Attributes = append(s.Attributes, attrs...)
+	s.StartTimeUnixNano = strconv.FormatInt(s.start.UnixNano(), 10)
+	s.EndTimeUnixNano = strconv.FormatInt(time.Now().UnixNano(), 10)
+	select {
+	case otelSpans <- s.otlpSpan:
+	default:
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func parseTraceparent(h string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// otelExporting is set once the exporter is running; until then spans and
+// metrics are not recorded.
+var otelExporting atomic.Bool
+
+var otelSpans = make(chan otlpSpan, otelMaxSpans)
+
+// otelHistogram is a cumulative explicit-bucket histogram.
+type otelHistogram struct {
+	counts   []uint64
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+func (h *otelHistogram) record(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(otelDurationBounds)+1)
+		h.min, h.max = v, v
+	}
+	i, _ := slices.BinarySearch(otelDurationBounds, v)
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+}
+
+type otelGauge struct {
+	value float64
+	at    time.Time
+}
+
+// otelSeries identifies a metric and its attribute set.
+type otelSeries struct {
+	name  string
+	attrs string
+}
+
+var otelMetrics = struct {
+	sync.Mutex
+	start      time.Time
+	histograms map[otelSeries]*otelHistogram
+	gauges     map[otelSeries]*otelGauge
+}{
+	start:      time.Now(),
+	histograms: map[otelSeries]*otelHistogram{},
+	gauges:     map[otelSeries]*otelGauge{},
+}
+
+// otelAttrs joins key/value pairs into a series key, skipping empty values.
+func otelAttrs(kv ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			parts = append(parts, kv[i]+"="+kv[i+1])
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func recordHistogram(name string, v float64, attrs string) {
+	if !otelExporting.Load() {
+		return
+	}
+	otelMetrics.Lock()
+	defer otelMetrics.Unlock()
+	k := otelSeries{name, attrs}
+	h, ok := otelMetrics.histograms[k]
+	if !ok {
+		h = &otelHistogram{}
+		otelMetrics.histograms[k] = h
+	}
+	h.record(v)
+}
+
+func recordGauge(name string, v float64, attrs string) {
+	if !otelExporting.Load() {
+		return
+	}
+	otelMetrics.Lock()
+	defer otelMetrics.Unlock()
+	otelMetrics.gauges[otelSeries{name, attrs}] = &otelGauge{v, time.Now()}
+}
+
+// traceCheck runs a check inside a span.
+func traceCheck(cfg *Config, t *targetConfig, sleep func(time.Duration)) checker.Result {
+	s := startSpan("check "+t.Name, spanKindInternal, "",
+		otelString("up.target", t.Name),
+		otelString("up.type", t.Type),
+		otelString("url.full", t.URL),
+	)
+	r := checkTarget(cfg, t, sleep)
+	if !checker.Answered(r.Status) {
+		s.setError("target is " + r.Status)
+	}
+	s.end(
+		otelString("up.status", r.Status),
+		otelInt("up.latency_ms", r.LatencyMs),
+		otelInt("up.dns_ms", r.DNSMs),
+		otelInt("up.connect_ms", r.ConnectMs),
+		otelInt("up.tls_ms", r.TLSMs),
+		otelInt("up.ttfb_ms", r.TTFBMs),
+	)
+	return r
+}
+
+// traceSpeedTest runs a provider's speed test inside a span.
+func traceSpeedTest(cfg *Config, p speedTestProvider) (speedTestResult, error) {
+	s := startSpan("speedtest "+p.Name, spanKindInternal, "", otelString("up.provider", p.Name))
+	r, err := runProviderSpeedTest(cfg, p)
+	if err != nil {
+		s.setError(err.Error())
+	}
+	s.end()
+	return r, err
+}
+
+// observeCheck records the metrics for a check result, local or from an
+// agent.
+func observeCheck(r checker.Result) {
+	attrs := otelAttrs("up.target", r.Target, "up.probe", r.Probe)
+	recordHistogram("up.check.duration", float64(r.LatencyMs), otelAttrs("up.target", r.Target, "up.probe", r.Probe, "up.status", r.Status))
+	up, degraded := 0.0, 0.0
+	if checker.Answered(r.Status) {
+		up = 1
+	}
+	if r.Status == "degraded" {
+		degraded = 1
+	}
+	recordGauge("up.check.up", up, attrs)
+	recordGauge("up.check.degraded", degraded, attrs)
+}
+
+func observeSpeedTest(r speedTestResult) {
+	attrs := otelAttrs("up.provider", r.Provider)
+	recordGauge("up.speedtest.download", r.DownloadMbps, attrs)
+	recordGauge("up.speedtest.upload", r.UploadMbps, attrs)
+	recordGauge("up.speedtest.latency", float64(r.LatencyMs), attrs)
+}
+
+// otelResponseWriter records the status code. It passes Flush and Hijack
+// through so /events and /ws keep working.
+type otelResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *otelResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *otelResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *otelResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking unsupported")
+	}
+	return h.Hijack()
+}
+
+func (w *otelResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// instrumentHandler traces and measures HTTP requests when the exporter is
+// running (-otel), continuing any trace passed in a traceparent header.
+func instrumentHandler(h http.Handler) http.Handler {
+	if !otelExporting.Load() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := startSpan(r.Method+" "+r.URL.Path, spanKindServer, r.Header.Get("traceparent"),
+			otelString("http.request.method", r.Method),
+			otelString("url.path", r.URL.Path),
+		)
+		ow := &otelResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(ow, r)
+		if ow.status == 0 {
+			ow.status = http.StatusOK
+		}
+		if ow.status >= 500 {
+			s.setError(http.StatusText(ow.status))
+		}
+		s.end(otelInt("http.response.status_code", int64(ow.status)))
+		recordHistogram("http.server.request.duration", float64(time.Since(s.start).Milliseconds()),
+			otelAttrs("http.request.method", r.Method, "http.response.status_code", strconv.Itoa(ow.status)))
+	})
+}
+
+// otelExporter holds the endpoints and headers read from the environment.
+type otelExporter struct {
+	client          *http.Client
+	tracesEndpoint  string
+	metricsEndpoint string
+	headers         map[string]string
+	resource        []otlpKeyValue
+	metricInterval  time.Duration
+}
+
+func newOTelExporter(proxyURL string) (*otelExporter, error) {
+	e := &otelExporter{
+		client:         checker.OutboundClient(proxyURL),
+		headers:        parseOTelList(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		metricInterval: 60 * time.Second,
+	}
+	e.client.Timeout = 10 * time.Second
+
+	base := strings.TrimSuffix(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/")
+	if base == "" {
+		base = "http://localhost:4318"
+	}
+	e.tracesEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if e.tracesEndpoint == "" {
+		e.tracesEndpoint = base + "/v1/traces"
+	}
+	e.metricsEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	if e.metricsEndpoint == "" {
+		e.metricsEndpoint = base + "/v1/metrics"
+	}
+
+	if v := os.Getenv("OTEL_METRIC_EXPORT_INTERVAL"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("invalid OTEL_METRIC_EXPORT_INTERVAL %q", v)
+		}
+		e.metricInterval = time.Duration(ms) * time.Millisecond
+	}
+
+	attrs := parseOTelList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		attrs["service.name"] = name
+	}
+	if attrs["service.name"] == "" {
+		attrs["service.name"] = "up"
+	}
+	if host, err := os.Hostname(); err == nil && attrs["host.name"] == "" {
+		attrs["host.name"] = host
+	}
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		e.resource = append(e.resource, otelString(k, attrs[k]))
+	}
+	return e, nil
+}
+
+// parseOTelList parses the key1=value1,key2=value2 format used by the
+// OTEL_* environment variables.
+func parseOTelList(s string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		if u, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+			v = u
+		}
+		m[strings.TrimSpace(k)] = v
+	}
+	return m
+}
+
+// startOTelExporter sends spans and metrics to the OTLP endpoint in the
+// background until stop is closed, then flushes what is left.
+func startOTelExporter(cfg *Config, stop <-chan struct{}) (done <-chan struct{}, err error) {
+	e, err := newOTelExporter(cfg.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	otelExporting.Store(true)
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		traceTicker := time.NewTicker(otelFlushInterval)
+		defer traceTicker.Stop()
+		metricTicker := time.NewTicker(e.metricInterval)
+		defer metricTicker.Stop()
+
+		var spans []otlpSpan
+		flushSpans := func() {
+			if len(spans) == 0 {
+				return
+			}
+			if err := e.exportSpans(spans); err != nil {
+				slog.Error("Failed to export spans", "spans", len(spans), "error", err)
+				if len(spans) < otelMaxSpans {
+					return
+				}
+				slog.Warn("Dropping buffered spans", "spans", len(spans))
+			}
+			spans = nil
+		}
+		exportMetrics := func() {
+			if err := e.exportMetrics(); err != nil {
+				slog.Error("Failed to export metrics", "error", err)
+			}
+		}
+
+		for {
+			select {
+			case s := <-otelSpans:
+				spans = append(spans, s)
+				if len(spans) >= otelSpanBatch {
+					flushSpans()
+				}
+			case <-traceTicker.C:
+				flushSpans()
+			case <-metricTicker.C:
+				exportMetrics()
+			case <-stop:
+				for len(otelSpans) > 0 {
+					spans = append(spans, <-otelSpans)
+				}
+				flushSpans()
+				exportMetrics()
+				return
+			}
+		}
+	}()
+	slog.Info("Exporting OpenTelemetry traces and metrics", "traces", e.tracesEndpoint, "metrics", e.metricsEndpoint)
+	return finished, nil
+}
+
+func (e *otelExporter) exportSpans(spans []otlpSpan) error {
+	return e.post(e.tracesEndpoint, map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": e.resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "up"},
+				"spans": spans,
+			}},
+		}},
+	})
+}
+
+func (e *otelExporter) exportMetrics() error {
+	otelMetrics.Lock()
+	start := strconv.FormatInt(otelMetrics.start.UnixNano(), 10)
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	histograms := map[string][]any{}
+	for k, h := range otelMetrics.histograms {
+		counts := make([]string, len(h.counts))
+		for i, c := range h.counts {
+			counts[i] = strconv.FormatUint(c, 10)
+		}
+		histograms[k.name] = append(histograms[k.name], map[string]any{
+			"attributes":        seriesAttributes(k.attrs),
+			"startTimeUnixNano": start,
+			"timeUnixNano":      now,
+			"count":             strconv.FormatUint(h.count, 10),
+			"sum":               h.sum,
+			"min":               h.min,
+			"max":               h.max,
+			"bucketCounts":      counts,
+			"explicitBounds":    otelDurationBounds,
+		})
+	}
+	gauges := map[string][]any{}
+	for k, g := range otelMetrics.gauges {
+		gauges[k.name] = append(gauges[k.name], map[string]any{
+			"attributes":   seriesAttributes(k.attrs),
+			"timeUnixNano": strconv.FormatInt(g.at.UnixNano(), 10),
+			"asDouble":     g.value,
+		})
+	}
+	otelMetrics.Unlock()
+
+	if len(histograms) == 0 && len(gauges) == 0 {
+		return nil
+	}
+
+	var metrics []any
+	for name, points := range histograms {
+		metrics = append(metrics, map[string]any{
+			"name": name,
+			"unit": "ms",
+			"histogram": map[string]any{
+				"dataPoints":             points,
+				"aggregationTemporality": 2, // cumulative
+			},
+		})
+	}
+	for name, points := range gauges {
+		metrics = append(metrics, map[string]any{
+			"name":  name,
+			"unit":  otelGaugeUnits[name],
+			"gauge": map[string]any{"dataPoints": points},
+		})
+	}
+
+	return e.post(e.metricsEndpoint, map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": e.resource},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]any{"name": "up"},
+				"metrics": metrics,
+			}},
+		}},
+	})
+}
+
+var otelGaugeUnits = map[string]string{
+	"up.check.up":           "1",
+	"up.speedtest.download": "Mbit/s",
+	"up.speedtest.upload":   "Mbit/s",
+	"up.speedtest.latency":  "ms",
+}
+
+func seriesAttributes(s string) []otlpKeyValue {
+	var attrs []otlpKeyValue
+	for _, kv := range strings.Split(s, "\x00") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			attrs = append(attrs, otelString(k, v))
+		}
+	}
+	return attrs
+}
+
+func (e *otelExporter) post(endpoint string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package up
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"up/checker"
+)
+
+var output struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+func (c *Config) checkOutputFormat() error {
+	switch c.OutputFormat {
+	case "", "ndjson":
+		return nil
+	}
+	return fmt.Errorf("-output must be ndjson")
+}
+
+// writeOutput writes a check result to stdout as a line of JSON, in the
+// same form as /status, for -output ndjson. Logs go to stderr, so stdout
+// carries nothing else.
+func writeOutput(format string, r checker.Result) {
+	if format != "ndjson" {
+		return
+	}
+	output.Lock()
+	defer output.Unlock()
+	if output.enc == nil {
+		output.enc = json.NewEncoder(os.Stdout)
+	}
+	if err := output.enc.Encode(r); err != nil {
+		slog.Error("Failed to write result to stdout", "error", err)
+	}
+}
+
+// tempDBPath creates an empty file for -no-db's temporary database.
+func tempDBPath() (string, error) {
+	f, err := os.CreateTemp("", "up-*.db")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// removeTempDB closes -no-db's temporary database at path and deletes it.
+func removeTempDB(path string) {
+	db.Close()
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		os.Remove(path + suffix)
+	}
+}
@@ -0,0 +1,85 @@
+package up
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyNotifier triggers a PagerDuty incident when a target goes down
+// and resolves it on recovery, using the Events API v2. The dedup key ties
+// the two together.
+type pagerDutyNotifier struct {
+	routingKey string
+	// severities maps target names to a PagerDuty severity; "" is the
+	// default.
+	severities map[string]string
+	client     *http.Client
+}
+
+// parsePagerDutySeverity parses -pagerduty-severity: a default severity
+// optionally followed by per-target overrides, e.g.
+// "critical,printer=warning".
+func parsePagerDutySeverity(s string) (map[string]string, error) {
+	severities := map[string]string{"": "critical"}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		target, severity, ok := strings.Cut(part, "=")
+		if !ok {
+			target, severity = "", part
+		}
+		switch severity {
+		case "critical", "error", "warning", "info":
+		default:
+			return nil, fmt.Errorf("invalid PagerDuty severity %q: must be critical, error, warning, or info", severity)
+		}
+		severities[strings.TrimSpace(target)] = severity
+	}
+	return severities, nil
+}
+
+func (p *pagerDutyNotifier) name() string { return "pagerduty" }
+
+func (p *pagerDutyNotifier) notify(a alert) error {
+	event := map[string]any{
+		"routing_key":  p.routingKey,
+		"dedup_key":    a.Key(),
+		"event_action": "resolve",
+	}
+	if a.Firing {
+		severity, ok := p.severities[a.Target]
+		if !ok {
+			severity = p.severities[""]
+		}
+		source, _ := os.Hostname()
+		if a.Probe != "" && a.Probe != "local" {
+			source = a.Probe
+		}
+		details := map[string]any{
+			"probe":             a.Probe,
+			"recent_latency_ms": a.RecentLatencyMs,
+		}
+		if msg := a.message("pagerduty", func() string { return "" }); msg != "" {
+			details["message"] = msg
+		}
+		event["event_action"] = "trigger"
+		event["payload"] = map[string]any{
+			"summary":        a.title("pagerduty"),
+			"source":         source,
+			"severity":       severity,
+			"timestamp":      a.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"),
+			"component":      a.Target,
+			"custom_details": details,
+		}
+		if a.dashboardURL != "" {
+			event["links"] = []map[string]string{{"href": a.dashboardURL, "text": "up dashboard"}}
+		}
+	}
+	return postJSON(p.client, pagerDutyEventsURL, event, nil)
+}
@@ -0,0 +1,40 @@
+package up
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"up/checker"
+)
+
+// targetHost is the host a target's checks connect to; push targets have
+// none.
+func (t *targetConfig) targetHost() string {
+	if t.Type == "push" {
+		return ""
+	}
+	return t.Hostname()
+}
+
+// captureIncidentPath traces the path to a target that has just gone down
+// and stores it with the incident.
+func captureIncidentPath(id int64, target string) {
+	t := findTarget(target)
+	if t == nil || t.targetHost() == "" {
+		return
+	}
+	path, err := checker.TracePath(t.targetHost(), t.Family)
+	if err != nil {
+		slog.Error("Failed to trace path", "target", target, "error", err)
+		return
+	}
+	data, err := json.Marshal(path)
+	if err != nil {
+		return
+	}
+	if _, err := db.Exec(`UPDATE incidents SET path = ? WHERE id = ?`, string(data), id); err != nil {
+		slog.Error("Failed to save incident path", "incident", id, "error", err)
+		return
+	}
+	slog.Info("Traced path to failing target", "target", target, "incident", id, "hops", len(path))
+}
@@ -0,0 +1,128 @@
+package up
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"up/checker"
+)
+
+// pathRounds is how many probes each hop gets per measurement, a second
+// apart, like mtr's report mode.
+const pathRounds = 10
+
+type pathReport struct {
+	Target    string             `json:"target"`
+	Timestamp time.Time          `json:"timestamp"`
+	Hops      []checker.HopStats `json:"hops"`
+}
+
+// monitorPaths measures the path to every target each -path-interval.
+func monitorPaths(ctx context.Context, cfg *Config) {
+	ticker := time.NewTicker(cfg.PathInterval)
+	defer ticker.Stop()
+	for {
+		for _, t := range currentTargets() {
+			host := t.targetHost()
+			if host == "" {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			hops, err := checker.MeasurePath(host, t.Family, pathRounds)
+			if err != nil {
+				slog.Error("Failed to measure path", "target", t.Name, "error", err)
+				continue
+			}
+			if err := savePathReport(t.Name, time.Now(), hops); err != nil {
+				slog.Error("Failed to save path", "target", t.Name, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func savePathReport(target string, ts time.Time, hops []checker.HopStats) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, h := range hops {
+		_, err := tx.Exec(`INSERT INTO path_hops (timestamp, target, ttl, addr, sent, received, avg_ms, best_ms, worst_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			ts, target, h.TTL, h.Addr, h.Sent, h.Received, h.AvgMs, h.BestMs, h.WorstMs)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// pathHandler serves the latest path measurement for each target, or with
+// ?window= each hop's statistics combined over that period.
+func (s *server) pathHandler(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT p.target, l.timestamp, ttl, addr, sent, received, avg_ms, best_ms, worst_ms FROM path_hops p
+		JOIN (SELECT target, MAX(timestamp) AS timestamp FROM path_hops GROUP BY target) l
+		ON p.target = l.target AND p.timestamp = l.timestamp`
+	var args []any
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		// The bare addr column comes from the row with MAX(timestamp), so
+		// each hop shows its most recent address.
+		query = `SELECT target, MAX(timestamp), ttl, addr, SUM(sent), SUM(received),
+			COALESCE(ROUND(SUM(avg_ms * received) / NULLIF(SUM(received), 0), 3), 0),
+			COALESCE(MIN(CASE WHEN received > 0 THEN best_ms END), 0), MAX(worst_ms)
+			FROM path_hops WHERE timestamp > ? GROUP BY target, ttl`
+		args = append(args, time.Now().Add(-d))
+	}
+	if target := r.URL.Query().Get("target"); target != "" {
+		query = `SELECT * FROM (` + query + `) WHERE target = ?`
+		args = append(args, target)
+	}
+	query += ` ORDER BY 1, 3`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	reports := []pathReport{}
+	for rows.Next() {
+		var target string
+		var lastSeen string
+		var h checker.HopStats
+		if err := rows.Scan(&target, &lastSeen, &h.TTL, &h.Addr, &h.Sent, &h.Received, &h.AvgMs, &h.BestMs, &h.WorstMs); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if h.Sent > 0 {
+			h.LossPct = float64(h.Sent-h.Received) / float64(h.Sent) * 100
+		}
+		if len(reports) == 0 || reports[len(reports)-1].Target != target {
+			reports = append(reports, pathReport{Target: target})
+		}
+		rep := &reports[len(reports)-1]
+		if ts, _ := time.Parse("2006-01-02 15:04:05.999999999-07:00", lastSeen); ts.After(rep.Timestamp) {
+			rep.Timestamp = ts
+		}
+		rep.Hops = append(rep.Hops, h)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
@@ -0,0 +1,188 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+func (c *Config) addPlanFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&c.PlanDownloadMbps, "plan-download", 0, "Advertised download speed of the internet plan in Mbps, to report speed tests against")
+	fs.Float64Var(&c.PlanUploadMbps, "plan-upload", 0, "Advertised upload speed of the internet plan in Mbps, to report speed tests against")
+	fs.Float64Var(&c.PlanSLAPct, "plan-sla", 80, "Percent of the plan's speeds a speed test must reach to count as meeting it")
+}
+
+func (c *Config) checkPlan() error {
+	if c.PlanDownloadMbps < 0 || c.PlanUploadMbps < 0 {
+		return fmt.Errorf("-plan-download and -plan-upload can't be negative")
+	}
+	if c.PlanSLAPct <= 0 || c.PlanSLAPct > 100 {
+		return fmt.Errorf("-plan-sla must be between 0 and 100")
+	}
+	return nil
+}
+
+func (c *Config) planConfigured() bool {
+	return c.PlanDownloadMbps > 0 || c.PlanUploadMbps > 0
+}
+
+// planReport compares speed tests with the plan, per period and per hour of
+// the day. Percentages are of the advertised speed, and are zero for a
+// direction the plan doesn't set.
+type planReport struct {
+	DownloadMbps float64      `json:"download_mbps"`
+	UploadMbps   float64      `json:"upload_mbps"`
+	SLAPct       float64      `json:"sla_pct"`
+	Tests        int          `json:"tests"`
+	DownloadPct  float64      `json:"download_pct"`
+	UploadPct    float64      `json:"upload_pct"`
+	BelowSLA     int          `json:"below_sla"`
+	Periods      []planPeriod `json:"periods"`
+	Hours        []planPeriod `json:"hours"`
+}
+
+// planPeriod is a period's or an hour's share of the plan. Start is the
+// period's first day, or the hour as "15:00".
+type planPeriod struct {
+	Start       string  `json:"start"`
+	Tests       int     `json:"tests"`
+	DownloadPct float64 `json:"download_pct"`
+	UploadPct   float64 `json:"upload_pct"`
+	BelowSLA    int     `json:"below_sla"`
+}
+
+// planTotals accumulates speed tests into a planPeriod.
+type planTotals struct {
+	tests, below     int
+	download, upload float64
+}
+
+func (t *planTotals) add(downloadPct, uploadPct float64, below bool) {
+	t.tests++
+	t.download += downloadPct
+	t.upload += uploadPct
+	if below {
+		t.below++
+	}
+}
+
+func (t *planTotals) period(start string) planPeriod {
+	p := planPeriod{Start: start, Tests: t.tests, BelowSLA: t.below}
+	if t.tests > 0 {
+		p.DownloadPct = math.Round(100*t.download/float64(t.tests)) / 100
+		p.UploadPct = math.Round(100*t.upload/float64(t.tests)) / 100
+	}
+	return p
+}
+
+// buildPlanReport compares the speed tests between from and to with the
+// plan, with days and hours in loc. It returns nil if no plan is set.
+func buildPlanReport(db *sql.DB, cfg *Config, period string, from, to time.Time, loc *time.Location) (*planReport, error) {
+	if !cfg.planConfigured() {
+		return nil, nil
+	}
+	if !validPeriod(period) {
+		return nil, fmt.Errorf("unknown period %q", period)
+	}
+
+	buckets := map[string]*planTotals{}
+	var order []string
+	for start := periodStart(from, period, loc); start.Before(to); start = nextPeriod(start, period) {
+		key := start.Format("2006-01-02")
+		buckets[key] = &planTotals{}
+		order = append(order, key)
+	}
+	var hours [24]planTotals
+	var total planTotals
+
+	rows, err := db.Query(`
+		SELECT timestamp, download_mbps, upload_mbps
+		FROM speedtests
+		WHERE timestamp >= ? AND timestamp < ?`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ts time.Time
+		var download, upload float64
+		if err := rows.Scan(&ts, &download, &upload); err != nil {
+			return nil, err
+		}
+		downloadPct, uploadPct := percentOfPlan(download, cfg.PlanDownloadMbps), percentOfPlan(upload, cfg.PlanUploadMbps)
+		below := cfg.PlanDownloadMbps > 0 && downloadPct < cfg.PlanSLAPct || cfg.PlanUploadMbps > 0 && uploadPct < cfg.PlanSLAPct
+
+		total.add(downloadPct, uploadPct, below)
+		hours[ts.In(loc).Hour()].add(downloadPct, uploadPct, below)
+		if b, ok := buckets[periodStart(ts, period, loc).Format("2006-01-02")]; ok {
+			b.add(downloadPct, uploadPct, below)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	t := total.period("")
+	report := &planReport{
+		DownloadMbps: cfg.PlanDownloadMbps,
+		UploadMbps:   cfg.PlanUploadMbps,
+		SLAPct:       cfg.PlanSLAPct,
+		Tests:        t.Tests,
+		DownloadPct:  t.DownloadPct,
+		UploadPct:    t.UploadPct,
+		BelowSLA:     t.BelowSLA,
+	}
+	for _, key := range order {
+		report.Periods = append(report.Periods, buckets[key].period(key))
+	}
+	for hour := range hours {
+		report.Hours = append(report.Hours, hours[hour].period(fmt.Sprintf("%02d:00", hour)))
+	}
+	return report, nil
+}
+
+func percentOfPlan(mbps, plan float64) float64 {
+	if plan <= 0 {
+		return 0
+	}
+	return 100 * mbps / plan
+}
+
+func (s *server) planReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.planConfigured() {
+		http.Error(w, "No plan configured: set -plan-download or -plan-upload", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+
+	period := q.Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	if !validPeriod(period) {
+		http.Error(w, "period must be daily, weekly, or monthly", http.StatusBadRequest)
+		return
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseRange(period, q.Get("from"), q.Get("to"), loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := buildPlanReport(s.db, &s.cfg, period, from, to, loc)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
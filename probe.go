@@ -0,0 +1,100 @@
+package up
+
+import (
+	"math"
+	"time"
+
+	"up/checker"
+)
+
+type probeStats struct {
+	AvgLatencyMs  float64
+	JitterMs      float64
+	PacketLossPct float64
+}
+
+// measureProbeBurst sends count sequential HEAD requests over a kept-alive
+// connection and derives average latency, jitter (mean absolute difference
+// between consecutive round trips), and the percentage of failed probes.
+// Requests go through proxyURL, as for checker.OutboundClient.
+func measureProbeBurst(proxyURL, url string, count int, spacing time.Duration) probeStats {
+	client := checker.OutboundClient(proxyURL)
+	client.Timeout = 2 * time.Second
+
+	// Warm up the connection so DNS and TLS setup don't skew the first sample.
+	if resp, err := client.Head(url); err == nil {
+		resp.Body.Close()
+	}
+
+	var rtts []float64
+	failed := 0
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(spacing)
+		}
+		start := time.Now()
+		resp, err := client.Head(url)
+		if err != nil {
+			failed++
+			continue
+		}
+		resp.Body.Close()
+		rtts = append(rtts, float64(time.Since(start).Microseconds())/1000)
+	}
+
+	var stats probeStats
+	if count > 0 {
+		stats.PacketLossPct = 100 * float64(failed) / float64(count)
+	}
+	if len(rtts) == 0 {
+		return stats
+	}
+
+	var sum float64
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	stats.AvgLatencyMs = sum / float64(len(rtts))
+
+	if len(rtts) > 1 {
+		var diffs float64
+		for i := 1; i < len(rtts); i++ {
+			diffs += math.Abs(rtts[i] - rtts[i-1])
+		}
+		stats.JitterMs = diffs / float64(len(rtts)-1)
+	}
+	return stats
+}
+
+// measureLoadedLatency probes url every interval until stop is closed and
+// returns the average round trip, in milliseconds, of the probes that
+// succeeded. Run alongside a speed test it shows how much latency rises
+// while the link is saturated (bufferbloat). Requests go through proxyURL,
+// as for checker.OutboundClient.
+func measureLoadedLatency(proxyURL, url string, interval time.Duration, stop <-chan struct{}) float64 {
+	client := checker.OutboundClient(proxyURL)
+	client.Timeout = 2 * time.Second
+
+	var sum float64
+	var n int
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if n == 0 {
+				return 0
+			}
+			return sum / float64(n)
+		case <-ticker.C:
+		}
+		start := time.Now()
+		resp, err := client.Head(url)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		sum += float64(time.Since(start).Microseconds()) / 1000
+		n++
+	}
+}
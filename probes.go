@@ -0,0 +1,51 @@
+package up
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"up/checker"
+)
+
+type probeInfo struct {
+	Probe     string    `json:"probe"`
+	LastSeen  time.Time `json:"last_seen"`
+	Checks    int       `json:"checks"`
+	UptimePct float64   `json:"uptime_pct"`
+}
+
+// probesHandler lists every probe that reported in the recent window.
+func (s *server) probesHandler(w http.ResponseWriter, r *http.Request) {
+	cutoff := time.Now().Add(-s.cfg.Recent)
+
+	rows, err := s.db.Query(`
+		SELECT probe,
+			MAX(timestamp),
+			COUNT(*),
+			ROUND(100.0 * SUM(CASE WHEN `+checker.AnsweredSQL+` THEN 1 ELSE 0 END) / COUNT(*), 2)
+		FROM checks
+		WHERE timestamp > ? AND maintenance = 0
+		GROUP BY probe
+		ORDER BY probe`, cutoff)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	probes := []probeInfo{}
+	for rows.Next() {
+		var p probeInfo
+		var lastSeen string
+		if err := rows.Scan(&p.Probe, &lastSeen, &p.Checks, &p.UptimePct); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		p.LastSeen, _ = time.Parse("2006-01-02 15:04:05.999999999-07:00", lastSeen)
+		probes = append(probes, p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(probes)
+}
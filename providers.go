@@ -0,0 +1,67 @@
+package up
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	// providerTargets are the prepared targets reported by the Kubernetes
+	// and Docker providers, by provider. They follow what the provider
+	// reports, not the config file or the API. Guarded by targetsMu.
+	providerTargets = map[string][]targetConfig{}
+	// providerWanted are the unprepared targets each provider last
+	// reported, to tell whether anything changed.
+	providerWanted = map[string][]targetConfig{}
+)
+
+// setProviderTargets replaces the targets a provider reports with wanted,
+// if they changed. Invalid targets are skipped with a warning rather than
+// holding up the rest.
+func setProviderTargets(cfg *Config, provider string, wanted []targetConfig) {
+	slices.SortFunc(wanted, func(a, b targetConfig) int { return strings.Compare(a.Name, b.Name) })
+
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	previous := providerWanted[provider]
+	if slices.EqualFunc(wanted, previous, func(a, b targetConfig) bool { return a.Name == b.Name && a.URL == b.URL }) {
+		return
+	}
+
+	var prepared []targetConfig
+	for _, t := range wanted {
+		p, err := prepareTargets([]targetConfig{t}, cfg)
+		if err != nil {
+			slog.Warn("Skipping target", "target", t.Name, "source", provider, "error", err)
+			continue
+		}
+		prepared = append(prepared, p...)
+	}
+	for _, t := range wanted {
+		if !slices.ContainsFunc(previous, func(old targetConfig) bool { return old.Name == t.Name }) {
+			slog.Info("Target added", "target", t.Name, "url", t.URL, "source", provider)
+		}
+	}
+	for _, old := range previous {
+		if !slices.ContainsFunc(wanted, func(t targetConfig) bool { return t.Name == old.Name }) {
+			slog.Info("Target removed", "target", old.Name, "source", provider)
+		}
+	}
+	providerWanted[provider] = wanted
+	providerTargets[provider] = prepared
+	if err := rebuildTargets(cfg, managedTargets); err != nil {
+		slog.Error("Failed to update targets", "error", err)
+	}
+}
+
+// allProviderTargets returns the targets of every provider, in provider
+// order. targetsMu must be held.
+func allProviderTargets() []targetConfig {
+	var all []targetConfig
+	for _, provider := range slices.Sorted(maps.Keys(providerTargets)) {
+		all = append(all, providerTargets[provider]...)
+	}
+	return all
+}
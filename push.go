@@ -0,0 +1,115 @@
+package up
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// heartbeat is the last ping received for a push target.
+type heartbeat struct {
+	at     time.Time
+	failed bool
+}
+
+var (
+	heartbeatMu sync.Mutex
+	heartbeats  = map[string]heartbeat{}
+
+	// pushStarted gives push targets one full interval after startup before
+	// a missing ping counts as down.
+	pushStarted = time.Now()
+)
+
+func (t *targetConfig) initPush() error {
+	if t.Name == "" {
+		return fmt.Errorf("push target is missing a name")
+	}
+	if t.HeartbeatInterval == "" {
+		return fmt.Errorf("target %s: push targets need a heartbeat_interval", t.Name)
+	}
+	d, err := time.ParseDuration(t.HeartbeatInterval)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("target %s: invalid heartbeat_interval %q", t.Name, t.HeartbeatInterval)
+	}
+	t.heartbeat = d
+
+	// Without an explicit token the URL is derived from the name, so it
+	// stays stable across restarts.
+	if t.Token == "" {
+		sum := sha256.Sum256([]byte("up-push:" + t.Name))
+		t.Token = hex.EncodeToString(sum[:12])
+	}
+	return nil
+}
+
+// checkPush reports a push target as up if it was pinged, without a
+// failure status, within its heartbeat interval.
+func checkPush(t *targetConfig) checker.Result {
+	heartbeatMu.Lock()
+	hb, ok := heartbeats[t.Name]
+	heartbeatMu.Unlock()
+
+	last := pushStarted
+	if ok {
+		last = hb.at
+	}
+
+	status := "up"
+	if hb.failed || time.Since(last) > t.heartbeat {
+		status = "down"
+	}
+	return checker.Result{
+		Timestamp: time.Now(),
+		Target:    t.Name,
+		Status:    status,
+	}
+}
+
+// logPushURLs prints the ping path of every push target so it can be copied
+// into a cron job.
+func logPushURLs() {
+	for _, t := range currentTargets() {
+		if t.Type == "push" {
+			slog.Info("Push target", "target", t.Name, "path", "/push/"+t.Token, "heartbeat_interval", t.heartbeat)
+		}
+	}
+}
+
+// pushHandler records a heartbeat for the push target owning the token in
+// /push/<token>. A ?status=down (or fail) ping marks the job as failed until
+// the next successful ping.
+func (s *server) pushHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/push/")
+
+	var t *targetConfig
+	ts := currentTargets()
+	for i := range ts {
+		if ts[i].Type == "push" && ts[i].Token == token {
+			t = &ts[i]
+			break
+		}
+	}
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	failed := status == "down" || status == "fail"
+
+	heartbeatMu.Lock()
+	heartbeats[t.Name] = heartbeat{at: time.Now(), failed: failed}
+	heartbeatMu.Unlock()
+	slog.Debug("Heartbeat received", "target", t.Name, "failed", failed)
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "OK")
+}
@@ -0,0 +1,48 @@
+package up
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const pushoverMessagesURL = "https://api.pushover.net/1/messages.json"
+
+type pushoverNotifier struct {
+	token, user              string
+	downPriority, upPriority int
+	client                   *http.Client
+}
+
+func checkPushoverPriority(p int) error {
+	if p < -2 || p > 2 {
+		return fmt.Errorf("invalid Pushover priority %d: must be between -2 and 2", p)
+	}
+	return nil
+}
+
+func (p *pushoverNotifier) name() string { return "pushover" }
+
+func (p *pushoverNotifier) notify(a alert) error {
+	priority := p.upPriority
+	if a.Firing {
+		priority = p.downPriority
+	}
+	msg := map[string]any{
+		"token":     p.token,
+		"user":      p.user,
+		"title":     a.title("pushover"),
+		"message":   a.message("pushover", a.Details),
+		"priority":  priority,
+		"timestamp": a.Timestamp.Unix(),
+	}
+	if a.dashboardURL != "" {
+		msg["url"] = a.dashboardURL
+	}
+	if priority == 2 {
+		// Emergency priority repeats until acknowledged, which Pushover
+		// requires an interval and a deadline for.
+		msg["retry"] = 300
+		msg["expire"] = 3600
+	}
+	return postJSON(p.client, pushoverMessagesURL, msg, nil)
+}
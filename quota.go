@@ -0,0 +1,97 @@
+package up
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// quotaInterval is how often the database is measured against -max-db-size
+// between prunes.
+const quotaInterval = 10 * time.Minute
+
+// agedTables are the tables aged out, oldest first, to keep the database
+// under -max-db-size.
+var agedTables = []string{"checks", "speedtests", "path_hops", "snmp", "dns_lookups", "ntp"}
+
+// dbUsedSize is the space the database's data takes up: its size less the
+// free pages left by deletes, which SQLite reuses before growing the file.
+func dbUsedSize() (int64, error) {
+	var size int64
+	err := db.QueryRow(`SELECT (page_count - freelist_count) * page_size
+		FROM pragma_page_count(), pragma_freelist_count(), pragma_page_size()`).Scan(&size)
+	return size, err
+}
+
+// watchDBSize enforces -max-db-size every quotaInterval, so a small disk
+// can't fill up between daily prunes.
+func watchDBSize(cfg *Config) {
+	for {
+		time.Sleep(quotaInterval)
+		aged, err := enforceSizeQuota(cfg.MaxDBSize)
+		if err != nil {
+			slog.Error("Failed to enforce the database size quota", "error", err)
+		} else if aged {
+			if err := vacuumDB(cfg.VacuumMode); err != nil {
+				slog.Error("Failed to vacuum database", "error", err)
+			}
+		}
+	}
+}
+
+// enforceSizeQuota deletes the oldest data from every table in agedTables,
+// in steps of at least an hour, until the database's data fits in quota
+// (-max-db-size), and reports whether it deleted any. The file itself only
+// shrinks with -vacuum; without it, it stops growing as new data reuses the
+// freed pages.
+func enforceSizeQuota(quota byteSize) (aged bool, err error) {
+	if quota == 0 {
+		return false, nil
+	}
+	for {
+		used, err := dbUsedSize()
+		if err != nil {
+			return aged, err
+		}
+		if used <= int64(quota) {
+			break
+		}
+
+		// Age out the oldest checks in proportion to the overshoot; the
+		// other tables are cut at the same time.
+		var total int64
+		if err := db.QueryRow(`SELECT COUNT(*) FROM checks`).Scan(&total); err != nil {
+			return aged, err
+		}
+		if total == 0 {
+			slog.Warn("Database is over -max-db-size but has no checks left to age out", "used_bytes", used, "max_bytes", int64(quota))
+			break
+		}
+		offset := min(total-1, total*(used-int64(quota))/used)
+		var oldest, cutoff time.Time
+		if err := db.QueryRow(`SELECT timestamp FROM checks ORDER BY timestamp LIMIT 1`).Scan(&oldest); err != nil {
+			return aged, err
+		}
+		if err := db.QueryRow(`SELECT timestamp FROM checks ORDER BY timestamp LIMIT 1 OFFSET ?`, offset).Scan(&cutoff); err != nil {
+			return aged, err
+		}
+		cutoff = cutoff.Add(time.Nanosecond)
+		if cutoff.Before(oldest.Add(time.Hour)) {
+			cutoff = oldest.Add(time.Hour)
+		}
+
+		var deleted int64
+		for _, table := range agedTables {
+			res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE timestamp < ?", table), cutoff)
+			if err != nil {
+				return aged, fmt.Errorf("failed to age out %s: %v", table, err)
+			}
+			n, _ := res.RowsAffected()
+			deleted += n
+		}
+		forgetRecentChecks(cutoff, func(string) bool { return true })
+		slog.Warn("Aged out data to stay under -max-db-size", "cutoff", cutoff.Format(time.RFC3339), "rows", deleted, "used_bytes", used, "max_bytes", int64(quota))
+		aged = true
+	}
+	return aged, nil
+}
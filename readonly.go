@@ -0,0 +1,23 @@
+package up
+
+// loadRecordedTargets lists the targets in the database's checks alongside
+// the configured ones, so an archived database can be viewed without its
+// config. They are listed like targets reported by agents.
+func loadRecordedTargets() error {
+	rows, err := db.Query(`SELECT DISTINCT target FROM checks`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	agentTargetsMu.Lock()
+	defer agentTargetsMu.Unlock()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		agentTargets[name] = true
+	}
+	return rows.Err()
+}
@@ -0,0 +1,70 @@
+package up
+
+import (
+	"log/slog"
+	"net/http"
+
+	"up/httpapi"
+)
+
+// reloadConfig re-reads -config (or -targets) and swaps in the new targets,
+// maintenance windows, speed test providers, alert rules, and message
+// templates. History, incidents, and state are keyed by target name, so
+// unchanged targets carry on as before.
+// On error the running configuration is kept.
+func reloadConfig(cfg *Config, o *commonOptions) error {
+	fc, err := o.load(cfg)
+	if err != nil {
+		return err
+	}
+
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+
+	prevTargets := configTargets
+	configTargets = fc.Targets
+	if err := rebuildTargets(cfg, managedTargets); err != nil {
+		configTargets = prevTargets
+		return err
+	}
+	maintenanceWindows = fc.Maintenance
+	speedTestProviders = fc.SpeedTestProviders
+	setupSpeedTestProviders(cfg)
+	alertRules, messageTemplates = fc.Alerts, fc.Templates
+	retentionPolicies = fc.Retention
+
+	slog.Info("Configuration reloaded", "targets", len(targets), "maintenance_windows", len(fc.Maintenance), "alert_rules", len(fc.Alerts))
+	return nil
+}
+
+// reloadHandler serves POST /reload, which has the same effect as SIGHUP.
+func (s *server) reloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !httpapi.BearerTokenMatches(r, s.cfg.APIToken) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		actor, remote := requestActor(r)
+		if err := auditedReload(reload, actor, remote); err != nil {
+			slog.Error("Failed to reload configuration", "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// auditedReload reloads the configuration and records it in the audit log,
+// with the targets before and after.
+func auditedReload(reload func() error, actor, remote string) error {
+	before := targetNames()
+	if err := reload(); err != nil {
+		return err
+	}
+	recordAudit(actor, remote, "config.reload", "config", before, targetNames())
+	return nil
+}
@@ -0,0 +1,245 @@
+package up
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+const (
+	remoteWriteFlushInterval = 10 * time.Second
+	remoteWriteBatchSamples  = 2000
+	// remoteWriteMaxBuffer bounds the samples kept while the endpoint is
+	// unreachable.
+	remoteWriteMaxBuffer = 100000
+)
+
+type promSample struct {
+	labels    []string // name/value pairs, including __name__
+	value     float64
+	timestamp int64 // milliseconds
+}
+
+// startRemoteWriteExporter pushes every check and speed test result to a
+// Prometheus remote_write endpoint, such as Mimir, VictoriaMetrics, or
+// Grafana Cloud, in batches.
+func startRemoteWriteExporter(cfg *Config) {
+	ch := events.subscribe()
+	client := checker.OutboundClient(cfg.ProxyURL)
+	client.Timeout = 30 * time.Second
+
+	go func() {
+		ticker := time.NewTicker(remoteWriteFlushInterval)
+		defer ticker.Stop()
+
+		var samples []promSample
+		flush := func() {
+			if len(samples) == 0 {
+				return
+			}
+			if retry, err := writeRemote(cfg, client, encodeWriteRequest(samples)); err != nil {
+				slog.Error("Failed to write to remote_write endpoint", "samples", len(samples), "error", err)
+				// Receivers reject bad batches, such as out-of-order
+				// samples, with a client error; sending them again won't help.
+				if !retry || len(samples) > remoteWriteMaxBuffer {
+					slog.Warn("Dropping buffered remote_write samples", "samples", len(samples))
+					samples = nil
+				}
+				return
+			}
+			samples = nil
+		}
+
+		for {
+			select {
+			case e := <-ch:
+				samples = appendPromSamples(samples, e)
+				if len(samples) >= remoteWriteBatchSamples {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	slog.Info("Exporting results with Prometheus remote_write", "url", cfg.RemoteWriteURL)
+}
+
+// appendPromSamples turns check and speed test events into samples; other
+// events are ignored.
+func appendPromSamples(samples []promSample, e event) []promSample {
+	switch r := e.Data.(type) {
+	case checker.Result:
+		ts := r.Timestamp.UnixMilli()
+		labels := promLabels("target", r.Target, "probe", r.Probe, "family", r.Family)
+		up, degraded := 0.0, 0.0
+		if checker.Answered(r.Status) {
+			up = 1
+		}
+		if r.Status == "degraded" {
+			degraded = 1
+		}
+		maintenance := 0.0
+		if r.Maintenance {
+			maintenance = 1
+		}
+		for _, m := range []struct {
+			name  string
+			value float64
+		}{
+			{"up_check_success", up},
+			{"up_check_degraded", degraded},
+			{"up_check_maintenance", maintenance},
+			{"up_check_latency_seconds", float64(r.LatencyMs) / 1000},
+			{"up_check_dns_seconds", float64(r.DNSMs) / 1000},
+			{"up_check_connect_seconds", float64(r.ConnectMs) / 1000},
+			{"up_check_tls_seconds", float64(r.TLSMs) / 1000},
+			{"up_check_ttfb_seconds", float64(r.TTFBMs) / 1000},
+		} {
+			samples = append(samples, promSample{labels: append([]string{"__name__", m.name}, labels...), value: m.value, timestamp: ts})
+		}
+	case speedTestResult:
+		ts := r.Timestamp.UnixMilli()
+		labels := promLabels("provider", r.Provider)
+		for _, m := range []struct {
+			name  string
+			value float64
+		}{
+			{"up_speedtest_download_mbps", r.DownloadMbps},
+			{"up_speedtest_download_peak_mbps", r.DownloadPeakMbps},
+			{"up_speedtest_upload_mbps", r.UploadMbps},
+			{"up_speedtest_latency_seconds", float64(r.LatencyMs) / 1000},
+			{"up_speedtest_loaded_latency_seconds", float64(r.LoadedLatencyMs) / 1000},
+			{"up_speedtest_jitter_seconds", r.JitterMs / 1000},
+			{"up_speedtest_packet_loss_percent", r.PacketLossPct},
+		} {
+			samples = append(samples, promSample{labels: append([]string{"__name__", m.name}, labels...), value: m.value, timestamp: ts})
+		}
+	}
+	return samples
+}
+
+// promLabels returns the key/value pairs with empty values left out.
+func promLabels(kv ...string) []string {
+	var labels []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			labels = append(labels, kv[i], kv[i+1])
+		}
+	}
+	return labels
+}
+
+// encodeWriteRequest encodes samples as a remote_write WriteRequest
+// protobuf message, with the samples of each series in one TimeSeries, in
+// time order, and labels sorted by name as receivers require.
+func encodeWriteRequest(samples []promSample) []byte {
+	type series struct {
+		labels  [][2]string
+		samples []promSample
+	}
+	var order []string
+	byKey := map[string]*series{}
+	for _, s := range samples {
+		var labels [][2]string
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			labels = append(labels, [2]string{s.labels[i], s.labels[i+1]})
+		}
+		slices.SortFunc(labels, func(a, b [2]string) int { return strings.Compare(a[0], b[0]) })
+		key := fmt.Sprint(labels)
+		if byKey[key] == nil {
+			byKey[key] = &series{labels: labels}
+			order = append(order, key)
+		}
+		byKey[key].samples = append(byKey[key].samples, s)
+	}
+
+	var req []byte
+	for _, key := range order {
+		s := byKey[key]
+		slices.SortStableFunc(s.samples, func(a, b promSample) int { return cmp.Compare(a.timestamp, b.timestamp) })
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protoBytes(label, 1, []byte(l[0]))
+			label = protoBytes(label, 2, []byte(l[1]))
+			ts = protoBytes(ts, 1, label)
+		}
+		for _, sample := range s.samples {
+			var b []byte
+			b = append(b, 1<<3|1) // field 1, 64-bit
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(sample.value))
+			b = append(b, 2<<3|0) // field 2, varint
+			b = binary.AppendUvarint(b, uint64(sample.timestamp))
+			ts = protoBytes(ts, 2, b)
+		}
+		req = protoBytes(req, 1, ts)
+	}
+	return req
+}
+
+// protoBytes appends a length-delimited protobuf field.
+func protoBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// snappyEncode frames data as a snappy block made only of literals. That
+// is valid snappy, which remote_write requires, without a compressor;
+// batches are small enough that the lack of compression doesn't matter.
+func snappyEncode(data []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := min(len(data), 1<<16)
+		if n <= 60 {
+			b = append(b, byte(n-1)<<2)
+		} else {
+			b = append(b, 61<<2)
+			b = binary.LittleEndian.AppendUint16(b, uint16(n-1))
+		}
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	return b
+}
+
+// writeRemote sends a WriteRequest, and on failure reports whether it is
+// worth retrying.
+func writeRemote(cfg *Config, client *http.Client, message []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, cfg.RemoteWriteURL, bytes.NewReader(snappyEncode(message)))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case cfg.RemoteWriteToken != "":
+		req.Header.Set("Authorization", "Bearer "+cfg.RemoteWriteToken)
+	case cfg.RemoteWriteUser != "":
+		req.SetBasicAuth(cfg.RemoteWriteUser, cfg.RemoteWritePassword)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("remote_write endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return false, nil
+}
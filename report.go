@@ -0,0 +1,249 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"up/checker"
+)
+
+type periodReport struct {
+	Start           string  `json:"start"`
+	End             string  `json:"end"`
+	TotalChecks     int     `json:"total_checks"`
+	UptimePct       float64 `json:"uptime_pct"`
+	DowntimeMinutes float64 `json:"downtime_minutes"`
+	Incidents       int     `json:"incidents"`
+	MTTRMinutes     float64 `json:"mttr_minutes"`
+}
+
+type targetReport struct {
+	Target  string         `json:"target"`
+	Period  string         `json:"period"`
+	Periods []periodReport `json:"periods"`
+}
+
+func validPeriod(period string) bool {
+	return period == "daily" || period == "weekly" || period == "monthly"
+}
+
+// periodStart returns the start of the period containing t, with days
+// beginning at midnight in loc.
+func periodStart(t time.Time, period string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch period {
+	case "weekly":
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset)
+	case "monthly":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	}
+	return day
+}
+
+func nextPeriod(t time.Time, period string) time.Time {
+	switch period {
+	case "weekly":
+		return t.AddDate(0, 0, 7)
+	case "monthly":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// defaultReportRange returns the range covered when no explicit range is
+// requested: 30 days, 12 weeks, or 12 months.
+func defaultReportRange(period string, now time.Time, loc *time.Location) (time.Time, time.Time) {
+	to := nextPeriod(periodStart(now, period, loc), period)
+	switch period {
+	case "weekly":
+		return to.AddDate(0, 0, -7*12), to
+	case "monthly":
+		return to.AddDate(0, -12, 0), to
+	}
+	return to.AddDate(0, 0, -30), to
+}
+
+// buildReport breaks the target's uptime and incidents down by period, with
+// days beginning at midnight in loc.
+func buildReport(db *sql.DB, target, period string, from, to time.Time, loc *time.Location) (targetReport, error) {
+	report := targetReport{Target: target, Period: period}
+	if !validPeriod(period) {
+		return report, fmt.Errorf("unknown period %q", period)
+	}
+
+	buckets := map[string]*periodReport{}
+	var order []string
+	for start := periodStart(from, period, loc); start.Before(to); start = nextPeriod(start, period) {
+		key := start.Format("2006-01-02")
+		buckets[key] = &periodReport{
+			Start: key,
+			End:   nextPeriod(start, period).Format("2006-01-02"),
+		}
+		order = append(order, key)
+	}
+
+	// Checks are counted in quarter hours of UTC, which every time zone's
+	// midnight falls on, and the quarters added up into periods here.
+	rows, err := db.Query(`
+		SELECT strftime('%Y-%m-%d %H:', timestamp) || printf('%02d', CAST(strftime('%M', timestamp) AS INTEGER) / 15 * 15) AS quarter,
+			COUNT(*),
+			SUM(CASE WHEN `+checker.AnsweredSQL+` THEN 1 ELSE 0 END)
+		FROM checks
+		WHERE target = ? AND timestamp >= ? AND timestamp < ? AND maintenance = 0
+		GROUP BY quarter`, target, from, to)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	ups := map[string]int{}
+	for rows.Next() {
+		var quarter string
+		var total, up int
+		if err := rows.Scan(&quarter, &total, &up); err != nil {
+			return report, err
+		}
+		t, err := time.Parse("2006-01-02 15:04", quarter)
+		if err != nil {
+			return report, err
+		}
+		key := periodStart(t, period, loc).Format("2006-01-02")
+		if b, ok := buckets[key]; ok {
+			b.TotalChecks += total
+			ups[key] += up
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	for key, b := range buckets {
+		if b.TotalChecks > 0 {
+			b.UptimePct = math.Round(10000*float64(ups[key])/float64(b.TotalChecks)) / 100
+		}
+	}
+
+	incidents, err := db.Query(`
+		SELECT start_time, end_time
+		FROM incidents
+		WHERE target = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)`, target, to, from)
+	if err != nil {
+		return report, err
+	}
+	defer incidents.Close()
+
+	repairMinutes := map[string]float64{}
+	repaired := map[string]int{}
+	for incidents.Next() {
+		var start time.Time
+		var end sql.NullTime
+		if err := incidents.Scan(&start, &end); err != nil {
+			return report, err
+		}
+		stop := time.Now()
+		if end.Valid {
+			stop = end.Time
+		}
+
+		// Downtime is split across every period the incident overlaps;
+		// the incident itself counts towards the period it started in.
+		for p := periodStart(start, period, loc); p.Before(stop) && p.Before(to); p = nextPeriod(p, period) {
+			b, ok := buckets[p.Format("2006-01-02")]
+			if !ok {
+				continue
+			}
+			lo, hi := maxTime(start, p), minTime(stop, nextPeriod(p, period))
+			b.DowntimeMinutes += hi.Sub(lo).Minutes()
+		}
+
+		key := periodStart(start, period, loc).Format("2006-01-02")
+		if b, ok := buckets[key]; ok {
+			b.Incidents++
+			if end.Valid {
+				repairMinutes[key] += end.Time.Sub(start).Minutes()
+				repaired[key]++
+			}
+		}
+	}
+	if err := incidents.Err(); err != nil {
+		return report, err
+	}
+
+	for _, key := range order {
+		b := buckets[key]
+		if repaired[key] > 0 {
+			b.MTTRMinutes = repairMinutes[key] / float64(repaired[key])
+		}
+		report.Periods = append(report.Periods, *b)
+	}
+	return report, nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain YYYY-MM-DD dates,
+// which start at midnight in loc.
+func parseTimeParam(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, loc)
+}
+
+func (s *server) reportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	period := q.Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	if !validPeriod(period) {
+		http.Error(w, "period must be daily, weekly, or monthly", http.StatusBadRequest)
+		return
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseRange(period, q.Get("from"), q.Get("to"), loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names := targetNames()
+	if target := q.Get("target"); target != "" {
+		names = []string{target}
+	}
+
+	var reports []targetReport
+	for _, target := range names {
+		report, err := buildReport(s.db, target, period, from, to, loc)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
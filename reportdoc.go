@@ -0,0 +1,325 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"text/template"
+	"time"
+
+	"up/checker"
+)
+
+// reportDocument is a standalone report over a time range, suitable for
+// attaching to an ISP support ticket.
+type reportDocument struct {
+	Generated  time.Time            `json:"generated"`
+	From       time.Time            `json:"from"`
+	To         time.Time            `json:"to"`
+	Period     string               `json:"period"`
+	Targets    []targetRangeSummary `json:"targets"`
+	Breakdown  []targetReport       `json:"breakdown"`
+	SpeedTests []speedTestSummary   `json:"speedtests"`
+	// Plan compares the speed tests with the internet plan, if one is set.
+	Plan      *planReport `json:"plan,omitempty"`
+	Incidents []incident  `json:"incidents"`
+}
+
+type targetRangeSummary struct {
+	Target          string  `json:"target"`
+	TotalChecks     int     `json:"total_checks"`
+	UptimePct       float64 `json:"uptime_pct"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+	P95LatencyMs    float64 `json:"p95_latency_ms"`
+	DowntimeMinutes float64 `json:"downtime_minutes"`
+	Incidents       int     `json:"incidents"`
+	MTTRMinutes     float64 `json:"mttr_minutes"`
+}
+
+type speedTestSummary struct {
+	Provider        string  `json:"provider"`
+	Tests           int     `json:"tests"`
+	AvgDownloadMbps float64 `json:"avg_download_mbps"`
+	MinDownloadMbps float64 `json:"min_download_mbps"`
+	MaxDownloadMbps float64 `json:"max_download_mbps"`
+	AvgUploadMbps   float64 `json:"avg_upload_mbps"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+}
+
+func buildReportDocument(db *sql.DB, cfg *Config, names []string, period string, from, to time.Time, loc *time.Location) (*reportDocument, error) {
+	doc := &reportDocument{
+		Generated: time.Now().In(loc),
+		From:      from.In(loc),
+		To:        to.In(loc),
+		Period:    period,
+	}
+
+	for _, name := range names {
+		report, err := buildReport(db, name, period, from, to, loc)
+		if err != nil {
+			return nil, err
+		}
+		doc.Breakdown = append(doc.Breakdown, report)
+
+		summary, err := summarizeRange(db, name, from, to, report)
+		if err != nil {
+			return nil, err
+		}
+		doc.Targets = append(doc.Targets, summary)
+	}
+
+	rows, err := db.Query(`
+		SELECT provider, COUNT(*), AVG(download_mbps), MIN(download_mbps), MAX(download_mbps), AVG(upload_mbps), AVG(latency_ms)
+		FROM speedtests
+		WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY provider
+		ORDER BY provider`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s speedTestSummary
+		if err := rows.Scan(&s.Provider, &s.Tests, &s.AvgDownloadMbps, &s.MinDownloadMbps, &s.MaxDownloadMbps, &s.AvgUploadMbps, &s.AvgLatencyMs); err != nil {
+			return nil, err
+		}
+		doc.SpeedTests = append(doc.SpeedTests, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if doc.Plan, err = buildPlanReport(db, cfg, period, from, to, loc); err != nil {
+		return nil, err
+	}
+
+	incidents, err := db.Query(`
+		SELECT id, target, probe, start_time, end_time, check_count
+		FROM incidents
+		WHERE start_time < ? AND (end_time IS NULL OR end_time > ?)
+		ORDER BY start_time`, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer incidents.Close()
+	for incidents.Next() {
+		var inc incident
+		var end sql.NullTime
+		if err := incidents.Scan(&inc.ID, &inc.Target, &inc.Probe, &inc.Start, &end, &inc.CheckCount); err != nil {
+			return nil, err
+		}
+		inc.Start = inc.Start.In(loc)
+		if end.Valid {
+			end.Time = end.Time.In(loc)
+			inc.End = &end.Time
+			inc.DurationSeconds = end.Time.Sub(inc.Start).Seconds()
+		} else {
+			inc.Ongoing = true
+			inc.DurationSeconds = time.Since(inc.Start).Seconds()
+		}
+		doc.Incidents = append(doc.Incidents, inc)
+	}
+	return doc, incidents.Err()
+}
+
+// summarizeRange totals a target's checks over the whole range, reusing the
+// per-period report for downtime and incident counts.
+func summarizeRange(db *sql.DB, target string, from, to time.Time, report targetReport) (targetRangeSummary, error) {
+	s := targetRangeSummary{Target: target}
+
+	var up int
+	var avg sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN `+checker.AnsweredSQL+` THEN 1 ELSE 0 END), 0), AVG(CASE WHEN `+checker.AnsweredSQL+` THEN latency_ms END)
+		FROM checks
+		WHERE target = ? AND timestamp >= ? AND timestamp < ? AND maintenance = 0`, target, from, to).Scan(&s.TotalChecks, &up, &avg)
+	if err != nil {
+		return s, err
+	}
+	if s.TotalChecks > 0 {
+		s.UptimePct = math.Round(10000*float64(up)/float64(s.TotalChecks)) / 100
+	}
+	s.AvgLatencyMs = math.Round(avg.Float64*100) / 100
+
+	rows, err := db.Query(`
+		SELECT latency_ms
+		FROM checks
+		WHERE target = ? AND timestamp >= ? AND timestamp < ? AND `+checker.AnsweredSQL+` AND maintenance = 0
+		ORDER BY latency_ms`, target, from, to)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	var latencies []int64
+	for rows.Next() {
+		var l int64
+		if err := rows.Scan(&l); err != nil {
+			return s, err
+		}
+		latencies = append(latencies, l)
+	}
+	s.P95LatencyMs = percentile(latencies, 95)
+
+	if err := rows.Err(); err != nil {
+		return s, err
+	}
+
+	for _, p := range report.Periods {
+		s.DowntimeMinutes += p.DowntimeMinutes
+		s.Incidents += p.Incidents
+	}
+
+	resolved, err := db.Query(`
+		SELECT start_time, end_time
+		FROM incidents
+		WHERE target = ? AND start_time >= ? AND start_time < ? AND end_time IS NOT NULL`, target, from, to)
+	if err != nil {
+		return s, err
+	}
+	defer resolved.Close()
+	var repairMinutes float64
+	var repaired int
+	for resolved.Next() {
+		var start, end time.Time
+		if err := resolved.Scan(&start, &end); err != nil {
+			return s, err
+		}
+		repairMinutes += end.Sub(start).Minutes()
+		repaired++
+	}
+	if repaired > 0 {
+		s.MTTRMinutes = repairMinutes / float64(repaired)
+	}
+	return s, resolved.Err()
+}
+
+var reportFuncs = map[string]any{
+	"date": func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+	"f2":   func(f float64) string { return fmt.Sprintf("%.2f", f) },
+	"mins": func(seconds float64) string { return fmt.Sprintf("%.1f", seconds/60) },
+}
+
+const markdownReport = `# Uptime report
+
+{{date .From}} – {{date .To}} (generated {{date .Generated}})
+
+## Targets
+
+| Target | Checks | Uptime | Avg latency | p95 latency | Downtime (min) | Incidents | MTTR (min) |
+|---|---:|---:|---:|---:|---:|---:|---:|
+{{range .Targets}}| {{.Target}} | {{.TotalChecks}} | {{f2 .UptimePct}}% | {{f2 .AvgLatencyMs}} ms | {{f2 .P95LatencyMs}} ms | {{f2 .DowntimeMinutes}} | {{.Incidents}} | {{f2 .MTTRMinutes}} |
+{{end}}
+## Speed tests
+{{if .SpeedTests}}
+| Provider | Tests | Avg down | Min down | Max down | Avg up | Avg latency |
+|---|---:|---:|---:|---:|---:|---:|
+{{range .SpeedTests}}| {{.Provider}} | {{.Tests}} | {{f2 .AvgDownloadMbps}} Mbps | {{f2 .MinDownloadMbps}} Mbps | {{f2 .MaxDownloadMbps}} Mbps | {{f2 .AvgUploadMbps}} Mbps | {{f2 .AvgLatencyMs}} ms |
+{{end}}{{else}}
+No speed tests in this range.
+{{end}}{{with .Plan}}
+## Internet plan
+
+Plan: {{f2 .DownloadMbps}} Mbps down, {{f2 .UploadMbps}} Mbps up. {{.Tests}} speed tests reached {{f2 .DownloadPct}}% of the plan's download and {{f2 .UploadPct}}% of its upload on average; {{.BelowSLA}} fell below {{f2 .SLAPct}}% of it.
+
+| Period | Tests | Download | Upload | Below {{f2 .SLAPct}}% |
+|---|---:|---:|---:|---:|
+{{range .Periods}}| {{.Start}} | {{.Tests}} | {{f2 .DownloadPct}}% | {{f2 .UploadPct}}% | {{.BelowSLA}} |
+{{end}}
+| Hour | Tests | Download | Upload | Below {{f2 .SLAPct}}% |
+|---|---:|---:|---:|---:|
+{{range .Hours}}| {{.Start}} | {{.Tests}} | {{f2 .DownloadPct}}% | {{f2 .UploadPct}}% | {{.BelowSLA}} |
+{{end}}{{end}}
+## Incidents
+{{if .Incidents}}
+| Target | Start | End | Duration (min) | Failed checks |
+|---|---|---|---:|---:|
+{{range .Incidents}}| {{.Target}} | {{date .Start}} | {{if .End}}{{date .End}}{{else}}ongoing{{end}} | {{mins .DurationSeconds}} | {{.CheckCount}} |
+{{end}}{{else}}
+No incidents in this range.
+{{end}}
+## {{.Period}} breakdown
+{{range .Breakdown}}
+### {{.Target}}
+
+| Period | Checks | Uptime | Downtime (min) | Incidents | MTTR (min) |
+|---|---:|---:|---:|---:|---:|
+{{range .Periods}}| {{.Start}} | {{.TotalChecks}} | {{f2 .UptimePct}}% | {{f2 .DowntimeMinutes}} | {{.Incidents}} | {{f2 .MTTRMinutes}} |
+{{end}}{{end}}`
+
+const htmlReport = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>Uptime report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 1000px; margin: 2em auto; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f3f3f3; }
+</style>
+</head>
+<body>
+<h1>Uptime report</h1>
+<p>{{date .From}} – {{date .To}} (generated {{date .Generated}})</p>
+
+<h2>Targets</h2>
+<table>
+<tr><th>Target</th><th>Checks</th><th>Uptime</th><th>Avg latency</th><th>p95 latency</th><th>Downtime (min)</th><th>Incidents</th><th>MTTR (min)</th></tr>
+{{range .Targets}}<tr><td>{{.Target}}</td><td>{{.TotalChecks}}</td><td>{{f2 .UptimePct}}%</td><td>{{f2 .AvgLatencyMs}} ms</td><td>{{f2 .P95LatencyMs}} ms</td><td>{{f2 .DowntimeMinutes}}</td><td>{{.Incidents}}</td><td>{{f2 .MTTRMinutes}}</td></tr>
+{{end}}</table>
+
+<h2>Speed tests</h2>
+{{if .SpeedTests}}<table>
+<tr><th>Provider</th><th>Tests</th><th>Avg down</th><th>Min down</th><th>Max down</th><th>Avg up</th><th>Avg latency</th></tr>
+{{range .SpeedTests}}<tr><td>{{.Provider}}</td><td>{{.Tests}}</td><td>{{f2 .AvgDownloadMbps}} Mbps</td><td>{{f2 .MinDownloadMbps}} Mbps</td><td>{{f2 .MaxDownloadMbps}} Mbps</td><td>{{f2 .AvgUploadMbps}} Mbps</td><td>{{f2 .AvgLatencyMs}} ms</td></tr>
+{{end}}</table>{{else}}<p>No speed tests in this range.</p>{{end}}
+{{with .Plan}}
+<h2>Internet plan</h2>
+<p>Plan: {{f2 .DownloadMbps}} Mbps down, {{f2 .UploadMbps}} Mbps up. {{.Tests}} speed tests reached {{f2 .DownloadPct}}% of the plan's download and {{f2 .UploadPct}}% of its upload on average; {{.BelowSLA}} fell below {{f2 .SLAPct}}% of it.</p>
+<table>
+<tr><th>Period</th><th>Tests</th><th>Download</th><th>Upload</th><th>Below {{f2 .SLAPct}}%</th></tr>
+{{range .Periods}}<tr><td>{{.Start}}</td><td>{{.Tests}}</td><td>{{f2 .DownloadPct}}%</td><td>{{f2 .UploadPct}}%</td><td>{{.BelowSLA}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>Hour</th><th>Tests</th><th>Download</th><th>Upload</th><th>Below {{f2 .SLAPct}}%</th></tr>
+{{range .Hours}}<tr><td>{{.Start}}</td><td>{{.Tests}}</td><td>{{f2 .DownloadPct}}%</td><td>{{f2 .UploadPct}}%</td><td>{{.BelowSLA}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Incidents</h2>
+{{if .Incidents}}<table>
+<tr><th>Target</th><th>Start</th><th>End</th><th>Duration (min)</th><th>Failed checks</th></tr>
+{{range .Incidents}}<tr><td>{{.Target}}</td><td>{{date .Start}}</td><td>{{if .End}}{{date .End}}{{else}}ongoing{{end}}</td><td>{{mins .DurationSeconds}}</td><td>{{.CheckCount}}</td></tr>
+{{end}}</table>{{else}}<p>No incidents in this range.</p>{{end}}
+
+<h2>{{.Period}} breakdown</h2>
+{{range .Breakdown}}<h3>{{.Target}}</h3>
+<table>
+<tr><th>Period</th><th>Checks</th><th>Uptime</th><th>Downtime (min)</th><th>Incidents</th><th>MTTR (min)</th></tr>
+{{range .Periods}}<tr><td>{{.Start}}</td><td>{{.TotalChecks}}</td><td>{{f2 .UptimePct}}%</td><td>{{f2 .DowntimeMinutes}}</td><td>{{.Incidents}}</td><td>{{f2 .MTTRMinutes}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`
+
+var (
+	markdownReportTemplate = template.Must(template.New("report.md").Funcs(reportFuncs).Parse(markdownReport))
+	htmlReportTemplate     = htmltemplate.Must(htmltemplate.New("report.html").Funcs(reportFuncs).Parse(htmlReport))
+)
+
+func (d *reportDocument) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case "md":
+		return markdownReportTemplate.Execute(w, d)
+	case "html":
+		return htmlReportTemplate.Execute(w, d)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,191 @@
+package up
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"up/internal/dnsmsg"
+)
+
+// dnsResolver is a DNS server whose lookups are timed for comparison, e.g.
+//
+//	{"name": "pihole", "address": "192.168.1.2"}
+//
+// An address of "system" uses the system's configured resolver (including
+// the hosts file); other addresses are queried directly.
+type dnsResolver struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+var (
+	dnsResolvers []dnsResolver
+)
+
+const resolverTimeout = 5 * time.Second
+
+func (d *dnsResolver) init() error {
+	if d.Name == "" || d.Address == "" {
+		return fmt.Errorf("resolver: name and address are required")
+	}
+	if d.Address == "system" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(d.Address); err != nil {
+		d.Address = net.JoinHostPort(d.Address, "53")
+	}
+	return nil
+}
+
+// monitorResolvers looks up each of -resolver-names on every resolver each
+// -resolver-interval until ctx is done, recording how long each lookup took
+// and whether it failed.
+func monitorResolvers(ctx context.Context, cfg *Config, resolvers []dnsResolver) {
+	var names []string
+	for _, n := range strings.Split(cfg.ResolverNames, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	slog.Info("Comparing DNS resolvers", "resolvers", len(resolvers), "names", names, "interval", cfg.ResolverInterval)
+
+	ticker := time.NewTicker(cfg.ResolverInterval)
+	defer ticker.Stop()
+	for {
+		// Resolvers are queried one at a time so they don't compete for the
+		// uplink.
+		for _, name := range names {
+			for i := range resolvers {
+				timeLookup(ctx, &resolvers[i], name)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func timeLookup(ctx context.Context, d *dnsResolver, name string) {
+	ctx, cancel := context.WithTimeout(ctx, resolverTimeout)
+	defer cancel()
+	start := time.Now()
+	var err error
+	if d.Address == "system" {
+		_, err = net.DefaultResolver.LookupHost(ctx, name)
+	} else {
+		_, err = dnsmsg.Lookup(ctx, d.Address, name)
+	}
+	latency := time.Since(start).Milliseconds()
+
+	var errText string
+	if err != nil {
+		errText = err.Error()
+		slog.Warn("DNS lookup failed", "resolver", d.Name, "name", name, "error", err)
+	}
+	_, err = db.Exec(`INSERT INTO dns_lookups (timestamp, resolver, name, latency_ms, error) VALUES (?, ?, ?, ?, ?)`,
+		start, d.Name, name, latency, errText)
+	if err != nil {
+		slog.Error("Failed to insert DNS lookup", "error", err)
+	}
+}
+
+type resolverStats struct {
+	Resolver   string  `json:"resolver"`
+	Lookups    int     `json:"lookups"`
+	Failures   int     `json:"failures"`
+	FailurePct float64 `json:"failure_pct"`
+	// Latencies cover successful lookups only.
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	P50LatencyMs float64 `json:"p50_latency_ms"`
+	P95LatencyMs float64 `json:"p95_latency_ms"`
+	LastError    string  `json:"last_error,omitempty"`
+}
+
+// resolversHandler compares the resolvers' lookups over the last ?window=
+// (default 24h), optionally for a single ?name=.
+func (s *server) resolversHandler(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	stats, err := queryResolverStats(s.db, r.URL.Query().Get("name"), time.Now().Add(-window))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func queryResolverStats(db *sql.DB, name string, since time.Time) ([]resolverStats, error) {
+	rows, err := db.Query(`SELECT resolver, timestamp, latency_ms, error FROM dns_lookups
+		WHERE timestamp > ? AND (? = '' OR name = ?)
+		ORDER BY resolver, latency_ms`, since, name, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []resolverStats{}
+	var latencies []int64
+	var lastErrorAt time.Time
+	finish := func() {
+		if len(stats) == 0 {
+			return
+		}
+		st := &stats[len(stats)-1]
+		st.FailurePct = float64(st.Failures) / float64(st.Lookups) * 100
+		var sum int64
+		for _, l := range latencies {
+			sum += l
+		}
+		if len(latencies) > 0 {
+			st.AvgLatencyMs = float64(sum) / float64(len(latencies))
+		}
+		st.P50LatencyMs = percentile(latencies, 50)
+		st.P95LatencyMs = percentile(latencies, 95)
+		latencies = nil
+		lastErrorAt = time.Time{}
+	}
+	for rows.Next() {
+		var resolver, errText string
+		var at time.Time
+		var latency int64
+		if err := rows.Scan(&resolver, &at, &latency, &errText); err != nil {
+			return nil, err
+		}
+		if len(stats) == 0 || stats[len(stats)-1].Resolver != resolver {
+			finish()
+			stats = append(stats, resolverStats{Resolver: resolver})
+		}
+		st := &stats[len(stats)-1]
+		st.Lookups++
+		if errText != "" {
+			st.Failures++
+			if at.After(lastErrorAt) {
+				st.LastError, lastErrorAt = errText, at
+			}
+			continue
+		}
+		latencies = append(latencies, latency)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+	return stats, nil
+}
@@ -0,0 +1,81 @@
+package up
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// retentionPolicy keeps the checks and path measurements of targets of a
+// type, or with a tag, for longer or shorter than -retention, e.g. a year
+// for "wan" targets and a week for noisy "lan" ones. A target's own
+// retention takes precedence, then the first policy that matches.
+type retentionPolicy struct {
+	// Type and Tag select the targets; when both are set, a target must
+	// match both.
+	Type      string `json:"type,omitempty"`
+	Tag       string `json:"tag,omitempty"`
+	Retention string `json:"retention"`
+
+	retention time.Duration
+}
+
+// retentionPolicies are the policies from -config.
+var retentionPolicies []retentionPolicy
+
+func (p *retentionPolicy) init() error {
+	if p.Type == "" && p.Tag == "" {
+		return fmt.Errorf("retention policy: type or tag is required")
+	}
+	d, err := time.ParseDuration(p.Retention)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("retention policy: invalid retention %q", p.Retention)
+	}
+	p.retention = d
+	return nil
+}
+
+func (p *retentionPolicy) matches(t targetConfig) bool {
+	// Targets without a type are HTTP checks.
+	if p.Type != "" && p.Type != cmp.Or(t.Type, "http") {
+		return false
+	}
+	if p.Tag != "" && !slices.Contains(t.Tags, p.Tag) {
+		return false
+	}
+	return true
+}
+
+func (t *targetConfig) initRetention() error {
+	if t.Retention == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(t.Retention)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("target %s: invalid retention %q", cmp.Or(t.Name, t.URL), t.Retention)
+	}
+	t.retention = d
+	return nil
+}
+
+// targetRetentions returns how long to keep the checks of each configured
+// target whose retention isn't the default.
+func targetRetentions(fallback time.Duration) map[string]time.Duration {
+	retentions := map[string]time.Duration{}
+	for _, t := range currentTargets() {
+		d := t.retention
+		for _, p := range retentionPolicies {
+			if d != 0 {
+				break
+			}
+			if p.matches(t) {
+				d = p.retention
+			}
+		}
+		if d != 0 && d != fallback {
+			retentions[t.Name] = d
+		}
+	}
+	return retentions
+}
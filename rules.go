@@ -0,0 +1,447 @@
+package up
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// alertRule raises an alert while its condition holds for a target (or, for
+// the speed conditions, a speed test provider), and a resolution once it
+// stops holding. Alerts go to the same notifiers as outages.
+type alertRule struct {
+	Name string `json:"name"`
+	// Condition is one of consecutive_failures, uptime_below,
+	// degraded_above, latency_p95_above, download_below, upload_below, or
+	// loaded_latency_above.
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+	// Window is the period uptime and latency are computed over (default
+	// 10m). For the speed conditions it averages the tests in the window
+	// instead of using only the latest.
+	Window string `json:"window,omitempty"`
+	// Consecutive makes a speed condition match only when each of the last
+	// Consecutive tests crossed the threshold, so a single slow test
+	// doesn't alert.
+	Consecutive int `json:"consecutive,omitempty"`
+
+	// Targets and Providers limit the rule; by default it applies to all.
+	Targets   []string `json:"targets,omitempty"`
+	Providers []string `json:"providers,omitempty"`
+	// Probe selects whose checks are evaluated (default: this server's).
+	Probe string `json:"probe,omitempty"`
+
+	// Repeat re-sends the alert at this interval while the rule matches.
+	Repeat string `json:"repeat,omitempty"`
+	// Escalation sends the alert to more notifiers the longer the rule
+	// matches. Without it, every notifier is alerted straight away.
+	Escalation []escalationStep `json:"escalation,omitempty"`
+
+	window time.Duration
+	repeat time.Duration
+}
+
+// escalationStep alerts Notifiers once a rule has matched for After.
+type escalationStep struct {
+	After     string   `json:"after,omitempty"`
+	Notifiers []string `json:"notifiers"`
+
+	after time.Duration
+}
+
+var alertRules []alertRule
+
+func (r *alertRule) init() error {
+	if r.Name == "" {
+		return fmt.Errorf("alert rule: name is required")
+	}
+	switch r.Condition {
+	case "consecutive_failures":
+		if r.Threshold < 1 || r.Threshold != float64(int(r.Threshold)) {
+			return fmt.Errorf("alert rule %s: threshold must be a whole number of checks", r.Name)
+		}
+	case "uptime_below", "degraded_above", "latency_p95_above", "download_below", "upload_below", "loaded_latency_above":
+		if r.Threshold <= 0 {
+			return fmt.Errorf("alert rule %s: threshold must be positive", r.Name)
+		}
+	default:
+		return fmt.Errorf("alert rule %s: unknown condition %q", r.Name, r.Condition)
+	}
+	if r.Consecutive != 0 {
+		switch {
+		case !r.speedTest():
+			return fmt.Errorf("alert rule %s: consecutive only applies to the speed conditions", r.Name)
+		case r.Consecutive < 0:
+			return fmt.Errorf("alert rule %s: consecutive must be positive", r.Name)
+		case r.Window != "":
+			return fmt.Errorf("alert rule %s: consecutive and window can't be used together", r.Name)
+		}
+	}
+
+	if r.Window != "" {
+		d, err := time.ParseDuration(r.Window)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("alert rule %s: invalid window %q", r.Name, r.Window)
+		}
+		r.window = d
+	} else if r.Condition == "uptime_below" || r.Condition == "degraded_above" || r.Condition == "latency_p95_above" {
+		r.window = 10 * time.Minute
+	}
+
+	if r.Repeat != "" {
+		d, err := time.ParseDuration(r.Repeat)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("alert rule %s: invalid repeat %q", r.Name, r.Repeat)
+		}
+		r.repeat = d
+	}
+	for i := range r.Escalation {
+		step := &r.Escalation[i]
+		if step.After != "" {
+			d, err := time.ParseDuration(step.After)
+			if err != nil || d < 0 {
+				return fmt.Errorf("alert rule %s: invalid escalation delay %q", r.Name, step.After)
+			}
+			step.after = d
+		}
+		if i > 0 && step.after < r.Escalation[i-1].after {
+			return fmt.Errorf("alert rule %s: escalation steps must be in order", r.Name)
+		}
+		if len(step.Notifiers) == 0 {
+			return fmt.Errorf("alert rule %s: escalation step has no notifiers", r.Name)
+		}
+		for _, n := range step.Notifiers {
+			if !slices.Contains(notifierTypes, n) {
+				return fmt.Errorf("alert rule %s: unknown notifier %q", r.Name, n)
+			}
+		}
+	}
+	return nil
+}
+
+// steps returns the escalation steps, or a single step alerting every
+// notifier.
+func (r *alertRule) steps() []escalationStep {
+	if len(r.Escalation) == 0 {
+		return []escalationStep{{}}
+	}
+	return r.Escalation
+}
+
+// notified returns the notifiers alerted by the first n steps; nil means
+// all of them.
+func (r *alertRule) notified(n int) []string {
+	var names []string
+	for _, step := range r.steps()[:n] {
+		if step.Notifiers == nil {
+			return nil
+		}
+		names = append(names, step.Notifiers...)
+	}
+	return names
+}
+
+func (r *alertRule) speedTest() bool {
+	switch r.Condition {
+	case "download_below", "upload_below", "loaded_latency_above":
+		return true
+	}
+	return false
+}
+
+// ruleSubject is a target or provider a rule is evaluated for.
+type ruleSubject struct {
+	rule, subject, probe string
+}
+
+// firingRule is a rule that currently matches, and how far its alerts have
+// got. It is stored in the database so a restart doesn't alert again.
+type firingRule struct {
+	since    time.Time
+	notified time.Time
+	steps    int
+}
+
+var (
+	ruleMu      sync.Mutex
+	firingRules = map[ruleSubject]*firingRule{}
+)
+
+func loadFiringRules() error {
+	rows, err := db.Query(`SELECT rule, subject, probe, since, notified, steps FROM alert_rules`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	for rows.Next() {
+		var key ruleSubject
+		f := &firingRule{}
+		if err := rows.Scan(&key.rule, &key.subject, &key.probe, &f.since, &f.notified, &f.steps); err != nil {
+			return err
+		}
+		firingRules[key] = f
+	}
+	return rows.Err()
+}
+
+func saveFiringRule(key ruleSubject, f *firingRule) {
+	_, err := db.Exec(`INSERT OR REPLACE INTO alert_rules (rule, subject, probe, since, notified, steps) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.rule, key.subject, key.probe, f.since, f.notified, f.steps)
+	if err != nil {
+		slog.Error("Failed to save alert rule state", "rule", key.rule, "error", err)
+	}
+}
+
+func deleteFiringRule(key ruleSubject) {
+	_, err := db.Exec(`DELETE FROM alert_rules WHERE rule = ? AND subject = ? AND probe = ?`, key.rule, key.subject, key.probe)
+	if err != nil {
+		slog.Error("Failed to save alert rule state", "rule", key.rule, "error", err)
+	}
+}
+
+// evaluateCheckRules runs after each check cycle.
+func evaluateCheckRules(cfg *Config) {
+	evaluateAlertRules(cfg, false)
+}
+
+// evaluateSpeedTestRules runs after each round of speed tests.
+func evaluateSpeedTestRules(cfg *Config) {
+	evaluateAlertRules(cfg, true)
+}
+
+func evaluateAlertRules(cfg *Config, speedTests bool) {
+	targetsMu.RLock()
+	rules, providers := alertRules, speedTestProviders
+	targetsMu.RUnlock()
+
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	now := time.Now()
+	for i := range rules {
+		r := &rules[i]
+		if r.speedTest() != speedTests {
+			continue
+		}
+
+		var subjects []string
+		probe := ""
+		if speedTests {
+			for _, p := range providers {
+				subjects = append(subjects, p.Name)
+			}
+			subjects = filterSubjects(subjects, r.Providers)
+		} else {
+			subjects = filterSubjects(targetNames(), r.Targets)
+			probe = r.Probe
+			if probe == "" {
+				probe = cfg.ProbeName
+			}
+		}
+
+		for _, subject := range subjects {
+			matched, reason, err := r.matches(subject, probe, now)
+			if err != nil {
+				slog.Error("Failed to evaluate alert rule", "rule", r.Name, "subject", subject, "error", err)
+				continue
+			}
+			updateRule(cfg, r, ruleSubject{r.Name, subject, probe}, matched, reason, now)
+		}
+	}
+}
+
+func filterSubjects(all, only []string) []string {
+	if len(only) == 0 {
+		return all
+	}
+	var subjects []string
+	for _, s := range all {
+		if slices.Contains(only, s) {
+			subjects = append(subjects, s)
+		}
+	}
+	return subjects
+}
+
+// updateRule sends an alert when a rule starts or stops matching, and while
+// it keeps matching, escalates and repeats it as configured.
+// ruleMu must be held.
+func updateRule(cfg *Config, r *alertRule, key ruleSubject, matched bool, reason string, now time.Time) {
+	f, firing := firingRules[key]
+	if !matched && !firing {
+		return
+	}
+	a := alert{
+		Target:    key.subject,
+		Probe:     key.probe,
+		Firing:    matched,
+		Timestamp: now,
+		Since:     now,
+		Rule:      r.Name,
+		Reason:    reason,
+	}
+	if !r.speedTest() {
+		a.RecentLatencyMs = recentLatencies(key.subject, key.probe)
+	}
+
+	switch {
+	case !matched:
+		a.Since = f.since
+		if f.steps > 0 {
+			dispatchAlertTo(cfg, a, r.notified(f.steps))
+		}
+		delete(firingRules, key)
+		deleteFiringRule(key)
+		slog.Info("Alert rule resolved", "rule", r.Name, "subject", key.subject)
+		return
+	case !firing:
+		f = &firingRule{since: now}
+		firingRules[key] = f
+		slog.Warn("Alert rule firing", "rule", r.Name, "subject", key.subject, "reason", reason)
+	}
+	a.Since = f.since
+
+	changed := !firing
+	steps := r.steps()
+	for f.steps < len(steps) && now.Sub(f.since) >= steps[f.steps].after {
+		dispatchAlertTo(cfg, a, steps[f.steps].Notifiers)
+		f.steps++
+		f.notified = now
+		changed = true
+	}
+	if !changed && r.repeat > 0 && f.steps > 0 && now.Sub(f.notified) >= r.repeat {
+		a.Reminder = true
+		dispatchAlertTo(cfg, a, r.notified(f.steps))
+		f.notified = now
+		changed = true
+	}
+	if changed {
+		saveFiringRule(key, f)
+	}
+}
+
+// matches reports whether the rule's condition holds for the subject, with
+// a description of what was measured.
+func (r *alertRule) matches(subject, probe string, now time.Time) (bool, string, error) {
+	switch r.Condition {
+	case "consecutive_failures":
+		n := int(r.Threshold)
+		rows, err := db.Query(`SELECT status FROM checks WHERE target = ? AND probe = ? AND maintenance = 0 ORDER BY timestamp DESC LIMIT ?`, subject, probe, n)
+		if err != nil {
+			return false, "", err
+		}
+		defer rows.Close()
+		failures := 0
+		for rows.Next() {
+			var status string
+			if err := rows.Scan(&status); err != nil {
+				return false, "", err
+			}
+			if checker.Answered(status) {
+				break
+			}
+			failures++
+		}
+		return failures >= n, fmt.Sprintf("%s failed %d checks in a row", subject, failures), rows.Err()
+
+	case "uptime_below":
+		var total, up int
+		err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(`+checker.AnsweredSQL+`), 0) FROM checks WHERE target = ? AND probe = ? AND maintenance = 0 AND timestamp > ?`,
+			subject, probe, now.Add(-r.window)).Scan(&total, &up)
+		if err != nil || total == 0 {
+			return false, "", err
+		}
+		uptime := float64(up) / float64(total) * 100
+		return uptime < r.Threshold, fmt.Sprintf("%s uptime is %.2f%% over the last %s (below %g%%)", subject, uptime, r.window, r.Threshold), nil
+
+	case "degraded_above":
+		var total, degraded int
+		err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(status = 'degraded'), 0) FROM checks WHERE target = ? AND probe = ? AND maintenance = 0 AND timestamp > ?`,
+			subject, probe, now.Add(-r.window)).Scan(&total, &degraded)
+		if err != nil || total == 0 {
+			return false, "", err
+		}
+		pct := float64(degraded) / float64(total) * 100
+		return pct > r.Threshold, fmt.Sprintf("%s was degraded for %.2f%% of checks over the last %s (above %g%%)", subject, pct, r.window, r.Threshold), nil
+
+	case "latency_p95_above":
+		p, err := queryLatencyPercentiles(db, subject, probe, now.Add(-r.window))
+		if err != nil {
+			return false, "", err
+		}
+		return p.P95 > r.Threshold, fmt.Sprintf("%s p95 latency is %.0f ms over the last %s (above %g ms)", subject, p.P95, r.window, r.Threshold), nil
+
+	case "download_below", "upload_below", "loaded_latency_above":
+		return r.matchesSpeedTests(subject, now)
+	}
+	return false, "", fmt.Errorf("unknown condition %q", r.Condition)
+}
+
+// matchesSpeedTests evaluates a speed condition against the provider's
+// latest test, the average over the window, or each of the last
+// Consecutive tests. Tests that measured no loaded latency are left out of
+// loaded_latency_above.
+func (r *alertRule) matchesSpeedTests(provider string, now time.Time) (bool, string, error) {
+	column, label, unit, above := "download_mbps", "download speed", "Mbps", false
+	filter := ""
+	switch r.Condition {
+	case "upload_below":
+		column, label = "upload_mbps", "upload speed"
+	case "loaded_latency_above":
+		column, label, unit, above = "loaded_latency_ms", "latency under load", "ms", true
+		filter = " AND loaded_latency_ms > 0"
+	}
+	crossed := func(v float64) bool {
+		if above {
+			return v > r.Threshold
+		}
+		return v < r.Threshold
+	}
+	bound := "below"
+	if above {
+		bound = "above"
+	}
+
+	if r.window > 0 {
+		var avg float64
+		var tests int
+		err := db.QueryRow(fmt.Sprintf(`SELECT COALESCE(AVG(%s), 0), COUNT(*) FROM speedtests WHERE provider = ? AND timestamp > ?%s`, column, filter),
+			provider, now.Add(-r.window)).Scan(&avg, &tests)
+		if err != nil || tests == 0 {
+			return false, "", err
+		}
+		return crossed(avg), fmt.Sprintf("%s %s is %.1f %s (%s %g %s)", provider, label, avg, unit, bound, r.Threshold, unit), nil
+	}
+
+	n := max(r.Consecutive, 1)
+	rows, err := db.Query(fmt.Sprintf(`SELECT %s FROM speedtests WHERE provider = ?%s ORDER BY timestamp DESC LIMIT ?`, column, filter), provider, n)
+	if err != nil {
+		return false, "", err
+	}
+	defer rows.Close()
+	var values []float64
+	for rows.Next() {
+		var v float64
+		if err := rows.Scan(&v); err != nil {
+			return false, "", err
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil || len(values) == 0 {
+		return false, "", err
+	}
+	matched := len(values) == n
+	for _, v := range values {
+		matched = matched && crossed(v)
+	}
+	if n == 1 || !matched {
+		return matched, fmt.Sprintf("%s %s is %.1f %s (%s %g %s)", provider, label, values[0], unit, bound, r.Threshold, unit), nil
+	}
+	return matched, fmt.Sprintf("%s %s was %s %g %s in the last %d tests (latest %.1f %s)", provider, label, bound, r.Threshold, unit, n, values[0], unit), nil
+}
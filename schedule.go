@@ -0,0 +1,202 @@
+package up
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// scheduleTick is how often the check loop looks for targets that are due,
+// and so the granularity of check intervals.
+const scheduleTick = time.Second
+
+// checkSchedule tracks when each target was last checked, so targets with
+// their own interval or cron schedule are checked independently of the
+// others. Each target's schedule is shifted by a random offset of up to
+// splay, so targets that share an interval aren't all checked at once.
+type checkSchedule struct {
+	interval time.Duration // for targets without an interval
+	splay    time.Duration
+	last     map[string]time.Time
+	offset   map[string]time.Duration
+}
+
+func newCheckSchedule(interval, splay time.Duration) *checkSchedule {
+	return &checkSchedule{
+		interval: interval,
+		splay:    splay,
+		last:     map[string]time.Time{},
+		offset:   map[string]time.Duration{},
+	}
+}
+
+// due returns the targets in ts that are due at now and records them as
+// checked. Targets not seen before are due straight away (after their
+// offset), and since only the last check is kept, a reloaded target's new
+// interval applies at once.
+func (s *checkSchedule) due(ts []targetConfig, now time.Time) []*targetConfig {
+	var due []*targetConfig
+	seen := make(map[string]bool, len(ts))
+	for i := range ts {
+		t := &ts[i]
+		seen[t.Name] = true
+		offset, ok := s.offset[t.Name]
+		if !ok && s.splay > 0 {
+			offset = rand.N(s.splay)
+			s.offset[t.Name] = offset
+		}
+		// The schedule is evaluated offset behind the clock.
+		at := now.Add(-offset)
+
+		last, ok := s.last[t.Name]
+		if t.cron != nil {
+			// Scheduled targets wait for their first matching time, rather
+			// than being checked when they are added.
+			if !ok {
+				s.last[t.Name] = at
+				continue
+			}
+			if next := t.cron.next(last); next.IsZero() || at.Before(next) {
+				continue
+			}
+		} else {
+			interval := s.interval
+			if t.interval > 0 {
+				interval = t.interval
+			}
+			if !ok {
+				last = now.Add(-interval)
+				s.last[t.Name] = last
+			}
+			// Allow for the tick arriving slightly early relative to the last.
+			if at.Sub(last) < interval-scheduleTick/2 {
+				continue
+			}
+		}
+		s.last[t.Name] = at
+		due = append(due, t)
+	}
+	for name := range s.last {
+		if !seen[name] {
+			delete(s.last, name)
+			delete(s.offset, name)
+		}
+	}
+	return due
+}
+
+// checkPool runs checks in the background, at most size at once and never
+// two of the same target at a time, so a slow or unreachable target doesn't
+// hold up the others.
+type checkPool struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	// idle is broadcast whenever a check finishes, for checkNow to wait on.
+	idle    *sync.Cond
+	running map[string]bool
+	// wait is time.Sleep, except in tests.
+	wait func(time.Duration)
+}
+
+func newCheckPool(size int) *checkPool {
+	p := &checkPool{slots: make(chan struct{}, size), running: map[string]bool{}, wait: time.Sleep}
+	p.idle = sync.NewCond(&p.mu)
+	return p
+}
+
+// start runs check(t) in the background once a slot is free. It reports
+// false, without running it, if t's last check hasn't finished yet. check
+// is given a sleep to wait with, such as between retries, that frees the
+// slot meanwhile.
+func (p *checkPool) start(t *targetConfig, check func(t *targetConfig, sleep func(time.Duration))) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running[t.Name] {
+		return false
+	}
+	p.launch(t, check)
+	return true
+}
+
+// checkNow runs check on each of ts in the pool, after any check of the
+// same target already running has finished, and returns once they all
+// have.
+func (p *checkPool) checkNow(ts []targetConfig, check func(t *targetConfig, sleep func(time.Duration))) {
+	var wg sync.WaitGroup
+	for i := range ts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.mu.Lock()
+			for p.running[ts[i].Name] {
+				p.idle.Wait()
+			}
+			done := p.launch(&ts[i], check)
+			p.mu.Unlock()
+			<-done
+		}()
+	}
+	wg.Wait()
+}
+
+// launch marks t as running and runs check(t) in the background once a
+// slot is free, closing the returned channel when it has finished. p.mu
+// must be held.
+func (p *checkPool) launch(t *targetConfig, check func(t *targetConfig, sleep func(time.Duration))) <-chan struct{} {
+	p.running[t.Name] = true
+	done := make(chan struct{})
+	go func() {
+		p.slots <- struct{}{}
+		check(t, p.sleep)
+		<-p.slots
+		p.mu.Lock()
+		delete(p.running, t.Name)
+		p.idle.Broadcast()
+		p.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// sleep waits for d without holding a slot, so that a target waiting to
+// retry doesn't keep others from being checked.
+func (p *checkPool) sleep(d time.Duration) {
+	<-p.slots
+	p.wait(d)
+	p.slots <- struct{}{}
+}
+
+// startDue starts checks of the targets in ts that are due at now.
+func (p *checkPool) startDue(s *checkSchedule, ts []targetConfig, now time.Time, check func(t *targetConfig, sleep func(time.Duration))) {
+	for _, t := range s.due(ts, now) {
+		if !p.start(t, check) {
+			slog.Debug("Skipping check while the last one is still running", "target", t.Name)
+		}
+	}
+}
+
+func (t *targetConfig) initInterval(loc *time.Location) error {
+	if t.Schedule != "" {
+		if t.Interval != "" {
+			return fmt.Errorf("target %s: set interval or schedule, not both", cmp.Or(t.Name, t.URL))
+		}
+		c, err := parseCron(t.Schedule, loc)
+		if err != nil {
+			return fmt.Errorf("target %s: %v", cmp.Or(t.Name, t.URL), err)
+		}
+		t.cron = c
+		return nil
+	}
+	if t.Interval == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(t.Interval)
+	if err != nil || d < scheduleTick {
+		return fmt.Errorf("target %s: invalid interval %q (must be at least %v)", cmp.Or(t.Name, t.URL), t.Interval, scheduleTick)
+	}
+	t.interval = d
+	return nil
+}
@@ -0,0 +1,189 @@
+package up
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"up/checker"
+)
+
+// checkRecorder is a check function for a checkPool that records how many
+// checks hold a slot at once and which targets were checked.
+type checkRecorder struct {
+	mu      sync.Mutex
+	active  int
+	max     int
+	checked []string
+	// sleep, if set, is how long each check sleeps, as if retrying.
+	sleep time.Duration
+	// block, if not nil, holds each check until it is closed.
+	block chan struct{}
+}
+
+func (c *checkRecorder) check(t *targetConfig, sleep func(time.Duration)) {
+	c.mu.Lock()
+	c.active++
+	c.max = max(c.max, c.active)
+	c.checked = append(c.checked, t.Name)
+	c.mu.Unlock()
+	if c.sleep > 0 {
+		// A sleeping check gives its slot back.
+		c.mu.Lock()
+		c.active--
+		c.mu.Unlock()
+		sleep(c.sleep)
+		c.mu.Lock()
+		c.active++
+		c.max = max(c.max, c.active)
+		c.mu.Unlock()
+	}
+	if c.block != nil {
+		<-c.block
+	}
+	c.mu.Lock()
+	c.active--
+	c.mu.Unlock()
+}
+
+func (c *checkRecorder) started() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.checked)
+}
+
+func (c *checkRecorder) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, checked := range c.checked {
+		if checked == name {
+			n++
+		}
+	}
+	return n
+}
+
+func testTargets(names ...string) []targetConfig {
+	ts := make([]targetConfig, len(names))
+	for i, name := range names {
+		ts[i] = targetConfig{Target: checker.Target{Name: name}}
+	}
+	return ts
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func (p *checkPool) idleNow() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.running) == 0
+}
+
+func TestCheckPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		start   []string
+		sleep   bool
+		want    []bool // what start reports for each
+		running int    // checks under way once all have started
+	}{
+		{"within the cap", 3, []string{"a", "b"}, false, []bool{true, true}, 2},
+		{"cap never exceeded", 2, []string{"a", "b", "c", "d", "e"}, false, []bool{true, true, true, true, true}, 2},
+		{"running target skipped", 2, []string{"a", "a", "b"}, false, []bool{true, false, true}, 2},
+		{"sleeping check gives its slot back", 1, []string{"a", "b", "c"}, true, []bool{true, true, true}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newCheckPool(tt.size)
+			release := make(chan struct{})
+			var slept []time.Duration
+			var sleptMu sync.Mutex
+			p.wait = func(d time.Duration) {
+				sleptMu.Lock()
+				slept = append(slept, d)
+				sleptMu.Unlock()
+				<-release
+			}
+			rec := &checkRecorder{}
+			if tt.sleep {
+				rec.sleep = time.Minute
+			} else {
+				rec.block = release
+			}
+
+			ts := testTargets(tt.start...)
+			for i := range ts {
+				if got := p.start(&ts[i], rec.check); got != tt.want[i] {
+					t.Errorf("start(%s) #%d = %v, want %v", ts[i].Name, i, got, tt.want[i])
+				}
+			}
+			waitFor(t, "checks to start", func() bool { return rec.started() >= tt.running })
+			// Give any check over the cap a chance to start wrongly.
+			time.Sleep(20 * time.Millisecond)
+			if got := rec.started(); got != tt.running {
+				t.Errorf("%d checks under way, want %d", got, tt.running)
+			}
+
+			close(release)
+			waitFor(t, "the pool to be idle", p.idleNow)
+			if rec.max > tt.size {
+				t.Errorf("%d checks held a slot at once in a pool of %d", rec.max, tt.size)
+			}
+			started := 0
+			for _, ok := range tt.want {
+				if ok {
+					started++
+				}
+			}
+			if len(rec.checked) != started {
+				t.Errorf("checked %v, want %d checks", rec.checked, started)
+			}
+			if tt.sleep && len(slept) != started {
+				t.Errorf("slept %v, want %d sleeps", slept, started)
+			}
+		})
+	}
+}
+
+func TestCheckPoolCheckNow(t *testing.T) {
+	p := newCheckPool(1)
+	ts := testTargets("a", "b")
+	scheduled := &checkRecorder{block: make(chan struct{})}
+	if !p.start(&ts[0], scheduled.check) {
+		t.Fatal("start refused an idle target")
+	}
+
+	now := &checkRecorder{}
+	done := make(chan struct{})
+	go func() {
+		p.checkNow(ts, now.check)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("checkNow returned while a scheduled check held the only slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := now.count("a"); n != 0 {
+		t.Fatalf("a checked %d times alongside its scheduled check", n)
+	}
+
+	close(scheduled.block)
+	<-done
+	if now.count("a") != 1 || now.count("b") != 1 {
+		t.Errorf("checked %v, want a and b once each", now.checked)
+	}
+	if now.max > 1 {
+		t.Errorf("%d checks ran at once in a pool of 1", now.max)
+	}
+}
@@ -0,0 +1,181 @@
+package up
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// securityHeaders is a snapshot of a target's security headers, recorded
+// whenever they change.
+type securityHeaders struct {
+	Target    string            `json:"target"`
+	Probe     string            `json:"probe"`
+	Timestamp time.Time         `json:"timestamp"`
+	Headers   map[string]string `json:"headers"`
+	Missing   []string          `json:"missing"`
+	// Regressions describe the headers that were removed or changed since
+	// the previous snapshot.
+	Regressions []string `json:"regressions"`
+}
+
+func headerRegressions(prev, cur map[string]string) []string {
+	regressions := []string{}
+	for _, name := range checker.SecurityHeaderNames {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+		case cur[name] == "":
+			regressions = append(regressions, fmt.Sprintf("%s removed (was %q)", name, old))
+		case cur[name] != old:
+			regressions = append(regressions, fmt.Sprintf("%s changed from %q to %q", name, old, cur[name]))
+		}
+	}
+	return regressions
+}
+
+var (
+	securityHeadersMu   sync.Mutex
+	lastSecurityHeaders = map[probeTarget]map[string]string{}
+)
+
+// trackSecurityHeaders records the result's security headers when they
+// differ from the previous ones, logging any regressions.
+func trackSecurityHeaders(r checker.Result) {
+	securityHeadersMu.Lock()
+	defer securityHeadersMu.Unlock()
+
+	key := probeTarget{r.Target, r.Probe}
+	prev, known := lastSecurityHeaders[key]
+	if !known {
+		var headers string
+		err := db.QueryRow(`SELECT headers FROM security_headers WHERE target = ? AND probe = ? ORDER BY id DESC LIMIT 1`,
+			r.Target, r.Probe).Scan(&headers)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			slog.Error("Failed to load security headers", "target", r.Target, "error", err)
+			return
+		default:
+			known = json.Unmarshal([]byte(headers), &prev) == nil
+		}
+	}
+	lastSecurityHeaders[key] = r.Headers
+	if known && maps.Equal(prev, r.Headers) {
+		return
+	}
+
+	regressions := headerRegressions(prev, r.Headers)
+	headers, _ := json.Marshal(r.Headers)
+	encoded, _ := json.Marshal(regressions)
+	if _, err := db.Exec(`INSERT INTO security_headers (timestamp, target, probe, headers, regressions) VALUES (?, ?, ?, ?, ?)`,
+		r.Timestamp, r.Target, r.Probe, string(headers), string(encoded)); err != nil {
+		slog.Error("Failed to record security headers", "target", r.Target, "error", err)
+		return
+	}
+	if len(regressions) > 0 {
+		slog.Warn("Security header regression", "target", r.Target, "probe", r.Probe, "regressions", regressions)
+		events.publish(event{Type: "security_headers", Data: newSecurityHeaders(r.Target, r.Probe, r.Timestamp, r.Headers, regressions)})
+	}
+}
+
+func newSecurityHeaders(target, probe string, at time.Time, headers map[string]string, regressions []string) securityHeaders {
+	s := securityHeaders{Target: target, Probe: probe, Timestamp: at, Headers: headers, Missing: []string{}, Regressions: regressions}
+	for _, name := range checker.SecurityHeaderNames {
+		if _, ok := headers[name]; !ok {
+			s.Missing = append(s.Missing, name)
+		}
+	}
+	return s
+}
+
+// securityHeadersHandler serves the latest security headers of each
+// target with audit_headers, or just ?target='s.
+func (s *server) securityHeadersHandler(w http.ResponseWriter, r *http.Request) {
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	names := targetNames()
+	if target := r.URL.Query().Get("target"); target != "" {
+		names = []string{target}
+	}
+	snapshots, err := querySecurityHeaders(s.db, `id IN (SELECT MAX(id) FROM security_headers GROUP BY target, probe)`)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	snapshots = slices.DeleteFunc(snapshots, func(h securityHeaders) bool { return !slices.Contains(names, h.Target) })
+	writeSecurityHeaders(w, snapshots, loc)
+}
+
+// securityHeadersHistoryHandler lists a target's security header
+// snapshots, newest first.
+func (s *server) securityHeadersHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "Missing target", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	loc, err := s.requestTimezone(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	snapshots, err := querySecurityHeaders(s.db, `target = ? ORDER BY id DESC LIMIT ?`, target, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeSecurityHeaders(w, snapshots, loc)
+}
+
+func writeSecurityHeaders(w http.ResponseWriter, snapshots []securityHeaders, loc *time.Location) {
+	for i := range snapshots {
+		snapshots[i].Timestamp = snapshots[i].Timestamp.In(loc)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+func querySecurityHeaders(db *sql.DB, where string, args ...any) ([]securityHeaders, error) {
+	rows, err := db.Query(`SELECT timestamp, target, probe, headers, regressions FROM security_headers WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []securityHeaders{}
+	for rows.Next() {
+		var target, probe, headers, regressions string
+		var at time.Time
+		if err := rows.Scan(&at, &target, &probe, &headers, &regressions); err != nil {
+			return nil, err
+		}
+		var h map[string]string
+		var reg []string
+		if err := json.Unmarshal([]byte(headers), &h); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(regressions), &reg); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, newSecurityHeaders(target, probe, at, h, reg))
+	}
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,65 @@
+package up
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const serviceName = "up"
+
+// serviceStop is closed when the Windows service manager asks up to stop;
+// serve and agent shut down as they would on SIGTERM.
+var serviceStop = make(chan struct{})
+
+var errServiceUnsupported = errors.New("services are only supported on Windows; use systemd or launchd elsewhere")
+
+// runServiceCommand implements `up service`, which installs and controls
+// up as a Windows service.
+func runServiceCommand(args []string) int {
+	if len(args) == 0 {
+		serviceUsage()
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "install":
+		// The service runs `up serve` unless another command is given, e.g.
+		// `up service install agent -server ...`.
+		run := args[1:]
+		if len(run) == 0 || strings.HasPrefix(run[0], "-") {
+			run = append([]string{"serve"}, run...)
+		}
+		err = installService(run)
+	case "uninstall":
+		err = uninstallService()
+	case "start":
+		err = startService()
+	case "stop":
+		err = stopService()
+	case "status":
+		var state string
+		if state, err = serviceStatus(); err == nil {
+			fmt.Println(state)
+		}
+	default:
+		serviceUsage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func serviceUsage() {
+	fmt.Fprint(os.Stderr, `Usage: up service <install|uninstall|start|stop|status>
+
+  up service install [command] [flags]
+	Install up as a service that starts with Windows and runs
+	'up <command> <flags>' (default: serve). Relative paths are
+	relative to the directory of the executable.
+`)
+}
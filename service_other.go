@@ -0,0 +1,13 @@
+//go:build !windows
+
+package up
+
+// runAsService reports whether the process was started by the Windows
+// service manager, which it never is here.
+func runAsService(run func() int) (int, bool) { return 0, false }
+
+func installService(args []string) error { return errServiceUnsupported }
+func uninstallService() error            { return errServiceUnsupported }
+func startService() error                { return errServiceUnsupported }
+func stopService() error                 { return errServiceUnsupported }
+func serviceStatus() (string, error)     { return "", errServiceUnsupported }
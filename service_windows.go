@@ -0,0 +1,202 @@
+//go:build windows
+
+package up
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// runAsService runs the command as a Windows service when the process was
+// started by the service manager. Services start in the system directory
+// with nowhere to log, so it works from the executable's directory and
+// logs to up.log there.
+func runAsService(run func() int) (int, bool) {
+	if ok, err := svc.IsWindowsService(); err != nil || !ok {
+		return 0, false
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return 1, true
+	}
+	dir := filepath.Dir(exe)
+	if err := os.Chdir(dir); err != nil {
+		return 1, true
+	}
+	if f, err := os.OpenFile(filepath.Join(dir, "up.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+		os.Stderr = f
+		os.Stdout = f
+	}
+
+	h := &serviceHandler{run: run}
+	if err := svc.Run(serviceName, h); err != nil {
+		fmt.Fprintln(os.Stderr, "service failed:", err)
+		return 1, true
+	}
+	return h.code, true
+}
+
+type serviceHandler struct {
+	run  func() int
+	code int
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan int, 1)
+	go func() { done <- h.run() }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case h.code = <-done:
+			// Exiting by itself is a failure as far as the service manager
+			// is concerned, so the recovery actions restart it.
+			return true, uint32(max(h.code, 1))
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: 30000}
+				close(serviceStop)
+				select {
+				case h.code = <-done:
+				case <-time.After(30 * time.Second):
+				}
+				return false, 0
+			}
+		}
+	}
+}
+
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %q is already installed", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "up",
+		Description: "Monitors internet uptime and speed",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to install service: %v", err)
+	}
+	defer s.Close()
+
+	// Restart after a crash, backing off a little on repeated failures.
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Minute},
+	}, 24*60*60); err != nil {
+		return fmt.Errorf("failed to set recovery actions: %v", err)
+	}
+	fmt.Printf("Installed service %q running %s %v; start it with 'up service start'\n", serviceName, exe, args)
+	return nil
+}
+
+func openService() (*mgr.Mgr, *mgr.Service, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to the service manager: %v", err)
+	}
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		m.Disconnect()
+		return nil, nil, fmt.Errorf("service %q is not installed", serviceName)
+	}
+	return m, s, nil
+}
+
+func uninstallService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+	if st, err := s.Query(); err == nil && st.State != svc.Stopped {
+		s.Control(svc.Stop)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to uninstall service: %v", err)
+	}
+	return nil
+}
+
+func startService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %v", err)
+	}
+	return nil
+}
+
+func stopService() error {
+	m, s, err := openService()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+	st, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("failed to stop service: %v", err)
+	}
+	for deadline := time.Now().Add(30 * time.Second); st.State != svc.Stopped; {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not stop within 30s")
+		}
+		time.Sleep(300 * time.Millisecond)
+		if st, err = s.Query(); err != nil {
+			return fmt.Errorf("failed to query service: %v", err)
+		}
+	}
+	return nil
+}
+
+func serviceStatus() (string, error) {
+	m, s, err := openService()
+	if err != nil {
+		return "", err
+	}
+	defer m.Disconnect()
+	defer s.Close()
+	st, err := s.Query()
+	if err != nil {
+		return "", fmt.Errorf("failed to query service: %v", err)
+	}
+	switch st.State {
+	case svc.Stopped:
+		return "stopped", nil
+	case svc.StartPending:
+		return "starting", nil
+	case svc.StopPending:
+		return "stopping", nil
+	case svc.Running:
+		return "running", nil
+	}
+	return fmt.Sprintf("state %d", st.State), nil
+}
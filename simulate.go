@@ -0,0 +1,287 @@
+package up
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"up/checker"
+	"up/store"
+)
+
+// simProfile describes the synthetic results of -simulate. Failure is the
+// chance a check fails on its own, and Outage the chance an outage starts,
+// lasting up to OutageChecks checks. Latency is each target's typical
+// latency, varied by Jitter.
+type simProfile struct {
+	Failure      float64
+	Outage       float64
+	OutageChecks int
+	Latency      time.Duration
+	Jitter       time.Duration
+	DownloadMbps float64
+	UploadMbps   float64
+}
+
+var simProfiles = map[string]simProfile{
+	"healthy": {Failure: 0.001, OutageChecks: 5, Latency: 30 * time.Millisecond, Jitter: 5 * time.Millisecond, DownloadMbps: 500, UploadMbps: 50},
+	"flaky":   {Failure: 0.05, Outage: 0.005, OutageChecks: 5, Latency: 60 * time.Millisecond, Jitter: 40 * time.Millisecond, DownloadMbps: 200, UploadMbps: 20},
+	"outages": {Failure: 0.01, Outage: 0.02, OutageChecks: 20, Latency: 40 * time.Millisecond, Jitter: 10 * time.Millisecond, DownloadMbps: 300, UploadMbps: 30},
+	"slow":    {Failure: 0.01, OutageChecks: 5, Latency: 400 * time.Millisecond, Jitter: 200 * time.Millisecond, DownloadMbps: 20, UploadMbps: 2},
+}
+
+// parseSimProfile parses a -simulate value: a profile name, optionally
+// followed by overrides, e.g. "flaky,latency=100ms,failure=0.1".
+func parseSimProfile(s string) (*simProfile, error) {
+	name, overrides, _ := strings.Cut(s, ",")
+	p, ok := simProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown -simulate profile %q: use healthy, flaky, outages, or slow", name)
+	}
+	for _, kv := range strings.Split(overrides, ",") {
+		if kv == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(kv, "=")
+		var err error
+		switch key {
+		case "failure":
+			p.Failure, err = parseChance(value)
+		case "outage":
+			p.Outage, err = parseChance(value)
+		case "outage_checks":
+			p.OutageChecks, err = strconv.Atoi(value)
+			if err == nil && p.OutageChecks < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "latency":
+			p.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			p.Jitter, err = time.ParseDuration(value)
+		case "download":
+			p.DownloadMbps, err = strconv.ParseFloat(value, 64)
+		case "upload":
+			p.UploadMbps, err = strconv.ParseFloat(value, 64)
+		default:
+			return nil, fmt.Errorf("unknown -simulate setting %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid -simulate setting %q: %v", kv, err)
+		}
+	}
+	return &p, nil
+}
+
+func parseChance(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil && (f < 0 || f > 1) {
+		err = fmt.Errorf("must be between 0 and 1")
+	}
+	return f, err
+}
+
+// simOutages counts down the checks left in each target's outage.
+var simOutages = struct {
+	sync.Mutex
+	left map[string]int
+}{left: map[string]int{}}
+
+// check makes up a result for a target. Each target's typical latency is
+// the profile's, scaled by a factor from its name, so targets differ.
+func (p *simProfile) check(t *targetConfig) checker.Result {
+	r := checker.Result{Timestamp: time.Now(), Target: t.Name, Family: t.Family, Status: "down", Failure: "connection"}
+
+	simOutages.Lock()
+	left := simOutages.left[t.Name]
+	switch {
+	case left > 0:
+		simOutages.left[t.Name] = left - 1
+	case rand.Float64() < p.Outage:
+		simOutages.left[t.Name] = rand.IntN(p.OutageChecks)
+		left = 1
+	}
+	simOutages.Unlock()
+	if left > 0 || rand.Float64() < p.Failure {
+		return r
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(t.Name))
+	scale := 0.5 + float64(h.Sum32()%100)/100
+	latency := float64(p.Latency)*scale + rand.NormFloat64()*float64(p.Jitter)
+	r.Status, r.Failure = "up", ""
+	r.LatencyMs = max(1, time.Duration(latency).Milliseconds())
+	r.TTFBMs = r.LatencyMs
+	return r
+}
+
+// speedTest makes up a speed test result for a provider.
+func (p *simProfile) speedTest(provider string) speedTestResult {
+	latency := max(1, p.Latency.Milliseconds()+int64(rand.NormFloat64()*float64(p.Jitter.Milliseconds())))
+	download := p.DownloadMbps * (0.7 + 0.35*rand.Float64())
+	return speedTestResult{
+		Timestamp:        time.Now(),
+		Provider:         provider,
+		DownloadMbps:     math.Round(100*download) / 100,
+		DownloadPeakMbps: math.Round(100*download*1.1) / 100,
+		UploadMbps:       math.Round(100*p.UploadMbps*(0.7+0.35*rand.Float64())) / 100,
+		LatencyMs:        latency,
+		LoadedLatencyMs:  latency * int64(2+rand.IntN(4)),
+		JitterMs:         math.Round(100*float64(p.Jitter.Milliseconds())*rand.Float64()) / 100,
+		PacketLossPct:    math.Round(1000*p.Failure*rand.Float64()) / 10,
+	}
+}
+
+// replayBatch is how many rows of each table the replay reads at a time.
+const replayBatch = 500
+
+// replayCursor reads a table of the replayed database in the order it was
+// written.
+type replayCursor struct {
+	src    *sql.DB
+	query  string
+	scan   func(*sql.Rows) (replayRow, error)
+	lastID int64
+	buf    []replayRow
+	done   bool
+}
+
+type replayRow struct {
+	id int64
+	ts time.Time
+	v  any
+}
+
+// peek returns the next row without consuming it, or nil at the end.
+func (c *replayCursor) peek() (*replayRow, error) {
+	if len(c.buf) == 0 && !c.done {
+		rows, err := c.src.Query(c.query, c.lastID, replayBatch)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			row, err := c.scan(rows)
+			if err != nil {
+				return nil, err
+			}
+			c.buf = append(c.buf, row)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		c.done = len(c.buf) < replayBatch
+	}
+	if len(c.buf) == 0 {
+		return nil, nil
+	}
+	return &c.buf[0], nil
+}
+
+func (c *replayCursor) next() {
+	c.lastID = c.buf[0].id
+	c.buf = c.buf[1:]
+}
+
+// replayDB plays back the checks and speed tests in the database at path,
+// in the order they were recorded and cfg.SimulateSpeed times faster, as if
+// they were happening now: each is stamped with the current time and goes
+// through incidents, alert rules, and notifications like a real one.
+func replayDB(ctx context.Context, cfg *Config, path string) error {
+	src, err := store.OpenReadOnly(path, "")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	checks := &replayCursor{
+		src: src,
+		query: `SELECT id, timestamp, target, status, latency_ms, maintenance, family, probe, attempts, failure, dns_ms, connect_ms, tls_ms, ttfb_ms
+			FROM checks WHERE id > ? ORDER BY id LIMIT ?`,
+	}
+	checks.scan = func(rows *sql.Rows) (replayRow, error) {
+		var r checker.Result
+		var id int64
+		err := rows.Scan(&id, &r.Timestamp, &r.Target, &r.Status, &r.LatencyMs, &r.Maintenance, &r.Family, &r.Probe, &r.Attempts, &r.Failure, &r.DNSMs, &r.ConnectMs, &r.TLSMs, &r.TTFBMs)
+		return replayRow{id, r.Timestamp, r}, err
+	}
+	speedTests := &replayCursor{
+		src: src,
+		query: `SELECT id, timestamp, provider, download_mbps, download_peak_mbps, upload_mbps, latency_ms, loaded_latency_ms, jitter_ms, packet_loss_pct
+			FROM speedtests WHERE id > ? ORDER BY id LIMIT ?`,
+	}
+	speedTests.scan = func(rows *sql.Rows) (replayRow, error) {
+		var r speedTestResult
+		var id int64
+		err := rows.Scan(&id, &r.Timestamp, &r.Provider, &r.DownloadMbps, &r.DownloadPeakMbps, &r.UploadMbps, &r.LatencyMs, &r.LoadedLatencyMs, &r.JitterMs, &r.PacketLossPct)
+		return replayRow{id, r.Timestamp, r}, err
+	}
+
+	var first time.Time
+	start := time.Now()
+	var replayed int
+	for {
+		// Take the earlier of the next check and the next speed test.
+		c, err := checks.peek()
+		if err != nil {
+			return err
+		}
+		s, err := speedTests.peek()
+		if err != nil {
+			return err
+		}
+		cursor, row := checks, c
+		if c == nil || s != nil && s.ts.Before(c.ts) {
+			cursor, row = speedTests, s
+		}
+		if row == nil {
+			break
+		}
+		if first.IsZero() {
+			first = row.ts
+		}
+
+		due := start.Add(time.Duration(float64(row.ts.Sub(first)) / cfg.SimulateSpeed))
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		switch v := row.v.(type) {
+		case checker.Result:
+			// Replayed targets are shown like agents' ones.
+			agentTargetsMu.Lock()
+			agentTargets[v.Target] = true
+			agentTargetsMu.Unlock()
+			v.Timestamp = time.Now()
+			v.Probe = cmp.Or(v.Probe, cfg.ProbeName)
+			threshold, _ := latencyThreshold(cfg, v.Target)
+			markDegraded(&v, threshold)
+			processResult(cfg, v)
+		case speedTestResult:
+			v.Timestamp = time.Now()
+			if err := saveSpeedTest(v); err != nil {
+				return err
+			}
+			evaluateSpeedTestRules(cfg)
+		}
+		cursor.next()
+		if replayed++; replayed%1000 == 0 {
+			slog.Info("Replaying", "rows", replayed, "at", row.ts.Format(time.DateTime))
+		}
+	}
+	slog.Info("Replay finished", "rows", replayed)
+	return nil
+}
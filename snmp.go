@@ -0,0 +1,413 @@
+package up
+
+import (
+	"context"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snmpDevice is a router or switch polled over SNMP v2c, e.g.
+//
+//	{"name": "router", "address": "192.168.1.1", "interfaces": [2]}
+type snmpDevice struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Community string `json:"community,omitempty"`
+	Interval  string `json:"interval,omitempty"`
+	// Interfaces are ifIndex values whose traffic, error, and discard
+	// counters are polled.
+	Interfaces []int `json:"interfaces,omitempty"`
+	// OIDs are extra values to poll, keyed by metric name.
+	OIDs map[string]string `json:"oids,omitempty"`
+
+	interval time.Duration
+	metrics  []snmpMetric
+}
+
+type snmpMetric struct {
+	name string
+	oid  asn1.ObjectIdentifier
+}
+
+var snmpDevices []snmpDevice
+
+// snmpInterfaceOIDs are the IF-MIB columns polled for each of a device's
+// interfaces, with the 64-bit octet counters so fast links don't wrap
+// between polls.
+var snmpInterfaceOIDs = []struct{ name, oid string }{
+	{"in_octets", "1.3.6.1.2.1.31.1.1.1.6"},
+	{"out_octets", "1.3.6.1.2.1.31.1.1.1.10"},
+	{"in_errors", "1.3.6.1.2.1.2.2.1.14"},
+	{"out_errors", "1.3.6.1.2.1.2.2.1.20"},
+	{"in_discards", "1.3.6.1.2.1.2.2.1.13"},
+	{"out_discards", "1.3.6.1.2.1.2.2.1.19"},
+}
+
+func (d *snmpDevice) init() error {
+	if d.Name == "" || d.Address == "" {
+		return fmt.Errorf("snmp device: name and address are required")
+	}
+	if _, _, err := net.SplitHostPort(d.Address); err != nil {
+		d.Address = net.JoinHostPort(d.Address, "161")
+	}
+	if d.Community == "" {
+		d.Community = "public"
+	}
+	d.interval = time.Minute
+	if d.Interval != "" {
+		i, err := time.ParseDuration(d.Interval)
+		if err != nil || i <= 0 {
+			return fmt.Errorf("snmp device %s: invalid interval %q", d.Name, d.Interval)
+		}
+		d.interval = i
+	}
+
+	d.metrics = nil
+	for _, index := range d.Interfaces {
+		for _, col := range snmpInterfaceOIDs {
+			oid, _ := parseOID(col.oid + "." + strconv.Itoa(index))
+			d.metrics = append(d.metrics, snmpMetric{fmt.Sprintf("if%d.%s", index, col.name), oid})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(d.OIDs)) {
+		oid, err := parseOID(d.OIDs[name])
+		if err != nil {
+			return fmt.Errorf("snmp device %s: invalid OID %q", d.Name, d.OIDs[name])
+		}
+		d.metrics = append(d.metrics, snmpMetric{name, oid})
+	}
+	if len(d.metrics) == 0 {
+		return fmt.Errorf("snmp device %s: no interfaces or oids to poll", d.Name)
+	}
+	return nil
+}
+
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(strings.TrimPrefix(s, "."), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	return oid, nil
+}
+
+// snmpValue is a polled value. Counters are turned into a per-second rate
+// between polls.
+type snmpValue struct {
+	value   uint64
+	signed  int64
+	counter bool
+	// bits is the counter width, for detecting wraps.
+	bits int
+}
+
+// startSNMPPollers polls every device on its own interval until ctx is
+// done.
+func startSNMPPollers(ctx context.Context, devices []snmpDevice) {
+	for i := range devices {
+		go pollSNMPDevice(ctx, &devices[i])
+	}
+	slog.Info("Polling SNMP devices", "devices", len(devices))
+}
+
+func pollSNMPDevice(ctx context.Context, d *snmpDevice) {
+	type sample struct {
+		at time.Time
+		v  snmpValue
+	}
+	last := map[string]sample{}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		values, err := snmpGet(d.Address, d.Community, d.metrics)
+		now := time.Now()
+		if err != nil {
+			slog.Error("Failed to poll SNMP device", "device", d.Name, "error", err)
+		}
+		for name, v := range values {
+			var rate *float64
+			if prev, ok := last[name]; ok && v.counter && prev.v.counter {
+				delta := v.value - prev.v.value
+				if v.value < prev.v.value && v.bits == 32 {
+					// A 32-bit counter wrapped since the last poll.
+					delta = v.value + (1<<32 - prev.v.value)
+				}
+				if v.value >= prev.v.value || v.bits == 32 {
+					r := float64(delta) / now.Sub(prev.at).Seconds()
+					rate = &r
+				}
+			}
+			last[name] = sample{now, v}
+
+			value := v.signed
+			if v.counter {
+				value = int64(v.value)
+			}
+			_, err := db.Exec(`INSERT INTO snmp (timestamp, device, metric, value, rate) VALUES (?, ?, ?, ?, ?)`, now, d.Name, name, value, rate)
+			if err != nil {
+				slog.Error("Failed to save SNMP sample", "device", d.Name, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snmpMessage is an SNMP v2c message. The PDU is left raw because its tag
+// says whether it is a request or a response.
+type snmpMessage struct {
+	Version   int
+	Community []byte
+	PDU       asn1.RawValue
+}
+
+type snmpVarBind struct {
+	Name  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+const (
+	snmpGetRequest  = 0
+	snmpGetResponse = 2
+	// snmpMaxVarBinds keeps requests small enough for modest agents.
+	snmpMaxVarBinds = 20
+)
+
+// snmpGet fetches the metrics from an agent with SNMP v2c GET requests.
+// Metrics the agent doesn't have are left out of the result.
+func snmpGet(addr, community string, metrics []snmpMetric) (map[string]snmpValue, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	values := map[string]snmpValue{}
+	for chunk := range slices.Chunk(metrics, snmpMaxVarBinds) {
+		binds, err := snmpRequest(conn, community, chunk)
+		if err != nil {
+			return values, err
+		}
+		for _, b := range binds {
+			for _, m := range chunk {
+				if !m.oid.Equal(b.Name) {
+					continue
+				}
+				if v, ok := parseSNMPValue(b.Value); ok {
+					values[m.name] = v
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// snmpRequest sends one GET, retrying twice, and returns the response's
+// variable bindings.
+func snmpRequest(conn net.Conn, community string, metrics []snmpMetric) ([]snmpVarBind, error) {
+	requestID := int(rand.Int32())
+	var binds []byte
+	for _, m := range metrics {
+		b, err := asn1.Marshal(snmpVarBind{Name: m.oid, Value: asn1.NullRawValue})
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, b...)
+	}
+	var pdu []byte
+	for _, n := range []int{requestID, 0, 0} {
+		b, _ := asn1.Marshal(n)
+		pdu = append(pdu, b...)
+	}
+	bindList, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: binds})
+	pdu = append(pdu, bindList...)
+	req, err := asn1.Marshal(snmpMessage{
+		Version:   1, // v2c
+		Community: []byte(community),
+		PDU:       asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: snmpGetRequest, IsCompound: true, Bytes: pdu},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			binds, id, err := parseSNMPResponse(buf[:n])
+			if err != nil {
+				return nil, err
+			}
+			// Replies to an earlier, retried request are skipped.
+			if id == requestID {
+				return binds, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no response from %s", conn.RemoteAddr())
+}
+
+func parseSNMPResponse(b []byte) ([]snmpVarBind, int, error) {
+	var msg snmpMessage
+	if _, err := asn1.Unmarshal(b, &msg); err != nil {
+		return nil, 0, fmt.Errorf("invalid SNMP response: %v", err)
+	}
+	if msg.PDU.Class != asn1.ClassContextSpecific || msg.PDU.Tag != snmpGetResponse {
+		return nil, 0, fmt.Errorf("unexpected SNMP PDU type %d", msg.PDU.Tag)
+	}
+
+	rest := msg.PDU.Bytes
+	var header [3]int64
+	for i := range header {
+		var v asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &v); err != nil {
+			return nil, 0, fmt.Errorf("invalid SNMP response: %v", err)
+		}
+		header[i] = parseBERInt(v.Bytes)
+	}
+	if header[1] != 0 {
+		return nil, 0, fmt.Errorf("SNMP error status %d at index %d", header[1], header[2])
+	}
+
+	var list asn1.RawValue
+	if _, err := asn1.Unmarshal(rest, &list); err != nil {
+		return nil, 0, fmt.Errorf("invalid SNMP response: %v", err)
+	}
+	var binds []snmpVarBind
+	for rest := list.Bytes; len(rest) > 0; {
+		var b snmpVarBind
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &b); err != nil {
+			return nil, 0, fmt.Errorf("invalid SNMP response: %v", err)
+		}
+		binds = append(binds, b)
+	}
+	return binds, int(header[0]), nil
+}
+
+// parseSNMPValue decodes the numeric SNMP types. noSuchObject,
+// noSuchInstance, strings, and the like are not numbers and are skipped.
+func parseSNMPValue(v asn1.RawValue) (snmpValue, bool) {
+	switch {
+	case v.Class == asn1.ClassUniversal && v.Tag == asn1.TagInteger:
+		return snmpValue{signed: parseBERInt(v.Bytes)}, true
+	case v.Class == asn1.ClassApplication:
+		var u uint64
+		for _, c := range v.Bytes {
+			u = u<<8 | uint64(c)
+		}
+		switch v.Tag {
+		case 1: // Counter32
+			return snmpValue{value: u, counter: true, bits: 32}, true
+		case 6: // Counter64
+			return snmpValue{value: u, counter: true, bits: 64}, true
+		case 2, 3: // Gauge32, TimeTicks
+			return snmpValue{signed: int64(u)}, true
+		}
+	}
+	return snmpValue{}, false
+}
+
+func parseBERInt(b []byte) int64 {
+	var n int64
+	for i, c := range b {
+		if i == 0 && c&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+type snmpSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     int64     `json:"value"`
+	Rate      *float64  `json:"rate,omitempty"`
+}
+
+type snmpSeries struct {
+	Device  string       `json:"device"`
+	Metric  string       `json:"metric"`
+	Samples []snmpSample `json:"samples"`
+}
+
+// snmpHandler serves polled SNMP values over the last ?window= (default
+// 24h), optionally limited to a ?device= and ?metric=. Counters include
+// their per-second rate.
+func (s *server) snmpHandler(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	query := `SELECT device, metric, timestamp, value, rate FROM snmp WHERE timestamp > ?`
+	args := []any{time.Now().Add(-window)}
+	if device := r.URL.Query().Get("device"); device != "" {
+		query += ` AND device = ?`
+		args = append(args, device)
+	}
+	if metric := r.URL.Query().Get("metric"); metric != "" {
+		query += ` AND metric = ?`
+		args = append(args, metric)
+	}
+	query += ` ORDER BY device, metric, timestamp`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	series := []snmpSeries{}
+	for rows.Next() {
+		var device, metric string
+		var sm snmpSample
+		if err := rows.Scan(&device, &metric, &sm.Timestamp, &sm.Value, &sm.Rate); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if len(series) == 0 || series[len(series)-1].Device != device || series[len(series)-1].Metric != metric {
+			series = append(series, snmpSeries{Device: device, Metric: metric})
+		}
+		last := &series[len(series)-1]
+		last.Samples = append(last.Samples, sm)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
@@ -0,0 +1,246 @@
+package up
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"up/checker"
+	"up/httpapi"
+	"up/speedtest"
+)
+
+// speedTestProvider is a pair of download/upload endpoints speaking the
+// Cloudflare speed test conventions, or with Type "ookla", a speedtest.net
+// server, or with Type "iperf3", an iperf3 server.
+type speedTestProvider struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+	UploadURL   string `json:"upload_url,omitempty"`
+	// Server is the host:port of the speedtest.net server to use (by
+	// default the nearest one is picked each run), or of the iperf3 server.
+	Server string `json:"server,omitempty"`
+}
+
+func (p *speedTestProvider) init() error {
+	if p.Name == "" {
+		return fmt.Errorf("speed test provider: name is required")
+	}
+	switch p.Type {
+	case "":
+		if p.DownloadURL == "" || p.UploadURL == "" {
+			return fmt.Errorf("speed test provider %s: download_url and upload_url are required", p.Name)
+		}
+	case "ookla":
+	case "iperf3":
+		if p.Server == "" {
+			return fmt.Errorf("speed test provider %s: server is required", p.Name)
+		}
+	default:
+		return fmt.Errorf("speed test provider %s: unknown type %q", p.Name, p.Type)
+	}
+	return nil
+}
+
+var speedTestProviders []speedTestProvider
+
+// speedTestMu keeps speed tests from running at the same time, which would
+// skew each other's results.
+var speedTestMu sync.Mutex
+
+// runSpeedTest runs a speed test against every configured provider.
+func runSpeedTest(cfg *Config) error {
+	targetsMu.RLock()
+	providers := speedTestProviders
+	targetsMu.RUnlock()
+
+	speedTestMu.Lock()
+	defer speedTestMu.Unlock()
+	_, err := runSpeedTests(cfg, providers)
+	return err
+}
+
+// runSpeedTests tests each provider in turn. speedTestMu must be held.
+func runSpeedTests(cfg *Config, providers []speedTestProvider) ([]speedTestResult, error) {
+	var results []speedTestResult
+	var errs []error
+	for _, p := range providers {
+		ok, err := speedTestBudgetLeft(cfg, p.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to check data budget: %v", p.Name, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		result, err := traceSpeedTest(cfg, p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", p.Name, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+type speedTestRun struct {
+	Results []speedTestResult `json:"results"`
+	Errors  []string          `json:"errors,omitempty"`
+}
+
+// speedTestRunHandler serves POST /speedtest/run, which runs a speed test
+// straight away (against ?provider= or every provider) and returns the
+// results. It fails with 409 Conflict while another test is running.
+func (s *server) speedTestRunHandler(w http.ResponseWriter, r *http.Request) {
+	if !httpapi.BearerTokenMatches(r, s.cfg.APIToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	targetsMu.RLock()
+	providers := speedTestProviders
+	targetsMu.RUnlock()
+	if name := r.URL.Query().Get("provider"); name != "" {
+		i := slices.IndexFunc(providers, func(p speedTestProvider) bool { return p.Name == name })
+		if i < 0 {
+			http.Error(w, "Unknown provider", http.StatusNotFound)
+			return
+		}
+		providers = providers[i : i+1]
+	}
+
+	if !speedTestMu.TryLock() {
+		http.Error(w, "A speed test is already running", http.StatusConflict)
+		return
+	}
+	results, err := runSpeedTests(&s.cfg, providers)
+	speedTestMu.Unlock()
+	evaluateSpeedTestRules(&s.cfg)
+
+	run := speedTestRun{Results: results}
+	if run.Results == nil {
+		run.Results = []speedTestResult{}
+	}
+	if err != nil {
+		slog.Error("Speed test failed", "error", err)
+		run.Errors = strings.Split(err.Error(), "\n")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(results) == 0 && err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(run)
+}
+
+type providerComparison struct {
+	Provider        string  `json:"provider"`
+	Tests           int     `json:"tests"`
+	AvgDownloadMbps float64 `json:"avg_download_mbps"`
+	AvgUploadMbps   float64 `json:"avg_upload_mbps"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+}
+
+// speedTestCompareHandler summarizes recent speed tests per provider so a
+// single provider's bad day is easy to tell apart from the connection's.
+func (s *server) speedTestCompareHandler(w http.ResponseWriter, r *http.Request) {
+	cutoff := time.Now().Add(-s.cfg.Recent)
+
+	rows, err := s.db.Query(`
+		SELECT provider, COUNT(*), AVG(download_mbps), AVG(upload_mbps), AVG(latency_ms)
+		FROM speedtests
+		WHERE timestamp > ?
+		GROUP BY provider
+		ORDER BY provider`, cutoff)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	comparisons := []providerComparison{}
+	for rows.Next() {
+		var c providerComparison
+		if err := rows.Scan(&c.Provider, &c.Tests, &c.AvgDownloadMbps, &c.AvgUploadMbps, &c.AvgLatencyMs); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		comparisons = append(comparisons, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparisons)
+}
+
+// TODO(nigel): Expose an endpoint elsewhere for speed test. These endpoints are not documented.
+func runProviderSpeedTest(cfg *Config, p speedTestProvider) (speedTestResult, error) {
+	if cfg.simulation != nil {
+		result := cfg.simulation.speedTest(p.Name)
+		return result, saveSpeedTest(result)
+	}
+	result := speedTestResult{Provider: p.Name}
+	var m speedtest.Result
+	var err error
+	stop := make(chan struct{})
+	loaded := make(chan float64, 1)
+	go func() { loaded <- measureLoadedLatency(cfg.ProxyURL, cfg.ProbeURL, 250*time.Millisecond, stop) }()
+	switch p.Type {
+	case "ookla":
+		m, err = speedtest.Ookla(checker.OutboundClient(cfg.ProxyURL), p.Server)
+		if m.Server != "" {
+			slog.Debug("Ookla speed test server", "server", m.Server)
+		}
+	case "iperf3":
+		m, err = speedtest.Iperf3(p.Server)
+	default:
+		m, err = speedtest.HTTP(checker.OutboundClient(cfg.ProxyURL), p.DownloadURL, p.UploadURL, cfg.SpeedTestBytes, cfg.SpeedTestUploadBytes)
+	}
+	close(stop)
+	result.LoadedLatencyMs = int64(math.Round(<-loaded))
+	if err != nil {
+		return result, err
+	}
+	result.DownloadMbps, result.DownloadPeakMbps, result.UploadMbps, result.JitterMs = m.DownloadMbps, m.DownloadPeakMbps, m.UploadMbps, m.JitterMs
+	latencyMs, transferred := m.LatencyMs, m.Bytes
+	if err := recordSpeedTestUsage(time.Now().In(cfg.Timezone), transferred); err != nil {
+		slog.Error("Failed to record speed test data usage", "provider", p.Name, "error", err)
+	}
+
+	probe := measureProbeBurst(cfg.ProxyURL, cfg.ProbeURL, cfg.ProbeCount, 100*time.Millisecond)
+	result.Timestamp = time.Now()
+	result.PacketLossPct = probe.PacketLossPct
+	if p.Type != "ookla" {
+		// Ookla's latency and jitter are measured against its own server,
+		// to match what the speedtest.net clients report.
+		latencyMs, result.JitterMs = probe.AvgLatencyMs, probe.JitterMs
+	}
+	result.LatencyMs = int64(math.Round(latencyMs))
+	return result, saveSpeedTest(result)
+}
+
+// saveSpeedTest stores a speed test result and publishes it.
+func saveSpeedTest(result speedTestResult) error {
+	stmt := `INSERT INTO speedtests (timestamp, provider, download_mbps, download_peak_mbps, upload_mbps, latency_ms, loaded_latency_ms, jitter_ms, packet_loss_pct) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(stmt, result.Timestamp, result.Provider, result.DownloadMbps, result.DownloadPeakMbps, result.UploadMbps, result.LatencyMs, result.LoadedLatencyMs, result.JitterMs, result.PacketLossPct)
+	if err != nil {
+		return fmt.Errorf("failed to save speed test result: %v", err)
+	}
+	events.publish(event{Type: "speedtest", Data: result})
+	observeSpeedTest(result)
+
+	slog.Info("Speed test completed", "provider", result.Provider,
+		"download_mbps", result.DownloadMbps, "download_peak_mbps", result.DownloadPeakMbps, "upload_mbps", result.UploadMbps, "latency_ms", result.LatencyMs,
+		"loaded_latency_ms", result.LoadedLatencyMs, "jitter_ms", result.JitterMs, "packet_loss_pct", result.PacketLossPct)
+	return nil
+}
@@ -0,0 +1,81 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// iperfDuration is how long each direction of an iperf3 test runs.
+const iperfDuration = 10 * time.Second
+
+// iperfReport is the part of iperf3's -J output up needs.
+type iperfReport struct {
+	End struct {
+		SumReceived struct {
+			Bytes         int64   `json:"bytes"`
+			BitsPerSecond float64 `json:"bits_per_second"`
+		} `json:"sum_received"`
+	} `json:"end"`
+	Error string `json:"error"`
+}
+
+// Iperf3 measures throughput to an iperf3 server (host or host:port) with
+// the iperf3 client: download with -R (server sends), then upload.
+func Iperf3(server string) (Result, error) {
+	down, err := runIperf(server, true)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run download test: %v", err)
+	}
+	up, err := runIperf(server, false)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run upload test: %v", err)
+	}
+	return Result{
+		DownloadMbps: down.End.SumReceived.BitsPerSecond / 1e6,
+		UploadMbps:   up.End.SumReceived.BitsPerSecond / 1e6,
+		Bytes:        down.End.SumReceived.Bytes + up.End.SumReceived.Bytes,
+	}, nil
+}
+
+func runIperf(server string, reverse bool) (*iperfReport, error) {
+	host, port := server, ""
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+	args := []string{"-c", host, "-J", "-t", fmt.Sprint(iperfDuration.Seconds())}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	if reverse {
+		args = append(args, "-R")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), iperfDuration+30*time.Second)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "iperf3", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+
+	// iperf3 reports its own errors in the JSON, with a non-zero exit.
+	var report iperfReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("iperf3: %v: %s", runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("iperf3: invalid output: %v", err)
+	}
+	if report.Error != "" {
+		return nil, fmt.Errorf("iperf3: %s", report.Error)
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("iperf3: %v", runErr)
+	}
+	return &report, nil
+}
@@ -0,0 +1,270 @@
+package speedtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ooklaServersURL = "https://www.speedtest.net/api/js/servers?engine=js&limit=10"
+	// ooklaCandidates is how many of the closest servers are pinged to pick
+	// the one with the lowest latency, as the speedtest.net clients do.
+	ooklaCandidates  = 5
+	ooklaPings       = 10
+	ooklaConnections = 4
+	ooklaDuration    = 10 * time.Second
+	ooklaChunk       = 1 << 20
+)
+
+type ooklaServer struct {
+	ID       string  `json:"id"`
+	Host     string  `json:"host"`
+	Name     string  `json:"name"`
+	Sponsor  string  `json:"sponsor"`
+	Distance float64 `json:"distance"`
+}
+
+// Ookla tests against a speedtest.net server (host:port), or when server is
+// empty, the nearest one, found with client. Latency and jitter come from
+// the server's own PING command, like the Ookla clients.
+func Ookla(client *http.Client, server string) (Result, error) {
+	var res Result
+	var s ooklaServer
+	if server != "" {
+		s = ooklaServer{Host: server, Name: server}
+	} else {
+		var err error
+		if s, err = nearestOoklaServer(client); err != nil {
+			return res, err
+		}
+		res.Server = fmt.Sprintf("%s (%s, %s)", s.Host, s.Sponsor, s.Name)
+	}
+	host := s.Host
+
+	c, err := dialOokla(host)
+	if err != nil {
+		return res, err
+	}
+	var rtts []float64
+	for range ooklaPings {
+		rtt, err := c.ping()
+		if err != nil {
+			c.Close()
+			return res, err
+		}
+		rtts = append(rtts, float64(rtt.Microseconds())/1000)
+	}
+	c.Close()
+	var sum, diffs float64
+	for i, rtt := range rtts {
+		sum += rtt
+		if i > 0 {
+			diffs += math.Abs(rtt - rtts[i-1])
+		}
+	}
+	res.LatencyMs = sum / float64(len(rtts))
+	res.JitterMs = diffs / float64(len(rtts)-1)
+
+	var down, up int64
+	if res.DownloadMbps, down, err = ooklaTransfer(host, (*ooklaConn).download); err != nil {
+		return res, fmt.Errorf("failed to run download test: %v", err)
+	}
+	if res.UploadMbps, up, err = ooklaTransfer(host, (*ooklaConn).upload); err != nil {
+		return res, fmt.Errorf("failed to run upload test: %v", err)
+	}
+	res.Bytes = down + up
+	return res, nil
+}
+
+// nearestOoklaServer fetches the servers closest to this connection and
+// picks the one with the lowest latency.
+func nearestOoklaServer(client *http.Client) (ooklaServer, error) {
+	resp, err := client.Get(ooklaServersURL)
+	if err != nil {
+		return ooklaServer{}, fmt.Errorf("failed to list servers: %v", err)
+	}
+	defer resp.Body.Close()
+	var servers []ooklaServer
+	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
+		return ooklaServer{}, fmt.Errorf("failed to list servers: %v", err)
+	}
+	if len(servers) == 0 {
+		return ooklaServer{}, fmt.Errorf("no servers found")
+	}
+
+	var best ooklaServer
+	bestRTT := time.Duration(math.MaxInt64)
+	for _, s := range servers[:min(len(servers), ooklaCandidates)] {
+		c, err := dialOokla(s.Host)
+		if err != nil {
+			slog.Debug("Ookla server unreachable", "server", s.Host, "error", err)
+			continue
+		}
+		rtt := time.Duration(math.MaxInt64)
+		for range 3 {
+			if d, err := c.ping(); err == nil {
+				rtt = min(rtt, d)
+			}
+		}
+		c.Close()
+		if rtt < bestRTT {
+			best, bestRTT = s, rtt
+		}
+	}
+	if best.Host == "" {
+		return best, fmt.Errorf("none of the %d nearest servers answered", min(len(servers), ooklaCandidates))
+	}
+	slog.Debug("Selected Ookla server", "server", best.Host, "sponsor", best.Sponsor, "name", best.Name, "latency", bestRTT)
+	return best, nil
+}
+
+// ooklaConn speaks the speedtest.net TCP protocol: line-based commands, with
+// DOWNLOAD and UPLOAD followed by that many bytes of payload.
+type ooklaConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func dialOokla(host string) (*ooklaConn, error) {
+	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &ooklaConn{Conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.command("HI")
+	if err == nil && !strings.HasPrefix(line, "HELLO") {
+		err = fmt.Errorf("unexpected greeting %q", line)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %v", host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (c *ooklaConn) command(cmd string) (string, error) {
+	if _, err := io.WriteString(c.Conn, cmd+"\n"); err != nil {
+		return "", err
+	}
+	line, err := c.r.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+func (c *ooklaConn) ping() (time.Duration, error) {
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	defer c.SetDeadline(time.Time{})
+	start := time.Now()
+	line, err := c.command(fmt.Sprintf("PING %d", start.UnixMilli()))
+	if err != nil {
+		return 0, err
+	}
+	if !strings.HasPrefix(line, "PONG") {
+		return 0, fmt.Errorf("unexpected reply to PING: %q", line)
+	}
+	return time.Since(start), nil
+}
+
+// download requests chunks until the deadline, adding what arrives to n.
+func (c *ooklaConn) download(n *atomic.Int64) error {
+	for {
+		if _, err := fmt.Fprintf(c.Conn, "DOWNLOAD %d\n", ooklaChunk); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(countingWriter{n}, c.r, ooklaChunk); err != nil {
+			return err
+		}
+	}
+}
+
+type countingWriter struct{ n *atomic.Int64 }
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// upload sends chunks until the deadline, adding what is written to n. Each
+// UPLOAD's size includes the command line, and the payload ends with a
+// newline.
+func (c *ooklaConn) upload(n *atomic.Int64) error {
+	header := fmt.Sprintf("UPLOAD %d 0\n", ooklaChunk)
+	payload := make([]byte, ooklaChunk)
+	copy(payload, header)
+	for i := len(header); i < len(payload)-1; i++ {
+		payload[i] = 'a' + byte(i%26)
+	}
+	payload[len(payload)-1] = '\n'
+	for {
+		for b := payload; len(b) > 0; {
+			w, err := c.Write(b[:min(len(b), 64<<10)])
+			n.Add(int64(w))
+			b = b[w:]
+			if err != nil {
+				return err
+			}
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "OK") {
+			return fmt.Errorf("unexpected reply to UPLOAD: %q", strings.TrimSpace(line))
+		}
+	}
+}
+
+// ooklaTransfer runs transfer over several connections for ooklaDuration
+// and returns the combined throughput in Mbps and the bytes transferred.
+func ooklaTransfer(host string, transfer func(*ooklaConn, *atomic.Int64) error) (float64, int64, error) {
+	var conns []*ooklaConn
+	for range ooklaConnections {
+		c, err := dialOokla(host)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return 0, 0, err
+		}
+		conns = append(conns, c)
+	}
+
+	var n atomic.Int64
+	var wg sync.WaitGroup
+	errs := make([]error, len(conns))
+	start := time.Now()
+	for i, c := range conns {
+		c.SetDeadline(start.Add(ooklaDuration))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.Close()
+			errs[i] = transfer(c, &n)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// Every connection ends by hitting the deadline; anything else is a
+	// failure, unless some data still got through.
+	for _, err := range errs {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			continue
+		}
+		if n.Load() == 0 {
+			return 0, 0, err
+		}
+	}
+	return float64(n.Load()) * 8 / 1e6 / elapsed.Seconds(), n.Load(), nil
+}
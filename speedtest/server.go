@@ -0,0 +1,40 @@
+package speedtest
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxServeBytes caps a single download requested from the speed test server.
+const maxServeBytes = 1 << 30
+
+// DownHandler mirrors Cloudflare's __down endpoint, streaming the requested
+// number of bytes, so other instances can test against this one with HTTP.
+func DownHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+	if err != nil || n < 0 || n > maxServeBytes {
+		http.Error(w, "bytes must be between 0 and 1073741824", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	io.CopyN(w, zeroReader{}, n)
+}
+
+// UpHandler mirrors Cloudflare's __up endpoint, discarding the uploaded
+// body.
+func UpHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := io.Copy(io.Discard, r.Body); err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,107 @@
+// Package speedtest measures throughput against Cloudflare-style HTTP
+// endpoints, speedtest.net servers, and iperf3 servers.
+package speedtest
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is a single speed test measurement.
+type Result struct {
+	DownloadMbps float64
+	// DownloadPeakMbps is the fastest the download ran over a quarter of a
+	// second; zero for methods that don't sample it.
+	DownloadPeakMbps float64
+	UploadMbps       float64
+	// LatencyMs and JitterMs are only measured by Ookla, against its own
+	// server.
+	LatencyMs float64
+	JitterMs  float64
+	// Bytes is the data transferred in both directions.
+	Bytes int64
+	// Server describes the server tested against, when it was picked
+	// automatically.
+	Server string
+}
+
+// HTTP downloads downloadBytes from downloadURL and uploads uploadBytes to
+// uploadURL. In downloadURL, {bytes} is replaced with the size requested;
+// in uploadURL, {id} with a random number.
+func HTTP(client *http.Client, downloadURL, uploadURL string, downloadBytes, uploadBytes int64) (Result, error) {
+	var res Result
+	url := strings.ReplaceAll(downloadURL, "{bytes}", strconv.FormatInt(downloadBytes, 10))
+
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		return res, fmt.Errorf("failed to run speed test: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Servers that ignore {bytes} serve a fixed file, so measure what was actually received.
+	meter := &throughputMeter{last: start}
+	if _, err := io.Copy(meter, resp.Body); err != nil {
+		return res, fmt.Errorf("failed to read response body: %v", err)
+	}
+	downloadDuration := time.Since(start)
+	res.DownloadMbps = (float64(meter.n) * 8.0 / 1_000_000.0) / downloadDuration.Seconds() // Convert bytes to Mbps
+	// Downloads shorter than a sample have only the average.
+	res.DownloadPeakMbps = max(meter.peakMbps, res.DownloadMbps)
+
+	// The payload is generated as it is sent rather than held in memory.
+	url = strings.ReplaceAll(uploadURL, "{id}", strconv.Itoa(rand.Intn(1000000)))
+	req, err := http.NewRequest(http.MethodPost, url, io.LimitReader(zeroReader{}, uploadBytes))
+	if err != nil {
+		return res, fmt.Errorf("failed to run upload speed test: %v", err)
+	}
+	req.ContentLength = uploadBytes
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	start = time.Now()
+	resp, err = client.Do(req)
+	uploadDuration := time.Since(start)
+	if err != nil {
+		return res, fmt.Errorf("failed to run upload speed test: %v", err)
+	}
+	defer resp.Body.Close()
+	res.UploadMbps = (float64(uploadBytes*8) / uploadDuration.Seconds()) / 1e6
+	slog.Debug("Upload completed", "duration", uploadDuration, "upload_mbps", res.UploadMbps)
+	res.Bytes = meter.n + uploadBytes
+	return res, nil
+}
+
+// sampleInterval is the interval download throughput is sampled over to
+// find the peak.
+const sampleInterval = 250 * time.Millisecond
+
+// throughputMeter counts the bytes written to it and the highest throughput
+// over any sampleInterval.
+type throughputMeter struct {
+	n, lastN int64
+	last     time.Time
+	peakMbps float64
+}
+
+func (m *throughputMeter) Write(p []byte) (int, error) {
+	m.n += int64(len(p))
+	now := time.Now()
+	if d := now.Sub(m.last); d >= sampleInterval {
+		m.peakMbps = max(m.peakMbps, float64(m.n-m.lastN)*8/1e6/d.Seconds())
+		m.last, m.lastN = now, m.n
+	}
+	return len(p), nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
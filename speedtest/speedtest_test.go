@@ -0,0 +1,58 @@
+package speedtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTP(t *testing.T) {
+	var uploaded int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__down", DownHandler)
+	mux.HandleFunc("/__up", func(w http.ResponseWriter, r *http.Request) {
+		uploaded = r.ContentLength
+		UpHandler(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	res, err := HTTP(srv.Client(), srv.URL+"/__down?bytes={bytes}", srv.URL+"/__up?r={id}", 1<<20, 1<<19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bytes != 1<<20+1<<19 {
+		t.Errorf("transferred %d bytes, want %d", res.Bytes, 1<<20+1<<19)
+	}
+	if uploaded != 1<<19 {
+		t.Errorf("uploaded %d bytes, want %d", uploaded, 1<<19)
+	}
+	if res.DownloadMbps <= 0 || res.UploadMbps <= 0 || res.DownloadPeakMbps < res.DownloadMbps {
+		t.Errorf("got %+v, want positive throughput with the peak at least the average", res)
+	}
+}
+
+func TestDownHandlerLimits(t *testing.T) {
+	for _, bytes := range []string{"", "-1", "abc", "1073741825"} {
+		w := httptest.NewRecorder()
+		DownHandler(w, httptest.NewRequest("GET", "/__down?bytes="+bytes, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("bytes=%s: status %d, want 400", bytes, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	DownHandler(w, httptest.NewRequest("GET", "/__down?bytes=10", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 10 {
+		t.Errorf("bytes=10: status %d with %d bytes", w.Code, w.Body.Len())
+	}
+}
+
+func TestUpHandlerNeedsPost(t *testing.T) {
+	w := httptest.NewRecorder()
+	UpHandler(w, httptest.NewRequest("GET", "/__up", strings.NewReader("x")))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", w.Code)
+	}
+}
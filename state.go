@@ -0,0 +1,50 @@
+package up
+
+import (
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+// stateChange records a target transitioning between statuses.
+type stateChange struct {
+	Timestamp time.Time `json:"timestamp"`
+	Target    string    `json:"target"`
+	Probe     string    `json:"probe"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+}
+
+var (
+	stateMu      sync.Mutex
+	targetStates = map[probeTarget]string{}
+)
+
+// probeTarget identifies a target as seen from one probe; incidents and
+// state are tracked separately per probe.
+type probeTarget struct {
+	target, probe string
+}
+
+// recordState remembers the latest status for the result's target and
+// reports whether it differs from the previous one. The first result seen
+// for a target is not treated as a change.
+func recordState(r checker.Result) (stateChange, bool) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	key := probeTarget{r.Target, r.Probe}
+	prev, seen := targetStates[key]
+	targetStates[key] = r.Status
+	if !seen || prev == r.Status {
+		return stateChange{}, false
+	}
+	return stateChange{
+		Timestamp: r.Timestamp,
+		Target:    r.Target,
+		Probe:     r.Probe,
+		From:      prev,
+		To:        r.Status,
+	}, true
+}
@@ -0,0 +1,100 @@
+package up
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+type latencyPercentiles struct {
+	P50 float64 `json:"p50_latency_ms"`
+	P90 float64 `json:"p90_latency_ms"`
+	P95 float64 `json:"p95_latency_ms"`
+	P99 float64 `json:"p99_latency_ms"`
+}
+
+// queryLatencyPercentiles computes latency percentiles over successful
+// checks for the target since the cutoff, from one probe or, if probe is
+// empty, all of them.
+func queryLatencyPercentiles(db *sql.DB, target, probe string, since time.Time) (latencyPercentiles, error) {
+	var p latencyPercentiles
+
+	rows, err := db.Query(`
+		SELECT latency_ms
+		FROM checks
+		WHERE target = ? AND timestamp > ? AND `+checker.AnsweredSQL+` AND maintenance = 0 AND (? = '' OR probe = ?)
+		ORDER BY latency_ms`, target, since, probe, probe)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	var latencies []int64
+	for rows.Next() {
+		var l int64
+		if err := rows.Scan(&l); err != nil {
+			return p, err
+		}
+		latencies = append(latencies, l)
+	}
+	if err := rows.Err(); err != nil {
+		return p, err
+	}
+
+	p.P50 = percentile(latencies, 50)
+	p.P90 = percentile(latencies, 90)
+	p.P95 = percentile(latencies, 95)
+	p.P99 = percentile(latencies, 99)
+	return p, nil
+}
+
+// queryLatencies returns the latencies of the named targets' successful
+// checks since cutoff, from probe (or all probes), sorted, by target and
+// probe. Without byProbe, each target's are listed under probe.
+func queryLatencies(db *sql.DB, names []string, probe string, byProbe bool, since time.Time) (map[[2]string][]int64, error) {
+	probeColumn := "?"
+	args := []any{probe}
+	if byProbe {
+		probeColumn, args = "probe", nil
+	}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	args = append(args, since, probe, probe)
+
+	rows, err := db.Query(`
+		SELECT target, `+probeColumn+` AS p, latency_ms
+		FROM checks
+		WHERE target IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")+`) AND timestamp > ? AND `+checker.AnsweredSQL+` AND maintenance = 0 AND (? = '' OR probe = ?)
+		ORDER BY target, p, latency_ms`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latencies := map[[2]string][]int64{}
+	for rows.Next() {
+		var target, p string
+		var l int64
+		if err := rows.Scan(&target, &p, &l); err != nil {
+			return nil, err
+		}
+		latencies[[2]string{target, p}] = append(latencies[[2]string{target, p}], l)
+	}
+	return latencies, rows.Err()
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []int64, pct float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(pct / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return float64(sorted[rank-1])
+}
@@ -0,0 +1,128 @@
+package up
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+
+	"up/checker"
+)
+
+// statsdMaxPacket keeps packets within a typical network's MTU.
+const statsdMaxPacket = 1432
+
+// startStatsDExporter sends every check and speed test result to a StatsD
+// or DogStatsD server over UDP.
+func startStatsDExporter(cfg *Config) error {
+	conn, err := net.Dial("udp", cfg.StatsDAddr)
+	if err != nil {
+		return err
+	}
+	ch := events.subscribe()
+	go func() {
+		for e := range ch {
+			for _, packet := range statsdPackets(statsdLines(cfg, e)) {
+				// StatsD is fire and forget; a missing server only shows as
+				// an error on some systems.
+				if _, err := conn.Write(packet); err != nil {
+					slog.Debug("Failed to send StatsD metrics", "addr", cfg.StatsDAddr, "error", err)
+				}
+			}
+		}
+	}()
+	slog.Info("Sending results to StatsD", "addr", cfg.StatsDAddr, "dogstatsd", cfg.StatsDDogStatsD)
+	return nil
+}
+
+// statsdLines encodes check and speed test events as StatsD lines; other
+// events are ignored. Check latency is a timer, and the rest are gauges.
+func statsdLines(cfg *Config, e event) []string {
+	var lines []string
+	add := func(group, metric, value, typ string, tags ...string) {
+		name := group
+		if !cfg.StatsDDogStatsD {
+			// Plain StatsD has no tags, so their values become part of the
+			// name: up.check.<target>.<probe>.latency.
+			for i := 1; i < len(tags); i += 2 {
+				if tags[i] != "" {
+					name += "." + statsdName(tags[i])
+				}
+			}
+		}
+		line := cfg.StatsDPrefix + name + "." + metric + ":" + value + "|" + typ
+		if cfg.StatsDDogStatsD {
+			line += statsdTags(tags...)
+		}
+		lines = append(lines, line)
+	}
+	switch r := e.Data.(type) {
+	case checker.Result:
+		up, degraded := 0, 0
+		if checker.Answered(r.Status) {
+			up = 1
+		}
+		if r.Status == "degraded" {
+			degraded = 1
+		}
+		tags := []string{"target", r.Target, "probe", r.Probe}
+		add("check", "up", fmt.Sprint(up), "g", tags...)
+		add("check", "degraded", fmt.Sprint(degraded), "g", tags...)
+		if checker.Answered(r.Status) {
+			add("check", "latency", fmt.Sprint(r.LatencyMs), "ms", tags...)
+		}
+	case speedTestResult:
+		tags := []string{"provider", r.Provider}
+		add("speedtest", "download_mbps", fmt.Sprintf("%g", r.DownloadMbps), "g", tags...)
+		add("speedtest", "upload_mbps", fmt.Sprintf("%g", r.UploadMbps), "g", tags...)
+		add("speedtest", "latency_ms", fmt.Sprint(r.LatencyMs), "g", tags...)
+		add("speedtest", "jitter_ms", fmt.Sprintf("%g", r.JitterMs), "g", tags...)
+	}
+	return lines
+}
+
+var (
+	statsdNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+	statsdTagEscaper  = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+)
+
+// statsdName makes a value safe to use as one component of a metric name.
+func statsdName(s string) string {
+	return strings.Trim(statsdNameInvalid.ReplaceAllString(s, "_"), "_")
+}
+
+// statsdTags formats key/value pairs as a DogStatsD tag section, skipping
+// empty values.
+func statsdTags(kv ...string) string {
+	var tags []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			tags = append(tags, kv[i]+":"+statsdTagEscaper.Replace(kv[i+1]))
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// statsdPackets joins lines into as few packets as fit statsdMaxPacket.
+func statsdPackets(lines []string) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacket {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
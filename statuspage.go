@@ -0,0 +1,208 @@
+package up
+
+import (
+	"database/sql"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"up/checker"
+)
+
+// statusPageDays is how many days of history the status page shows.
+const statusPageDays = 90
+
+type statusPage struct {
+	Title     string
+	Generated time.Time
+	AllUp     bool
+	Targets   []statusPageTarget
+	Incidents []incident
+}
+
+type statusPageTarget struct {
+	Name      string
+	Status    string
+	UptimePct float64
+	Days      []statusPageDay
+}
+
+type statusPageDay struct {
+	Date      string
+	Checks    int
+	UptimePct float64
+	Incidents int
+}
+
+// Class buckets a day for the uptime bar colour.
+func (d statusPageDay) Class() string {
+	switch {
+	case d.Checks == 0:
+		return "none"
+	case d.UptimePct >= 99.9:
+		return "ok"
+	case d.UptimePct >= 99:
+		return "minor"
+	}
+	return "major"
+}
+
+func buildStatusPage(db *sql.DB, cfg *Config) (*statusPage, error) {
+	now := time.Now()
+	to := nextPeriod(periodStart(now, "daily", cfg.Timezone), "daily")
+	from := to.AddDate(0, 0, -statusPageDays)
+
+	page := &statusPage{Title: cfg.StatusPageTitle, Generated: now, AllUp: true}
+	for _, name := range targetNames() {
+		t := statusPageTarget{Name: name, Status: "unknown"}
+		err := db.QueryRow(`SELECT status FROM checks WHERE target = ? ORDER BY timestamp DESC LIMIT 1`, name).Scan(&t.Status)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if !checker.Answered(t.Status) {
+			page.AllUp = false
+		}
+
+		report, err := buildReport(db, name, "daily", from, to, cfg.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		var checks int
+		var up float64
+		for _, p := range report.Periods {
+			t.Days = append(t.Days, statusPageDay{
+				Date:      p.Start,
+				Checks:    p.TotalChecks,
+				UptimePct: p.UptimePct,
+				Incidents: p.Incidents,
+			})
+			checks += p.TotalChecks
+			up += p.UptimePct * float64(p.TotalChecks)
+		}
+		if checks > 0 {
+			t.UptimePct = up / float64(checks)
+		}
+		page.Targets = append(page.Targets, t)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, target, probe, start_time, end_time, check_count
+		FROM incidents
+		WHERE start_time >= ? OR end_time IS NULL
+		ORDER BY start_time DESC
+		LIMIT 20`, now.AddDate(0, 0, -14))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var inc incident
+		var end sql.NullTime
+		if err := rows.Scan(&inc.ID, &inc.Target, &inc.Probe, &inc.Start, &end, &inc.CheckCount); err != nil {
+			return nil, err
+		}
+		if end.Valid {
+			inc.End = &end.Time
+			inc.DurationSeconds = end.Time.Sub(inc.Start).Seconds()
+		} else {
+			inc.Ongoing = true
+			inc.DurationSeconds = time.Since(inc.Start).Seconds()
+		}
+		page.Incidents = append(page.Incidents, inc)
+	}
+	return page, rows.Err()
+}
+
+const statusPageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>{{.Title}}</title>
+<link rel="alternate" type="application/atom+xml" title="{{.Title}} incidents" href="incidents.atom">
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 900px; margin: 2em auto; padding: 0 1em; color: #222; }
+.banner { padding: 1em; border-radius: 6px; color: #fff; font-weight: bold; margin-bottom: 2em; }
+.banner.ok { background: #3ba55c; }
+.banner.major { background: #e05d44; }
+.target { margin-bottom: 1.5em; }
+.target h3 { display: flex; justify-content: space-between; margin: 0 0 .4em; font-size: 1em; }
+.state-up { color: #3ba55c; }
+.state-down { color: #e05d44; }
+.state-degraded { color: #dfb317; }
+.state-captive { color: #fe7d37; }
+.state-unknown { color: #999; }
+.bars { display: flex; gap: 2px; height: 32px; }
+.bars span { flex: 1; border-radius: 2px; }
+.bars .ok { background: #3ba55c; }
+.bars .minor { background: #dfb317; }
+.bars .major { background: #e05d44; }
+.bars .none { background: #ddd; }
+.legend { display: flex; justify-content: space-between; color: #888; font-size: .8em; margin-top: .3em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #eee; padding: 6px 8px; text-align: left; }
+footer { color: #888; font-size: .8em; margin-top: 2em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .AllUp}}<div class="banner ok">All systems operational</div>{{else}}<div class="banner major">Some systems are experiencing problems</div>{{end}}
+
+{{range .Targets}}<div class="target">
+<h3><span>{{.Name}}</span><span class="state-{{.Status}}">{{.Status}}</span></h3>
+<div class="bars">{{range .Days}}<span class="{{.Class}}" title="{{.Date}}: {{if .Checks}}{{f2 .UptimePct}}% uptime{{else}}no data{{end}}{{if .Incidents}}, {{.Incidents}} incident(s){{end}}"></span>{{end}}</div>
+<div class="legend"><span>90 days ago</span><span>{{f2 .UptimePct}}% uptime</span><span>Today</span></div>
+</div>
+{{end}}
+<h2>Recent incidents</h2>
+{{if .Incidents}}<table>
+<tr><th>Target</th><th>Started</th><th>Resolved</th><th>Duration (min)</th></tr>
+{{range .Incidents}}<tr><td>{{.Target}}</td><td>{{date .Start}}</td><td>{{if .End}}{{date .End}}{{else}}ongoing{{end}}</td><td>{{mins .DurationSeconds}}</td></tr>
+{{end}}</table>{{else}}<p>No incidents in the last 14 days.</p>{{end}}
+
+<footer>Updated {{date .Generated}}</footer>
+</body>
+</html>
+`
+
+var statusPageTemplate = template.Must(template.New("status.html").Funcs(reportFuncs).Parse(statusPageHTML))
+
+// statusPageHandler serves the public, read-only status page.
+func (s *server) statusPageHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := buildStatusPage(s.db, &s.cfg)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPageTemplate.Execute(w, page); err != nil {
+		slog.Error("Failed to execute status page template", "error", err)
+	}
+}
+
+// startPublicServer serves only the status page, its incident and
+// maintenance feeds, and badges, so the dashboard and its raw data
+// endpoints can stay on a private address.
+func startPublicServer(addr string, s *server) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/badge/", s.badgeHandler)
+	mux.HandleFunc("/incidents.atom", s.api.Limiter.Limit(s.incidentsFeedHandler("/")))
+	mux.HandleFunc("/maintenance.ics", s.api.Limiter.Limit(s.maintenanceICalHandler))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		s.statusPageHandler(w, r)
+	})
+
+	go func() {
+		slog.Info("Starting public status page", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
+			slog.Error("Public status page server error", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Migration is one change to the schema.
+type Migration struct {
+	Version     int
+	Description string
+	apply       func(*sql.Tx) error
+}
+
+// migrations change the schema, in order. Each is applied once, in its own
+// transaction, and recorded in the schema_version table. Add new tables and
+// columns as new migrations at the end; never change or remove one that
+// has been released.
+var migrations = []Migration{
+	{1, "Create the schema", createSchema},
+	{2, "Add the columns added before migrations", addColumns},
+	{3, "Store times in UTC", convertTimesToUTC},
+}
+
+// Version is the schema version of this version of up.
+func Version() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// AppliedVersion returns the schema version of the database: the last
+// migration applied to it, or 0 if none has been.
+func AppliedVersion(db *sql.DB) (int, error) {
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// Pending returns the migrations not yet applied to the database. It fails
+// if the database was migrated by a newer version of up.
+func Pending(db *sql.DB) ([]Migration, error) {
+	version, err := AppliedVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if version > Version() {
+		return nil, fmt.Errorf("the database has schema version %d, newer than this version of up supports (%d)", version, Version())
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies the pending migrations and returns them.
+func Migrate(db *sql.DB) ([]Migration, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := Pending(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range pending {
+		if err := apply(db, m); err != nil {
+			return nil, fmt.Errorf("migration %d (%s): %v", m.Version, m.Description, err)
+		}
+	}
+	return pending, nil
+}
+
+func apply(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := m.apply(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`, m.Version, m.Description, time.Now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,396 @@
+// Package store opens up's SQLite database and keeps its schema current.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// utcDriver is the SQLite driver with every time.Time argument converted
+// to UTC. The driver stores times as text with their own offset, and
+// SQLite compares them as text, so mixing offsets (the server's local time,
+// an agent's, or either side of a daylight saving change) would compare
+// wrongly. With a key, each connection is unlocked with it, which needs
+// SQLite to be SQLCipher.
+type utcDriver struct {
+	key string
+}
+
+func (d utcDriver) Open(dsn string) (driver.Conn, error) {
+	sd := &sqlite3.SQLiteDriver{}
+	if d.key != "" {
+		sd.ConnectHook = func(c *sqlite3.SQLiteConn) error {
+			_, err := c.Exec("PRAGMA key = '"+strings.ReplaceAll(d.key, "'", "''")+"'", nil)
+			return err
+		}
+	}
+	c, err := sd.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return utcConn{c.(*sqlite3.SQLiteConn)}, nil
+}
+
+type utcConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (utcConn) CheckNamedValue(v *driver.NamedValue) error {
+	if t, ok := v.Value.(time.Time); ok {
+		v.Value = t.UTC()
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// utcConnector opens connections to one database with utcDriver.
+type utcConnector struct {
+	driver utcDriver
+	dsn    string
+}
+
+func (c utcConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c utcConnector) Driver() driver.Driver                        { return c.driver }
+
+// ErrNoSQLCipher is returned for a key when SQLite isn't SQLCipher, which
+// would otherwise ignore the key and write the database unencrypted.
+var ErrNoSQLCipher = errors.New("database encryption needs up to be built with SQLCipher (go build -tags libsqlite3 ./cmd/up, linked against SQLCipher)")
+
+// open opens the database at dsn, unlocking it with key if it isn't empty.
+func open(dsn, key string) (*sql.DB, error) {
+	db := sql.OpenDB(utcConnector{utcDriver{key}, dsn})
+	if key != "" {
+		var version string
+		err := db.QueryRow(`PRAGMA cipher_version`).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && version == "" {
+			err = ErrNoSQLCipher
+		}
+		if err == nil {
+			// A wrong key only shows when the database is read.
+			if _, err = db.Exec(`SELECT COUNT(*) FROM sqlite_master`); err != nil {
+				err = fmt.Errorf("wrong key, or not an encrypted database: %v", err)
+			}
+		}
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// Open opens the SQLite database at path, creating it or applying the
+// migrations it is missing. A non-empty key encrypts it with SQLCipher.
+func Open(path, key string) (*sql.DB, error) {
+	db, err := open(path, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := Init(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to init DB: %v", err)
+	}
+	return db, nil
+}
+
+// OpenReadOnly opens an existing database at path without writing to it,
+// so its schema is used as it is.
+func OpenReadOnly(path, key string) (*sql.DB, error) {
+	db, err := open("file:"+path+"?mode=ro", key)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Init brings the schema up to date, creating it in a new database, by
+// applying the migrations not yet applied.
+func Init(db *sql.DB) error {
+	_, err := Migrate(db)
+	return err
+}
+
+// schemaSQL is the schema as it was when migrations were introduced. It
+// only creates what is missing, so databases from before then take it as
+// their first migration.
+const schemaSQL = `
+    CREATE TABLE IF NOT EXISTS checks (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        timestamp DATETIME NOT NULL,
+        target TEXT NOT NULL,
+        status TEXT NOT NULL,
+        latency_ms INTEGER
+    );
+    CREATE INDEX IF NOT EXISTS idx_checks_time ON checks(timestamp);
+    CREATE INDEX IF NOT EXISTS idx_checks_target_time ON checks(target, timestamp);
+    
+    CREATE TABLE IF NOT EXISTS speedtests (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        timestamp DATETIME NOT NULL,
+        download_mbps REAL NOT NULL,
+        upload_mbps REAL NOT NULL,
+        latency_ms INTEGER NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_speedtests_time ON speedtests(timestamp);
+
+    CREATE TABLE IF NOT EXISTS incidents (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        target TEXT NOT NULL,
+        start_time DATETIME NOT NULL,
+        end_time DATETIME,
+        check_count INTEGER NOT NULL DEFAULT 0
+    );
+    CREATE INDEX IF NOT EXISTS idx_incidents_start ON incidents(start_time);
+
+    CREATE TABLE IF NOT EXISTS targets (
+        name TEXT PRIMARY KEY,
+        config TEXT NOT NULL,
+        created_at DATETIME NOT NULL
+    );
+
+    CREATE TABLE IF NOT EXISTS discovered (
+        url TEXT PRIMARY KEY,
+        name TEXT NOT NULL,
+        source TEXT NOT NULL,
+        detail TEXT NOT NULL DEFAULT '',
+        first_seen DATETIME NOT NULL,
+        last_seen DATETIME NOT NULL
+    );
+
+    CREATE TABLE IF NOT EXISTS alert_rules (
+        rule TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        probe TEXT NOT NULL,
+        since DATETIME NOT NULL,
+        notified DATETIME NOT NULL,
+        steps INTEGER NOT NULL,
+        PRIMARY KEY (rule, subject, probe)
+    );
+
+    CREATE TABLE IF NOT EXISTS path_hops (
+        timestamp DATETIME NOT NULL,
+        target TEXT NOT NULL,
+        ttl INTEGER NOT NULL,
+        addr TEXT NOT NULL,
+        sent INTEGER NOT NULL,
+        received INTEGER NOT NULL,
+        avg_ms REAL NOT NULL,
+        best_ms REAL NOT NULL,
+        worst_ms REAL NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_path_hops_target_time ON path_hops(target, timestamp);
+
+    CREATE TABLE IF NOT EXISTS snmp (
+        timestamp DATETIME NOT NULL,
+        device TEXT NOT NULL,
+        metric TEXT NOT NULL,
+        value INTEGER NOT NULL,
+        rate REAL
+    );
+    CREATE INDEX IF NOT EXISTS idx_snmp_time ON snmp(timestamp);
+
+    CREATE TABLE IF NOT EXISTS dns_lookups (
+        timestamp DATETIME NOT NULL,
+        resolver TEXT NOT NULL,
+        name TEXT NOT NULL,
+        latency_ms INTEGER NOT NULL,
+        error TEXT NOT NULL DEFAULT ''
+    );
+    CREATE INDEX IF NOT EXISTS idx_dns_lookups_time ON dns_lookups(timestamp);
+
+    CREATE TABLE IF NOT EXISTS ntp (
+        timestamp DATETIME NOT NULL,
+        server TEXT NOT NULL,
+        offset_ms REAL NOT NULL,
+        delay_ms REAL NOT NULL,
+        stratum INTEGER NOT NULL,
+        error TEXT NOT NULL DEFAULT ''
+    );
+    CREATE INDEX IF NOT EXISTS idx_ntp_time ON ntp(timestamp);
+
+    CREATE TABLE IF NOT EXISTS annotations (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        target TEXT NOT NULL DEFAULT '',
+        incident_id INTEGER,
+        start_time DATETIME NOT NULL,
+        end_time DATETIME,
+        text TEXT NOT NULL,
+        created_at DATETIME NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_annotations_start ON annotations(start_time);
+
+    CREATE TABLE IF NOT EXISTS degradations (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        target TEXT NOT NULL,
+        probe TEXT NOT NULL,
+        start_time DATETIME NOT NULL,
+        end_time DATETIME,
+        baseline_ms REAL NOT NULL,
+        peak_ms REAL NOT NULL,
+        score REAL NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_degradations_start ON degradations(start_time);
+
+    CREATE TABLE IF NOT EXISTS content_changes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        timestamp DATETIME NOT NULL,
+        target TEXT NOT NULL,
+        probe TEXT NOT NULL,
+        old_hash TEXT NOT NULL,
+        new_hash TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_content_changes_target ON content_changes(target, timestamp);
+
+    CREATE TABLE IF NOT EXISTS certificates (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        first_seen DATETIME NOT NULL,
+        target TEXT NOT NULL,
+        probe TEXT NOT NULL,
+        fingerprint TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        issuer TEXT NOT NULL,
+        serial TEXT NOT NULL,
+        sans TEXT NOT NULL,
+        not_before DATETIME NOT NULL,
+        not_after DATETIME NOT NULL,
+        chain TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_certificates_target ON certificates(target, first_seen);
+
+    CREATE TABLE IF NOT EXISTS security_headers (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        timestamp DATETIME NOT NULL,
+        target TEXT NOT NULL,
+        probe TEXT NOT NULL,
+        headers TEXT NOT NULL,
+        regressions TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_security_headers_target ON security_headers(target, timestamp);
+
+    CREATE TABLE IF NOT EXISTS domains (
+        domain TEXT PRIMARY KEY,
+        checked DATETIME NOT NULL,
+        expires DATETIME,
+        registrar TEXT NOT NULL DEFAULT '',
+        error TEXT NOT NULL DEFAULT ''
+    );
+
+    CREATE TABLE IF NOT EXISTS audit (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        timestamp DATETIME NOT NULL,
+        actor TEXT NOT NULL,
+        remote TEXT NOT NULL,
+        action TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        old TEXT NOT NULL,
+        new TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_audit_subject ON audit(subject);
+
+    CREATE TABLE IF NOT EXISTS speedtest_usage (
+        month TEXT PRIMARY KEY,
+        bytes INTEGER NOT NULL DEFAULT 0,
+        skipped INTEGER NOT NULL DEFAULT 0
+    );
+    `
+
+func createSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(schemaSQL)
+	return err
+}
+
+// addColumns adds the columns added after the original schema, before
+// migrations were introduced.
+func addColumns(tx *sql.Tx) error {
+	columns := []struct{ table, column, definition string }{
+		{"checks", "maintenance", "INTEGER NOT NULL DEFAULT 0"},
+		{"speedtests", "provider", "TEXT NOT NULL DEFAULT 'cloudflare'"},
+		{"speedtests", "jitter_ms", "REAL NOT NULL DEFAULT 0"},
+		{"speedtests", "packet_loss_pct", "REAL NOT NULL DEFAULT 0"},
+		{"speedtests", "download_peak_mbps", "REAL NOT NULL DEFAULT 0"},
+		{"checks", "dns_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"checks", "connect_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"checks", "tls_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"checks", "ttfb_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"checks", "family", "TEXT NOT NULL DEFAULT ''"},
+		{"checks", "probe", "TEXT NOT NULL DEFAULT 'local'"},
+		{"incidents", "probe", "TEXT NOT NULL DEFAULT 'local'"},
+		{"incidents", "path", "TEXT"},
+		{"incidents", "classification", "TEXT NOT NULL DEFAULT ''"},
+		{"checks", "attempts", "INTEGER NOT NULL DEFAULT 1"},
+		{"checks", "failure", "TEXT NOT NULL DEFAULT ''"},
+		{"checks", "protocol", "TEXT NOT NULL DEFAULT ''"},
+		{"speedtests", "loaded_latency_ms", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := EnsureColumn(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeColumns are the DATETIME columns, which older versions stored in the
+// server's local time.
+var timeColumns = []struct{ table, column string }{
+	{"checks", "timestamp"},
+	{"speedtests", "timestamp"},
+	{"incidents", "start_time"},
+	{"incidents", "end_time"},
+	{"targets", "created_at"},
+	{"alert_rules", "since"},
+	{"alert_rules", "notified"},
+	{"path_hops", "timestamp"},
+	{"snmp", "timestamp"},
+	{"dns_lookups", "timestamp"},
+	{"ntp", "timestamp"},
+}
+
+// convertTimesToUTC rewrites times stored with another offset in UTC. The
+// user_version pragma records that it has been done in databases from
+// before migrations were introduced.
+func convertTimesToUTC(tx *sql.Tx) error {
+	var version int
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version >= 1 {
+		return nil
+	}
+	for _, c := range timeColumns {
+		// strftime converts to UTC, keeping milliseconds.
+		_, err := tx.Exec(fmt.Sprintf(`UPDATE %[1]s SET %[2]s = strftime('%%Y-%%m-%%d %%H:%%M:%%f+00:00', %[2]s)
+			WHERE %[2]s IS NOT NULL AND %[2]s NOT LIKE '%%+00:00'`, c.table, c.column))
+		if err != nil {
+			return fmt.Errorf("failed to convert %s.%s to UTC: %v", c.table, c.column, err)
+		}
+	}
+	_, err := tx.Exec(`PRAGMA user_version = 1`)
+	return err
+}
+
+// EnsureColumn adds a column to an existing table if it is missing, so
+// databases created by older versions pick up new columns.
+func EnsureColumn(db querier, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
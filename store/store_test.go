@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenMigrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "up.db")
+	db, err := Open(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := AppliedVersion(db)
+	if err != nil || version != Version() {
+		t.Errorf("AppliedVersion = %d, %v; want %d", version, err, Version())
+	}
+	pending, err := Pending(db)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Pending = %v, %v; want none", pending, err)
+	}
+	db.Close()
+
+	// Opening it again applies nothing.
+	db, err = Open(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	applied, err := Migrate(db)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Migrate = %v, %v; want nothing applied", applied, err)
+	}
+}
+
+func TestNewerSchema(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "up.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO schema_version (version, description, applied_at) VALUES (?, 'from the future', ?)`, Version()+1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(db); err == nil {
+		t.Error("Migrate succeeded on a newer schema")
+	}
+}
+
+func TestTimesStoredInUTC(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "up.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Two checks a minute apart, written in different zones, must still
+	// sort and compare by the instant they happened.
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	later := at.Add(time.Minute).In(time.FixedZone("UTC-8", -8*3600))
+	for _, ts := range []time.Time{later, at} {
+		if _, err := db.Exec(`INSERT INTO checks (timestamp, target, status, latency_ms) VALUES (?, 't', 'up', 1)`, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var first time.Time
+	if err := db.QueryRow(`SELECT timestamp FROM checks WHERE timestamp >= ? ORDER BY timestamp LIMIT 1`, at).Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equal(at) {
+		t.Errorf("earliest check at %v, want %v", first, at)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "up.db")
+	db, err := Open(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenReadOnly(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO checks (timestamp, target, status, latency_ms) VALUES (?, 't', 'up', 1)`, time.Now()); err == nil {
+		t.Error("wrote to a read-only database")
+	}
+}
+
+func TestOpenWithKeyNeedsSQLCipher(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "up.db"), "secret")
+	if !errors.Is(err, ErrNoSQLCipher) {
+		t.Skipf("SQLite is SQLCipher here (%v)", err)
+	}
+}
+
+func TestConvertTimesToUTC(t *testing.T) {
+	// A database from before migration 2: the original checks table, no
+	// schema_version, and a time written with the server's offset.
+	path := filepath.Join(t.TempDir(), "up.db")
+	db, err := open(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		target TEXT NOT NULL,
+		status TEXT NOT NULL,
+		latency_ms INTEGER
+	);
+	INSERT INTO checks (timestamp, target, status, latency_ms) VALUES ('2024-03-10 04:00:00-08:00', 't', 'up', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	const want = "2024-03-10 12:00:00.000+00:00"
+	stored := func(db *sql.DB) string {
+		t.Helper()
+		var ts string
+		if err := db.QueryRow(`SELECT timestamp || '' FROM checks`).Scan(&ts); err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	db, err = Open(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if version, err := AppliedVersion(db); err != nil || version != Version() {
+		t.Errorf("AppliedVersion = %d, %v; want %d", version, err, Version())
+	}
+	if got := stored(db); got != want {
+		t.Errorf("after migrating, timestamp %q, want %q", got, want)
+	}
+
+	// At version 3, migrating again changes nothing, and neither does
+	// running the conversion itself again.
+	if applied, err := Migrate(db); err != nil || len(applied) != 0 {
+		t.Errorf("Migrate = %v, %v; want nothing applied", applied, err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := convertTimesToUTC(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(db); got != want {
+		t.Errorf("after converting again, timestamp %q, want %q", got, want)
+	}
+}
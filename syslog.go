@@ -0,0 +1,155 @@
+package up
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog severities.
+const (
+	syslogError   = 3
+	syslogWarning = 4
+	syslogNotice  = 5
+	syslogInfo    = 6
+)
+
+// syslogSDID names the structured data element of each message, under the
+// example enterprise number RFC 5424 sets aside.
+const syslogSDID = "up@32473"
+
+// startSyslogForwarder sends every check result and state change to a
+// syslog server as RFC 5424 messages, over UDP, TCP, or TLS. Messages sent
+// while a TCP or TLS server is unreachable are lost; it is reconnected
+// with backoff.
+func startSyslogForwarder(cfg *Config) error {
+	u, err := url.Parse(cfg.SyslogURL)
+	if err != nil {
+		return fmt.Errorf("invalid -syslog-url: %v", err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return fmt.Errorf("invalid -syslog-url: unsupported scheme %q", u.Scheme)
+	}
+	facility, ok := syslogFacilities[strings.ToLower(cfg.SyslogFacility)]
+	if !ok {
+		return fmt.Errorf("invalid -syslog-facility %q", cfg.SyslogFacility)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	ch := events.subscribe()
+	go func() {
+		var conn net.Conn
+		var retryAt time.Time
+		backoff := time.Second
+		for e := range ch {
+			msg := syslogMessage(e, facility, hostname)
+			if msg == "" {
+				continue
+			}
+			if conn == nil {
+				if time.Now().Before(retryAt) {
+					continue
+				}
+				c, err := dialSyslog(u)
+				if err != nil {
+					slog.Error("Failed to connect to syslog server", "url", u.Redacted(), "error", err)
+					retryAt = time.Now().Add(backoff)
+					backoff = min(backoff*2, time.Minute)
+					continue
+				}
+				conn, backoff = c, time.Second
+			}
+			// Stream transports frame each message with its length (RFC 6587
+			// octet counting); over UDP a datagram is a message.
+			if u.Scheme != "udp" {
+				msg = strconv.Itoa(len(msg)) + " " + msg
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				slog.Error("Failed to send to syslog server", "url", u.Redacted(), "error", err)
+				conn.Close()
+				conn = nil
+			}
+		}
+	}()
+	slog.Info("Forwarding results to syslog", "url", u.Redacted(), "facility", cfg.SyslogFacility)
+	return nil
+}
+
+func dialSyslog(u *url.URL) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "514"
+		if u.Scheme == "tls" {
+			port = "6514"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if u.Scheme == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	}
+	return dialer.Dial(u.Scheme, host)
+}
+
+// syslogMessage formats check and state change events as RFC 5424
+// messages, with their fields as structured data; other events give "".
+// Failed checks and targets going down are logged at higher severities.
+func syslogMessage(e event, facility int, hostname string) string {
+	var severity int
+	var at time.Time
+	var msgID, text string
+	var params []string
+	switch d := e.Data.(type) {
+	case checker.Result:
+		severity, at, msgID = syslogInfo, d.Timestamp, "check"
+		if !checker.Answered(d.Status) && !d.Maintenance {
+			severity = syslogWarning
+		}
+		text = fmt.Sprintf("%s is %s (%d ms)", d.Target, d.Status, d.LatencyMs)
+		params = []string{"target", d.Target, "probe", d.Probe, "status", d.Status,
+			"latency_ms", strconv.FormatInt(d.LatencyMs, 10), "failure", d.Failure,
+			"maintenance", strconv.FormatBool(d.Maintenance)}
+	case stateChange:
+		severity, at, msgID = syslogNotice, d.Timestamp, "state"
+		if d.To == "down" {
+			severity = syslogError
+		}
+		text = fmt.Sprintf("%s is now %s (was %s)", d.Target, d.To, d.From)
+		params = []string{"target", d.Target, "probe", d.Probe, "from", d.From, "to", d.To}
+	default:
+		return ""
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			fmt.Fprintf(&sd, ` %s="%s"`, params[i], syslogParamEscaper.Replace(params[i+1]))
+		}
+	}
+	sd.WriteString("]")
+	return fmt.Sprintf("<%d>1 %s %s up %d %s %s %s",
+		facility*8+severity, at.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), hostname, os.Getpid(), msgID, sd.String(), text)
+}
+
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "]", `\]`)
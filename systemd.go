@@ -0,0 +1,95 @@
+package up
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state update such as "READY=1" to systemd when running
+// as a Type=notify service; otherwise it does nothing.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to notify systemd: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %v", err)
+	}
+	return nil
+}
+
+// systemdListener returns the socket passed by systemd socket activation,
+// or nil when the process wasn't socket-activated.
+func systemdListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		slog.Warn("systemd passed several sockets, using the first", "count", n)
+	}
+	// Children such as iperf3 must not think the sockets are theirs.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	const firstFD = 3 // SD_LISTEN_FDS_START
+	f := os.NewFile(firstFD, "systemd-socket")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use systemd socket: %v", err)
+	}
+	return l, nil
+}
+
+// startSystemdWatchdog sends keepalives at half the WatchdogSec= interval
+// while the check loop is running, so systemd restarts the service if it
+// stalls.
+func startSystemdWatchdog(ctx context.Context, checkInterval time.Duration) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid, err := strconv.Atoi(os.Getenv("WATCHDOG_PID")); err == nil && pid != os.Getpid() {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	slog.Info("Sending systemd watchdog keepalives", "interval", interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Same test as /readyz: the check loop has run recently.
+				if since := time.Since(time.Unix(0, lastCheckRun.Load())); since > 2*checkInterval {
+					slog.Warn("Check loop stalled, withholding systemd watchdog keepalive", "last_run", since.Round(time.Second))
+					continue
+				}
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					slog.Error("Failed to send watchdog keepalive", "error", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,200 @@
+package up
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"up/checker"
+)
+
+// targetConfig describes a single monitored target. Targets passed via
+// -targets use the defaults; a config file can override them per target.
+type targetConfig struct {
+	checker.Target
+
+	// Role tells outage classification what the target stands for:
+	// "gateway" for the local router, "dns" for a resolver, or empty for an
+	// external service.
+	Role string `json:"role,omitempty"`
+
+	// Tags put the target in groups, such as "lan", "wan", or "work",
+	// that summaries can be filtered and aggregated by.
+	Tags []string `json:"tags,omitempty"`
+
+	// Push targets are not probed; instead they are expected to be pinged
+	// at /push/<token> at least every HeartbeatInterval.
+	HeartbeatInterval string `json:"heartbeat_interval,omitempty"`
+	Token             string `json:"token,omitempty"`
+
+	// Interval overrides -interval for this target, e.g. "10s" for the
+	// router or "5m" for a rate-limited API.
+	Interval string `json:"interval,omitempty"`
+	// Schedule is a cron expression to check on instead, e.g.
+	// "*/5 9-17 * * mon-fri".
+	Schedule string `json:"schedule,omitempty"`
+
+	// LatencyThreshold overrides -latency-threshold (or the learned
+	// threshold) for this target, e.g. "20ms" on the LAN.
+	LatencyThreshold string `json:"latency_threshold,omitempty"`
+
+	// Retention overrides -retention, and any retention policy, for this
+	// target's checks, e.g. "8760h" to keep a year.
+	Retention string `json:"retention,omitempty"`
+
+	heartbeat        time.Duration
+	interval         time.Duration
+	cron             *cronSchedule
+	latencyThreshold time.Duration
+	retention        time.Duration
+}
+
+type fileConfig struct {
+	Targets     []targetConfig      `json:"targets"`
+	Maintenance []maintenanceWindow `json:"maintenance,omitempty"`
+
+	SpeedTestProviders []speedTestProvider `json:"speedtest_providers,omitempty"`
+
+	Alerts []alertRule `json:"alerts,omitempty"`
+	// SNMP devices are polled from startup; they are not reloaded.
+	SNMP []snmpDevice `json:"snmp,omitempty"`
+	// Resolvers are compared from startup; they are not reloaded.
+	Resolvers []dnsResolver `json:"resolvers,omitempty"`
+
+	// Retention keeps the checks of some kinds of target for longer or
+	// shorter than -retention.
+	Retention []retentionPolicy `json:"retention,omitempty"`
+
+	// Templates customize alert messages, keyed by notifier name or
+	// "default".
+	Templates map[string]messageTemplate `json:"templates,omitempty"`
+
+	// Settings holds flag values, keyed by flag name, used when neither the
+	// flag nor its UP_* environment variable is set.
+	Settings map[string]json.RawMessage `json:"settings,omitempty"`
+}
+
+// init validates the target and prepares it to be checked, with the proxy,
+// CA file, and time zone in cfg as defaults.
+func (t *targetConfig) init(cfg *Config) error {
+	switch t.Role {
+	case "", "gateway", "dns":
+	default:
+		return fmt.Errorf("target %s: unknown role %q", t.Name, t.Role)
+	}
+	for _, tag := range t.Tags {
+		if tag == "" || tag != strings.TrimSpace(tag) {
+			return fmt.Errorf("target %s: invalid tag %q", cmp.Or(t.Name, t.URL), tag)
+		}
+	}
+	if err := t.initInterval(cfg.Timezone); err != nil {
+		return err
+	}
+	if err := t.initLatencyThreshold(); err != nil {
+		return err
+	}
+	if err := t.initRetention(); err != nil {
+		return err
+	}
+	if t.Type == "push" {
+		return t.initPush()
+	}
+	return t.Target.Init(checker.Options{Proxy: cfg.ProxyURL, CAFile: cfg.CAFile})
+}
+
+// expandTargets replaces each dual-stack target with one IPv4 and one IPv6
+// target, named after the original with the family appended.
+func expandTargets(in []targetConfig) []targetConfig {
+	var out []targetConfig
+	for _, t := range in {
+		if !t.DualStack || t.Type == "push" {
+			out = append(out, t)
+			continue
+		}
+		name := t.Name
+		if name == "" {
+			name = t.URL
+		}
+		for _, family := range []string{"ipv4", "ipv6"} {
+			ft := t
+			ft.Name = fmt.Sprintf("%s (%s)", name, family)
+			ft.Family = family
+			out = append(out, ft)
+		}
+	}
+	return out
+}
+
+// prepareTargets expands dual-stack targets and initializes every target.
+func prepareTargets(in []targetConfig, cfg *Config) ([]targetConfig, error) {
+	if cfg.DualStack {
+		for i := range in {
+			in[i].DualStack = true
+		}
+	}
+	out := expandTargets(in)
+	for i := range out {
+		if err := out[i].init(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func loadConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	var cfg fileConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return &cfg, nil
+}
+
+// targetNames returns the configured targets followed by any targets
+// reported only by agents.
+func targetNames() []string {
+	ts := currentTargets()
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.Name
+	}
+	return append(names, agentTargetNames(names)...)
+}
+
+// groupTargetNames returns the names of the targets tagged with group, or
+// of every target if group is empty. Targets reported only by agents have
+// no tags.
+func groupTargetNames(group string) []string {
+	if group == "" {
+		return targetNames()
+	}
+	var names []string
+	for _, t := range currentTargets() {
+		if slices.Contains(t.Tags, group) {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// targetGroups returns every tag in use, sorted.
+func targetGroups() []string {
+	var groups []string
+	for _, t := range currentTargets() {
+		for _, tag := range t.Tags {
+			if !slices.Contains(groups, tag) {
+				groups = append(groups, tag)
+			}
+		}
+	}
+	slices.Sort(groups)
+	return groups
+}
@@ -0,0 +1,371 @@
+package up
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"up/checker"
+	"up/httpapi"
+)
+
+var (
+	// targetsMu guards targets, providerTargets, maintenanceWindows,
+	// speedTestProviders, alertRules, and messageTemplates. Writers replace
+	// them rather than modifying them, so readers can keep using a snapshot
+	// without the lock.
+	targetsMu sync.RWMutex
+
+	// configTargets are the prepared targets from -targets or -config;
+	// managedTargets are the unprepared targets added through the API.
+	configTargets  []targetConfig
+	managedTargets []targetConfig
+)
+
+// currentTargets returns a snapshot of the targets being monitored.
+func currentTargets() []targetConfig {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	return targets
+}
+
+// loadManagedTargets reads the targets added through the API in previous
+// runs and starts monitoring them alongside the configured targets.
+func loadManagedTargets(cfg *Config) error {
+	rows, err := db.Query(`SELECT config FROM targets ORDER BY created_at`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var managed []targetConfig
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		var t targetConfig
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return fmt.Errorf("failed to parse stored target: %v", err)
+		}
+		managed = append(managed, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	return rebuildTargets(cfg, managed)
+}
+
+// rebuildTargets prepares managed and, if that succeeds, makes it the new
+// set of API targets, monitored along with the configured targets and those
+// of the Kubernetes and Docker providers. They are prepared with cfg, so
+// -dual-stack applies to them too. targetsMu must be held.
+func rebuildTargets(cfg *Config, managed []targetConfig) error {
+	in := make([]targetConfig, len(managed))
+	copy(in, managed)
+	prepared, err := prepareTargets(in, cfg)
+	if err != nil {
+		return err
+	}
+	managedTargets = managed
+	targets = append(append(slices.Clip(configTargets), prepared...), allProviderTargets()...)
+	return nil
+}
+
+func isConfigTarget(name string) bool {
+	for _, t := range configTargets {
+		if t.Name == name || t.URL == name {
+			return true
+		}
+	}
+	return false
+}
+
+// targetsAPIHandler serves the management API:
+//
+//	GET    /api/targets        list all targets
+//	POST   /api/targets        add or replace a target (JSON as in the config file)
+//	DELETE /api/targets/{name} remove a target added through the API
+//
+// It is also served under /api/v1/targets.
+// Names containing slashes (such as URLs) can be deleted with
+// DELETE /api/targets?name=...
+func (s *server) targetsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !httpapi.BearerTokenMatches(r, s.cfg.APIToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	name := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(path, "/api"), "/targets"), "/")
+	if name == "" {
+		name = r.URL.Query().Get("name")
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.listTargets(w)
+	case http.MethodPost:
+		s.addTarget(w, r)
+	case http.MethodDelete:
+		if name == "" {
+			http.Error(w, "Missing target name", http.StatusBadRequest)
+			return
+		}
+		s.deleteTarget(w, r, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// redactedSecret stands in for a credential in targets the API returns.
+const redactedSecret = "redacted"
+
+// redacted returns a copy of the target with its credentials replaced by
+// redactedSecret: the bearer token, cookies, header values, push token, and
+// passwords in its URL and proxy. Anyone holding the API token can read
+// targets, so it mustn't hand out the credentials of the services they
+// check.
+func (t targetConfig) redacted() targetConfig {
+	secret := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redactedSecret
+	}
+	secrets := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		out := make(map[string]string, len(m))
+		for k := range m {
+			out[k] = redactedSecret
+		}
+		return out
+	}
+	t.BearerToken = secret(t.BearerToken)
+	t.Token = secret(t.Token)
+	t.Cookies = secrets(t.Cookies)
+	t.Headers = secrets(t.Headers)
+	t.URL = redactURL(t.URL)
+	t.Proxy = redactURL(t.Proxy)
+	return t
+}
+
+// redactURL hides the password in a URL, if it has one.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	u.User = url.UserPassword(u.User.Username(), redactedSecret)
+	return u.String()
+}
+
+// keepSecrets fills in the credentials a client sent back redacted, as
+// after listing a target to change it, from old.
+func (t *targetConfig) keepSecrets(old targetConfig) {
+	if t.BearerToken == redactedSecret {
+		t.BearerToken = old.BearerToken
+	}
+	if t.Token == redactedSecret {
+		t.Token = old.Token
+	}
+	for k, v := range t.Cookies {
+		if v == redactedSecret {
+			t.Cookies[k] = old.Cookies[k]
+		}
+	}
+	for k, v := range t.Headers {
+		if v == redactedSecret {
+			t.Headers[k] = old.Headers[k]
+		}
+	}
+	if t.URL == redactURL(old.URL) {
+		t.URL = old.URL
+	}
+	if t.Proxy == redactURL(old.Proxy) {
+		t.Proxy = old.Proxy
+	}
+}
+
+// listedTarget is a target as listed by the API, with where it came from.
+type listedTarget struct {
+	targetConfig
+	Source string `json:"source"`
+}
+
+func (s *server) listTargets(w http.ResponseWriter) {
+	targetsMu.RLock()
+	list := []listedTarget{}
+	for _, t := range configTargets {
+		list = append(list, listedTarget{t.redacted(), "config"})
+	}
+	for _, t := range managedTargets {
+		list = append(list, listedTarget{t.redacted(), "api"})
+	}
+	for _, provider := range slices.Sorted(maps.Keys(providerTargets)) {
+		for _, t := range providerTargets[provider] {
+			list = append(list, listedTarget{t.redacted(), provider})
+		}
+	}
+	targetsMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *server) addTarget(w http.ResponseWriter, r *http.Request) {
+	var t targetConfig
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&t); err != nil {
+		http.Error(w, "Invalid target", http.StatusBadRequest)
+		return
+	}
+	if t.Name == "" {
+		t.Name = t.URL
+	}
+	targetsMu.RLock()
+	if i := slices.IndexFunc(managedTargets, func(m targetConfig) bool { return m.Name == t.Name }); i >= 0 {
+		t.keepSecrets(managedTargets[i])
+	}
+	targetsMu.RUnlock()
+
+	// Validate on a copy so a bad target is rejected before it is stored.
+	check := t
+	if err := check.init(&s.cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t.Token = check.Token
+
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+
+	if isConfigTarget(t.Name) {
+		http.Error(w, "Target is defined in the config file", http.StatusConflict)
+		return
+	}
+
+	data, _ := json.Marshal(t)
+	_, err := s.db.Exec(`
+		INSERT INTO targets (name, config, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET config = excluded.config`, t.Name, string(data), time.Now())
+	if err != nil {
+		slog.Error("Failed to save target", "target", t.Name, "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var old any
+	if i := slices.IndexFunc(managedTargets, func(m targetConfig) bool { return m.Name == t.Name }); i >= 0 {
+		old = managedTargets[i].redacted()
+	}
+	managed := slices.DeleteFunc(slices.Clone(managedTargets), func(m targetConfig) bool { return m.Name == t.Name })
+	managed = append(managed, t)
+	if err := rebuildTargets(&s.cfg, managed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	slog.Info("Target added", "target", t.Name)
+	actor, remote := requestActor(r)
+	action := "target.add"
+	if old != nil {
+		action = "target.update"
+	}
+	recordAudit(actor, remote, action, t.Name, old, t.redacted())
+
+	// The push token is returned, as it may have just been made up.
+	listed := t.redacted()
+	listed.Token = t.Token
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(listed)
+}
+
+func (s *server) deleteTarget(w http.ResponseWriter, r *http.Request, name string) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+
+	if isConfigTarget(name) {
+		http.Error(w, "Target is defined in the config file", http.StatusConflict)
+		return
+	}
+	i := slices.IndexFunc(managedTargets, func(m targetConfig) bool { return m.Name == name })
+	if i < 0 {
+		http.Error(w, "Target not found", http.StatusNotFound)
+		return
+	}
+	old := managedTargets[i]
+	managed := slices.Delete(slices.Clone(managedTargets), i, i+1)
+
+	if _, err := s.db.Exec(`DELETE FROM targets WHERE name = ?`, name); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := rebuildTargets(&s.cfg, managed); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Target removed", "target", name)
+	actor, remote := requestActor(r)
+	recordAudit(actor, remote, "target.delete", name, old.redacted(), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkNowHandler serves POST /check, which checks ?target= (or every
+// target) straight away and returns the results. They are recorded like
+// scheduled checks, so a recovery is picked up without waiting for the
+// next interval.
+func (s *server) checkNowHandler(w http.ResponseWriter, r *http.Request) {
+	if !httpapi.BearerTokenMatches(r, s.cfg.APIToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ts := currentTargets()
+	if name := r.URL.Query().Get("target"); name != "" {
+		t := findTarget(name)
+		if t == nil {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		}
+		ts = []targetConfig{*t}
+	}
+
+	// The checks go through the pool, so they count against
+	// -check-concurrency and wait for a scheduled check of the same target
+	// to finish rather than overlapping it.
+	var mu sync.Mutex
+	checked := map[string]checker.Result{}
+	s.pool.checkNow(ts, func(t *targetConfig, sleep func(time.Duration)) {
+		if res, ok := checkAndRecord(&s.cfg, t, sleep); ok {
+			mu.Lock()
+			checked[t.Name] = res
+			mu.Unlock()
+		}
+	})
+	results := []checker.Result{}
+	for _, t := range ts {
+		if res, ok := checked[t.Name]; ok {
+			results = append(results, res)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
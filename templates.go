@@ -0,0 +1,91 @@
+package up
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// messageTemplate replaces the title and message a notifier sends with Go
+// text/templates executed against the alert, e.g.
+//
+//	{"title": "{{.Target}} {{if .Firing}}DOWN{{else}}UP{{end}}"}
+type messageTemplate struct {
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	title, message *template.Template
+}
+
+// messageTemplates are the templates from -config, keyed by notifier name;
+// "default" applies to notifiers without one of their own. It is guarded by
+// targetsMu.
+var messageTemplates map[string]messageTemplate
+
+func (m *messageTemplate) init(name string) error {
+	if name != "default" && !slices.Contains(notifierTypes, name) {
+		return fmt.Errorf("templates: unknown notifier %q", name)
+	}
+	var err error
+	if m.title, err = parseMessageTemplate(name+" title", m.Title); err != nil {
+		return err
+	}
+	if m.message, err = parseMessageTemplate(name+" message", m.Message); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseMessageTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("templates: %v", err)
+	}
+	// Execute against a sample alert so that misspelt fields are reported
+	// at startup rather than when the first alert is sent.
+	sample := alert{Target: "example", Probe: "local", Status: "down", Firing: true, Timestamp: time.Now(), Since: time.Now(), RecentLatencyMs: []int64{42}, loc: time.Local}
+	if err := t.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("templates: %v", err)
+	}
+	return t, nil
+}
+
+func messageTemplatesFor(notifier string) (own, def messageTemplate) {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	return messageTemplates[notifier], messageTemplates["default"]
+}
+
+// title is the alert's title as sent by the notifier: its template, the
+// default template, or the summary.
+func (a alert) title(notifier string) string {
+	own, def := messageTemplatesFor(notifier)
+	return a.execute(cmp.Or(own.title, def.title), a.Summary)
+}
+
+// message is the alert's message body as sent by the notifier, falling back
+// to fallback when there is no template.
+func (a alert) message(notifier string, fallback func() string) string {
+	own, def := messageTemplatesFor(notifier)
+	return a.execute(cmp.Or(own.message, def.message), fallback)
+}
+
+func (a alert) execute(t *template.Template, fallback func() string) string {
+	if t == nil {
+		return fallback()
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, a); err != nil {
+		slog.Error("Failed to render alert template", "template", t.Name(), "error", err)
+		return fallback()
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,125 @@
+package up
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+const (
+	thresholdLearnInterval = time.Hour
+	thresholdHistory       = 7 * 24 * time.Hour
+	// A learned threshold is twice the target's 95th percentile latency,
+	// but at least thresholdFloorMs, once it has thresholdMinSamples
+	// successful checks.
+	thresholdFloorMs    = 10
+	thresholdMinSamples = 100
+)
+
+var (
+	learnedThresholdsMu sync.Mutex
+	learnedThresholds   = map[string]int64{}
+)
+
+// markDegraded records a successful check slower than thresholdMs as
+// "degraded": the target answered, so it isn't down, but too slowly to
+// count as up.
+func markDegraded(r *checker.Result, thresholdMs int64) {
+	if r.Status == "up" && r.LatencyMs > thresholdMs {
+		r.Status = "degraded"
+	}
+}
+
+func (t *targetConfig) initLatencyThreshold() error {
+	if t.LatencyThreshold == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(t.LatencyThreshold)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("target %s: invalid latency_threshold %q", cmp.Or(t.Name, t.URL), t.LatencyThreshold)
+	}
+	t.latencyThreshold = d
+	return nil
+}
+
+// latencyThreshold returns the latency in milliseconds above which the
+// named target's checks are degraded, and where it came from: "target" for
+// the target's latency_threshold, "learned" with -adaptive-thresholds, or
+// "default" for -latency-threshold.
+func latencyThreshold(cfg *Config, name string) (int64, string) {
+	for _, t := range currentTargets() {
+		if t.Name == name && t.latencyThreshold > 0 {
+			return t.latencyThreshold.Milliseconds(), "target"
+		}
+	}
+	if cfg.AdaptiveThresholds {
+		learnedThresholdsMu.Lock()
+		defer learnedThresholdsMu.Unlock()
+		if ms, ok := learnedThresholds[name]; ok {
+			return ms, "learned"
+		}
+	}
+	return cfg.LatencyThreshold, "default"
+}
+
+// learnThresholds relearns every target's threshold from the last week of
+// checks each hour until ctx is done.
+func learnThresholds(ctx context.Context) {
+	ticker := time.NewTicker(thresholdLearnInterval)
+	defer ticker.Stop()
+	for {
+		learned := map[string]int64{}
+		for _, name := range targetNames() {
+			ms, err := learnThreshold(db, name, time.Now().Add(-thresholdHistory))
+			if err != nil {
+				slog.Error("Failed to learn latency threshold", "target", name, "error", err)
+				continue
+			}
+			if ms > 0 {
+				learned[name] = ms
+			}
+		}
+		learnedThresholdsMu.Lock()
+		learnedThresholds = learned
+		learnedThresholdsMu.Unlock()
+		slog.Debug("Learned latency thresholds", "thresholds", learned)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// learnThreshold returns the threshold learned from the target's
+// successful checks since the given time, or 0 if there are too few.
+func learnThreshold(db *sql.DB, target string, since time.Time) (int64, error) {
+	rows, err := db.Query(`
+		SELECT latency_ms
+		FROM checks
+		WHERE target = ? AND timestamp > ? AND `+checker.AnsweredSQL+` AND maintenance = 0
+		ORDER BY latency_ms`, target, since)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var latencies []int64
+	for rows.Next() {
+		var l int64
+		if err := rows.Scan(&l); err != nil {
+			return 0, err
+		}
+		latencies = append(latencies, l)
+	}
+	if err := rows.Err(); err != nil || len(latencies) < thresholdMinSamples {
+		return 0, err
+	}
+	return max(int64(2*percentile(latencies, 95)), thresholdFloorMs), nil
+}
@@ -0,0 +1,37 @@
+package up
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"up/httpapi"
+)
+
+func (c *Config) addTimezoneFlag(fs *flag.FlagSet) {
+	c.Timezone = time.Local
+	fs.Func("timezone", "IANA time zone for day boundaries, e.g. Europe/Berlin (default: the system's)", func(s string) error {
+		loc, err := time.LoadLocation(s)
+		if err != nil {
+			return fmt.Errorf("unknown time zone %q", s)
+		}
+		c.Timezone = loc
+		return nil
+	})
+}
+
+var tzParam = httpapi.Param{Name: "tz", Description: "IANA time zone to report times and day boundaries in (default -timezone)"}
+
+// requestTimezone returns the zone named by ?tz=, or -timezone.
+func (s *server) requestTimezone(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return s.cfg.Timezone, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
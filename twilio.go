@@ -0,0 +1,98 @@
+package up
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const twilioAPIURL = "https://api.twilio.com/2010-04-01/Accounts/"
+
+// twilioMaxLength is the longest message Twilio accepts, in characters.
+const twilioMaxLength = 1600
+
+// twilioNotifier texts alerts with Twilio, which still gets through when the
+// outage takes out the internet connection push notifications need.
+type twilioNotifier struct {
+	accountSID, authToken string
+	from                  string
+	to                    []string
+	client                *http.Client
+
+	// delivered remembers which numbers an alert has been texted to, so
+	// that retrying it after some fail doesn't text the others again.
+	mu        sync.Mutex
+	delivered map[string]time.Time
+}
+
+// checkPhoneNumber checks that n is in E.164 format, as Twilio expects.
+func checkPhoneNumber(n string) error {
+	digits := strings.TrimPrefix(n, "+")
+	if digits == n || len(digits) < 8 || len(digits) > 15 || strings.Trim(digits, "0123456789") != "" {
+		return fmt.Errorf("invalid phone number %q: use E.164 format, e.g. +14155550100", n)
+	}
+	return nil
+}
+
+func (t *twilioNotifier) name() string { return "twilio" }
+
+func (t *twilioNotifier) notify(a alert) error {
+	body := a.title("twilio") + "\n" + a.message("twilio", a.Details)
+	if runes := []rune(body); len(runes) > twilioMaxLength {
+		body = string(runes[:twilioMaxLength-1]) + "…"
+	}
+	id := fmt.Sprintf("%s/%d/%t", a.Key(), a.Timestamp.UnixNano(), a.Firing)
+	var errs []string
+	for _, to := range t.to {
+		t.mu.Lock()
+		_, done := t.delivered[id+"/"+to]
+		t.mu.Unlock()
+		if done {
+			continue
+		}
+		if err := t.send(to, body); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", to, err))
+			continue
+		}
+		t.mu.Lock()
+		if t.delivered == nil {
+			t.delivered = map[string]time.Time{}
+		}
+		for k, at := range t.delivered {
+			if time.Since(at) > time.Hour {
+				delete(t.delivered, k)
+			}
+		}
+		t.delivered[id+"/"+to] = time.Now()
+		t.mu.Unlock()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (t *twilioNotifier) send(to, body string) error {
+	form := url.Values{"From": {t.from}, "To": {to}, "Body": {body}}
+	req, err := http.NewRequest(http.MethodPost, twilioAPIURL+url.PathEscape(t.accountSID)+"/Messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
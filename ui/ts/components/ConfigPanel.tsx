@@ -5,6 +5,9 @@ interface ConfigPanelProps {
   windowSize: number;
   onRefreshRateChange: (rate: number) => void;
   onWindowSizeChange: (size: number) => void;
+  groups: string[];
+  group: string;
+  onGroupChange: (group: string) => void;
 }
 
 const REFRESH_RATE_OPTIONS = [
@@ -26,6 +29,9 @@ const ConfigPanel: React.FC<ConfigPanelProps> = ({
   windowSize,
   onRefreshRateChange,
   onWindowSizeChange,
+  groups,
+  group,
+  onGroupChange,
 }) => {
   return (
     <div style={{
@@ -81,6 +87,30 @@ const ConfigPanel: React.FC<ConfigPanelProps> = ({
           ))}
         </select>
       </div>
+      {groups.length > 0 && (
+        <div style={{ display: 'flex', alignItems: 'center', gap: '10px' }}>
+          <label htmlFor="group" style={{ color: '#e0e0e0' }}>Group:</label>
+          <select
+            id="group"
+            value={group}
+            onChange={(e) => onGroupChange(e.target.value)}
+            style={{
+              backgroundColor: '#1a1a1a',
+              color: '#e0e0e0',
+              border: '1px solid #404040',
+              padding: '5px 10px',
+              borderRadius: '4px',
+            }}
+          >
+            <option value="">All targets</option>
+            {groups.map(g => (
+              <option key={g} value={g}>
+                {g}
+              </option>
+            ))}
+          </select>
+        </div>
+      )}
     </div>
   );
 };
@@ -18,7 +18,7 @@ import ConfigPanel from './ConfigPanel';
 
 interface StatusData {
   Timestamp: string;
-  Status: 'up' | 'down';
+  Status: 'up' | 'degraded' | 'down' | 'captive';
   LatencyMs: number;
   Target: string;
 }
@@ -48,6 +48,15 @@ interface TableSize {
 interface UptimeData {
   target: string;
   uptime_pct: number;
+  degraded_pct: number;
+  total_checks: number;
+  window_hours: number;
+}
+
+interface GroupData {
+  group: string;
+  targets: string[];
+  uptime_pct: number;
   total_checks: number;
   window_hours: number;
 }
@@ -57,8 +66,40 @@ interface SpeedTestData {
   DownloadMbps: number;
   UploadMbps: number;
   LatencyMs: number;
+  JitterMs: number;
+  PacketLossPct: number;
+}
+
+interface PlanData {
+  download_mbps: number;
+  upload_mbps: number;
+  sla_pct: number;
+  tests: number;
+  download_pct: number;
+  upload_pct: number;
+  below_sla: number;
 }
 
+interface IncidentData {
+  id: number;
+  target: string;
+  start: string;
+  duration_seconds: number;
+  ongoing: boolean;
+  classification?: 'lan' | 'isp' | 'remote';
+}
+
+const classificationLabels: Record<string, string> = {
+  lan: 'Local network',
+  isp: 'ISP',
+  remote: 'Remote service',
+};
+
+const MAX_INCIDENTS = 10;
+
+// Matches the row limit of the /status endpoint.
+const MAX_STATUS_POINTS = 500;
+
 const formatBytes = (bytes: number): string => {
   if (bytes === 0) return '0 B';
   const k = 1024;
@@ -104,6 +145,10 @@ const Dashboard: React.FC = () => {
   const [refreshRate, setRefreshRate] = useState<number>(10000);
   const [windowSize, setWindowSize] = useState<number>(60);
   const [speedTestData, setSpeedTestData] = useState<SpeedTestData[]>([]);
+  const [incidents, setIncidents] = useState<IncidentData[]>([]);
+  const [plan, setPlan] = useState<PlanData | null>(null);
+  const [groups, setGroups] = useState<GroupData[]>([]);
+  const [group, setGroup] = useState<string>('');
 
   const aspectRatio = 2;
   const margin: Margin = { top: 20, right: 50, bottom: 40, left: 50 };
@@ -132,7 +177,7 @@ const Dashboard: React.FC = () => {
 
   const fetchUptimeData = async (): Promise<void> => {
     try {
-      const response = await fetch('/uptime');
+      const response = await fetch(group ? `/uptime?group=${encodeURIComponent(group)}` : '/uptime');
       const data: UptimeData[] = await response.json();
       setUptimeData(data);
     } catch (error) {
@@ -140,6 +185,26 @@ const Dashboard: React.FC = () => {
     }
   };
 
+  const fetchGroups = async (): Promise<void> => {
+    try {
+      const response = await fetch('/groups');
+      const data: GroupData[] = await response.json();
+      setGroups(data);
+    } catch (error) {
+      console.error('Error fetching groups:', error);
+    }
+  };
+
+  const fetchIncidents = async (): Promise<void> => {
+    try {
+      const response = await fetch(`/incidents?limit=${MAX_INCIDENTS}`);
+      const data: IncidentData[] = await response.json();
+      setIncidents(data);
+    } catch (error) {
+      console.error('Error fetching incidents:', error);
+    }
+  };
+
   const fetchSpeedTestData = async (): Promise<void> => {
     try {
       const response = await fetch('/speedtest');
@@ -150,6 +215,18 @@ const Dashboard: React.FC = () => {
     }
   };
 
+  // The plan report covers the last 30 days; it is 404 when no plan is set.
+  const fetchPlan = async (): Promise<void> => {
+    try {
+      const response = await fetch('/report/plan');
+      if (!response.ok) return;
+      const data: PlanData = await response.json();
+      setPlan(data);
+    } catch (error) {
+      console.error('Error fetching plan report:', error);
+    }
+  };
+
   useEffect(() => {
     const handleResize = (): void => {
       if (chartRef.current) {
@@ -167,27 +244,52 @@ const Dashboard: React.FC = () => {
   }, []);
 
   useEffect(() => {
-    fetchData();
     fetchTableSize();
     fetchUptimeData();
-    fetchSpeedTestData();
-    const dataInterval = setInterval(fetchData, refreshRate);
+    fetchGroups();
+    fetchIncidents();
     const sizeInterval = setInterval(fetchTableSize, 60000);
     const uptimeInterval = setInterval(fetchUptimeData, refreshRate);
-    const speedTestInterval = setInterval(fetchSpeedTestData, refreshRate);
+    const groupsInterval = setInterval(fetchGroups, refreshRate);
+    const incidentsInterval = setInterval(fetchIncidents, refreshRate);
     return () => {
-      clearInterval(dataInterval);
       clearInterval(sizeInterval);
       clearInterval(uptimeInterval);
-      clearInterval(speedTestInterval);
+      clearInterval(groupsInterval);
+      clearInterval(incidentsInterval);
     };
-  }, [refreshRate]);
+  }, [refreshRate, group]);
 
   useEffect(() => {
-    if (!data.length || !dimensions.width) return;
+    fetchData();
+    fetchSpeedTestData();
+    fetchPlan();
 
+    const source = new EventSource('/events');
+    source.addEventListener('check', (e: MessageEvent) => {
+      const result: StatusData = JSON.parse(e.data);
+      setData(prev => [result, ...prev].slice(0, MAX_STATUS_POINTS));
+    });
+    source.addEventListener('speedtest', (e: MessageEvent) => {
+      const result: SpeedTestData = JSON.parse(e.data);
+      setSpeedTestData(prev => [result, ...prev]);
+      fetchPlan();
+    });
+    // The browser reconnects on its own; refetch so nothing is missed while disconnected.
+    source.onopen = () => {
+      fetchData();
+      fetchSpeedTestData();
+    };
+    return () => source.close();
+  }, []);
+
+  useEffect(() => {
     select(chartRef.current).selectAll('*').remove();
 
+    const groupTargets = groups.find(g => g.group === group)?.targets;
+    const visible = groupTargets ? data.filter(d => groupTargets.includes(d.Target)) : data;
+    if (!visible.length || !dimensions.width) return;
+
     const { width, height } = dimensions;
 
     const svg = select(chartRef.current)
@@ -210,9 +312,9 @@ const Dashboard: React.FC = () => {
       .attr('width', width - margin.left - margin.right)
       .attr('height', height - margin.top - margin.bottom);
 
-    const processedData: ProcessedData[] = data.map(d => ({
+    const processedData: ProcessedData[] = visible.map(d => ({
       timestamp: new Date(d.Timestamp),
-      latency_ms: d.Status === 'up' ? d.LatencyMs : null,
+      latency_ms: d.Status === 'up' || d.Status === 'degraded' ? d.LatencyMs : null,
       target: d.Target,
     }));
 
@@ -313,7 +415,7 @@ const Dashboard: React.FC = () => {
       .on('mouseleave', function () {
         tooltip.transition().duration(200).style('opacity', 0);
       });
-  }, [data, dimensions, windowSize]);
+  }, [data, dimensions, windowSize, groups, group]);
 
   return (
     <div className="dashboard">
@@ -325,6 +427,9 @@ const Dashboard: React.FC = () => {
         onRefreshRateChange={setRefreshRate}
         windowSize={windowSize}
         onWindowSizeChange={setWindowSize}
+        groups={groups.map(g => g.group)}
+        group={group}
+        onGroupChange={setGroup}
       />
       <div ref={chartRef} className="chart" />
       <div className="stats">
@@ -332,11 +437,22 @@ const Dashboard: React.FC = () => {
           <span className="label">Database Size:</span>
           <span className="value">{formatBytes(tableSize)}</span>
         </div>
+        {groups
+          .filter(g => !group || g.group === group)
+          .map((g) => (
+            <div key={`group-${g.group}`} className="stat">
+              <span className="label">{g.group} group Uptime:</span>
+              <span className="value">{g.uptime_pct.toFixed(2)}%</span>
+              <span className="subtext">({g.targets.length} targets, {g.window_hours.toFixed(1)}h window)</span>
+            </div>
+          ))}
         {uptimeData.map((uptime) => (
           <div key={uptime.target} className="stat">
             <span className="label">{uptime.target} Uptime:</span>
             <span className="value">{uptime.uptime_pct.toFixed(2)}%</span>
-            <span className="subtext">({uptime.window_hours.toFixed(1)}h window)</span>
+            <span className="subtext">
+              ({uptime.degraded_pct > 0 && `${uptime.degraded_pct.toFixed(2)}% degraded, `}{uptime.window_hours.toFixed(1)}h window)
+            </span>
           </div>
         ))}
         {speedTestData.length > 0 && (
@@ -354,11 +470,59 @@ const Dashboard: React.FC = () => {
               <span className="label">Latency:</span>
               <span className="value">{speedTestData[0].LatencyMs} ms</span>
             </div>
+            <div className="stat">
+              <span className="label">Jitter:</span>
+              <span className="value">{speedTestData[0].JitterMs.toFixed(1)} ms</span>
+            </div>
+            <div className="stat">
+              <span className="label">Packet Loss:</span>
+              <span className="value">{speedTestData[0].PacketLossPct.toFixed(1)}%</span>
+            </div>
             <div className="subtext">
               Last updated: {new Date(speedTestData[0].Timestamp).toLocaleString()}
             </div>
           </div>
         )}
+        {plan && plan.tests > 0 && (
+          <div className="speedtest-stats">
+            <h3>Internet Plan (30 days)</h3>
+            {plan.download_mbps > 0 && (
+              <div className="stat">
+                <span className="label">Download:</span>
+                <span className="value">{plan.download_pct.toFixed(1)}% of plan</span>
+                <span className="subtext">({plan.download_mbps} Mbps advertised)</span>
+              </div>
+            )}
+            {plan.upload_mbps > 0 && (
+              <div className="stat">
+                <span className="label">Upload:</span>
+                <span className="value">{plan.upload_pct.toFixed(1)}% of plan</span>
+                <span className="subtext">({plan.upload_mbps} Mbps advertised)</span>
+              </div>
+            )}
+            <div className="stat">
+              <span className="label">Below {plan.sla_pct}%:</span>
+              <span className="value">{plan.below_sla} of {plan.tests} tests</span>
+            </div>
+          </div>
+        )}
+        {incidents.length > 0 && (
+          <div className="incidents">
+            <h3>Recent Incidents</h3>
+            {incidents.map((incident) => (
+              <div key={incident.id} className="stat">
+                <span className="label">{incident.target}</span>
+                <span className="value">
+                  {classificationLabels[incident.classification ?? ''] ?? 'Unclassified'}
+                </span>
+                <span className="subtext">
+                  {new Date(incident.start).toLocaleString()},{' '}
+                  {incident.ongoing ? 'ongoing' : `${Math.round(incident.duration_seconds / 60)} min`}
+                </span>
+              </div>
+            ))}
+          </div>
+        )}
       </div>
     </div>
   );
@@ -0,0 +1,69 @@
+package up
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func (c *Config) checkVacuumMode() error {
+	switch c.VacuumMode {
+	case "none", "incremental", "full":
+		return nil
+	}
+	return fmt.Errorf("-vacuum must be none, incremental, or full")
+}
+
+func dbSize() (int64, error) {
+	var size int64
+	err := db.QueryRow("SELECT page_count * page_size as size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	return size, err
+}
+
+// vacuumDB returns the space freed by pruning to the filesystem. The
+// incremental mode switches the database to auto_vacuum=INCREMENTAL the first
+// time it runs, which needs one full VACUUM; after that each run only
+// truncates free pages. A full VACUUM rewrites the whole file and blocks
+// writers while it runs.
+func vacuumDB(mode string) error {
+	if mode == "none" {
+		return nil
+	}
+
+	before, err := dbSize()
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case "incremental":
+		var autoVacuum int
+		if err := db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+			return err
+		}
+		if autoVacuum != 2 {
+			slog.Info("Enabling incremental auto_vacuum; this runs a one-time full VACUUM")
+			if _, err := db.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+				return err
+			}
+			if _, err := db.Exec("VACUUM"); err != nil {
+				return err
+			}
+		}
+		if _, err := db.Exec("PRAGMA incremental_vacuum"); err != nil {
+			return err
+		}
+	case "full":
+		if _, err := db.Exec("VACUUM"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown vacuum mode %q", mode)
+	}
+
+	after, err := dbSize()
+	if err != nil {
+		return err
+	}
+	slog.Info("Vacuumed database", "mode", mode, "size_bytes", after, "reclaimed_bytes", before-after)
+	return nil
+}
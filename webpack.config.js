@@ -47,7 +47,8 @@ module.exports = {
       '/summary': 'http://localhost:8080',
       '/size': 'http://localhost:8080',
       '/uptime': 'http://localhost:8080',
-      '/speedtest': 'http://localhost:8080'
+      '/speedtest': 'http://localhost:8080',
+      '/events': 'http://localhost:8080'
     }
   }
 }; 
\ No newline at end of file
@@ -0,0 +1,149 @@
+package up
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"up/checker"
+)
+
+const (
+	// writeRetryDelay is how long the writer waits to try again after
+	// failing to write a batch.
+	writeRetryDelay = 5 * time.Second
+	// maxQueuedResults caps the results held while the database can't be
+	// written, so a long failure doesn't use up memory. The oldest are
+	// dropped first.
+	maxQueuedResults = 100_000
+)
+
+// resultQueue holds check results waiting to be written, so checks don't
+// wait on the database. Only the writer goroutine writes them; due is
+// signalled when a batch should be written before the next interval.
+var resultQueue = struct {
+	mu      sync.Mutex
+	pending []checker.Result
+	due     chan struct{}
+}{due: make(chan struct{}, 1)}
+
+// resultsWritten is signalled after queued results are written, for what
+// reads them back from the database, such as the alert rules.
+var resultsWritten = make(chan struct{}, 1)
+
+// wake wakes whoever waits on c, without blocking if it is already
+// signalled.
+func wake(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// startResultWriter writes queued results every -write-interval, or as
+// soon as -write-batch are waiting (or each as it comes, with a zero
+// interval), until ctx is done. Then it writes what is left and closes the
+// returned channel. A batch that fails to write is kept and retried.
+func startResultWriter(ctx context.Context, cfg *Config) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var tick <-chan time.Time
+		if cfg.WriteInterval > 0 {
+			ticker := time.NewTicker(cfg.WriteInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		var retry <-chan time.Time
+		for {
+			// While retrying, wait for the retry rather than writing each
+			// time another result comes in.
+			due := resultQueue.due
+			if retry != nil {
+				due = nil
+			}
+			select {
+			case <-ctx.Done():
+				if n, err := writeQueuedResults(); err != nil {
+					slog.Error("Failed to write check results on shutdown; they are lost", "rows", n, "error", err)
+				}
+				return
+			case <-tick:
+			case <-due:
+			case <-retry:
+			}
+			retry = nil
+			if n, err := writeQueuedResults(); err != nil {
+				slog.Error("Failed to write check results; retrying", "rows", n, "retry_in", writeRetryDelay, "error", err)
+				retry = time.After(writeRetryDelay)
+			}
+		}
+	}()
+	return done
+}
+
+// saveResult queues a result to be written, and adds it to the in-memory
+// summaries straight away. With -no-db it is only added to the summaries.
+func saveResult(cfg *Config, r checker.Result) {
+	noteRecentCheck(r)
+	if cfg.NoDB {
+		wake(resultsWritten)
+		return
+	}
+	resultQueue.mu.Lock()
+	resultQueue.pending = append(resultQueue.pending, r)
+	n := len(resultQueue.pending)
+	resultQueue.mu.Unlock()
+
+	if cfg.WriteInterval <= 0 || n >= cfg.WriteBatchSize {
+		wake(resultQueue.due)
+	}
+}
+
+// writeQueuedResults writes the queued results in one transaction. If that
+// fails, they go back on the queue to be retried, and it returns how many
+// there were.
+func writeQueuedResults() (int, error) {
+	resultQueue.mu.Lock()
+	batch := resultQueue.pending
+	resultQueue.pending = nil
+	resultQueue.mu.Unlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	if err := insertResults(batch); err != nil {
+		resultQueue.mu.Lock()
+		resultQueue.pending = append(batch, resultQueue.pending...)
+		if drop := len(resultQueue.pending) - maxQueuedResults; drop > 0 {
+			slog.Warn("Dropping the oldest unwritten check results", "rows", drop)
+			resultQueue.pending = resultQueue.pending[drop:]
+		}
+		resultQueue.mu.Unlock()
+		return len(batch), err
+	}
+	noteChecksChanged()
+	wake(resultsWritten)
+	return len(batch), nil
+}
+
+func insertResults(batch []checker.Result) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO checks (timestamp, target, status, latency_ms, maintenance, family, probe, dns_ms, connect_ms, tls_ms, ttfb_ms, attempts, failure, protocol) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range batch {
+		// Agents predating confirmations don't send attempts.
+		if _, err := stmt.Exec(r.Timestamp, r.Target, r.Status, r.LatencyMs, r.Maintenance, r.Family, r.Probe, r.DNSMs, r.ConnectMs, r.TLSMs, r.TTFBMs, max(r.Attempts, 1), r.Failure, r.Protocol); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,140 @@
+package up
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"up/checker"
+	"up/store"
+)
+
+// useTestDB opens a new database as db for the test, with the result queue
+// empty.
+func useTestDB(t *testing.T) {
+	d, err := store.Open(filepath.Join(t.TempDir(), "up.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = d
+	t.Cleanup(func() {
+		d.Close()
+		db = old
+		resultQueue.mu.Lock()
+		resultQueue.pending = nil
+		resultQueue.mu.Unlock()
+	})
+}
+
+// breakChecksTable makes inserting checks fail until the returned function
+// is called.
+func breakChecksTable(t *testing.T) (fix func()) {
+	t.Helper()
+	if _, err := db.Exec(`ALTER TABLE checks RENAME TO checks_away`); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if _, err := db.Exec(`ALTER TABLE checks_away RENAME TO checks`); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countChecks(t *testing.T) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM checks`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func queuedResults() []checker.Result {
+	resultQueue.mu.Lock()
+	defer resultQueue.mu.Unlock()
+	return resultQueue.pending
+}
+
+func testResult(i int) checker.Result {
+	return checker.Result{Timestamp: time.Unix(int64(i), 0), Target: "a", Status: "up", LatencyMs: int64(i)}
+}
+
+func TestWriteQueuedResultsRetries(t *testing.T) {
+	useTestDB(t)
+	cfg := &Config{WriteInterval: time.Hour, WriteBatchSize: 100}
+	for i := range 3 {
+		saveResult(cfg, testResult(i))
+	}
+
+	fix := breakChecksTable(t)
+	if n, err := writeQueuedResults(); err == nil || n != 3 {
+		t.Fatalf("writeQueuedResults = %d, %v; want 3 and an error", n, err)
+	}
+	saveResult(cfg, testResult(3))
+	queued := queuedResults()
+	if len(queued) != 4 || queued[0].LatencyMs != 0 || queued[3].LatencyMs != 3 {
+		t.Fatalf("queued %d results after a failed write, want the 3 kept ahead of the new one", len(queued))
+	}
+
+	fix()
+	if n, err := writeQueuedResults(); err != nil || n != 4 {
+		t.Fatalf("retry: writeQueuedResults = %d, %v; want 4", n, err)
+	}
+	if n := countChecks(t); n != 4 {
+		t.Errorf("%d checks written, want 4", n)
+	}
+	if queued := queuedResults(); len(queued) != 0 {
+		t.Errorf("%d results still queued", len(queued))
+	}
+}
+
+func TestWriteQueuedResultsDropsOldest(t *testing.T) {
+	useTestDB(t)
+	const extra = 10
+	pending := make([]checker.Result, maxQueuedResults+extra)
+	for i := range pending {
+		pending[i] = testResult(i)
+	}
+	resultQueue.mu.Lock()
+	resultQueue.pending = pending
+	resultQueue.mu.Unlock()
+
+	defer breakChecksTable(t)()
+	if _, err := writeQueuedResults(); err == nil {
+		t.Fatal("writeQueuedResults succeeded without a checks table")
+	}
+	queued := queuedResults()
+	if len(queued) != maxQueuedResults {
+		t.Fatalf("%d results queued, want the cap of %d", len(queued), maxQueuedResults)
+	}
+	if first, last := queued[0].LatencyMs, queued[len(queued)-1].LatencyMs; first != extra || last != maxQueuedResults+extra-1 {
+		t.Errorf("kept results %d to %d, want the newest, %d to %d", first, last, extra, maxQueuedResults+extra-1)
+	}
+}
+
+func TestResultWriterFlushesOnShutdown(t *testing.T) {
+	useTestDB(t)
+	// Neither the interval nor the batch size comes due, so only the
+	// shutdown writes them.
+	cfg := &Config{WriteInterval: time.Hour, WriteBatchSize: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startResultWriter(ctx, cfg)
+	for i := range 5 {
+		saveResult(cfg, testResult(i))
+	}
+	if n := countChecks(t); n != 0 {
+		t.Fatalf("%d checks written before they were due", n)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the writer didn't stop")
+	}
+	if n := countChecks(t); n != 5 {
+		t.Errorf("%d checks written on shutdown, want 5", n)
+	}
+}
@@ -0,0 +1,107 @@
+package up
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"up/checker"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsFilter restricts which target-scoped events a connection receives. An
+// empty filter passes everything.
+type wsFilter struct {
+	mu      sync.RWMutex
+	targets map[string]bool
+}
+
+func (f *wsFilter) set(targets []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.targets = make(map[string]bool, len(targets))
+	for _, t := range targets {
+		f.targets[t] = true
+	}
+}
+
+func (f *wsFilter) allows(e event) bool {
+	target := eventTarget(e)
+	if target == "" {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.targets) == 0 || f.targets[target]
+}
+
+// eventTarget returns the target an event refers to, or "" for events that
+// are not target-scoped (e.g. speed tests).
+func eventTarget(e event) string {
+	switch d := e.Data.(type) {
+	case checker.Result:
+		return d.Target
+	case stateChange:
+		return d.Target
+	}
+	return ""
+}
+
+// wsHandler streams events over a WebSocket. Clients may narrow the stream
+// with ?target= query parameters or by sending {"targets": [...]}.
+func (s *server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Debug("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	filter := &wsFilter{}
+	filter.set(r.URL.Query()["target"])
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg struct {
+				Targets []string `json:"targets"`
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			filter.set(msg.Targets)
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		case e := <-ch:
+			if !filter.allows(e) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		}
+	}
+}